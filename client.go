@@ -2,255 +2,413 @@ package labcon
 
 import (
 	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"time"
 
+	"github.com/ktnyt/labcon/codec"
 	"github.com/ktnyt/labcon/driver"
-	"github.com/ktnyt/labcon/utils"
 )
 
 type Client struct {
 	Addr string
-}
 
-func NewClient(addr string) *Client {
-	return &Client{Addr: addr}
+	httpClient *http.Client
+	header     http.Header
+	retry      RetryPolicy
+	onDrain    func()
+	codec      codec.Codec
 }
 
-func (client *Client) List() ([]string, error) {
-	url := fmt.Sprintf("%s/driver", client.Addr)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+// ClientOption configures a Client.
+type ClientOption func(client *Client)
+
+// WithHTTPClient sets the HTTP client used to send requests. Options that
+// modify the HTTP client, such as WithTimeout and WithTLSConfig, apply to a
+// copy of it and must therefore be given after this option.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(client *Client) {
+		client.httpClient = httpClient
 	}
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+// WithTimeout sets the time limit for each request made by the client,
+// including reading the response body.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		httpClient := client.cloneHTTPClient()
+		httpClient.Timeout = timeout
+		client.httpClient = httpClient
 	}
+}
 
-	buf := bytes.Buffer{}
-	io.Copy(&buf, res.Body)
+// WithTLSConfig sets the TLS configuration used to connect to the server,
+// e.g. to trust a private CA or to present a client certificate. It applies to
+// a copy of the transport of the HTTP client. A transport that is not an
+// *http.Transport, such as one wrapping another, cannot be configured and is
+// replaced by a copy of http.DefaultTransport, so set the TLS configuration of
+// the wrapped transport instead of using this option.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(client *Client) {
+		httpClient := client.cloneHTTPClient()
+		transport, ok := httpClient.Transport.(*http.Transport)
+		if !ok {
+			transport = http.DefaultTransport.(*http.Transport)
+		}
+		transport = transport.Clone()
+		transport.TLSClientConfig = config
+		httpClient.Transport = transport
+		client.httpClient = httpClient
+	}
+}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(buf.String())
+// WithHeader adds a header sent with every request.
+func WithHeader(key, value string) ClientOption {
+	return func(client *Client) {
+		client.header.Add(key, value)
 	}
+}
 
-	var names []string
-	err = json.Unmarshal(buf.Bytes(), &names)
-	return names, err
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(client *Client) {
+		client.header.Set("User-Agent", userAgent)
+	}
 }
 
-func (client *Client) Register(name string, state interface{}) (string, error) {
-	params := driver.RegisterParams{
-		Name:  name,
-		State: state,
+// WithAPIKey authenticates every request with the given API key.
+func WithAPIKey(key string) ClientOption {
+	return func(client *Client) {
+		client.header.Set("Authorization", "Bearer "+key)
 	}
+}
 
-	body, err := utils.JsonMarshalToBuffer(params)
-	if err != nil {
-		return "", fmt.Errorf("failed to register driver %q: %v", name, err)
+// WithDrainHandler sets a function called whenever a response indicates that
+// the server is shutting down, e.g. to stop a driver before it is cut off.
+func WithDrainHandler(f func()) ClientOption {
+	return func(client *Client) {
+		client.onDrain = f
 	}
+}
 
-	url := fmt.Sprintf("%s/driver", client.Addr)
-	req, err := http.NewRequest(http.MethodPost, url, body)
-	if err != nil {
-		return "", fmt.Errorf("failed to register driver %q: %v", name, err)
+// WithCodec sets the encoding of request bodies and asks the server to respond
+// in the same encoding, e.g. codec.Msgpack for compact bodies. Requests are
+// encoded as JSON by default.
+func WithCodec(c codec.Codec) ClientOption {
+	return func(client *Client) {
+		client.codec = c
 	}
-	req.Header.Add("Content-Type", "application/json")
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to register driver %q: %v", name, err)
+func NewClient(addr string, opts ...ClientOption) *Client {
+	client := &Client{Addr: addr, header: http.Header{}, codec: codec.JSON}
+	for _, opt := range opts {
+		opt(client)
 	}
+	return client
+}
 
-	buf := bytes.Buffer{}
-	io.Copy(&buf, res.Body)
+func (client *Client) cloneHTTPClient() *http.Client {
+	if client.httpClient == nil {
+		return &http.Client{}
+	}
+	httpClient := *client.httpClient
+	return &httpClient
+}
 
-	if res.StatusCode != http.StatusOK {
-		return "", errors.New(buf.String())
+func (client *Client) do(req *http.Request) (*http.Response, error) {
+	if client.httpClient == nil {
+		return http.DefaultClient.Do(req)
 	}
+	return client.httpClient.Do(req)
+}
 
-	var token string
-	err = json.Unmarshal(buf.Bytes(), &token)
-	return token, err
+// call sends a request to the server and decodes the response body into out
+// if it is not nil. The body of POST and PUT requests is encoded from in with
+// the codec of the client.
+// Failed requests are retried according to the retry policy of the client.
+func (client *Client) call(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var body []byte
+	if method == http.MethodPost || method == http.MethodPut {
+		var err error
+		if body, err = client.codec.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := client.send(ctx, method, path, token, body, out)
+		if err == nil || attempt >= client.retry.MaxAttempts || !client.retry.allows(method) || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if err := sleep(ctx, client.retry.Backoff(attempt)); err != nil {
+			return err
+		}
+	}
 }
 
-func (client *Client) GetState(name string, state interface{}) error {
-	url := fmt.Sprintf("%s/driver/%s/state", client.Addr, name)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to get state for driver %q: %v", name, err)
+func (client *Client) send(ctx context.Context, method, path, token string, body []byte, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, method, client.Addr+path, r)
 	if err != nil {
-		return fmt.Errorf("failed to get state for driver %q: %v", name, err)
+		return err
 	}
-
-	buf := bytes.Buffer{}
-	io.Copy(&buf, res.Body)
-
-	if res.StatusCode != http.StatusOK {
-		return errors.New(buf.String())
+	for key, values := range client.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", client.codec.ContentType())
+	}
+	req.Header.Set("Accept", client.codec.ContentType())
+	if token != "" {
+		req.Header.Set("X-Driver-Token", token)
 	}
 
-	return json.Unmarshal(buf.Bytes(), state)
-}
-
-func (client *Client) SetState(name, token string, state interface{}) error {
-	body, err := utils.JsonMarshalToBuffer(state)
+	res, err := client.do(req)
 	if err != nil {
-		return fmt.Errorf("failed to register driver %q: %v", name, err)
+		return err
 	}
+	defer res.Body.Close()
 
-	url := fmt.Sprintf("%s/driver/%s/state", client.Addr, name)
-	req, err := http.NewRequest(http.MethodPut, url, body)
-	if err != nil {
-		return fmt.Errorf("failed to set state for driver %q: %v", name, err)
+	if client.onDrain != nil && res.Header.Get("X-Labcon-Draining") != "" {
+		client.onDrain()
 	}
-	req.Header.Add("X-Driver-Token", token)
-	req.Header.Add("Content-Type", "application/json")
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to set state for driver %q: %v", name, err)
+	buf := bytes.Buffer{}
+	if _, err := io.Copy(&buf, res.Body); err != nil {
+		return err
+	}
+
+	// Decode by the content type of the response rather than the codec of
+	// the client, as a server may not support the codec.
+	c, ok := codec.Lookup(res.Header.Get("Content-Type"))
+	if !ok {
+		c = codec.JSON
 	}
 
 	if res.StatusCode != http.StatusOK {
-		buf := bytes.Buffer{}
-		io.Copy(&buf, res.Body)
-		return errors.New(buf.String())
+		return newStatusError(res.StatusCode, c, buf.Bytes())
 	}
 
+	if out != nil {
+		return c.Unmarshal(buf.Bytes(), out)
+	}
 	return nil
 }
 
-func (client *Client) GetStatus(name string) (driver.Status, error) {
-	url := fmt.Sprintf("%s/driver/%s/status", client.Addr, name)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return driver.Error, fmt.Errorf("failed to get status for driver %q: %v", name, err)
-	}
+func (client *Client) List() ([]string, error) {
+	return client.ListCtx(context.Background())
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return driver.Error, fmt.Errorf("failed to get status for driver %q: %v", name, err)
+func (client *Client) ListCtx(ctx context.Context) ([]string, error) {
+	var names []string
+	if err := client.call(ctx, http.MethodGet, "/driver", "", nil, &names); err != nil {
+		return nil, wrapError(err, "failed to list drivers")
 	}
+	return names, nil
+}
 
-	buf := bytes.Buffer{}
-	io.Copy(&buf, res.Body)
+// Summaries returns summaries of the drivers selected by their labels, e.g.
+// with "room=302,kind!=pipettor", or of every driver if the selector is empty.
+func (client *Client) Summaries(selector string) ([]driver.Summary, error) {
+	return client.SummariesCtx(context.Background(), selector)
+}
 
-	if res.StatusCode != http.StatusOK {
-		return driver.Error, errors.New(buf.String())
+func (client *Client) SummariesCtx(ctx context.Context, selector string) ([]driver.Summary, error) {
+	query := url.Values{"summary": {"true"}}
+	if selector != "" {
+		query.Set("selector", selector)
 	}
+	var summaries []driver.Summary
+	if err := client.call(ctx, http.MethodGet, "/driver?"+query.Encode(), "", nil, &summaries); err != nil {
+		return nil, wrapError(err, "failed to list drivers")
+	}
+	return summaries, nil
+}
 
-	status := driver.Error
-	err = json.Unmarshal(buf.Bytes(), &status)
-	return status, err
+func (client *Client) Register(name string, state interface{}) (string, error) {
+	return client.RegisterCtx(context.Background(), name, state)
 }
 
-func (client *Client) SetStatus(name, token string, status driver.Status) error {
-	body, err := utils.JsonMarshalToBuffer(status)
-	if err != nil {
-		return err
-	}
+func (client *Client) RegisterCtx(ctx context.Context, name string, state interface{}) (string, error) {
+	return client.RegisterWithInfoCtx(ctx, name, state, driver.Info{})
+}
 
-	url := fmt.Sprintf("%s/driver/%s/status", client.Addr, name)
-	req, err := http.NewRequest(http.MethodPut, url, body)
-	if err != nil {
-		return err
+// RegisterWithInfo registers a driver that describes itself with labels and
+// metadata.
+func (client *Client) RegisterWithInfo(name string, state interface{}, info driver.Info) (string, error) {
+	return client.RegisterWithInfoCtx(context.Background(), name, state, info)
+}
+
+func (client *Client) RegisterWithInfoCtx(ctx context.Context, name string, state interface{}, info driver.Info) (string, error) {
+	params := driver.RegisterParams{
+		Name:  name,
+		State: state,
+		Info:  info,
 	}
-	req.Header.Add("X-Driver-Token", token)
-	req.Header.Add("Content-Type", "application/json")
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to set status for driver %q: %v", name, err)
+	var token string
+	if err := client.call(ctx, http.MethodPost, "/driver", "", params, &token); err != nil {
+		return "", wrapError(err, "failed to register driver %q", name)
 	}
+	return token, nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		buf := bytes.Buffer{}
-		io.Copy(&buf, res.Body)
-		return errors.New(buf.String())
+func (client *Client) GetState(name string, state interface{}) error {
+	return client.GetStateCtx(context.Background(), name, state)
+}
+
+func (client *Client) GetStateCtx(ctx context.Context, name string, state interface{}) error {
+	path := fmt.Sprintf("/driver/%s/state", name)
+	if err := client.call(ctx, http.MethodGet, path, "", nil, state); err != nil {
+		return wrapError(err, "failed to get state for driver %q", name)
 	}
+	return nil
+}
+
+// WaitState waits until the condition holds for the state of the driver and
+// decodes that state into state. Conditions are written like the conditions
+// of workflow wait steps, e.g. "abs($.temperature - 37) <= 0.5". The error
+// matches ErrTimeout if the condition does not hold within timeout, unless it
+// is zero. The wait is exempt from the request timeout of the server, so it
+// may last longer than that, but a timeout set with WithTimeout cuts it short.
+func (client *Client) WaitState(name, until string, timeout time.Duration, state interface{}) error {
+	return client.WaitStateCtx(context.Background(), name, until, timeout, state)
+}
 
+func (client *Client) WaitStateCtx(ctx context.Context, name, until string, timeout time.Duration, state interface{}) error {
+	query := url.Values{"until": {until}}
+	if timeout > 0 {
+		query.Set("timeout", timeout.String())
+	}
+	path := fmt.Sprintf("/driver/%s/state/wait?%s", name, query.Encode())
+	if err := client.call(ctx, http.MethodGet, path, "", nil, state); err != nil {
+		return wrapError(err, "failed to wait for state of driver %q", name)
+	}
 	return nil
 }
 
-func (client *Client) Operation(name, token string) (*driver.Op, error) {
-	url := fmt.Sprintf("%s/driver/%s/operation", client.Addr, name)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get operation for driver %q: %v", name, err)
+func (client *Client) SetState(name, token string, state interface{}) error {
+	return client.SetStateCtx(context.Background(), name, token, state)
+}
+
+func (client *Client) SetStateCtx(ctx context.Context, name, token string, state interface{}) error {
+	path := fmt.Sprintf("/driver/%s/state", name)
+	if err := client.call(ctx, http.MethodPut, path, token, state, nil); err != nil {
+		return wrapError(err, "failed to set state for driver %q", name)
 	}
-	req.Header.Add("X-Driver-Token", token)
+	return nil
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get operation for driver %q: %v", name, err)
+func (client *Client) GetStatus(name string) (driver.Status, error) {
+	return client.GetStatusCtx(context.Background(), name)
+}
+
+func (client *Client) GetStatusCtx(ctx context.Context, name string) (driver.Status, error) {
+	path := fmt.Sprintf("/driver/%s/status", name)
+	status := driver.Error
+	if err := client.call(ctx, http.MethodGet, path, "", nil, &status); err != nil {
+		return driver.Error, wrapError(err, "failed to get status for driver %q", name)
 	}
+	return status, nil
+}
 
-	buf := bytes.Buffer{}
-	io.Copy(&buf, res.Body)
+func (client *Client) SetStatus(name, token string, status driver.Status) error {
+	return client.SetStatusCtx(context.Background(), name, token, status)
+}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(buf.String())
+func (client *Client) SetStatusCtx(ctx context.Context, name, token string, status driver.Status) error {
+	path := fmt.Sprintf("/driver/%s/status", name)
+	if err := client.call(ctx, http.MethodPut, path, token, status, nil); err != nil {
+		return wrapError(err, "failed to set status for driver %q", name)
 	}
+	return nil
+}
 
+func (client *Client) Operation(name, token string) (*driver.Op, error) {
+	return client.OperationCtx(context.Background(), name, token)
+}
+
+func (client *Client) OperationCtx(ctx context.Context, name, token string) (*driver.Op, error) {
+	path := fmt.Sprintf("/driver/%s/operation", name)
 	op := new(driver.Op)
-	err = json.Unmarshal(buf.Bytes(), &op)
-	return op, err
+	if err := client.call(ctx, http.MethodGet, path, token, nil, &op); err != nil {
+		return nil, wrapError(err, "failed to get operation for driver %q", name)
+	}
+	return op, nil
 }
 
 func (client *Client) Dispatch(name string, op driver.Op) error {
-	body, err := utils.JsonMarshalToBuffer(op)
-	if err != nil {
-		return fmt.Errorf("failed to dispatch to driver %q: %v", name, body)
-	}
+	return client.DispatchCtx(context.Background(), name, op)
+}
 
-	url := fmt.Sprintf("%s/driver/%s/operation", client.Addr, name)
-	req, err := http.NewRequest(http.MethodPost, url, body)
-	if err != nil {
-		return fmt.Errorf("failed to dispatch to driver %q: %v", name, body)
+func (client *Client) DispatchCtx(ctx context.Context, name string, op driver.Op) error {
+	path := fmt.Sprintf("/driver/%s/operation", name)
+	if err := client.call(ctx, http.MethodPost, path, "", op, nil); err != nil {
+		return wrapError(err, "failed to dispatch to driver %q", name)
 	}
-	req.Header.Add("Content-Type", "application/json")
+	return nil
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to dispatch to driver %q: %v", name, body)
-	}
+// Cancel withdraws the operation dispatched to the driver that it has not
+// completed yet. ErrNotFound is returned if there is no such operation.
+func (client *Client) Cancel(name string) error {
+	return client.CancelCtx(context.Background(), name)
+}
 
-	if res.StatusCode != http.StatusOK {
-		buf := bytes.Buffer{}
-		io.Copy(&buf, res.Body)
-		return errors.New(buf.String())
+func (client *Client) CancelCtx(ctx context.Context, name string) error {
+	path := fmt.Sprintf("/driver/%s/operation", name)
+	if err := client.call(ctx, http.MethodDelete, path, "", nil, nil); err != nil {
+		return wrapError(err, "failed to cancel operation of driver %q", name)
 	}
-
 	return nil
 }
 
-func (client *Client) Disconnect(name, token string) error {
-	url := fmt.Sprintf("%s/driver/%s", client.Addr, name)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Add("X-Driver-Token", token)
+func (client *Client) GetInfo(name string) (driver.Info, error) {
+	return client.GetInfoCtx(context.Background(), name)
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+func (client *Client) GetInfoCtx(ctx context.Context, name string) (driver.Info, error) {
+	var info driver.Info
+	path := fmt.Sprintf("/driver/%s/info", name)
+	if err := client.call(ctx, http.MethodGet, path, "", nil, &info); err != nil {
+		return info, wrapError(err, "failed to get info for driver %q", name)
 	}
+	return info, nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		buf := bytes.Buffer{}
-		io.Copy(&buf, res.Body)
-		return errors.New(buf.String())
+// SetInfo replaces the labels and metadata of the driver. The client must be
+// authenticated with an admin API key if the server requires API keys.
+func (client *Client) SetInfo(name string, info driver.Info) error {
+	return client.SetInfoCtx(context.Background(), name, info)
+}
+
+func (client *Client) SetInfoCtx(ctx context.Context, name string, info driver.Info) error {
+	path := fmt.Sprintf("/driver/%s/info", name)
+	if err := client.call(ctx, http.MethodPut, path, "", info, nil); err != nil {
+		return wrapError(err, "failed to set info for driver %q", name)
 	}
+	return nil
+}
 
+func (client *Client) Disconnect(name, token string) error {
+	return client.DisconnectCtx(context.Background(), name, token)
+}
+
+func (client *Client) DisconnectCtx(ctx context.Context, name, token string) error {
+	path := fmt.Sprintf("/driver/%s", name)
+	if err := client.call(ctx, http.MethodDelete, path, token, nil, nil); err != nil {
+		return wrapError(err, "failed to disconnect driver %q", name)
+	}
 	return nil
 }
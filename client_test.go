@@ -1,16 +1,24 @@
 package labcon
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/ktnyt/labcon/cmd/labcon/app"
 	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/codec"
 	"github.com/ktnyt/labcon/driver"
 	"github.com/ktnyt/labcon/utils"
 	"github.com/rs/zerolog"
@@ -161,3 +169,742 @@ func TestClient(t *testing.T) {
 		t.Fatal(utils.JoinOps(ops, "\n"))
 	}
 }
+
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	r := chi.NewMux()
+
+	b := &strings.Builder{}
+	logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+	logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r.Use(
+		middleware.RequestID,
+		lib.Logger(logger),
+		lib.Negotiate,
+		lib.Badger(db),
+		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	return r
+}
+
+func TestClientCodec(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	type state struct {
+		Volume float64 `json:"volume"`
+		Tip    bool    `json:"tip"`
+	}
+
+	for i, c := range []codec.Codec{codec.JSON, codec.Msgpack, codec.YAML} {
+		lib.RunCase(t, c.ContentType(), func(t *testing.T) {
+			client := NewClient(server.URL, WithCodec(c))
+			name := fmt.Sprintf("foo%d", i)
+
+			token, err := client.Register(name, state{Volume: 1.5, Tip: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got state
+			if err := client.GetState(name, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != (state{Volume: 1.5, Tip: true}) {
+				t.Errorf("client.GetState(%q, &state) = %+v, want %+v", name, got, state{Volume: 1.5, Tip: true})
+			}
+
+			op := driver.Op{Name: "aspirate", Arg: map[string]interface{}{"volume": 10}}
+			if err := client.Dispatch(name, op); err != nil {
+				t.Fatal(err)
+			}
+
+			next, err := client.Operation(name, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next == nil || next.Name != "aspirate" {
+				t.Fatalf("client.Operation(%q, token) = %+v, want %+v", name, next, op)
+			}
+			var arg struct {
+				Volume int `json:"volume"`
+			}
+			if err := (Arg{value: next.Arg}).Decode(&arg); err != nil || arg.Volume != 10 {
+				t.Errorf("operation argument = %#v, want %#v", next.Arg, op.Arg)
+			}
+
+			if err := client.Dispatch(name, op); !errors.Is(err, ErrBusy) {
+				t.Errorf("client.Dispatch(%q, op) = %v, want %v", name, err, ErrBusy)
+			}
+
+			if err := client.SetStatus(name, token, driver.Idle); err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := client.GetStatus(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != driver.Idle {
+				t.Errorf("client.GetStatus(%q) = %q, want %q", name, status, driver.Idle)
+			}
+		})
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(newTestHandler(t))
+	defer server.Close()
+
+	if _, err := NewClient(server.URL).List(); err == nil {
+		t.Fatal("client without the server certificate connected to the TLS server")
+	}
+
+	transport := server.Client().Transport.(*http.Transport)
+	client := NewClient(server.URL, WithTLSConfig(transport.TLSClientConfig))
+
+	if _, err := client.Register("foo", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := client.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := utils.ObjDiff(names, []string{"foo"}); ops != nil {
+		t.Fatal(utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestClientTLSTransport(t *testing.T) {
+	config := &tls.Config{ServerName: "labcon"}
+
+	// The transport of the HTTP client is configured on a copy.
+	transport := &http.Transport{MaxIdleConnsPerHost: 7}
+	client := NewClient("https://localhost", WithHTTPClient(&http.Client{Transport: transport}), WithTLSConfig(config))
+	got, ok := client.httpClient.Transport.(*http.Transport)
+	if !ok || got == transport || got.MaxIdleConnsPerHost != 7 || got.TLSClientConfig != config {
+		t.Errorf("client transport = %#v, want a copy of the given transport with the TLS configuration", client.httpClient.Transport)
+	}
+	if transport.TLSClientConfig == config {
+		t.Error("given transport was configured, want it left as is")
+	}
+
+	// Other transports are replaced.
+	wrapped := roundTripperFunc(http.DefaultTransport.RoundTrip)
+	client = NewClient("https://localhost", WithHTTPClient(&http.Client{Transport: wrapped}), WithTLSConfig(config))
+	if got, ok := client.httpClient.Transport.(*http.Transport); !ok || got == http.DefaultTransport || got.TLSClientConfig != config {
+		t.Errorf("client transport = %#v, want a copy of the default transport with the TLS configuration", client.httpClient.Transport)
+	}
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	ca := lib.NewTestCertificateAuthority(t)
+
+	server := httptest.NewUnstartedServer(newTestHandler(t))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.Issue(t, "localhost")},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := NewClient(server.URL, WithTLSConfig(&tls.Config{
+		RootCAs:      ca.Pool(),
+		Certificates: []tls.Certificate{ca.Issue(t, "foo")},
+	}))
+
+	if _, err := client.Register("foo", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Register("bar", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate authenticates the driver without a token.
+	if err := client.SetState("foo", "", "baz"); err != nil {
+		t.Fatal(err)
+	}
+
+	var state string
+	if err := client.GetState("foo", &state); err != nil {
+		t.Fatal(err)
+	}
+
+	if state != "baz" {
+		t.Fatalf("client state = %q, want \"baz\"", state)
+	}
+
+	// The certificate does not authenticate other drivers.
+	if err := client.SetState("bar", "", "baz"); err == nil {
+		t.Fatal("driver \"bar\" was authenticated by the certificate for \"foo\"")
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientOptions(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	var header http.Header
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header.Clone()
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	client := NewClient(
+		server.URL,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithTimeout(time.Second),
+		WithHeader("X-Foo", "foo"),
+		WithUserAgent("labcon-test"),
+	)
+
+	if _, err := client.List(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := header.Get("X-Foo"); got != "foo" {
+		t.Errorf("X-Foo header = %q, want \"foo\"", got)
+	}
+
+	if got := header.Get("User-Agent"); got != "labcon-test" {
+		t.Errorf("User-Agent header = %q, want \"labcon-test\"", got)
+	}
+}
+
+func TestClientAPIKey(t *testing.T) {
+	keys := []lib.APIKey{{Name: "alice", Key: "secret", Role: lib.RoleUser}}
+	server := httptest.NewServer(lib.APIKeys(keys, true)(newTestHandler(t)))
+	defer server.Close()
+
+	cases := []struct {
+		opts []ClientOption
+		err  error
+	}{
+		{
+			opts: []ClientOption{WithAPIKey("secret")},
+			err:  nil,
+		},
+		{
+			opts: []ClientOption{WithAPIKey("guess")},
+			err:  ErrUnauthorized,
+		},
+		{
+			opts: nil,
+			err:  ErrUnauthorized,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if _, err := NewClient(server.URL, tt.opts...).List(); !errors.Is(err, tt.err) {
+				t.Errorf("client.List() = (_, %v), want (_, %v)", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClientDrain(t *testing.T) {
+	drainer := lib.NewDrainer()
+	server := httptest.NewServer(lib.Drain(drainer)(newTestHandler(t)))
+	defer server.Close()
+
+	drains := 0
+	client := NewClient(server.URL, WithDrainHandler(func() { drains++ }))
+
+	d, err := NewDriver(client, "foo", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drains != 0 {
+		t.Fatalf("drain handler called %d times before draining", drains)
+	}
+
+	drainer.Drain()
+
+	if _, err := client.Register("bar", "bar"); !errors.Is(err, ErrDraining) {
+		t.Errorf("client.Register(\"bar\", \"bar\") = (_, %v), want (_, %v)", err, ErrDraining)
+	}
+	if err := client.Dispatch("foo", driver.Op{Name: "foo"}); !errors.Is(err, ErrDraining) {
+		t.Errorf("client.Dispatch(\"foo\", op) = %v, want %v", err, ErrDraining)
+	}
+	if err := d.SetState("bar"); err != nil {
+		t.Errorf("driver.SetState(\"bar\") = %v while draining", err)
+	}
+	if drains != 3 {
+		t.Errorf("drain handler called %d times, want 3", drains)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	keys := []lib.APIKey{
+		{Name: "facility", Key: "facility-key", Role: lib.RoleAdmin},
+		{Name: "alice", Key: "alice-key", Role: lib.RoleUser},
+		{Name: "bob", Key: "bob-key", Role: lib.RoleUser},
+	}
+	server := httptest.NewServer(lib.APIKeys(keys, false)(newTestHandler(t)))
+	defer server.Close()
+
+	admin := NewClient(server.URL, WithAPIKey("facility-key"))
+	alice := NewClient(server.URL, WithAPIKey("alice-key"))
+	bob := NewClient(server.URL, WithAPIKey("bob-key"))
+	anonymous := NewClient(server.URL)
+
+	if _, err := admin.Register("foo", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.Dispatch("foo", driver.Op{Name: "aspirate"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Cancel("foo"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("bob.Cancel(\"foo\") = %v, want %v", err, ErrForbidden)
+	}
+	if err := alice.Cancel("foo"); err != nil {
+		t.Errorf("alice.Cancel(\"foo\") = %v, want nil", err)
+	}
+	if err := alice.Cancel("foo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("alice.Cancel(\"foo\") = %v, want %v", err, ErrNotFound)
+	}
+
+	if err := bob.Dispatch("foo", driver.Op{Name: "dispense"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.Cancel("foo"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("anonymous.Cancel(\"foo\") = %v, want %v", err, ErrForbidden)
+	}
+	if err := admin.Cancel("foo"); err != nil {
+		t.Errorf("admin.Cancel(\"foo\") = %v, want nil", err)
+	}
+
+	// Operations dispatched without an API key are canceled without one.
+	if err := anonymous.Dispatch("foo", driver.Op{Name: "mix"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.Cancel("foo"); err != nil {
+		t.Errorf("anonymous.Cancel(\"foo\") = %v, want nil", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := NewClient(server.URL, WithTimeout(10*time.Millisecond))
+	if _, err := client.List(); err == nil {
+		t.Fatal("client.List() returned without error after timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewClient(server.URL).ListCtx(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("client.ListCtx(ctx) = (_, %v), want (_, %v)", err, context.Canceled)
+	}
+}
+
+func TestClientWaitState(t *testing.T) {
+	const requestTimeout = 20 * time.Millisecond
+
+	r := chi.NewMux()
+
+	b := &strings.Builder{}
+	logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+	logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r.Use(
+		lib.Logger(logger),
+		lib.Negotiate,
+		lib.Badger(db),
+		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+		lib.Notifications(lib.NewNotifier()),
+		lib.Timeout(requestTimeout, app.UntimedPaths...),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	type incubator struct {
+		Temperature float64 `json:"temperature"`
+	}
+
+	token, err := client.Register("foo", incubator{Temperature: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state incubator
+	if err := client.WaitState("foo", "$.temperature < 30", 0, &state); err != nil || state.Temperature != 25 {
+		t.Fatalf("client.WaitState(...) = %v with %v, want nil with 25", err, state.Temperature)
+	}
+
+	if err := client.WaitState("foo", "$.temperature >= 37", 10*time.Millisecond, &state); !errors.Is(err, ErrTimeout) {
+		t.Errorf("client.WaitState(...) = %v, want %v", err, ErrTimeout)
+	}
+
+	if err := client.WaitState("foo", "temperature >= 37", 0, &state); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("client.WaitState(...) = %v, want %v", err, ErrBadRequest)
+	}
+
+	// The wait ends as soon as the driver reaches the condition.
+	errs := make(chan error, 1)
+	go func() {
+		errs <- client.WaitState("foo", "abs($.temperature - 37) <= 0.5", time.Minute, &state)
+	}()
+	for _, temperature := range []float64{30, 36.8} {
+		time.Sleep(10 * time.Millisecond)
+		if err := client.SetState("foo", token, incubator{Temperature: temperature}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-errs; err != nil || state.Temperature != 36.8 {
+		t.Fatalf("client.WaitState(...) = %v with %v, want nil with 36.8", err, state.Temperature)
+	}
+
+	// Waits outlast the request timeout of the server.
+	go func() {
+		errs <- client.WaitState("foo", "$.temperature >= 37", 0, &state)
+	}()
+	time.Sleep(2 * requestTimeout)
+	if err := client.SetState("foo", token, incubator{Temperature: 37}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil || state.Temperature != 37 {
+		t.Fatalf("client.WaitState(...) = %v with %v, want nil with 37", err, state.Temperature)
+	}
+	if err := client.WaitState("foo", "$.temperature < 30", 2*requestTimeout, &state); !errors.Is(err, ErrTimeout) {
+		t.Errorf("client.WaitState(...) = %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestClientInfo(t *testing.T) {
+	r := chi.NewMux()
+
+	b := &strings.Builder{}
+	logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+	logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r.Use(
+		lib.Logger(logger),
+		lib.Badger(db),
+		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+		lib.APIKeys([]lib.APIKey{{Name: "facility", Key: "secret", Role: lib.RoleAdmin}}, false),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := NewClient(server.URL, WithAPIKey("secret"))
+
+	reader := driver.Info{
+		Labels:   map[string]string{"room": "302", "kind": "reader"},
+		Metadata: driver.Metadata{Location: "bench 3", Model: "Infinite 200", Owner: "alice"},
+	}
+	if _, err := client.RegisterWithInfo("reader", "idle", reader); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RegisterWithInfo("pipettor", "idle", driver.Info{Labels: map[string]string{"room": "302", "kind": "pipettor"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Register("washer", "idle"); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := client.Summaries("room=302,kind!=pipettor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []driver.Summary{{Name: "reader", Status: driver.Idle, Info: reader}}
+	if ops := utils.ObjDiff(summaries, expected); ops != nil {
+		t.Errorf("client.Summaries(\"room=302,kind!=pipettor\"):\n%s", utils.JoinOps(ops, "\n"))
+	}
+
+	if _, err := client.Summaries("room=="); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("client.Summaries(\"room==\") = (_, %v), want (_, %v)", err, ErrBadRequest)
+	}
+
+	// The washer is moved into room 302.
+	washer := driver.Info{Labels: map[string]string{"room": "302"}, Metadata: driver.Metadata{Location: "sink"}}
+	if err := client.SetInfo("washer", washer); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClient(server.URL).SetInfo("washer", driver.Info{}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("client.SetInfo(\"washer\", driver.Info{}) without an API key = %v, want %v", err, ErrUnauthorized)
+	}
+	info, err := client.GetInfo("washer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(info, washer); ops != nil {
+		t.Errorf("client.GetInfo(\"washer\"):\n%s", utils.JoinOps(ops, "\n"))
+	}
+
+	summaries, err = client.Summaries("room=302")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(summaries))
+	for i, summary := range summaries {
+		names[i] = summary.Name
+	}
+	if ops := utils.ObjDiff(names, []string{"pipettor", "reader", "washer"}); ops != nil {
+		t.Errorf("client.Summaries(\"room=302\"):\n%s", utils.JoinOps(ops, "\n"))
+	}
+
+	if err := client.SetInfo("mixer", washer); !errors.Is(err, ErrNotFound) {
+		t.Errorf("client.SetInfo(\"mixer\", info) = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	token, err := client.Register("foo", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Register("foo", "foo")
+	if !errors.Is(err, ErrConflict) || errors.Is(err, ErrBusy) {
+		t.Errorf("client.Register(\"foo\", \"foo\") = (_, %v), want (_, %v)", err, ErrConflict)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("client.Register(\"foo\", \"foo\") = (_, %T), want (_, %T)", err, statusErr)
+	}
+
+	if statusErr.StatusCode != http.StatusConflict || statusErr.Code != "already_exists" {
+		t.Errorf("status error = (%d, %q), want (%d, \"already_exists\")", statusErr.StatusCode, statusErr.Code, http.StatusConflict)
+	}
+
+	if statusErr.RequestID == "" {
+		t.Error("status error is missing the request ID")
+	}
+
+	var state string
+	if err := client.GetState("bar", &state); !errors.Is(err, ErrNotFound) {
+		t.Errorf("client.GetState(\"bar\", &state) = %v, want %v", err, ErrNotFound)
+	}
+
+	if err := client.SetState("foo", "bar", "bar"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("client.SetState(\"foo\", \"bar\", \"bar\") = %v, want %v", err, ErrForbidden)
+	}
+
+	if err := client.SetState("foo", "", "bar"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("client.SetState(\"foo\", \"\", \"bar\") = %v, want %v", err, ErrUnauthorized)
+	}
+
+	op := driver.Op{Name: "op"}
+	if err := client.Dispatch("foo", op); err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Dispatch("foo", op)
+	if !errors.Is(err, ErrBusy) || !errors.Is(err, ErrConflict) {
+		t.Errorf("client.Dispatch(\"foo\", op) = %v, want %v", err, ErrBusy)
+	}
+
+	err = client.Dispatch("foo", driver.Op{})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("client.Dispatch(\"foo\", driver.Op{}) = %v, want %v", err, ErrBadRequest)
+	}
+
+	if !errors.As(err, &statusErr) || len(statusErr.Details) != 1 || statusErr.Details[0].Field != "name" {
+		t.Errorf("client.Dispatch(\"foo\", driver.Op{}) = %#v, want details for field \"name\"", err)
+	}
+
+	// Without API keys, any operation may be canceled.
+	if err := client.Cancel("foo"); err != nil {
+		t.Errorf("client.Cancel(\"foo\") = %v, want nil", err)
+	}
+
+	if err := client.Cancel("foo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("client.Cancel(\"foo\") = %v, want %v", err, ErrNotFound)
+	}
+
+	if err := client.Disconnect("foo", token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var failures, attempts int32
+	handler := newTestHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			lib.HTTPError(w, http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Multiplier:     2,
+	}
+
+	cases := []struct {
+		failures int32
+		attempts int32
+		call     func(client *Client) error
+		err      error
+	}{
+		{
+			failures: 2,
+			attempts: 3,
+			call: func(client *Client) error {
+				_, err := client.List()
+				return err
+			},
+			err: nil,
+		},
+		{
+			failures: 3,
+			attempts: 3,
+			call: func(client *Client) error {
+				_, err := client.List()
+				return err
+			},
+			err: &StatusError{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			failures: 1,
+			attempts: 1,
+			call: func(client *Client) error {
+				return client.Dispatch("foo", driver.Op{Name: "op"})
+			},
+			err: &StatusError{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			failures: 0,
+			attempts: 1,
+			call: func(client *Client) error {
+				var state interface{}
+				return client.GetState("foo", &state)
+			},
+			err: ErrNotFound,
+		},
+	}
+
+	client := NewClient(server.URL, WithRetry(policy))
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			atomic.StoreInt32(&failures, tt.failures)
+			atomic.StoreInt32(&attempts, 0)
+
+			err := tt.call(client)
+
+			var statusErr *StatusError
+			switch want := tt.err.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("call returned %v, want nil", err)
+				}
+			case *StatusError:
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != want.StatusCode {
+					t.Errorf("call returned %v, want status %d", err, want.StatusCode)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("call returned %v, want %v", err, want)
+				}
+			}
+
+			if got := atomic.LoadInt32(&attempts); got != tt.attempts {
+				t.Errorf("call made %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	cases := []struct {
+		retry int
+		out   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if out := policy.Backoff(tt.retry); out != tt.out {
+				t.Errorf("policy.Backoff(%d) = %v, want %v", tt.retry, out, tt.out)
+			}
+
+			policy := policy
+			policy.Jitter = 0.5
+			out := policy.Backoff(tt.retry)
+			if out < tt.out/2 || out > tt.out*3/2 {
+				t.Errorf("policy.Backoff(%d) = %v, want within 50%% of %v", tt.retry, out, tt.out)
+			}
+		})
+	}
+}
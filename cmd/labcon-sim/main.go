@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ktnyt/labcon"
+	"github.com/ktnyt/labcon/cmd/labcon-sim/sim"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	w := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	logger := log.Output(w).Level(zerolog.InfoLevel)
+
+	path := flag.String("config", "labcon-sim.yaml", "path to the simulation config")
+	server := flag.String("server", "", "address of the labcon server, overriding the config")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for simulated failures")
+	flag.Parse()
+
+	config, err := sim.Load(*path)
+	if err != nil {
+		logger.Fatal().Err(err).Msgf("failed to load config %q", *path)
+	}
+
+	if *server != "" {
+		config.Server = *server
+	}
+	if config.Server == "" {
+		config.Server = "http://localhost:5000"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := labcon.NewClient(config.Server, labcon.WithRetry(labcon.DefaultRetryPolicy))
+
+	logger.Info().Str("server", config.Server).Int64("seed", *seed).Msgf("simulating %d drivers", len(config.Drivers))
+
+	if err := sim.Run(
+		ctx,
+		client,
+		config,
+		*seed,
+		labcon.WithResultHandler(func(op driver.Op, err error) {
+			if err != nil {
+				logger.Warn().Err(err).Str("op", op.Name).Msg("operation failed")
+				return
+			}
+			logger.Info().Str("op", op.Name).Msg("operation completed")
+		}),
+		labcon.WithErrorHandler(func(err error) {
+			logger.Err(err).Msg("failed to communicate with server")
+		}),
+	); err != nil {
+		logger.Fatal().Err(err).Msg("simulation failed")
+	}
+}
@@ -0,0 +1,149 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+var (
+	ErrNoDrivers        = errors.New("no drivers configured")
+	ErrMissingName      = errors.New("missing driver name")
+	ErrDuplicateName    = errors.New("duplicate driver name")
+	ErrNoOps            = errors.New("no operations configured")
+	ErrFailureRate      = errors.New("failure rate must be between 0 and 1")
+	ErrNegativeDuration = errors.New("duration must not be negative")
+	ErrUnknownField     = errors.New("unknown state field")
+)
+
+// Config describes a set of simulated drivers.
+type Config struct {
+	// Server is the address of the labcon server.
+	Server string `yaml:"server"`
+
+	// PollInterval is how often the drivers poll for operations.
+	PollInterval time.Duration `yaml:"poll_interval"`
+
+	Drivers []DriverConfig `yaml:"drivers"`
+}
+
+// DriverConfig describes a simulated driver.
+type DriverConfig struct {
+	Name string `yaml:"name"`
+
+	// State is the initial state of the driver.
+	State map[string]interface{} `yaml:"state"`
+
+	Ops map[string]OpConfig `yaml:"ops"`
+}
+
+// OpConfig describes a simulated operation.
+//
+// Values in Set may refer to the operation argument: "$arg" is replaced by
+// the whole argument and "$arg.key" by the value of key in the argument.
+type OpConfig struct {
+	// Duration is how long the operation takes.
+	Duration time.Duration `yaml:"duration"`
+
+	// Set assigns values to state fields once the operation completes.
+	Set map[string]interface{} `yaml:"set"`
+
+	// Add adds values to numeric state fields once the operation completes.
+	Add map[string]float64 `yaml:"add"`
+
+	// FailureRate is the probability of the operation failing.
+	FailureRate float64 `yaml:"failure_rate"`
+}
+
+// Load reads and validates the configuration at the given path.
+func Load(path string) (Config, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(p)
+}
+
+// Parse parses and validates a YAML configuration.
+func Parse(p []byte) (Config, error) {
+	config := Config{PollInterval: time.Second}
+	if err := yaml.UnmarshalWithOptions(p, &config, yaml.Strict()); err != nil {
+		return Config{}, err
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Validate checks the configuration for errors.
+func (config Config) Validate() error {
+	if len(config.Drivers) == 0 {
+		return ErrNoDrivers
+	}
+
+	names := make(map[string]bool)
+	for i, driver := range config.Drivers {
+		if driver.Name == "" {
+			return fmt.Errorf("driver %d: %w", i+1, ErrMissingName)
+		}
+		if names[driver.Name] {
+			return fmt.Errorf("driver %q: %w", driver.Name, ErrDuplicateName)
+		}
+		names[driver.Name] = true
+
+		if err := driver.Validate(); err != nil {
+			return fmt.Errorf("driver %q: %w", driver.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the driver configuration for errors.
+func (config DriverConfig) Validate() error {
+	if len(config.Ops) == 0 {
+		return ErrNoOps
+	}
+
+	for name, op := range config.Ops {
+		if op.Duration < 0 {
+			return fmt.Errorf("op %q: %w", name, ErrNegativeDuration)
+		}
+		if op.FailureRate < 0 || op.FailureRate > 1 {
+			return fmt.Errorf("op %q: %w", name, ErrFailureRate)
+		}
+		for field := range op.Set {
+			if _, ok := config.State[field]; !ok {
+				return fmt.Errorf("op %q: %w %q", name, ErrUnknownField, field)
+			}
+		}
+		for field := range op.Add {
+			if _, ok := config.State[field]; !ok {
+				return fmt.Errorf("op %q: %w %q", name, ErrUnknownField, field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolve replaces references to the operation argument in value.
+func resolve(value interface{}, arg interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "$arg") {
+		return value
+	}
+	if s == "$arg" {
+		return arg
+	}
+	key := strings.TrimPrefix(s, "$arg.")
+	if m, ok := arg.(map[string]interface{}); ok && key != s {
+		return m[key]
+	}
+	return value
+}
@@ -0,0 +1,167 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ktnyt/labcon"
+)
+
+var (
+	ErrSimulatedFailure = errors.New("simulated failure")
+	ErrNotNumeric       = errors.New("state field is not numeric")
+)
+
+// Simulator simulates the operations of a single driver.
+type Simulator struct {
+	config DriverConfig
+
+	mu     sync.Mutex
+	state  map[string]interface{}
+	random *rand.Rand
+}
+
+// NewSimulator creates a simulator for the given driver. Failures are drawn
+// from random, which must not be shared with other simulators.
+func NewSimulator(config DriverConfig, random *rand.Rand) *Simulator {
+	state := make(map[string]interface{}, len(config.State))
+	for key, value := range config.State {
+		state[key] = value
+	}
+	return &Simulator{
+		config: config,
+		state:  state,
+		random: random,
+	}
+}
+
+// State returns a copy of the simulated state.
+func (sim *Simulator) State() map[string]interface{} {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	state := make(map[string]interface{}, len(sim.state))
+	for key, value := range sim.state {
+		state[key] = value
+	}
+	return state
+}
+
+// Register registers a handler for each simulated operation.
+func (sim *Simulator) Register(runtime *labcon.Runtime) {
+	for name, op := range sim.config.Ops {
+		runtime.Handle(name, sim.handler(name, op))
+	}
+}
+
+func (sim *Simulator) handler(name string, op OpConfig) labcon.Handler {
+	return func(ctx context.Context, arg labcon.Arg, update labcon.StateUpdater) error {
+		timer := time.NewTimer(op.Duration)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if sim.fail(op.FailureRate) {
+			return fmt.Errorf("op %q: %w", name, ErrSimulatedFailure)
+		}
+
+		state, err := sim.apply(op, arg.Value())
+		if err != nil {
+			return fmt.Errorf("op %q: %w", name, err)
+		}
+		return update(state)
+	}
+}
+
+func (sim *Simulator) fail(rate float64) bool {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return rate > 0 && sim.random.Float64() < rate
+}
+
+func (sim *Simulator) apply(op OpConfig, arg interface{}) (map[string]interface{}, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	state := make(map[string]interface{}, len(sim.state))
+	for key, value := range sim.state {
+		state[key] = value
+	}
+
+	for field, value := range op.Set {
+		state[field] = resolve(value, arg)
+	}
+
+	for field, delta := range op.Add {
+		value, ok := toFloat(state[field])
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrNotNumeric, field)
+		}
+		state[field] = value + delta
+	}
+
+	sim.state = state
+	return state, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// Run registers the configured drivers with the server and simulates them
+// until the context is done, after which they are disconnected. The failures
+// of the i-th driver are drawn from a source seeded with seed+i.
+func Run(ctx context.Context, client *labcon.Client, config Config, seed int64, opts ...labcon.RuntimeOption) error {
+	opts = append([]labcon.RuntimeOption{labcon.WithPollInterval(config.PollInterval)}, opts...)
+
+	drivers := make([]labcon.Driver, 0, len(config.Drivers))
+	runtimes := make([]*labcon.Runtime, 0, len(config.Drivers))
+	for i, driver := range config.Drivers {
+		sim := NewSimulator(driver, rand.New(rand.NewSource(seed+int64(i))))
+		d, err := labcon.NewDriverCtx(ctx, client, driver.Name, sim.State())
+		if err != nil {
+			for _, d := range drivers {
+				d.DisconnectCtx(context.Background())
+			}
+			return err
+		}
+		runtime := labcon.NewRuntime(d, opts...)
+		sim.Register(runtime)
+		drivers = append(drivers, d)
+		runtimes = append(runtimes, runtime)
+	}
+
+	errs := make(chan error, len(runtimes))
+	for _, runtime := range runtimes {
+		go func(runtime *labcon.Runtime) {
+			errs <- runtime.Run(ctx)
+		}(runtime)
+	}
+
+	var err error
+	for range runtimes {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package sim_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon"
+	"github.com/ktnyt/labcon/cmd/labcon-sim/sim"
+	"github.com/ktnyt/labcon/cmd/labcon/app"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in  string
+		err error
+	}{
+		{
+			in: strings.Join([]string{
+				"drivers:",
+				"  - name: foo",
+				"    state: {volume: 0}",
+				"    ops:",
+				"      aspirate: {duration: 1s, add: {volume: 10}}",
+			}, "\n"),
+			err: nil,
+		},
+		{
+			in:  "drivers: []",
+			err: sim.ErrNoDrivers,
+		},
+		{
+			in: strings.Join([]string{
+				"drivers:",
+				"  - state: {volume: 0}",
+				"    ops: {aspirate: {}}",
+			}, "\n"),
+			err: sim.ErrMissingName,
+		},
+		{
+			in: strings.Join([]string{
+				"drivers:",
+				"  - name: foo",
+				"    ops: {aspirate: {}}",
+				"  - name: foo",
+				"    ops: {aspirate: {}}",
+			}, "\n"),
+			err: sim.ErrDuplicateName,
+		},
+		{
+			in: strings.Join([]string{
+				"drivers:",
+				"  - name: foo",
+				"    state: {volume: 0}",
+			}, "\n"),
+			err: sim.ErrNoOps,
+		},
+		{
+			in: strings.Join([]string{
+				"drivers:",
+				"  - name: foo",
+				"    state: {volume: 0}",
+				"    ops: {aspirate: {failure_rate: 2}}",
+			}, "\n"),
+			err: sim.ErrFailureRate,
+		},
+		{
+			in: strings.Join([]string{
+				"drivers:",
+				"  - name: foo",
+				"    state: {volume: 0}",
+				"    ops: {aspirate: {set: {tip: true}}}",
+			}, "\n"),
+			err: sim.ErrUnknownField,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if _, err := sim.Parse([]byte(tt.in)); !errors.Is(err, tt.err) {
+				t.Errorf("sim.Parse(in) = (_, %v), expected (_, %v)", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	r := chi.NewMux()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r.Use(
+		lib.Logger(zerolog.Nop()),
+		lib.Badger(db),
+		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	config, err := sim.Parse([]byte(strings.Join([]string{
+		"poll_interval: 1ms",
+		"drivers:",
+		"  - name: pipettor",
+		"    state: {tip: false, volume: 0}",
+		"    ops:",
+		"      pick_tip: {set: {tip: true}}",
+		"      aspirate: {duration: 10ms, add: {volume: 100}}",
+		"  - name: incubator",
+		"    state: {temperature: 25}",
+		"    ops:",
+		"      set_temperature: {set: {temperature: $arg.temperature}}",
+		"      break: {failure_rate: 1}",
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan error)
+	client := labcon.NewClient(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- sim.Run(ctx, client, config, 1, labcon.WithResultHandler(func(op driver.Op, err error) {
+			results <- err
+		}))
+	}()
+
+	// Wait for the drivers to register.
+	for {
+		names, err := client.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cases := []struct {
+		name   string
+		op     driver.Op
+		err    error
+		status driver.Status
+		state  map[string]interface{}
+	}{
+		{
+			name:   "pipettor",
+			op:     driver.Op{Name: "pick_tip"},
+			err:    nil,
+			status: driver.Idle,
+			state:  map[string]interface{}{"tip": true, "volume": 0.0},
+		},
+		{
+			name:   "pipettor",
+			op:     driver.Op{Name: "aspirate"},
+			err:    nil,
+			status: driver.Idle,
+			state:  map[string]interface{}{"tip": true, "volume": 100.0},
+		},
+		{
+			name:   "incubator",
+			op:     driver.Op{Name: "set_temperature", Arg: map[string]interface{}{"temperature": 37}},
+			err:    nil,
+			status: driver.Idle,
+			state:  map[string]interface{}{"temperature": 37.0},
+		},
+		{
+			name:   "incubator",
+			op:     driver.Op{Name: "break"},
+			err:    sim.ErrSimulatedFailure,
+			status: driver.Error,
+			state:  map[string]interface{}{"temperature": 37.0},
+		},
+		{
+			name:   "incubator",
+			op:     driver.Op{Name: "set_temperature", Arg: map[string]interface{}{"temperature": 4}},
+			err:    nil,
+			status: driver.Idle,
+			state:  map[string]interface{}{"temperature": 4.0},
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if err := client.Dispatch(tt.name, tt.op); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := <-results; !errors.Is(err, tt.err) {
+				t.Errorf("operation %q returned %v, expected %v", tt.op.Name, err, tt.err)
+			}
+
+			status, err := client.GetStatus(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != tt.status {
+				t.Errorf("status = %q, expected %q", status, tt.status)
+			}
+
+			var state map[string]interface{}
+			if err := client.GetState(tt.name, &state); err != nil {
+				t.Fatal(err)
+			}
+
+			if ops := utils.ObjDiff(state, tt.state); ops != nil {
+				t.Error(utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
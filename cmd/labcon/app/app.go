@@ -7,18 +7,95 @@ import (
 	"github.com/ktnyt/labcon/cmd/labcon/app/views"
 )
 
+// UntimedPaths are the patterns of the paths of requests that are held open
+// for as long as clients ask to, which are exempt from request timeouts.
+var UntimedPaths = []string{"/driver/*/state/wait"}
+
 type App struct {
-	driver controllers.DriverController
+	driver   controllers.DriverController
+	metrics  controllers.MetricsController
+	audit    controllers.AuditController
+	health   controllers.HealthController
+	workflow controllers.WorkflowController
+	schedule controllers.ScheduleController
+	booking  controllers.BookingController
+}
+
+type appOptions struct {
+	injectAudit    injectors.AuditInjector
+	injectHealth   injectors.HealthInjector
+	injectWorkflow injectors.WorkflowInjector
+	injectSchedule injectors.ScheduleInjector
+	injectBooking  injectors.BookingInjector
+}
+
+// AppOption replaces the injector of a subsystem other than drivers.
+type AppOption func(options *appOptions)
+
+func WithAuditInjector(inject injectors.AuditInjector) AppOption {
+	return func(options *appOptions) {
+		options.injectAudit = inject
+	}
+}
+
+func WithHealthInjector(inject injectors.HealthInjector) AppOption {
+	return func(options *appOptions) {
+		options.injectHealth = inject
+	}
+}
+
+func WithWorkflowInjector(inject injectors.WorkflowInjector) AppOption {
+	return func(options *appOptions) {
+		options.injectWorkflow = inject
+	}
+}
+
+func WithScheduleInjector(inject injectors.ScheduleInjector) AppOption {
+	return func(options *appOptions) {
+		options.injectSchedule = inject
+	}
 }
 
-func NewApp(injectDriver injectors.DriverInjector) App {
+func WithBookingInjector(inject injectors.BookingInjector) AppOption {
+	return func(options *appOptions) {
+		options.injectBooking = inject
+	}
+}
+
+func NewApp(injectDriver injectors.DriverInjector, opts ...AppOption) App {
+	options := appOptions{
+		injectAudit:    injectors.Audit,
+		injectHealth:   injectors.Health,
+		injectWorkflow: injectors.Workflow,
+		injectSchedule: injectors.Schedule,
+		injectBooking:  injectors.Booking,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
 	return App{
-		driver: controllers.NewDriverController(injectDriver),
+		driver:   controllers.NewDriverController(injectDriver),
+		metrics:  controllers.NewMetricsController(injectDriver),
+		audit:    controllers.NewAuditController(options.injectAudit),
+		health:   controllers.NewHealthController(options.injectHealth, injectDriver),
+		workflow: controllers.NewWorkflowController(options.injectWorkflow),
+		schedule: controllers.NewScheduleController(options.injectSchedule),
+		booking:  controllers.NewBookingController(options.injectBooking),
 	}
 }
 
 func (a App) Setup(r chi.Router) {
+	r.NotFound(views.NotFoundView)
+	r.MethodNotAllowed(views.MethodNotAllowedView)
 	r.Get("/", views.EmptyView)
+	r.Get("/openapi.json", views.OpenAPIView)
+	r.Get("/healthz", a.health.Live)
+	r.Get("/readyz", a.health.Ready)
+	r.Get("/metrics", a.metrics.Metrics)
+	r.Route("/audit", func(r chi.Router) {
+		r.Get("/", a.audit.List)
+		r.Get("/export", a.audit.Export)
+	})
 	r.Route("/driver", func(r chi.Router) {
 		r.Get("/", a.driver.List)
 		r.Post("/", a.driver.Register)
@@ -26,16 +103,57 @@ func (a App) Setup(r chi.Router) {
 			r.Route("/state", func(r chi.Router) {
 				r.Get("/", a.driver.GetState)
 				r.Put("/", a.driver.SetState)
+				r.Get("/wait", a.driver.WaitState)
 			})
 			r.Route("/status", func(r chi.Router) {
 				r.Get("/", a.driver.GetStatus)
 				r.Put("/", a.driver.SetStatus)
 			})
+			r.Route("/info", func(r chi.Router) {
+				r.Get("/", a.driver.GetInfo)
+				r.Put("/", a.driver.SetInfo)
+			})
 			r.Route("/operation", func(r chi.Router) {
 				r.Get("/", a.driver.Operation)
 				r.Post("/", a.driver.Dispatch)
+				r.Delete("/", a.driver.Cancel)
+			})
+			r.Route("/booking", func(r chi.Router) {
+				r.Get("/", a.booking.List)
+				r.Post("/", a.booking.Create)
+				r.Get("/export", a.booking.Export)
+				r.Route("/{id}", func(r chi.Router) {
+					r.Get("/", a.booking.Get)
+					r.Delete("/", a.booking.Cancel)
+				})
 			})
 			r.Delete("/", a.driver.Disconnect)
 		})
 	})
+	r.Route("/workflow", func(r chi.Router) {
+		r.Get("/", a.workflow.List)
+		r.Route("/{name}", func(r chi.Router) {
+			r.Get("/", a.workflow.Get)
+			r.Put("/", a.workflow.Put)
+			r.Delete("/", a.workflow.Delete)
+			r.Post("/run", a.workflow.Start)
+		})
+	})
+	r.Route("/run", func(r chi.Router) {
+		r.Get("/", a.workflow.ListRuns)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", a.workflow.GetRun)
+			r.Post("/pause", a.workflow.Pause)
+			r.Post("/resume", a.workflow.Resume)
+			r.Post("/abort", a.workflow.Abort)
+		})
+	})
+	r.Route("/schedule", func(r chi.Router) {
+		r.Get("/", a.schedule.List)
+		r.Route("/{name}", func(r chi.Router) {
+			r.Get("/", a.schedule.Get)
+			r.Put("/", a.schedule.Put)
+			r.Delete("/", a.schedule.Delete)
+		})
+	})
 }
@@ -2,10 +2,12 @@ package app_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -15,6 +17,9 @@ import (
 	"github.com/ktnyt/labcon/cmd/labcon/app"
 	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/metrics"
+	"github.com/ktnyt/labcon/cmd/labcon/openapi"
+	"github.com/ktnyt/labcon/codec"
 	"github.com/ktnyt/labcon/driver"
 	"github.com/ktnyt/labcon/utils"
 	"github.com/rs/zerolog"
@@ -73,6 +78,17 @@ func TestIntegration(t *testing.T) {
 			out:  bytes.NewBufferString("OK\n"),
 		},
 
+		{
+			setup: func() *http.Request {
+				return newRequest(t, http.MethodGet, "/unknown", nil)
+			},
+			code: http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "Not Found",
+			}),
+		},
+
 		{
 			setup: func() *http.Request {
 				req := newRequest(t, http.MethodPost, "/driver", lib.MustJsonMarshalToBuffer(t, driver.RegisterParams{
@@ -241,3 +257,491 @@ func TestIntegration(t *testing.T) {
 		}
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewMux()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	token := lib.DefaultTokenGenerator()
+	registry := metrics.NewRegistry(metrics.WithStateGauges(true))
+
+	r.Use(
+		lib.Logger(zerolog.Nop(), registry.ObserveRequest),
+		lib.Badger(db),
+		lib.DriverTokenGenerator(func() string { return token }),
+		metrics.Middleware(registry),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	requests := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPost, "/driver", driver.RegisterParams{Name: "foo", State: map[string]interface{}{"volume": 10}}},
+		{http.MethodPost, "/driver/foo/operation", driver.Op{Name: "aspirate"}},
+		{http.MethodPut, "/driver/foo/status", driver.Idle},
+		{http.MethodPost, "/driver/foo/operation", driver.Op{Name: "aspirate"}},
+		{http.MethodPut, "/driver/foo/status", driver.Error},
+	}
+
+	for _, tt := range requests {
+		req, err := http.NewRequest(tt.method, server.URL+tt.path, lib.MustJsonMarshalToBuffer(t, tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Driver-Token", token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: %s", tt.method, tt.path, res.Status)
+		}
+	}
+
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if got := res.Header.Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("Content-Type = %q, expected %q", got, metrics.ContentType)
+	}
+
+	p, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`labcon_http_requests_total{method="POST",route="/driver/{name}/operation/",code="200"} 2`,
+		`labcon_operations_dispatched_total{driver="foo",op="aspirate"} 2`,
+		`labcon_operations_completed_total{driver="foo",op="aspirate"} 1`,
+		`labcon_operations_failed_total{driver="foo",op="aspirate"} 1`,
+		`labcon_driver_status{driver="foo",status="error"} 1`,
+		`labcon_driver_state{driver="foo",field="volume"} 10`,
+	} {
+		if !strings.Contains(string(p), want+"\n") {
+			t.Errorf("missing %q in metrics:\n%s", want, p)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	r := chi.NewMux()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	token := lib.DefaultTokenGenerator()
+	keys := []lib.APIKey{
+		{Name: "alice", Key: "alice-key", Role: lib.RoleAdmin},
+		{Name: "bob", Key: "bob-key", Role: lib.RoleUser},
+	}
+
+	r.Use(
+		lib.Logger(zerolog.Nop()),
+		lib.Badger(db),
+		lib.DriverTokenGenerator(func() string { return token }),
+		lib.APIKeys(keys, false),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	do := func(method, path, key string, body interface{}) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, lib.MustJsonMarshalToBuffer(t, body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Driver-Token", token)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	requests := []struct {
+		method string
+		path   string
+		key    string
+		body   interface{}
+	}{
+		{http.MethodPost, "/driver", "", driver.RegisterParams{Name: "foo", State: "foo"}},
+		{http.MethodPost, "/driver/foo/operation", "bob-key", driver.Op{Name: "aspirate"}},
+		{http.MethodDelete, "/driver/foo/operation", "alice-key", nil},
+		{http.MethodPost, "/driver/foo/operation", "", driver.Op{Name: "dispense"}},
+		{http.MethodPut, "/driver/foo/status", "", driver.Idle},
+		{http.MethodDelete, "/driver/foo", "", nil},
+	}
+
+	for _, tt := range requests {
+		res := do(tt.method, tt.path, tt.key, tt.body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: %s", tt.method, tt.path, res.Status)
+		}
+	}
+
+	if res := do(http.MethodDelete, "/driver/foo/operation", "alice-key", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("cancel without operation: %s, expected %d", res.Status, http.StatusNotFound)
+	}
+
+	if res := do(http.MethodGet, "/audit", "bob-key", nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /audit as user: %s, expected %d", res.Status, http.StatusForbidden)
+	}
+
+	res := do(http.MethodGet, "/audit/export?driver=foo", "alice-key", nil)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET /audit/export: %s", res.Status)
+	}
+
+	var got []string
+	dec := json.NewDecoder(res.Body)
+	for dec.More() {
+		var entry struct {
+			Actor  string    `json:"actor"`
+			Action string    `json:"action"`
+			Op     driver.Op `json:"op"`
+		}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strings.TrimSpace(fmt.Sprintf("%s %s %s", entry.Actor, entry.Action, entry.Op.Name)))
+	}
+
+	expected := []string{
+		"driver:foo register",
+		"key:bob dispatch aspirate",
+		"key:alice cancel aspirate",
+		"anonymous dispatch dispense",
+		"driver:foo status dispense",
+		"driver:foo disconnect",
+	}
+	if ops := utils.ObjDiff(expected, got); ops != nil {
+		t.Errorf("audit log:\n%s", utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestHealth(t *testing.T) {
+	r := chi.NewMux()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	drainer := lib.NewDrainer()
+
+	r.Use(
+		lib.Logger(zerolog.Nop()),
+		lib.Drain(drainer),
+		lib.APIKeys([]lib.APIKey{{Name: "alice", Key: "alice-key", Role: lib.RoleAdmin}}, true, "/healthz", "/readyz"),
+		lib.Badger(db),
+		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/driver", lib.MustJsonMarshalToBuffer(t, driver.RegisterParams{Name: "foo", State: "foo"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer alice-key")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	cases := []struct {
+		path  string
+		drain bool
+		code  int
+		out   io.Reader
+	}{
+		{
+			path: "/healthz",
+			code: http.StatusOK,
+			out:  bytes.NewBufferString("{\"status\":\"ok\"}\n"),
+		},
+		{
+			path: "/readyz?drivers=true",
+			code: http.StatusOK,
+			out:  bytes.NewBufferString("{\"status\":\"ok\",\"checks\":{\"server\":\"ok\",\"storage\":\"ok\"},\"drivers\":{\"busy\":0,\"error\":0,\"idle\":1,\"lost\":0}}\n"),
+		},
+		{
+			path: "/driver",
+			code: http.StatusUnauthorized,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "missing API key",
+			}),
+		},
+		{
+			path:  "/readyz",
+			drain: true,
+			code:  http.StatusServiceUnavailable,
+			out:   bytes.NewBufferString("{\"status\":\"unavailable\",\"checks\":{\"server\":\"server is shutting down\",\"storage\":\"ok\"}}\n"),
+		},
+		{
+			path:  "/healthz",
+			drain: true,
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("{\"status\":\"ok\"}\n"),
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if tt.drain {
+				drainer.Drain()
+			}
+
+			res, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.code {
+				t.Errorf("GET %s got %d: expected %d", tt.path, res.StatusCode, tt.code)
+			}
+
+			if ops := utils.ReaderDiff(res.Body, tt.out); ops != nil {
+				t.Errorf("GET %s response body:\n%s", tt.path, utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+}
+
+// TestNegotiation checks that request bodies are decoded according to their
+// Content-Type and responses are encoded according to the Accept header.
+func TestNegotiation(t *testing.T) {
+	r := chi.NewMux()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r.Use(
+		lib.Logger(zerolog.Nop()),
+		lib.Negotiate,
+		lib.Badger(db),
+		lib.DriverTokenGenerator(func() string { return "token" }),
+	)
+
+	a := app.NewApp(injectors.Driver)
+	a.Setup(r)
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	mustMarshal := func(c codec.Codec, v interface{}) []byte {
+		p, err := c.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	params := driver.RegisterParams{Name: "foo", State: map[string]interface{}{"volume": 1.5}}
+
+	cases := []struct {
+		method      string
+		path        string
+		token       string
+		contentType string
+		accept      string
+		in          []byte
+		code        int
+		outType     string
+		out         []byte
+	}{
+		{
+			method:      http.MethodPost,
+			path:        "/driver",
+			contentType: "application/msgpack",
+			accept:      "application/yaml",
+			in:          mustMarshal(codec.Msgpack, params),
+			code:        http.StatusOK,
+			outType:     "application/yaml",
+			out:         mustMarshal(codec.YAML, "token"),
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/driver/foo/state",
+			accept:  "application/msgpack",
+			code:    http.StatusOK,
+			outType: "application/msgpack",
+			out:     mustMarshal(codec.Msgpack, params.State),
+		},
+		{
+			method:      http.MethodPut,
+			path:        "/driver/foo/state",
+			token:       "token",
+			contentType: "application/yaml",
+			in:          []byte("volume: 2.5\n"),
+			code:        http.StatusOK,
+			outType:     "text/plain; charset=utf-8",
+			out:         []byte("OK\n"),
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/driver/foo/state",
+			accept:  "text/html, application/yaml;q=0.9, application/json;q=0.8",
+			code:    http.StatusOK,
+			outType: "application/yaml",
+			out:     mustMarshal(codec.YAML, map[string]interface{}{"volume": 2.5}),
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/driver/bar/state",
+			accept:  "application/yaml",
+			code:    http.StatusNotFound,
+			outType: "application/yaml",
+			out: mustMarshal(codec.YAML, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to get state for driver \"bar\": not found",
+			}),
+		},
+		{
+			method:      http.MethodPost,
+			path:        "/driver",
+			contentType: "text/plain",
+			accept:      "application/msgpack",
+			in:          []byte("foo"),
+			code:        http.StatusBadRequest,
+			outType:     "application/msgpack",
+			out: mustMarshal(codec.Msgpack, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: lib.ErrContentType.Error(),
+			}),
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, bytes.NewReader(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("X-Driver-Token", tt.token)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.code {
+				t.Errorf("%s %s got %d: expected %d", tt.method, tt.path, res.StatusCode, tt.code)
+			}
+
+			if outType := res.Header.Get("Content-Type"); outType != tt.outType {
+				t.Errorf("%s %s Content-Type = %q: expected %q", tt.method, tt.path, outType, tt.outType)
+			}
+
+			if vary := res.Header.Get("Vary"); vary != "Accept" {
+				t.Errorf("%s %s Vary = %q: expected %q", tt.method, tt.path, vary, "Accept")
+			}
+
+			if ops := utils.ReaderDiff(res.Body, bytes.NewReader(tt.out)); ops != nil {
+				t.Errorf("%s %s response body:\n%s", tt.method, tt.path, utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+}
+
+// TestOpenAPI checks that every route registered by App.Setup is described in
+// the OpenAPI document and vice versa.
+func TestOpenAPI(t *testing.T) {
+	r := chi.NewMux()
+	app.NewApp(injectors.Driver).Setup(r)
+
+	routes := []string{}
+	if err := chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// Routes of subrouters are reported with a trailing slash.
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routes = append(routes, method+" "+route)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(routes)
+
+	ops, err := openapi.Operations()
+	if err != nil {
+		t.Fatalf("failed to parse OpenAPI document: %v", err)
+	}
+
+	if diff := utils.ObjDiff(ops, routes); diff != nil {
+		t.Errorf("routes (+) and OpenAPI operations (-) differ:\n%s", utils.JoinOps(diff, "\n"))
+	}
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET /openapi.json got %d: expected %d", res.StatusCode, http.StatusOK)
+	}
+
+	if ops := utils.ReaderDiff(res.Body, bytes.NewReader(openapi.Document)); ops != nil {
+		t.Errorf("GET /openapi.json response body:\n%s", utils.JoinOps(ops, "\n"))
+	}
+}
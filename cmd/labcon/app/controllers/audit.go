@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+var (
+	errAuditAdminOnly = errors.New("the audit log is only available to admin API keys")
+	errInvalidLimit   = errors.New("query parameter \"limit\" must be a non-negative integer")
+)
+
+var auditActions = map[models.AuditAction]bool{
+	models.AuditRegister:   true,
+	models.AuditDispatch:   true,
+	models.AuditStatus:     true,
+	models.AuditCancel:     true,
+	models.AuditDisconnect: true,
+	models.AuditInfo:       true,
+}
+
+type AuditController interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Export(w http.ResponseWriter, r *http.Request)
+}
+
+type AuditControllerImpl struct {
+	inject func(context.Context) usecases.AuditUsecase
+}
+
+func NewAuditController(inject func(context.Context) usecases.AuditUsecase) AuditController {
+	return AuditControllerImpl{inject: inject}
+}
+
+func (controller AuditControllerImpl) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	if !authorizeAdmin(w, r, errAuditAdminOnly) {
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	entries, err := usecase.List(query)
+	if err != nil {
+		logger.Err(err).Msg("failed to list audit entries")
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, entries)
+}
+
+// Export writes the selected audit entries as JSON lines, streaming them so
+// that the whole log can be exported without holding it in memory.
+func (controller AuditControllerImpl) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	if !authorizeAdmin(w, r, errAuditAdminOnly) {
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	err = usecase.Each(query, func(entry models.AuditEntry) error {
+		return enc.Encode(entry)
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		// The status has been written with the first entry, so the export
+		// can only be cut short.
+		logger.Err(err).Msg("failed to export audit entries")
+	}
+}
+
+// authorizeAdmin rejects requests not authenticated with an admin API key with
+// the given error: anonymous requests as unauthorized and requests with other
+// keys as forbidden. An error response is written and false is returned if the
+// check fails.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, err error) bool {
+	ctx := r.Context()
+	actor, ok := lib.UseActor(ctx)
+	if !ok {
+		lib.WriteError(w, ctx, http.StatusUnauthorized, err)
+		return false
+	}
+	if actor.Role != lib.RoleAdmin {
+		lib.WriteError(w, ctx, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+func parseAuditQuery(r *http.Request) (models.AuditQuery, error) {
+	values := r.URL.Query()
+	query := models.AuditQuery{
+		Driver: values.Get("driver"),
+		Actor:  values.Get("actor"),
+		Action: models.AuditAction(values.Get("action")),
+	}
+
+	if query.Action != "" && !auditActions[query.Action] {
+		return query, fmt.Errorf("unknown audit action %q", query.Action)
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"since", &query.Since},
+		{"until", &query.Until},
+	} {
+		value := values.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return query, fmt.Errorf("query parameter %q must be an RFC 3339 time: %q", param.name, value)
+		}
+		*param.dst = t
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return query, errInvalidLimit
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
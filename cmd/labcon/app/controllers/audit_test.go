@@ -0,0 +1,280 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/controllers"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var auditEntries = []models.AuditEntry{
+	{
+		ID:     "00000000000000000001-0000",
+		Time:   time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC),
+		Actor:  "driver:foo",
+		Action: models.AuditRegister,
+		Driver: "foo",
+	},
+	{
+		ID:     "00000000000000000002-0000",
+		Time:   time.Date(2022, 4, 1, 9, 1, 0, 0, time.UTC),
+		Actor:  "key:alice",
+		Action: models.AuditDispatch,
+		Driver: "foo",
+		Op:     &driver.Op{Name: "op", Arg: "arg"},
+	},
+}
+
+// newAdminRequest returns a request authenticated with an admin API key.
+func newAdminRequest(method, target string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	ctx := lib.WithActor(r.Context(), lib.Actor{Name: "alice", Role: lib.RoleAdmin})
+	return r.WithContext(ctx)
+}
+
+func TestAuditList(t *testing.T) {
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockAuditUsecase)
+		setup func() *http.Request
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockAuditUsecase) {
+				usecase.EXPECT().
+					List(models.AuditQuery{}).
+					Return(auditEntries, nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return newAdminRequest(http.MethodGet, "/audit", nil)
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, auditEntries),
+		},
+
+		{
+			label: "query",
+			mock: func(usecase *usecases_mock.MockAuditUsecase) {
+				usecase.EXPECT().
+					List(models.AuditQuery{
+						Driver: "foo",
+						Actor:  "key:alice",
+						Action: models.AuditDispatch,
+						Since:  time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC),
+						Until:  time.Date(2022, 4, 2, 9, 0, 0, 0, time.UTC),
+						Limit:  10,
+					}).
+					Return(auditEntries[1:], nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return newAdminRequest(http.MethodGet, "/audit?driver=foo&actor=key:alice&action=dispatch&since=2022-04-01T09:00:00Z&until=2022-04-02T09:00:00Z&limit=10", nil)
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, auditEntries[1:]),
+		},
+
+		{
+			label: "anonymous",
+			mock:  func(usecase *usecases_mock.MockAuditUsecase) {},
+			setup: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/audit", nil)
+			},
+			code: http.StatusUnauthorized,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "the audit log is only available to admin API keys",
+			}),
+		},
+
+		{
+			label: "forbidden",
+			mock:  func(usecase *usecases_mock.MockAuditUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/audit", nil)
+				ctx := lib.WithActor(r.Context(), lib.Actor{Name: "bob", Role: lib.RoleUser})
+				return r.WithContext(ctx)
+			},
+			code: http.StatusForbidden,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "the audit log is only available to admin API keys",
+			}),
+		},
+
+		{
+			label: "unknown action",
+			mock:  func(usecase *usecases_mock.MockAuditUsecase) {},
+			setup: func() *http.Request {
+				return newAdminRequest(http.MethodGet, "/audit?action=explode", nil)
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "unknown audit action \"explode\"",
+			}),
+		},
+
+		{
+			label: "invalid time",
+			mock:  func(usecase *usecases_mock.MockAuditUsecase) {},
+			setup: func() *http.Request {
+				return newAdminRequest(http.MethodGet, "/audit?since=yesterday", nil)
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "query parameter \"since\" must be an RFC 3339 time: \"yesterday\"",
+			}),
+		},
+
+		{
+			label: "invalid limit",
+			mock:  func(usecase *usecases_mock.MockAuditUsecase) {},
+			setup: func() *http.Request {
+				return newAdminRequest(http.MethodGet, "/audit?limit=-1", nil)
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "query parameter \"limit\" must be a non-negative integer",
+			}),
+		},
+
+		{
+			label: "internal server error",
+			mock: func(usecase *usecases_mock.MockAuditUsecase) {
+				usecase.EXPECT().
+					List(models.AuditQuery{}).
+					Return(nil, lib.ErrUnknown).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return newAdminRequest(http.MethodGet, "/audit", nil)
+			},
+			code: http.StatusInternalServerError,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			failed := false
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			usecase := usecases_mock.NewMockAuditUsecase(ctrl)
+			inject := func(context.Context) usecases.AuditUsecase { return usecase }
+			controller := controllers.NewAuditController(inject)
+
+			tt.mock(usecase)
+
+			w := httptest.NewRecorder()
+			r := tt.setup()
+
+			b := &strings.Builder{}
+			logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+			logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+			ctx := r.Context()
+			ctx = logger.WithContext(ctx)
+
+			controller.List(w, r.WithContext(ctx))
+
+			if w.Code != tt.code {
+				t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, tt.code)
+				failed = true
+			}
+
+			if ops := utils.ReaderDiff(w.Body, tt.out); ops != nil {
+				t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("log output:\n%s", b.String())
+			}
+		})
+	}
+}
+
+func TestAuditExport(t *testing.T) {
+	out := &bytes.Buffer{}
+	for _, entry := range auditEntries {
+		out.Write(lib.MustJsonMarshalToBuffer(t, entry).Bytes())
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usecase := usecases_mock.NewMockAuditUsecase(ctrl)
+	usecase.EXPECT().
+		Each(models.AuditQuery{Driver: "foo"}, gomock.Any()).
+		DoAndReturn(func(query models.AuditQuery, f func(entry models.AuditEntry) error) error {
+			for _, entry := range auditEntries {
+				if err := f(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Times(1)
+
+	inject := func(context.Context) usecases.AuditUsecase { return usecase }
+	controller := controllers.NewAuditController(inject)
+
+	w := httptest.NewRecorder()
+	r := newAdminRequest(http.MethodGet, "/audit/export?driver=foo", nil)
+	controller.Export(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, http.StatusOK)
+	}
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("%s %s Content-Type = %q: expected %q", r.Method, r.RequestURI, contentType, "application/x-ndjson")
+	}
+
+	if ops := utils.ReaderDiff(w.Body, out); ops != nil {
+		t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestAuditExportAnonymous(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usecase := usecases_mock.NewMockAuditUsecase(ctrl)
+	inject := func(context.Context) usecases.AuditUsecase { return usecase }
+	controller := controllers.NewAuditController(inject)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/audit/export", nil)
+	controller.Export(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, http.StatusUnauthorized)
+	}
+}
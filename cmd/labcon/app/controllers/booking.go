@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/ical"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+var (
+	errBookingAPIKey = errors.New("bookings are held by API keys: authenticate with one to book")
+)
+
+type BookingController interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
+	Export(w http.ResponseWriter, r *http.Request)
+}
+
+type BookingControllerImpl struct {
+	inject func(context.Context) usecases.BookingUsecase
+}
+
+func NewBookingController(inject func(context.Context) usecases.BookingUsecase) BookingController {
+	return BookingControllerImpl{inject: inject}
+}
+
+func (controller BookingControllerImpl) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	from, to, err := parseBookingRange(r)
+	if err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	bookings, err := usecase.List(name, from, to)
+	if err != nil {
+		logger.Err(err).Msgf("failed to list bookings of driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, bookings)
+}
+
+// Create books the driver for the API key of the request. The ID, driver and
+// holder in the body, if any, are ignored.
+func (controller BookingControllerImpl) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	actor, ok := lib.UseActor(ctx)
+	if !ok {
+		lib.WriteError(w, ctx, http.StatusUnauthorized, errBookingAPIKey)
+		return
+	}
+
+	var booking models.Booking
+	if err := lib.ReadRequest(r, &booking); err != nil {
+		logger.Warn().Err(err).Msg("failed to process request")
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+	booking.ID, booking.Driver, booking.Holder = "", name, actor.Name
+
+	if err := lib.Validate(booking); err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	booking, err := usecase.Create(booking)
+	if err != nil {
+		if errors.Is(err, models.ErrBookingPast) {
+			lib.WriteError(w, ctx, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrBookingConflict) {
+			lib.WriteError(w, ctx, http.StatusConflict, fmt.Errorf("failed to book driver %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to book driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, booking)
+}
+
+func (controller BookingControllerImpl) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name, id, ok := bookingParams(w, r)
+	if !ok {
+		return
+	}
+
+	booking, err := usecase.Get(name, id)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get booking %s of driver %q: %w", id, name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to get booking %s of driver %q", id, name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, booking)
+}
+
+// Cancel cancels a booking. Only the holder of the booking and admin API keys
+// may cancel it.
+func (controller BookingControllerImpl) Cancel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name, id, ok := bookingParams(w, r)
+	if !ok {
+		return
+	}
+
+	booking, err := usecase.Get(name, id)
+	if err == nil {
+		actor, _ := lib.UseActor(ctx)
+		if actor.Role != lib.RoleAdmin && actor.Name != booking.Holder {
+			lib.WriteError(w, ctx, http.StatusForbidden, fmt.Errorf("failed to cancel %s: %w: only its holder may cancel it", booking, lib.ErrForbidden))
+			return
+		}
+		err = usecase.Cancel(name, id)
+	}
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to cancel booking %s of driver %q: %w", id, name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to cancel booking %s of driver %q", id, name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.HTTPError(w, http.StatusOK)
+}
+
+// Export writes the selected bookings of the driver as an iCalendar file.
+func (controller BookingControllerImpl) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	from, to, err := parseBookingRange(r)
+	if err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	bookings, err := usecase.List(name, from, to)
+	if err != nil {
+		logger.Err(err).Msgf("failed to export bookings of driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	calendar := ical.Calendar{Name: name}
+	for _, booking := range bookings {
+		calendar.Events = append(calendar.Events, ical.Event{
+			UID:         fmt.Sprintf("booking-%s-%s@labcon", booking.ID, name),
+			Stamp:       booking.Created,
+			Start:       booking.Start,
+			End:         booking.End,
+			Summary:     fmt.Sprintf("%s booked by %s", name, booking.Holder),
+			Description: booking.Note,
+		})
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".ics"))
+	if _, err := calendar.WriteTo(w); err != nil {
+		logger.Err(err).Msgf("failed to export bookings of driver %q", name)
+	}
+}
+
+// bookingParams returns the driver name and booking ID in the URL. An error
+// response is written and false is returned if either is missing.
+func bookingParams(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return "", "", false
+	}
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingID)
+		return "", "", false
+	}
+	return name, id, true
+}
+
+// parseBookingRange returns the times in the "from" and "to" query
+// parameters, which are zero if absent.
+func parseBookingRange(r *http.Request) (time.Time, time.Time, error) {
+	values := r.URL.Query()
+	var times [2]time.Time
+	for i, param := range []string{"from", "to"} {
+		value := values.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return times[0], times[1], fmt.Errorf("query parameter %q must be an RFC 3339 time: %q", param, value)
+		}
+		times[i] = t
+	}
+	return times[0], times[1], nil
+}
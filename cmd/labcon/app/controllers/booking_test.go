@@ -0,0 +1,291 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/controllers"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var testBooking = models.Booking{
+	ID:      "1",
+	Driver:  "confocal",
+	Holder:  "alice",
+	Start:   time.Date(2022, 4, 1, 13, 0, 0, 0, time.UTC),
+	End:     time.Date(2022, 4, 1, 15, 0, 0, 0, time.UTC),
+	Note:    "live imaging",
+	Created: time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC),
+}
+
+// serveBooking calls a handler of a booking controller backed by the mock on
+// behalf of the actor, if any, and checks the response.
+func serveBooking(t *testing.T, mock func(usecase *usecases_mock.MockBookingUsecase), handler func(controller controllers.BookingController) http.HandlerFunc, r *http.Request, actor *lib.Actor, code int, out io.Reader) {
+	t.Helper()
+	failed := false
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usecase := usecases_mock.NewMockBookingUsecase(ctrl)
+	inject := func(context.Context) usecases.BookingUsecase { return usecase }
+	controller := controllers.NewBookingController(inject)
+
+	mock(usecase)
+
+	w := httptest.NewRecorder()
+
+	b := &strings.Builder{}
+	logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+	logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+	ctx := r.Context()
+	ctx = logger.WithContext(ctx)
+	if actor != nil {
+		ctx = lib.WithActor(ctx, *actor)
+	}
+
+	handler(controller)(w, r.WithContext(ctx))
+
+	if w.Code != code {
+		t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, code)
+		failed = true
+	}
+
+	if ops := utils.ReaderDiff(w.Body, out); ops != nil {
+		t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+		failed = true
+	}
+
+	if failed {
+		t.Errorf("log output:\n%s", b.String())
+	}
+}
+
+func TestBookingCreate(t *testing.T) {
+	alice := &lib.Actor{Name: "alice", Role: lib.RoleUser}
+	body := `{"start": "2022-04-01T13:00:00Z", "end": "2022-04-01T15:00:00Z", "note": "live imaging", "holder": "bob"}`
+	request := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/driver/confocal/booking", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return withURLParam(r, "name", "confocal")
+	}
+	requested := models.Booking{
+		Driver: "confocal",
+		Holder: "alice",
+		Start:  testBooking.Start,
+		End:    testBooking.End,
+		Note:   testBooking.Note,
+	}
+
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockBookingUsecase)
+		body  string
+		actor *lib.Actor
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				usecase.EXPECT().
+					Create(requested).
+					Return(testBooking, nil).
+					Times(1)
+			},
+			body:  body,
+			actor: alice,
+			code:  http.StatusOK,
+			out:   lib.MustJsonMarshalToBuffer(t, testBooking),
+		},
+
+		{
+			label: "conflict",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				other := testBooking
+				other.Holder = "bob"
+				usecase.EXPECT().
+					Create(requested).
+					Return(requested, fmt.Errorf("%w: %s", models.ErrBookingConflict, other)).
+					Times(1)
+			},
+			body:  body,
+			actor: alice,
+			code:  http.StatusConflict,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "conflict",
+				Message: "failed to book driver \"confocal\": driver is already booked: booking 1 of driver \"confocal\" by \"bob\" from 2022-04-01T13:00:00Z to 2022-04-01T15:00:00Z",
+			}),
+		},
+
+		{
+			label: "past",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				usecase.EXPECT().
+					Create(requested).
+					Return(requested, models.ErrBookingPast).
+					Times(1)
+			},
+			body:  body,
+			actor: alice,
+			code:  http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "booking must end in the future",
+			}),
+		},
+
+		{
+			label: "invalid range",
+			mock:  func(usecase *usecases_mock.MockBookingUsecase) {},
+			body:  `{"start": "2022-04-01T15:00:00Z", "end": "2022-04-01T13:00:00Z"}`,
+			actor: alice,
+			code:  http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "booking must end after it starts",
+			}),
+		},
+
+		{
+			label: "unauthenticated",
+			mock:  func(usecase *usecases_mock.MockBookingUsecase) {},
+			body:  body,
+			actor: nil,
+			code:  http.StatusUnauthorized,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "bookings are held by API keys: authenticate with one to book",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			serveBooking(t, tt.mock, func(controller controllers.BookingController) http.HandlerFunc {
+				return controller.Create
+			}, request(tt.body), tt.actor, tt.code, tt.out)
+		})
+	}
+}
+
+func TestBookingCancel(t *testing.T) {
+	request := func() *http.Request {
+		r := withURLParam(httptest.NewRequest(http.MethodDelete, "/driver/confocal/booking/1", nil), "name", "confocal")
+		rctx := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+		rctx.URLParams.Add("id", "1")
+		return r
+	}
+
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockBookingUsecase)
+		actor *lib.Actor
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "holder",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				usecase.EXPECT().Get("confocal", "1").Return(testBooking, nil).Times(1)
+				usecase.EXPECT().Cancel("confocal", "1").Return(nil).Times(1)
+			},
+			actor: &lib.Actor{Name: "alice", Role: lib.RoleUser},
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "admin",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				usecase.EXPECT().Get("confocal", "1").Return(testBooking, nil).Times(1)
+				usecase.EXPECT().Cancel("confocal", "1").Return(nil).Times(1)
+			},
+			actor: &lib.Actor{Name: "facility", Role: lib.RoleAdmin},
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "other",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				usecase.EXPECT().Get("confocal", "1").Return(testBooking, nil).Times(1)
+			},
+			actor: &lib.Actor{Name: "bob", Role: lib.RoleUser},
+			code:  http.StatusForbidden,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to cancel booking 1 of driver \"confocal\" by \"alice\" from 2022-04-01T13:00:00Z to 2022-04-01T15:00:00Z: forbidden: only its holder may cancel it",
+			}),
+		},
+
+		{
+			label: "not found",
+			mock: func(usecase *usecases_mock.MockBookingUsecase) {
+				usecase.EXPECT().Get("confocal", "1").Return(models.Booking{}, lib.ErrNotFound).Times(1)
+			},
+			actor: &lib.Actor{Name: "alice", Role: lib.RoleUser},
+			code:  http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to cancel booking 1 of driver \"confocal\": not found",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			serveBooking(t, tt.mock, func(controller controllers.BookingController) http.HandlerFunc {
+				return controller.Cancel
+			}, request(), tt.actor, tt.code, tt.out)
+		})
+	}
+}
+
+func TestBookingExport(t *testing.T) {
+	r := withURLParam(httptest.NewRequest(http.MethodGet, "/driver/confocal/booking/export?from=2022-04-01T00:00:00Z", nil), "name", "confocal")
+	from := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	out := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//labcon//bookings//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:confocal",
+		"BEGIN:VEVENT",
+		"UID:booking-1-confocal@labcon",
+		"DTSTAMP:20220401T090000Z",
+		"DTSTART:20220401T130000Z",
+		"DTEND:20220401T150000Z",
+		"SUMMARY:confocal booked by alice",
+		"DESCRIPTION:live imaging",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	serveBooking(t, func(usecase *usecases_mock.MockBookingUsecase) {
+		usecase.EXPECT().
+			List("confocal", from, time.Time{}).
+			Return([]models.Booking{testBooking}, nil).
+			Times(1)
+	}, func(controller controllers.BookingController) http.HandlerFunc {
+		return controller.Export
+	}, r, nil, http.StatusOK, bytes.NewBufferString(out))
+}
@@ -5,23 +5,44 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
 	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/expr"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
 	"github.com/ktnyt/labcon/driver"
 )
 
+var (
+	errMissingName    = errors.New("missing URL parameter \"name\"")
+	errMissingToken   = errors.New("missing X-Driver-Token header")
+	errMissingUntil   = errors.New("missing query parameter \"until\"")
+	errInvalidTimeout = errors.New("query parameter \"timeout\" must be a positive duration such as \"30s\"")
+	errInvalidSummary = errors.New("query parameter \"summary\" must be a boolean")
+	errInfoAdminOnly  = errors.New("driver labels and metadata may only be edited with admin API keys")
+)
+
+// waitPollInterval is how often a wait reads the driver again if the server
+// has no notifier.
+const waitPollInterval = time.Second
+
 type DriverController interface {
 	List(w http.ResponseWriter, r *http.Request)
 	Register(w http.ResponseWriter, r *http.Request)
 	GetState(w http.ResponseWriter, r *http.Request)
+	WaitState(w http.ResponseWriter, r *http.Request)
 	SetState(w http.ResponseWriter, r *http.Request)
 	GetStatus(w http.ResponseWriter, r *http.Request)
 	SetStatus(w http.ResponseWriter, r *http.Request)
 	Operation(w http.ResponseWriter, r *http.Request)
 	Dispatch(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
 	Disconnect(w http.ResponseWriter, r *http.Request)
+	GetInfo(w http.ResponseWriter, r *http.Request)
+	SetInfo(w http.ResponseWriter, r *http.Request)
 }
 
 type DriverControllerImpl struct {
@@ -32,6 +53,9 @@ func NewDriverController(inject func(context.Context) usecases.DriverUsecase) Dr
 	return DriverControllerImpl{inject: inject}
 }
 
+// List responds with the names of the drivers, or with summaries of them if
+// the "summary" query parameter is true. The "selector" query parameter
+// selects drivers by their labels, as parsed by models.ParseSelector.
 func (controller DriverControllerImpl) List(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := lib.UseLogger(ctx)
@@ -39,14 +63,49 @@ func (controller DriverControllerImpl) List(w http.ResponseWriter, r *http.Reque
 	// Dependency injection.
 	usecase := controller.inject(ctx)
 
-	list, err := usecase.List()
+	values := r.URL.Query()
+	selector, err := models.ParseSelector(values.Get("selector"))
+	if err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+	summary := false
+	if value := values.Get("summary"); value != "" {
+		if summary, err = strconv.ParseBool(value); err != nil {
+			lib.WriteError(w, ctx, http.StatusBadRequest, errInvalidSummary)
+			return
+		}
+	}
+
+	if selector == nil && !summary {
+		list, err := usecase.List()
+		if err != nil {
+			logger.Err(err).Msgf("failed to list drivers")
+			lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+			return
+		}
+
+		lib.WriteResponse(w, ctx, list)
+		return
+	}
+
+	summaries, err := usecase.Summaries(selector)
 	if err != nil {
 		logger.Err(err).Msgf("failed to list drivers")
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
-	lib.JsonResponse(w, ctx, list)
+	if summary {
+		lib.WriteResponse(w, ctx, summaries)
+		return
+	}
+
+	list := make([]string, len(summaries))
+	for i, s := range summaries {
+		list[i] = s.Name
+	}
+	lib.WriteResponse(w, ctx, list)
 }
 
 func (controller DriverControllerImpl) Register(w http.ResponseWriter, r *http.Request) {
@@ -56,30 +115,35 @@ func (controller DriverControllerImpl) Register(w http.ResponseWriter, r *http.R
 	// Dependency injection.
 	usecase := controller.inject(ctx)
 
+	if lib.UseDrainer(ctx).Draining() {
+		lib.WriteError(w, ctx, http.StatusServiceUnavailable, fmt.Errorf("failed to register driver: %w", lib.ErrDraining))
+		return
+	}
+
 	var req driver.RegisterParams
-	if err := lib.JsonRequest(r, &req); err != nil {
+	if err := lib.ReadRequest(r, &req); err != nil {
 		logger.Warn().Err(err).Msg("failed to process request")
-		lib.HTTPError(w, http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := lib.Validate(req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
 		return
 	}
 
-	token, err := usecase.Register(req.Name, req.State)
+	token, err := usecase.Register(req)
 	if err != nil {
 		if errors.Is(err, lib.ErrAlreadyExists) {
-			http.Error(w, fmt.Sprintf("failed to register driver %q: %v", req.Name, err), http.StatusBadRequest)
+			lib.WriteError(w, ctx, http.StatusConflict, fmt.Errorf("failed to register driver %q: %w", req.Name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to register driver %q", req.Name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
-	lib.JsonResponse(w, ctx, token)
+	lib.WriteResponse(w, ctx, token)
 }
 
 func (controller DriverControllerImpl) GetState(w http.ResponseWriter, r *http.Request) {
@@ -91,25 +155,29 @@ func (controller DriverControllerImpl) GetState(w http.ResponseWriter, r *http.R
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
 		return
 	}
 
 	state, err := usecase.GetState(name)
 	if err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to get state for driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get state for driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to get state for driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
-	lib.JsonResponse(w, ctx, state)
+	lib.WriteResponse(w, ctx, state)
 }
 
-func (controller DriverControllerImpl) SetState(w http.ResponseWriter, r *http.Request) {
+// WaitState responds with the state of the driver once the condition in the
+// "until" query parameter holds for it, or with 408 Request Timeout if the
+// condition does not hold within the "timeout" query parameter, if given. The
+// condition is evaluated again whenever the driver changes.
+func (controller DriverControllerImpl) WaitState(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := lib.UseLogger(ctx)
 
@@ -118,44 +186,111 @@ func (controller DriverControllerImpl) SetState(w http.ResponseWriter, r *http.R
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
 		return
 	}
 
-	token := r.Header.Get("X-Driver-Token")
-	if token == "" {
-		http.Error(w, "missing X-Driver-Token header", http.StatusUnauthorized)
+	values := r.URL.Query()
+	if values.Get("until") == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingUntil)
+		return
+	}
+	until, err := expr.Parse(values.Get("until"))
+	if err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, fmt.Errorf("query parameter \"until\": %w", err))
 		return
 	}
 
-	if err := usecase.Authorize(name, token); err != nil {
-		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in set state: %v", name, err), http.StatusNotFound)
+	var expired <-chan time.Time
+	if value := values.Get("timeout"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			lib.WriteError(w, ctx, http.StatusBadRequest, errInvalidTimeout)
 			return
 		}
-		if errors.Is(err, lib.ErrForbidden) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in set state: %v", name, err), http.StatusForbidden)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// Subscribe before reading the state so that no change is missed.
+	var changed <-chan struct{}
+	var poll <-chan time.Time
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		ch, unsubscribe := notifier.Subscribe(name)
+		defer unsubscribe()
+		changed = ch
+	} else {
+		ticker := time.NewTicker(waitPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	drainer := lib.UseDrainer(ctx)
+
+	for {
+		state, err := usecase.GetState(name)
+		if err != nil {
+			if errors.Is(err, lib.ErrNotFound) {
+				lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to wait for driver %q: %w", name, err))
+				return
+			}
+			logger.Err(err).Msgf("failed to wait for driver %q", name)
+			lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+			return
+		}
+
+		if until.Eval(state) {
+			lib.WriteResponse(w, ctx, state)
 			return
 		}
-		logger.Err(err).Msgf("failed to authorize driver %q in set state", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-drainer.Done():
+			lib.WriteError(w, ctx, http.StatusServiceUnavailable, fmt.Errorf("failed to wait for driver %q: %w", name, lib.ErrDraining))
+			return
+		case <-expired:
+			lib.WriteError(w, ctx, http.StatusRequestTimeout, fmt.Errorf("failed to wait for driver %q until %s: %w", name, until, lib.ErrTimeout))
+			return
+		case <-changed:
+		case <-poll:
+		}
+	}
+}
+
+func (controller DriverControllerImpl) SetState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	if !authorize(w, r, usecase, name, "set state") {
 		return
 	}
 
 	var state interface{}
-	if err := lib.JsonRequest(r, &state); err != nil {
+	if err := lib.ReadRequest(r, &state); err != nil {
 		logger.Warn().Err(err).Msg("failed to process request")
-		lib.HTTPError(w, http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := usecase.SetState(name, state); err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to set state for driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to set state for driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to set state for driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
@@ -171,22 +306,22 @@ func (controller DriverControllerImpl) GetStatus(w http.ResponseWriter, r *http.
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
 		return
 	}
 
 	status, err := usecase.GetStatus(name)
 	if err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to get status for driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get status for driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to get status for driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
-	lib.JsonResponse(w, ctx, status)
+	lib.WriteResponse(w, ctx, status)
 }
 
 func (controller DriverControllerImpl) SetStatus(w http.ResponseWriter, r *http.Request) {
@@ -198,44 +333,28 @@ func (controller DriverControllerImpl) SetStatus(w http.ResponseWriter, r *http.
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
 		return
 	}
 
-	token := r.Header.Get("X-Driver-Token")
-	if token == "" {
-		http.Error(w, "missing X-Driver-Token header", http.StatusUnauthorized)
-		return
-	}
-
-	if err := usecase.Authorize(name, token); err != nil {
-		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in set status: %v", name, err), http.StatusNotFound)
-			return
-		}
-		if errors.Is(err, lib.ErrForbidden) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in set status: %v", name, err), http.StatusForbidden)
-			return
-		}
-		logger.Err(err).Msgf("failed to authorize driver %q in set status", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+	if !authorize(w, r, usecase, name, "set status") {
 		return
 	}
 
 	var status driver.Status
-	if err := lib.JsonRequest(r, &status); err != nil {
+	if err := lib.ReadRequest(r, &status); err != nil {
 		logger.Warn().Err(err).Msg("failed to process request")
-		lib.HTTPError(w, http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := usecase.SetStatus(name, status); err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to set status for driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to set status for driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to set status for driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
@@ -251,42 +370,26 @@ func (controller DriverControllerImpl) Operation(w http.ResponseWriter, r *http.
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
 		return
 	}
 
-	token := r.Header.Get("X-Driver-Token")
-	if token == "" {
-		http.Error(w, "missing X-Driver-Token header", http.StatusUnauthorized)
-		return
-	}
-
-	if err := usecase.Authorize(name, token); err != nil {
-		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in get operation: %v", name, err), http.StatusNotFound)
-			return
-		}
-		if errors.Is(err, lib.ErrForbidden) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in get operation: %v", name, err), http.StatusForbidden)
-			return
-		}
-		logger.Err(err).Msgf("failed to authorize driver %q in get operation", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+	if !authorize(w, r, usecase, name, "get operation") {
 		return
 	}
 
 	op, err := usecase.GetOp(name)
 	if err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to get operation for driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get operation for driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to get operation for driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
-	lib.JsonResponse(w, ctx, op)
+	lib.WriteResponse(w, ctx, op)
 }
 
 func (controller DriverControllerImpl) Dispatch(w http.ResponseWriter, r *http.Request) {
@@ -298,36 +401,45 @@ func (controller DriverControllerImpl) Dispatch(w http.ResponseWriter, r *http.R
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	if lib.UseDrainer(ctx).Draining() {
+		lib.WriteError(w, ctx, http.StatusServiceUnavailable, fmt.Errorf("failed to dispatch for driver %q: %w", name, lib.ErrDraining))
 		return
 	}
 
 	var op driver.Op
-	if err := lib.JsonRequest(r, &op); err != nil {
+	if err := lib.ReadRequest(r, &op); err != nil {
 		logger.Warn().Err(err).Msg("failed to process request")
-		lib.HTTPError(w, http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := lib.Validate(op); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := usecase.SetOp(name, op); err != nil {
+		if errors.Is(err, lib.ErrBusy) || errors.Is(err, lib.ErrBooked) {
+			lib.WriteError(w, ctx, http.StatusConflict, fmt.Errorf("failed to dispatch for driver %q: %w", name, err))
+			return
+		}
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to dispatch for driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to dispatch for driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to dispatch for driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
 	lib.HTTPError(w, http.StatusOK)
 }
 
-func (controller DriverControllerImpl) Disconnect(w http.ResponseWriter, r *http.Request) {
+func (controller DriverControllerImpl) Cancel(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := lib.UseLogger(ctx)
 
@@ -336,40 +448,164 @@ func (controller DriverControllerImpl) Disconnect(w http.ResponseWriter, r *http
 
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		http.Error(w, "missing URL parameter \"name\"", http.StatusBadRequest)
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
 		return
 	}
 
-	token := r.Header.Get("X-Driver-Token")
-	if token == "" {
-		http.Error(w, "missing X-Driver-Token header", http.StatusUnauthorized)
-		return
-	}
+	// Admins may cancel any operation, and others only their own. Requests
+	// without an API key may cancel operations dispatched without one, which
+	// are all operations if no API keys are configured.
+	actor, _ := lib.UseActor(ctx)
 
-	if err := usecase.Authorize(name, token); err != nil {
+	if err := usecase.CancelOp(name, actor.Name, actor.Role == lib.RoleAdmin); err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in disconnect: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to cancel operation for driver %q: %w", name, err))
 			return
 		}
 		if errors.Is(err, lib.ErrForbidden) {
-			http.Error(w, fmt.Sprintf("failed to authorize driver %q in disconnect: %v", name, err), http.StatusForbidden)
+			lib.WriteError(w, ctx, http.StatusForbidden, fmt.Errorf("failed to cancel operation for driver %q: %w", name, err))
 			return
 		}
-		logger.Err(err).Msgf("failed to authorize driver %q in disconnect", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		logger.Err(err).Msgf("failed to cancel operation for driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.HTTPError(w, http.StatusOK)
+}
+
+func (controller DriverControllerImpl) Disconnect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	if !authorize(w, r, usecase, name, "disconnect") {
 		return
 	}
 
 	err := usecase.Delete(name)
 	if err != nil {
 		if errors.Is(err, lib.ErrNotFound) {
-			http.Error(w, fmt.Sprintf("failed to disconnect driver %q: %v", name, err), http.StatusNotFound)
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to disconnect driver %q: %w", name, err))
 			return
 		}
 		logger.Err(err).Msgf("failed to disconnect driver %q", name)
-		lib.HTTPError(w, http.StatusInternalServerError)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
 		return
 	}
 
 	lib.HTTPError(w, http.StatusOK)
 }
+
+func (controller DriverControllerImpl) GetInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	model, err := usecase.Inspect(name)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get info for driver %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to get info for driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, model.Info())
+}
+
+// SetInfo replaces the labels and metadata of a driver. Only requests with an
+// admin API key may do so.
+func (controller DriverControllerImpl) SetInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	if !authorizeAdmin(w, r, errInfoAdminOnly) {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	var info driver.Info
+	if err := lib.ReadRequest(r, &info); err != nil {
+		logger.Warn().Err(err).Msg("failed to process request")
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := lib.Validate(info); err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := usecase.SetInfo(name, info); err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to set info for driver %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to set info for driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.HTTPError(w, http.StatusOK)
+}
+
+// authorize checks that the request is made by the driver with the given name.
+// A driver is identified either by its X-Driver-Token header or by a verified
+// client certificate whose common name matches the driver name. An error
+// response is written and false is returned if the check fails.
+func authorize(w http.ResponseWriter, r *http.Request, usecase usecases.DriverUsecase, name, action string) bool {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	token := r.Header.Get("X-Driver-Token")
+	if token == "" {
+		if lib.PeerName(r) == name {
+			return true
+		}
+		lib.WriteError(w, ctx, http.StatusUnauthorized, errMissingToken)
+		return false
+	}
+
+	if err := usecase.Authorize(name, token); err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to authorize driver %q in %s: %w", name, action, err))
+			return false
+		}
+		if errors.Is(err, lib.ErrForbidden) {
+			lib.WriteError(w, ctx, http.StatusForbidden, fmt.Errorf("failed to authorize driver %q in %s: %w", name, action, err))
+			return false
+		}
+		logger.Err(err).Msgf("failed to authorize driver %q in %s", name, action)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return false
+	}
+
+	return true
+}
@@ -3,6 +3,10 @@ package controllers_test
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +17,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/ktnyt/labcon/cmd/labcon/app/controllers"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
 	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
 	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
@@ -22,6 +27,25 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+var testSummaries = []driver.Summary{
+	{
+		Name:   "foo",
+		Status: driver.Idle,
+		Info: driver.Info{
+			Labels:   map[string]string{"room": "302", "kind": "reader"},
+			Metadata: driver.Metadata{Location: "bench 3", Model: "Infinite 200", Owner: "alice"},
+		},
+	},
+	{
+		Name:   "bar",
+		Status: driver.Busy,
+		Op:     &driver.Op{Name: "shake"},
+		Info: driver.Info{
+			Labels: map[string]string{"room": "302"},
+		},
+	},
+}
+
 func TestDriverList(t *testing.T) {
 	cases := []struct {
 		label string
@@ -45,6 +69,65 @@ func TestDriverList(t *testing.T) {
 			out:  lib.MustJsonMarshalToBuffer(t, []string{"foo", "bar"}),
 		},
 
+		{
+			label: "selector",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					Summaries(models.Selector{
+						{Key: "room", Op: models.SelectorEquals, Value: "302"},
+						{Key: "kind", Op: models.SelectorNotEquals, Value: "pipettor"},
+					}).
+					Return(testSummaries, nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/driver?selector=room%3D302,kind!%3Dpipettor", nil)
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, []string{"foo", "bar"}),
+		},
+
+		{
+			label: "summary",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					Summaries(nil).
+					Return(testSummaries, nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/driver?summary=true", nil)
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, testSummaries),
+		},
+
+		{
+			label: "invalid selector",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			setup: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/driver?selector=room%3D", nil)
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "invalid label selector: invalid value in \"room=\"",
+			}),
+		},
+
+		{
+			label: "invalid summary",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			setup: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/driver?summary=maybe", nil)
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "query parameter \"summary\" must be a boolean",
+			}),
+		},
+
 		{
 			label: "internal error",
 			mock: func(usecase *usecases_mock.MockDriverUsecase) {
@@ -57,7 +140,10 @@ func TestDriverList(t *testing.T) {
 				return httptest.NewRequest(http.MethodGet, "/driver", nil)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -117,7 +203,7 @@ func TestDriverRegister(t *testing.T) {
 			label: "success",
 			mock: func(usecase *usecases_mock.MockDriverUsecase) {
 				usecase.EXPECT().
-					Register("foo", "foo").
+					Register(driver.RegisterParams{Name: "foo", State: "foo"}).
 					Return(token, nil).
 					Times(1)
 			},
@@ -148,7 +234,10 @@ func TestDriverRegister(t *testing.T) {
 				return r
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("Bad Request\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: lib.ErrContentType.Error(),
+			}),
 		},
 
 		{
@@ -165,18 +254,32 @@ func TestDriverRegister(t *testing.T) {
 				return r
 			},
 			code: http.StatusBadRequest,
-			out: bytes.NewBufferString(strings.Join([]string{
-				"validation failed on field \"name\" for constraint \"required\"",
-				"validation failed on field \"state\" for constraint \"required\"",
-				"",
-			}, "\n")),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code: "validation_failed",
+				Message: strings.Join([]string{
+					"validation failed on field \"name\" for constraint \"required\"",
+					"validation failed on field \"state\" for constraint \"required\"",
+				}, "\n"),
+				Details: []lib.FieldError{
+					{
+						Field:      "name",
+						Constraint: "required",
+						Message:    "validation failed on field \"name\" for constraint \"required\"",
+					},
+					{
+						Field:      "state",
+						Constraint: "required",
+						Message:    "validation failed on field \"state\" for constraint \"required\"",
+					},
+				},
+			}),
 		},
 
 		{
 			label: "already exists",
 			mock: func(usecase *usecases_mock.MockDriverUsecase) {
 				usecase.EXPECT().
-					Register("foo", "foo").
+					Register(driver.RegisterParams{Name: "foo", State: "foo"}).
 					Return("", lib.ErrAlreadyExists).
 					Times(1)
 			},
@@ -190,15 +293,18 @@ func TestDriverRegister(t *testing.T) {
 				r.Header.Set("Content-Type", "application/json")
 				return r
 			},
-			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("failed to register driver \"foo\": already exists\n"),
+			code: http.StatusConflict,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "already_exists",
+				Message: "failed to register driver \"foo\": already exists",
+			}),
 		},
 
 		{
 			label: "internal error",
 			mock: func(usecase *usecases_mock.MockDriverUsecase) {
 				usecase.EXPECT().
-					Register("foo", "foo").
+					Register(driver.RegisterParams{Name: "foo", State: "foo"}).
 					Return("", lib.ErrUnknown).
 					Times(1)
 			},
@@ -213,7 +319,10 @@ func TestDriverRegister(t *testing.T) {
 				return r
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -296,7 +405,10 @@ func TestDriverGetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -315,7 +427,10 @@ func TestDriverGetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to get state for driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to get state for driver \"foo\": not found",
+			}),
 		},
 
 		{
@@ -334,7 +449,10 @@ func TestDriverGetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -380,6 +498,195 @@ func TestDriverGetState(t *testing.T) {
 	}
 }
 
+func TestDriverWaitState(t *testing.T) {
+	request := func(target string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("name", "foo")
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+		return r.WithContext(ctx)
+	}
+
+	cold := map[string]interface{}{"temperature": 25}
+	warm := map[string]interface{}{"temperature": 37}
+
+	cases := []struct {
+		label    string
+		mock     func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier)
+		setup    func() *http.Request
+		draining bool
+		code     int
+		out      io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {
+				gomock.InOrder(
+					usecase.EXPECT().
+						GetState("foo").
+						DoAndReturn(func(string) (interface{}, error) {
+							notifier.Notify("foo")
+							return cold, nil
+						}).
+						Times(1),
+					usecase.EXPECT().
+						GetState("foo").
+						Return(warm, nil).
+						Times(1),
+				)
+			},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait?until=%24.temperature+%3E%3D+37&timeout=1m")
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, warm),
+		},
+
+		{
+			label: "timeout",
+			mock: func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {
+				usecase.EXPECT().
+					GetState("foo").
+					Return(cold, nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait?until=%24.ready&timeout=1ms")
+			},
+			code: http.StatusRequestTimeout,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "timeout",
+				Message: "failed to wait for driver \"foo\" until $.ready: timed out",
+			}),
+		},
+
+		{
+			label: "draining",
+			mock: func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {
+				usecase.EXPECT().
+					GetState("foo").
+					Return(cold, nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait?until=%24.temperature+%3E%3D+37")
+			},
+			draining: true,
+			code:     http.StatusServiceUnavailable,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "draining",
+				Message: "failed to wait for driver \"foo\": server is shutting down",
+			}),
+		},
+
+		{
+			label: "missing condition",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing query parameter \"until\"",
+			}),
+		},
+
+		{
+			label: "invalid condition",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait?until=temperature")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "query parameter \"until\": syntax error at 12: unknown name \"temperature\", paths start with $",
+			}),
+		},
+
+		{
+			label: "invalid timeout",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait?until=true&timeout=-1s")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "query parameter \"timeout\" must be a positive duration such as \"30s\"",
+			}),
+		},
+
+		{
+			label: "not found",
+			mock: func(usecase *usecases_mock.MockDriverUsecase, notifier *lib.Notifier) {
+				usecase.EXPECT().
+					GetState("foo").
+					Return(nil, lib.ErrNotFound).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				return request("/driver/foo/state/wait?until=true")
+			},
+			code: http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to wait for driver \"foo\": not found",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			failed := false
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			usecase := usecases_mock.NewMockDriverUsecase(ctrl)
+			inject := func(context.Context) usecases.DriverUsecase { return usecase }
+			controller := controllers.NewDriverController(inject)
+
+			notifier := lib.NewNotifier()
+			drainer := lib.NewDrainer()
+			if tt.draining {
+				drainer.Drain()
+			}
+
+			tt.mock(usecase, notifier)
+
+			w := httptest.NewRecorder()
+			r := tt.setup()
+
+			b := &strings.Builder{}
+			logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+			logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+			ctx := r.Context()
+			ctx = logger.WithContext(ctx)
+			ctx = lib.WithNotifier(ctx, notifier)
+			ctx = lib.WithDrainer(ctx, drainer)
+
+			controller.WaitState(w, r.WithContext(ctx))
+
+			if w.Code != tt.code {
+				t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, tt.code)
+				failed = true
+			}
+
+			if ops := utils.ReaderDiff(w.Body, tt.out); ops != nil {
+				t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("log output:\n%s", b.String())
+			}
+		})
+	}
+}
+
 func TestDriverSetState(t *testing.T) {
 	cases := []struct {
 		label string
@@ -413,6 +720,29 @@ func TestDriverSetState(t *testing.T) {
 			out:  bytes.NewBufferString("OK\n"),
 		},
 
+		{
+			label: "client certificate",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					SetState("foo", "bar").
+					Return(nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodPut, "/driver/foo/state", lib.MustJsonMarshalToBuffer(t, "bar"))
+				r.Header.Set("Content-Type", "application/json")
+				r.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "foo"}}}},
+				}
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			code: http.StatusOK,
+			out:  bytes.NewBufferString("OK\n"),
+		},
+
 		{
 			label: "missing URL parameter",
 			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
@@ -425,7 +755,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -440,7 +773,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusUnauthorized,
-			out:  bytes.NewBufferString("missing X-Driver-Token header\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "missing X-Driver-Token header",
+			}),
 		},
 
 		{
@@ -461,7 +797,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in set state: not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to authorize driver \"foo\" in set state: not found",
+			}),
 		},
 
 		{
@@ -482,7 +821,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusForbidden,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in set state: forbidden\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to authorize driver \"foo\" in set state: forbidden",
+			}),
 		},
 
 		{
@@ -503,7 +845,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 
 		{
@@ -523,7 +868,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("Bad Request\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: lib.ErrContentType.Error(),
+			}),
 		},
 
 		{
@@ -548,7 +896,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to set state for driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to set state for driver \"foo\": not found",
+			}),
 		},
 
 		{
@@ -573,7 +924,10 @@ func TestDriverSetState(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -656,7 +1010,10 @@ func TestDriverGetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -676,7 +1033,10 @@ func TestDriverGetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to get status for driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to get status for driver \"foo\": not found",
+			}),
 		},
 
 		{
@@ -696,7 +1056,10 @@ func TestDriverGetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -787,7 +1150,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -802,7 +1168,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusUnauthorized,
-			out:  bytes.NewBufferString("missing X-Driver-Token header\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "missing X-Driver-Token header",
+			}),
 		},
 
 		{
@@ -823,7 +1192,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in set status: not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to authorize driver \"foo\" in set status: not found",
+			}),
 		},
 
 		{
@@ -844,7 +1216,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusForbidden,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in set status: forbidden\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to authorize driver \"foo\" in set status: forbidden",
+			}),
 		},
 
 		{
@@ -865,7 +1240,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 
 		{
@@ -885,7 +1263,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("Bad Request\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: lib.ErrContentType.Error(),
+			}),
 		},
 
 		{
@@ -910,7 +1291,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to set status for driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to set status for driver \"foo\": not found",
+			}),
 		},
 
 		{
@@ -935,7 +1319,10 @@ func TestDriverSetStatus(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -1029,7 +1416,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -1043,7 +1433,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusUnauthorized,
-			out:  bytes.NewBufferString("missing X-Driver-Token header\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "missing X-Driver-Token header",
+			}),
 		},
 
 		{
@@ -1063,7 +1456,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in get operation: not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to authorize driver \"foo\" in get operation: not found",
+			}),
 		},
 
 		{
@@ -1083,7 +1479,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusForbidden,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in get operation: forbidden\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to authorize driver \"foo\" in get operation: forbidden",
+			}),
 		},
 
 		{
@@ -1103,7 +1502,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 
 		{
@@ -1127,7 +1529,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to get operation for driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to get operation for driver \"foo\": not found",
+			}),
 		},
 
 		{
@@ -1151,7 +1556,10 @@ func TestDriverOperation(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -1232,6 +1640,29 @@ func TestDriverDispatch(t *testing.T) {
 			out:  bytes.NewBufferString("OK\n"),
 		},
 
+		{
+			label: "draining",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodPost, "/driver/foo/operation", lib.MustJsonMarshalToBuffer(t, driver.Op{
+					Name: "op",
+					Arg:  "arg",
+				}))
+				r.Header.Set("Content-Type", "application/json")
+				drainer := lib.NewDrainer()
+				drainer.Drain()
+				ctx := context.WithValue(lib.WithDrainer(r.Context(), drainer), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			code: http.StatusServiceUnavailable,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "draining",
+				Message: "failed to dispatch for driver \"foo\": server is shutting down",
+			}),
+		},
+
 		{
 			label: "missing URL parameter",
 			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
@@ -1245,7 +1676,10 @@ func TestDriverDispatch(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -1263,7 +1697,10 @@ func TestDriverDispatch(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("Bad Request\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: lib.ErrContentType.Error(),
+			}),
 		},
 
 		{
@@ -1282,7 +1719,17 @@ func TestDriverDispatch(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("validation failed on field \"name\" for constraint \"required\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "validation_failed",
+				Message: "validation failed on field \"name\" for constraint \"required\"",
+				Details: []lib.FieldError{
+					{
+						Field:      "name",
+						Constraint: "required",
+						Message:    "validation failed on field \"name\" for constraint \"required\"",
+					},
+				},
+			}),
 		},
 
 		{
@@ -1309,7 +1756,39 @@ func TestDriverDispatch(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to dispatch for driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to dispatch for driver \"foo\": not found",
+			}),
+		},
+
+		{
+			label: "busy",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					SetOp("foo", driver.Op{
+						Name: "op",
+						Arg:  "arg",
+					}).
+					Return(lib.ErrBusy).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodPost, "/driver/foo/operation", lib.MustJsonMarshalToBuffer(t, driver.Op{
+					Name: "op",
+					Arg:  "arg",
+				}))
+				r.Header.Set("Content-Type", "application/json")
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			code: http.StatusConflict,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "busy",
+				Message: "failed to dispatch for driver \"foo\": busy",
+			}),
 		},
 
 		{
@@ -1336,7 +1815,10 @@ func TestDriverDispatch(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -1381,6 +1863,234 @@ func TestDriverDispatch(t *testing.T) {
 		})
 	}
 }
+
+func TestDriverCancel(t *testing.T) {
+	admin := &lib.Actor{Name: "facility", Role: lib.RoleAdmin}
+	user := &lib.Actor{Name: "bob", Role: lib.RoleUser}
+
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockDriverUsecase)
+		setup func() *http.Request
+		actor *lib.Actor
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "facility", true).
+					Return(nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: admin,
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "dispatcher",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "bob", false).
+					Return(nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: user,
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "forbidden",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "bob", false).
+					Return(fmt.Errorf("%w: the operation was dispatched with another API key", lib.ErrForbidden)).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: user,
+			code:  http.StatusForbidden,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to cancel operation for driver \"foo\": forbidden: the operation was dispatched with another API key",
+			}),
+		},
+
+		{
+			label: "anonymous",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "", false).
+					Return(nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: nil,
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "anonymous forbidden",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "", false).
+					Return(fmt.Errorf("%w: the operation was dispatched with an API key", lib.ErrForbidden)).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: nil,
+			code:  http.StatusForbidden,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to cancel operation for driver \"foo\": forbidden: the operation was dispatched with an API key",
+			}),
+		},
+
+		{
+			label: "missing URL parameter",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: admin,
+			code:  http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
+		},
+
+		{
+			label: "not found",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "facility", true).
+					Return(fmt.Errorf("%w: no operation to cancel", lib.ErrNotFound)).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: admin,
+			code:  http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to cancel operation for driver \"foo\": not found: no operation to cancel",
+			}),
+		},
+
+		{
+			label: "internal server error",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					CancelOp("foo", "facility", true).
+					Return(lib.ErrUnknown).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("name", "foo")
+				r := httptest.NewRequest(http.MethodDelete, "/driver/foo/operation", nil)
+				ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+				return r.WithContext(ctx)
+			},
+			actor: admin,
+			code:  http.StatusInternalServerError,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			failed := false
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			usecase := usecases_mock.NewMockDriverUsecase(ctrl)
+			inject := func(context.Context) usecases.DriverUsecase { return usecase }
+			controller := controllers.NewDriverController(inject)
+
+			tt.mock(usecase)
+
+			w := httptest.NewRecorder()
+			r := tt.setup()
+
+			b := &strings.Builder{}
+			logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+			logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+			ctx := r.Context()
+			ctx = logger.WithContext(ctx)
+			if tt.actor != nil {
+				ctx = lib.WithActor(ctx, *tt.actor)
+			}
+
+			controller.Cancel(w, r.WithContext(ctx))
+
+			if w.Code != tt.code {
+				t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, tt.code)
+				failed = true
+			}
+
+			if ops := utils.ReaderDiff(w.Body, tt.out); ops != nil {
+				t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("log output:\n%s", b.String())
+			}
+		})
+	}
+}
+
 func TestDriverDisconnect(t *testing.T) {
 	cases := []struct {
 		label string
@@ -1424,7 +2134,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusBadRequest,
-			out:  bytes.NewBufferString("missing URL parameter \"name\"\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
 		},
 
 		{
@@ -1438,7 +2151,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusUnauthorized,
-			out:  bytes.NewBufferString("missing X-Driver-Token header\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "missing X-Driver-Token header",
+			}),
 		},
 
 		{
@@ -1458,7 +2174,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in disconnect: not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to authorize driver \"foo\" in disconnect: not found",
+			}),
 		},
 
 		{
@@ -1478,7 +2197,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusForbidden,
-			out:  bytes.NewBufferString("failed to authorize driver \"foo\" in disconnect: forbidden\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "failed to authorize driver \"foo\" in disconnect: forbidden",
+			}),
 		},
 
 		{
@@ -1498,7 +2220,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 
 		{
@@ -1522,7 +2247,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusNotFound,
-			out:  bytes.NewBufferString("failed to disconnect driver \"foo\": not found\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to disconnect driver \"foo\": not found",
+			}),
 		},
 
 		{
@@ -1546,7 +2274,10 @@ func TestDriverDisconnect(t *testing.T) {
 				return r.WithContext(ctx)
 			},
 			code: http.StatusInternalServerError,
-			out:  bytes.NewBufferString("Internal Server Error\n"),
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
 		},
 	}
 
@@ -1591,3 +2322,138 @@ func TestDriverDisconnect(t *testing.T) {
 		})
 	}
 }
+
+func TestDriverSetInfo(t *testing.T) {
+	info := driver.Info{
+		Labels:   map[string]string{"room": "302", "kind": "reader"},
+		Metadata: driver.Metadata{Location: "bench 3", Serial: "1510003123", Owner: "alice"},
+	}
+	admin := &lib.Actor{Name: "facility", Role: lib.RoleAdmin}
+
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockDriverUsecase)
+		in    driver.Info
+		actor *lib.Actor
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					SetInfo("foo", info).
+					Return(nil).
+					Times(1)
+			},
+			in:    info,
+			actor: admin,
+			code:  http.StatusOK,
+			out:   bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "not found",
+			mock: func(usecase *usecases_mock.MockDriverUsecase) {
+				usecase.EXPECT().
+					SetInfo("foo", info).
+					Return(lib.ErrNotFound).
+					Times(1)
+			},
+			in:    info,
+			actor: admin,
+			code:  http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to set info for driver \"foo\": not found",
+			}),
+		},
+
+		{
+			label: "invalid label",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			in:    driver.Info{Labels: map[string]string{"room": "3 02"}},
+			actor: admin,
+			code:  http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "validation_failed",
+				Message: "validation failed on field \"labels[room]\" for constraint \"label\"",
+				Details: []lib.FieldError{{
+					Field:      "labels[room]",
+					Constraint: "label",
+					Message:    "validation failed on field \"labels[room]\" for constraint \"label\"",
+				}},
+			}),
+		},
+
+		{
+			label: "forbidden",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			in:    info,
+			actor: &lib.Actor{Name: "alice", Role: lib.RoleUser},
+			code:  http.StatusForbidden,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "forbidden",
+				Message: "driver labels and metadata may only be edited with admin API keys",
+			}),
+		},
+
+		{
+			label: "anonymous",
+			mock:  func(usecase *usecases_mock.MockDriverUsecase) {},
+			in:    info,
+			actor: nil,
+			code:  http.StatusUnauthorized,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "unauthorized",
+				Message: "driver labels and metadata may only be edited with admin API keys",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			failed := false
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			usecase := usecases_mock.NewMockDriverUsecase(ctrl)
+			inject := func(context.Context) usecases.DriverUsecase { return usecase }
+			controller := controllers.NewDriverController(inject)
+
+			tt.mock(usecase)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/driver/foo/info", lib.MustJsonMarshalToBuffer(t, tt.in))
+			r.Header.Set("Content-Type", "application/json")
+			r = withURLParam(r, "name", "foo")
+
+			b := &strings.Builder{}
+			logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+			logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+			ctx := r.Context()
+			ctx = logger.WithContext(ctx)
+			if tt.actor != nil {
+				ctx = lib.WithActor(ctx, *tt.actor)
+			}
+
+			controller.SetInfo(w, r.WithContext(ctx))
+
+			if w.Code != tt.code {
+				t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, tt.code)
+				failed = true
+			}
+
+			if ops := utils.ReaderDiff(w.Body, tt.out); ops != nil {
+				t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("log output:\n%s", b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+)
+
+// Health statuses.
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthReport is the response of the health endpoints. Checks maps each
+// check to "ok" or the reason it failed. Drivers counts drivers by status and
+// is only given on request.
+type HealthReport struct {
+	Status  string                `json:"status"`
+	Checks  map[string]string     `json:"checks,omitempty"`
+	Drivers map[driver.Status]int `json:"drivers,omitempty"`
+}
+
+type HealthController interface {
+	Live(w http.ResponseWriter, r *http.Request)
+	Ready(w http.ResponseWriter, r *http.Request)
+}
+
+type HealthControllerImpl struct {
+	inject       func(context.Context) usecases.HealthUsecase
+	injectDriver func(context.Context) usecases.DriverUsecase
+}
+
+func NewHealthController(inject func(context.Context) usecases.HealthUsecase, injectDriver func(context.Context) usecases.DriverUsecase) HealthController {
+	return HealthControllerImpl{inject: inject, injectDriver: injectDriver}
+}
+
+// Live reports that the server is able to handle requests at all. It does not
+// depend on the storage backend so that a slow disk does not get the server
+// restarted.
+func (controller HealthControllerImpl) Live(w http.ResponseWriter, r *http.Request) {
+	lib.WriteResponse(w, r.Context(), HealthReport{Status: HealthOK})
+}
+
+// Ready reports whether the server can serve drivers: it must not be draining
+// and the storage backend must be readable and writable. Driver counts by
+// status are included if the drivers query parameter is true.
+func (controller HealthControllerImpl) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	summary := false
+	if value := r.URL.Query().Get("drivers"); value != "" {
+		var err error
+		if summary, err = strconv.ParseBool(value); err != nil {
+			lib.WriteError(w, ctx, http.StatusBadRequest, fmt.Errorf("query parameter \"drivers\" must be a boolean: %q", value))
+			return
+		}
+	}
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	report := HealthReport{Status: HealthOK, Checks: map[string]string{}}
+	fail := func(check string, err error) {
+		report.Status = HealthUnavailable
+		report.Checks[check] = err.Error()
+	}
+
+	if lib.UseDrainer(ctx).Draining() {
+		fail("server", lib.ErrDraining)
+	} else {
+		report.Checks["server"] = HealthOK
+	}
+
+	if err := usecase.CheckStorage(); err != nil {
+		logger.Err(err).Msg("storage check failed")
+		fail("storage", err)
+	} else {
+		report.Checks["storage"] = HealthOK
+	}
+
+	if summary && report.Checks["storage"] == HealthOK {
+		drivers, err := controller.summarize(ctx)
+		if err != nil {
+			logger.Err(err).Msg("failed to summarize drivers")
+			fail("drivers", err)
+		} else {
+			report.Drivers = drivers
+		}
+	}
+
+	code := http.StatusOK
+	if report.Status != HealthOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	lib.WriteStatusResponse(w, ctx, code, report)
+}
+
+func (controller HealthControllerImpl) summarize(ctx context.Context) (map[driver.Status]int, error) {
+	// Dependency injection.
+	usecase := controller.injectDriver(ctx)
+
+	names, err := usecase.List()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[driver.Status]int{
+		driver.Idle:  0,
+		driver.Busy:  0,
+		driver.Lost:  0,
+		driver.Error: 0,
+	}
+	for _, name := range names {
+		status, err := usecase.GetStatus(name)
+		if err != nil {
+			// The driver may have disconnected since it was listed.
+			if errors.Is(err, lib.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		counts[status]++
+	}
+	return counts, nil
+}
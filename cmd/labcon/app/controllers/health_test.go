@@ -0,0 +1,221 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/controllers"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestHealthLive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	health := usecases_mock.NewMockHealthUsecase(ctrl)
+	usecase := usecases_mock.NewMockDriverUsecase(ctrl)
+	controller := controllers.NewHealthController(
+		func(context.Context) usecases.HealthUsecase { return health },
+		func(context.Context) usecases.DriverUsecase { return usecase },
+	)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	controller.Live(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, http.StatusOK)
+	}
+
+	out := lib.MustJsonMarshalToBuffer(t, controllers.HealthReport{Status: "ok"})
+	if ops := utils.ReaderDiff(w.Body, out); ops != nil {
+		t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestHealthReady(t *testing.T) {
+	cases := []struct {
+		label    string
+		mock     func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase)
+		path     string
+		draining bool
+		code     int
+		out      io.Reader
+	}{
+		{
+			label: "ready",
+			mock: func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase) {
+				health.EXPECT().
+					CheckStorage().
+					Return(nil).
+					Times(1)
+			},
+			path: "/readyz",
+			code: http.StatusOK,
+			out: lib.MustJsonMarshalToBuffer(t, controllers.HealthReport{
+				Status: "ok",
+				Checks: map[string]string{"server": "ok", "storage": "ok"},
+			}),
+		},
+
+		{
+			label: "driver summary",
+			mock: func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase) {
+				health.EXPECT().
+					CheckStorage().
+					Return(nil).
+					Times(1)
+				usecase.EXPECT().
+					List().
+					Return([]string{"foo", "bar", "baz"}, nil).
+					Times(1)
+				usecase.EXPECT().
+					GetStatus("foo").
+					Return(driver.Busy, nil).
+					Times(1)
+				usecase.EXPECT().
+					GetStatus("bar").
+					Return(driver.Busy, nil).
+					Times(1)
+				usecase.EXPECT().
+					GetStatus("baz").
+					Return(driver.Error, lib.ErrNotFound).
+					Times(1)
+			},
+			path: "/readyz?drivers=true",
+			code: http.StatusOK,
+			out: lib.MustJsonMarshalToBuffer(t, controllers.HealthReport{
+				Status:  "ok",
+				Checks:  map[string]string{"server": "ok", "storage": "ok"},
+				Drivers: map[driver.Status]int{driver.Idle: 0, driver.Busy: 2, driver.Lost: 0, driver.Error: 0},
+			}),
+		},
+
+		{
+			label: "storage failure",
+			mock: func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase) {
+				health.EXPECT().
+					CheckStorage().
+					Return(errors.New("failed to write probe: disk full")).
+					Times(1)
+			},
+			path: "/readyz?drivers=true",
+			code: http.StatusServiceUnavailable,
+			out: lib.MustJsonMarshalToBuffer(t, controllers.HealthReport{
+				Status: "unavailable",
+				Checks: map[string]string{"server": "ok", "storage": "failed to write probe: disk full"},
+			}),
+		},
+
+		{
+			label: "driver summary failure",
+			mock: func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase) {
+				health.EXPECT().
+					CheckStorage().
+					Return(nil).
+					Times(1)
+				usecase.EXPECT().
+					List().
+					Return(nil, lib.ErrUnknown).
+					Times(1)
+			},
+			path: "/readyz?drivers=1",
+			code: http.StatusServiceUnavailable,
+			out: lib.MustJsonMarshalToBuffer(t, controllers.HealthReport{
+				Status: "unavailable",
+				Checks: map[string]string{"server": "ok", "storage": "ok", "drivers": "unknown error"},
+			}),
+		},
+
+		{
+			label: "draining",
+			mock: func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase) {
+				health.EXPECT().
+					CheckStorage().
+					Return(nil).
+					Times(1)
+			},
+			path:     "/readyz",
+			draining: true,
+			code:     http.StatusServiceUnavailable,
+			out: lib.MustJsonMarshalToBuffer(t, controllers.HealthReport{
+				Status: "unavailable",
+				Checks: map[string]string{"server": "server is shutting down", "storage": "ok"},
+			}),
+		},
+
+		{
+			label: "invalid drivers parameter",
+			mock:  func(health *usecases_mock.MockHealthUsecase, usecase *usecases_mock.MockDriverUsecase) {},
+			path:  "/readyz?drivers=some",
+			code:  http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "query parameter \"drivers\" must be a boolean: \"some\"",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			failed := false
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			health := usecases_mock.NewMockHealthUsecase(ctrl)
+			usecase := usecases_mock.NewMockDriverUsecase(ctrl)
+			controller := controllers.NewHealthController(
+				func(context.Context) usecases.HealthUsecase { return health },
+				func(context.Context) usecases.DriverUsecase { return usecase },
+			)
+
+			tt.mock(health, usecase)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			b := &strings.Builder{}
+			logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+			logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+			ctx := r.Context()
+			ctx = logger.WithContext(ctx)
+
+			drainer := lib.NewDrainer()
+			if tt.draining {
+				drainer.Drain()
+			}
+			ctx = lib.WithDrainer(ctx, drainer)
+
+			controller.Ready(w, r.WithContext(ctx))
+
+			if w.Code != tt.code {
+				t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, tt.code)
+				failed = true
+			}
+
+			if ops := utils.ReaderDiff(w.Body, tt.out); ops != nil {
+				t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+				failed = true
+			}
+
+			if failed {
+				t.Errorf("log output:\n%s", b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/metrics"
+)
+
+var (
+	errMetricsDisabled = errors.New("metrics are not collected")
+)
+
+type MetricsController interface {
+	Metrics(w http.ResponseWriter, r *http.Request)
+}
+
+type MetricsControllerImpl struct {
+	inject func(context.Context) usecases.DriverUsecase
+}
+
+func NewMetricsController(inject func(context.Context) usecases.DriverUsecase) MetricsController {
+	return MetricsControllerImpl{inject: inject}
+}
+
+func (controller MetricsControllerImpl) Metrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	registry := metrics.UseRegistry(ctx)
+	if registry == nil {
+		lib.WriteError(w, ctx, http.StatusNotFound, errMetricsDisabled)
+		return
+	}
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	names, err := usecase.List()
+	if err != nil {
+		logger.Err(err).Msg("failed to list drivers")
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	samples := make([]metrics.DriverSample, 0, len(names))
+	for _, name := range names {
+		status, err := usecase.GetStatus(name)
+		if err == nil {
+			var state interface{}
+			if state, err = usecase.GetState(name); err == nil {
+				samples = append(samples, metrics.DriverSample{Name: name, Status: status, State: state})
+				continue
+			}
+		}
+
+		// The driver may have disconnected since it was listed.
+		if errors.Is(err, lib.ErrNotFound) {
+			continue
+		}
+		logger.Err(err).Msgf("failed to get driver %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := registry.Write(w, samples); err != nil {
+		logger.Err(err).Msg("failed to write metrics")
+	}
+}
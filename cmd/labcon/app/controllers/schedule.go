@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type ScheduleController interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Put(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+type ScheduleControllerImpl struct {
+	inject func(context.Context) usecases.ScheduleUsecase
+}
+
+func NewScheduleController(inject func(context.Context) usecases.ScheduleUsecase) ScheduleController {
+	return ScheduleControllerImpl{inject: inject}
+}
+
+func (controller ScheduleControllerImpl) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	schedules, err := usecase.List()
+	if err != nil {
+		logger.Err(err).Msg("failed to list schedules")
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, schedules)
+}
+
+func (controller ScheduleControllerImpl) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	schedule, err := usecase.Get(name)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get schedule %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to get schedule %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, schedule)
+}
+
+// Put creates or replaces the named schedule and responds with it as stored.
+// The name in the body, if any, is ignored, and so are the fields kept by the
+// server.
+func (controller ScheduleControllerImpl) Put(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	var schedule models.Schedule
+	if err := lib.ReadRequest(r, &schedule); err != nil {
+		logger.Warn().Err(err).Msg("failed to process request")
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+	schedule.Name = name
+
+	if err := lib.Validate(schedule); err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	schedule, err := usecase.Put(schedule)
+	if err != nil {
+		logger.Err(err).Msgf("failed to put schedule %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, schedule)
+}
+
+func (controller ScheduleControllerImpl) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	if err := usecase.Delete(name); err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to delete schedule %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to delete schedule %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.HTTPError(w, http.StatusOK)
+}
@@ -0,0 +1,249 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/controllers"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const testScheduleYAML = `
+driver: reader
+op: {name: read_od}
+cron: "*/10 0-6 * * *"
+timezone: UTC
+next: 2000-01-01T00:00:00Z
+`
+
+var testSchedule = models.Schedule{
+	Name:     "overnight",
+	Driver:   "reader",
+	Op:       driver.Op{Name: "read_od"},
+	Cron:     "*/10 0-6 * * *",
+	Timezone: "UTC",
+}
+
+// serveSchedule calls a handler of a schedule controller backed by the mock
+// and checks the response.
+func serveSchedule(t *testing.T, mock func(usecase *usecases_mock.MockScheduleUsecase), handler func(controller controllers.ScheduleController) http.HandlerFunc, r *http.Request, code int, out io.Reader) {
+	t.Helper()
+	failed := false
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usecase := usecases_mock.NewMockScheduleUsecase(ctrl)
+	inject := func(context.Context) usecases.ScheduleUsecase { return usecase }
+	controller := controllers.NewScheduleController(inject)
+
+	mock(usecase)
+
+	w := httptest.NewRecorder()
+
+	b := &strings.Builder{}
+	logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+	logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+	ctx := r.Context()
+	ctx = logger.WithContext(ctx)
+
+	handler(controller)(w, r.WithContext(ctx))
+
+	if w.Code != code {
+		t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, code)
+		failed = true
+	}
+
+	if ops := utils.ReaderDiff(w.Body, out); ops != nil {
+		t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+		failed = true
+	}
+
+	if failed {
+		t.Errorf("log output:\n%s", b.String())
+	}
+}
+
+func TestSchedulePut(t *testing.T) {
+	next := time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)
+	stored := testSchedule
+	stored.Next = &next
+
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockScheduleUsecase)
+		setup func() *http.Request
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockScheduleUsecase) {
+				usecase.EXPECT().
+					Put(gomock.Any()).
+					DoAndReturn(func(schedule models.Schedule) (models.Schedule, error) {
+						if schedule.Name != "overnight" || schedule.Cron != testSchedule.Cron {
+							t.Errorf("usecase.Put(%v), expected %v", schedule, testSchedule)
+						}
+						return stored, nil
+					}).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/schedule/overnight", strings.NewReader(testScheduleYAML))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "overnight")
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, stored),
+		},
+
+		{
+			label: "invalid cron",
+			mock:  func(usecase *usecases_mock.MockScheduleUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/schedule/overnight", strings.NewReader(`{"driver": "reader", "op": {"name": "read_od"}, "cron": "*/10 0-24 * * *"}`))
+				r.Header.Set("Content-Type", "application/json")
+				return withURLParam(r, "name", "overnight")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "cron: invalid cron expression: hour: 24 is out of range 0-23",
+			}),
+		},
+
+		{
+			label: "cron and interval",
+			mock:  func(usecase *usecases_mock.MockScheduleUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/schedule/overnight", strings.NewReader(`{"driver": "reader", "op": {"name": "read_od"}, "cron": "@daily", "every": "10m"}`))
+				r.Header.Set("Content-Type", "application/json")
+				return withURLParam(r, "name", "overnight")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "schedule must have exactly one of cron and every",
+			}),
+		},
+
+		{
+			label: "unknown timezone",
+			mock:  func(usecase *usecases_mock.MockScheduleUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/schedule/overnight", strings.NewReader(`{"driver": "reader", "op": {"name": "read_od"}, "every": "10m", "timezone": "Mars/Olympus"}`))
+				r.Header.Set("Content-Type", "application/json")
+				return withURLParam(r, "name", "overnight")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "unknown timezone \"Mars/Olympus\"",
+			}),
+		},
+
+		{
+			label: "missing URL parameter",
+			mock:  func(usecase *usecases_mock.MockScheduleUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/schedule/overnight", strings.NewReader(testScheduleYAML))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
+		},
+
+		{
+			label: "internal server error",
+			mock: func(usecase *usecases_mock.MockScheduleUsecase) {
+				usecase.EXPECT().
+					Put(gomock.Any()).
+					Return(models.Schedule{}, lib.ErrUnknown).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/schedule/overnight", strings.NewReader(testScheduleYAML))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "overnight")
+			},
+			code: http.StatusInternalServerError,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			serveSchedule(t, tt.mock, func(controller controllers.ScheduleController) http.HandlerFunc {
+				return controller.Put
+			}, tt.setup(), tt.code, tt.out)
+		})
+	}
+}
+
+func TestScheduleDelete(t *testing.T) {
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockScheduleUsecase)
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockScheduleUsecase) {
+				usecase.EXPECT().
+					Delete("overnight").
+					Return(nil).
+					Times(1)
+			},
+			code: http.StatusOK,
+			out:  bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "not found",
+			mock: func(usecase *usecases_mock.MockScheduleUsecase) {
+				usecase.EXPECT().
+					Delete("overnight").
+					Return(lib.ErrNotFound).
+					Times(1)
+			},
+			code: http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to delete schedule \"overnight\": not found",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			r := withURLParam(httptest.NewRequest(http.MethodDelete, "/schedule/overnight", nil), "name", "overnight")
+			serveSchedule(t, tt.mock, func(controller controllers.ScheduleController) http.HandlerFunc {
+				return controller.Delete
+			}, r, tt.code, tt.out)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+var (
+	errMissingID = errors.New("missing URL parameter \"id\"")
+)
+
+type WorkflowController interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Put(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+	Start(w http.ResponseWriter, r *http.Request)
+	ListRuns(w http.ResponseWriter, r *http.Request)
+	GetRun(w http.ResponseWriter, r *http.Request)
+	Pause(w http.ResponseWriter, r *http.Request)
+	Resume(w http.ResponseWriter, r *http.Request)
+	Abort(w http.ResponseWriter, r *http.Request)
+}
+
+type WorkflowControllerImpl struct {
+	inject func(context.Context) usecases.WorkflowUsecase
+}
+
+func NewWorkflowController(inject func(context.Context) usecases.WorkflowUsecase) WorkflowController {
+	return WorkflowControllerImpl{inject: inject}
+}
+
+func (controller WorkflowControllerImpl) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	list, err := usecase.List()
+	if err != nil {
+		logger.Err(err).Msg("failed to list workflows")
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, list)
+}
+
+func (controller WorkflowControllerImpl) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	workflow, err := usecase.Get(name)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get workflow %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to get workflow %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, workflow)
+}
+
+// Put creates or replaces the named workflow. The name in the body, if any,
+// is ignored.
+func (controller WorkflowControllerImpl) Put(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	var workflow models.Workflow
+	if err := lib.ReadRequest(r, &workflow); err != nil {
+		logger.Warn().Err(err).Msg("failed to process request")
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+	workflow.Name = name
+
+	if err := lib.Validate(workflow); err != nil {
+		lib.WriteError(w, ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := usecase.Put(workflow); err != nil {
+		logger.Err(err).Msgf("failed to put workflow %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.HTTPError(w, http.StatusOK)
+}
+
+func (controller WorkflowControllerImpl) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	if err := usecase.Delete(name); err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to delete workflow %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to delete workflow %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.HTTPError(w, http.StatusOK)
+}
+
+func (controller WorkflowControllerImpl) Start(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingName)
+		return
+	}
+
+	if lib.UseDrainer(ctx).Draining() {
+		lib.WriteError(w, ctx, http.StatusServiceUnavailable, fmt.Errorf("failed to start workflow %q: %w", name, lib.ErrDraining))
+		return
+	}
+
+	run, err := usecase.Start(name)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to start workflow %q: %w", name, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to start workflow %q", name)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, run)
+}
+
+func (controller WorkflowControllerImpl) ListRuns(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	runs, err := usecase.ListRuns()
+	if err != nil {
+		logger.Err(err).Msg("failed to list runs")
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, runs)
+}
+
+func (controller WorkflowControllerImpl) GetRun(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingID)
+		return
+	}
+
+	run, err := usecase.GetRun(id)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to get run %s: %w", id, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to get run %s", id)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, run)
+}
+
+func (controller WorkflowControllerImpl) Pause(w http.ResponseWriter, r *http.Request) {
+	controller.control(w, r, "pause", func(usecase usecases.WorkflowUsecase, id string) (models.RunModel, error) {
+		return usecase.Pause(id)
+	})
+}
+
+func (controller WorkflowControllerImpl) Resume(w http.ResponseWriter, r *http.Request) {
+	controller.control(w, r, "resume", func(usecase usecases.WorkflowUsecase, id string) (models.RunModel, error) {
+		return usecase.Resume(id)
+	})
+}
+
+func (controller WorkflowControllerImpl) Abort(w http.ResponseWriter, r *http.Request) {
+	controller.control(w, r, "abort", func(usecase usecases.WorkflowUsecase, id string) (models.RunModel, error) {
+		return usecase.Abort(id)
+	})
+}
+
+// control applies an action to the run with the ID in the URL and writes the
+// run it leaves.
+func (controller WorkflowControllerImpl) control(w http.ResponseWriter, r *http.Request, action string, f func(usecase usecases.WorkflowUsecase, id string) (models.RunModel, error)) {
+	ctx := r.Context()
+	logger := lib.UseLogger(ctx)
+
+	// Dependency injection.
+	usecase := controller.inject(ctx)
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		lib.WriteError(w, ctx, http.StatusBadRequest, errMissingID)
+		return
+	}
+
+	run, err := f(usecase, id)
+	if err != nil {
+		if errors.Is(err, lib.ErrNotFound) {
+			lib.WriteError(w, ctx, http.StatusNotFound, fmt.Errorf("failed to %s run %s: %w", action, id, err))
+			return
+		}
+		if errors.Is(err, usecases.ErrRunStatus) {
+			lib.WriteError(w, ctx, http.StatusConflict, fmt.Errorf("failed to %s run %s: %w", action, id, err))
+			return
+		}
+		logger.Err(err).Msgf("failed to %s run %s", action, id)
+		lib.WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	lib.WriteResponse(w, ctx, run)
+}
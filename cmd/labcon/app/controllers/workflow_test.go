@@ -0,0 +1,371 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/controllers"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const testWorkflowYAML = `
+description: read a plate
+steps:
+  - dispatch: {driver: reader, op: {name: read}}
+  - delay: 30m
+`
+
+var testWorkflow = func() models.Workflow {
+	delay := models.Duration(30 * time.Minute)
+	return models.Workflow{
+		Name:        "assay",
+		Description: "read a plate",
+		Steps: []models.Step{
+			{Dispatch: &models.DispatchStep{Driver: "reader", Op: driver.Op{Name: "read"}}},
+			{Delay: &delay},
+		},
+	}
+}()
+
+var testRun = models.RunModel{
+	ID:         "1",
+	Workflow:   "assay",
+	Definition: testWorkflow,
+	Status:     models.RunRunning,
+	Created:    time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC),
+	Updated:    time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC),
+}
+
+// serveWorkflow calls a handler of a workflow controller backed by the mock
+// and checks the response.
+func serveWorkflow(t *testing.T, mock func(usecase *usecases_mock.MockWorkflowUsecase), handler func(controller controllers.WorkflowController) http.HandlerFunc, r *http.Request, code int, out io.Reader) {
+	t.Helper()
+	failed := false
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usecase := usecases_mock.NewMockWorkflowUsecase(ctrl)
+	inject := func(context.Context) usecases.WorkflowUsecase { return usecase }
+	controller := controllers.NewWorkflowController(inject)
+
+	mock(usecase)
+
+	w := httptest.NewRecorder()
+
+	b := &strings.Builder{}
+	logout := zerolog.ConsoleWriter{Out: b, TimeFormat: time.RFC3339}
+	logger := log.Output(logout).Level(zerolog.TraceLevel)
+
+	ctx := r.Context()
+	ctx = logger.WithContext(ctx)
+
+	handler(controller)(w, r.WithContext(ctx))
+
+	if w.Code != code {
+		t.Errorf("%s %s got %d: expected %d", r.Method, r.RequestURI, w.Code, code)
+		failed = true
+	}
+
+	if ops := utils.ReaderDiff(w.Body, out); ops != nil {
+		t.Errorf("%s %s response body:\n%s", r.Method, r.RequestURI, utils.JoinOps(ops, "\n"))
+		failed = true
+	}
+
+	if failed {
+		t.Errorf("log output:\n%s", b.String())
+	}
+}
+
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	if value != "" {
+		rctx.URLParams.Add(key, value)
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestWorkflowPut(t *testing.T) {
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockWorkflowUsecase)
+		setup func() *http.Request
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Put(testWorkflow).
+					Return(nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/workflow/assay", strings.NewReader(testWorkflowYAML))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "assay")
+			},
+			code: http.StatusOK,
+			out:  bytes.NewBufferString("OK\n"),
+		},
+
+		{
+			label: "invalid step",
+			mock:  func(usecase *usecases_mock.MockWorkflowUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/workflow/assay", strings.NewReader("steps: [{delay: 1m, wait: {driver: foo, until: $.ready}}]"))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "assay")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "steps[0]: step must have exactly one of dispatch, wait, delay and loop",
+			}),
+		},
+
+		{
+			label: "invalid condition",
+			mock:  func(usecase *usecases_mock.MockWorkflowUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/workflow/assay", strings.NewReader(`{"steps": [{"loop": {"count": 2, "steps": [{"wait": {"driver": "foo", "until": "$.ready =="}}]}}]}`))
+				r.Header.Set("Content-Type", "application/json")
+				return withURLParam(r, "name", "assay")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "steps[0].loop.steps[0]: syntax error at 11: unexpected end of expression",
+			}),
+		},
+
+		{
+			label: "missing URL parameter",
+			mock:  func(usecase *usecases_mock.MockWorkflowUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/workflow/assay", strings.NewReader(testWorkflowYAML))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"name\"",
+			}),
+		},
+
+		{
+			label: "internal server error",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Put(testWorkflow).
+					Return(lib.ErrUnknown).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPut, "/workflow/assay", strings.NewReader(testWorkflowYAML))
+				r.Header.Set("Content-Type", "application/yaml")
+				return withURLParam(r, "name", "assay")
+			},
+			code: http.StatusInternalServerError,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "internal_server_error",
+				Message: "Internal Server Error",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			serveWorkflow(t, tt.mock, func(controller controllers.WorkflowController) http.HandlerFunc {
+				return controller.Put
+			}, tt.setup(), tt.code, tt.out)
+		})
+	}
+}
+
+func TestWorkflowStart(t *testing.T) {
+	cases := []struct {
+		label string
+		mock  func(usecase *usecases_mock.MockWorkflowUsecase)
+		setup func() *http.Request
+		code  int
+		out   io.Reader
+	}{
+		{
+			label: "success",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Start("assay").
+					Return(testRun, nil).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/workflow/assay/run", nil)
+				return withURLParam(r, "name", "assay")
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, testRun),
+		},
+
+		{
+			label: "draining",
+			mock:  func(usecase *usecases_mock.MockWorkflowUsecase) {},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/workflow/assay/run", nil)
+				drainer := lib.NewDrainer()
+				drainer.Drain()
+				return withURLParam(r.WithContext(lib.WithDrainer(r.Context(), drainer)), "name", "assay")
+			},
+			code: http.StatusServiceUnavailable,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "draining",
+				Message: "failed to start workflow \"assay\": server is shutting down",
+			}),
+		},
+
+		{
+			label: "not found",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Start("assay").
+					Return(models.RunModel{}, lib.ErrNotFound).
+					Times(1)
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/workflow/assay/run", nil)
+				return withURLParam(r, "name", "assay")
+			},
+			code: http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to start workflow \"assay\": not found",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			serveWorkflow(t, tt.mock, func(controller controllers.WorkflowController) http.HandlerFunc {
+				return controller.Start
+			}, tt.setup(), tt.code, tt.out)
+		})
+	}
+}
+
+func TestWorkflowControl(t *testing.T) {
+	paused := testRun
+	paused.Status = models.RunPaused
+
+	cases := []struct {
+		label   string
+		mock    func(usecase *usecases_mock.MockWorkflowUsecase)
+		handler func(controller controllers.WorkflowController) http.HandlerFunc
+		setup   func() *http.Request
+		code    int
+		out     io.Reader
+	}{
+		{
+			label: "pause",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Pause("1").
+					Return(paused, nil).
+					Times(1)
+			},
+			handler: func(controller controllers.WorkflowController) http.HandlerFunc {
+				return controller.Pause
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/run/1/pause", nil)
+				return withURLParam(r, "id", "1")
+			},
+			code: http.StatusOK,
+			out:  lib.MustJsonMarshalToBuffer(t, paused),
+		},
+
+		{
+			label: "resume conflict",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Resume("1").
+					Return(testRun, fmt.Errorf("%w: run 1 is running", usecases.ErrRunStatus)).
+					Times(1)
+			},
+			handler: func(controller controllers.WorkflowController) http.HandlerFunc {
+				return controller.Resume
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/run/1/resume", nil)
+				return withURLParam(r, "id", "1")
+			},
+			code: http.StatusConflict,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "conflict",
+				Message: "failed to resume run 1: run cannot do this in its current status: run 1 is running",
+			}),
+		},
+
+		{
+			label: "abort not found",
+			mock: func(usecase *usecases_mock.MockWorkflowUsecase) {
+				usecase.EXPECT().
+					Abort("2").
+					Return(models.RunModel{}, lib.ErrNotFound).
+					Times(1)
+			},
+			handler: func(controller controllers.WorkflowController) http.HandlerFunc {
+				return controller.Abort
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/run/2/abort", nil)
+				return withURLParam(r, "id", "2")
+			},
+			code: http.StatusNotFound,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "not_found",
+				Message: "failed to abort run 2: not found",
+			}),
+		},
+
+		{
+			label: "missing URL parameter",
+			mock:  func(usecase *usecases_mock.MockWorkflowUsecase) {},
+			handler: func(controller controllers.WorkflowController) http.HandlerFunc {
+				return controller.GetRun
+			},
+			setup: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/run/", nil)
+				return withURLParam(r, "id", "")
+			},
+			code: http.StatusBadRequest,
+			out: lib.MustJsonMarshalToBuffer(t, lib.ErrorResponse{
+				Code:    "bad_request",
+				Message: "missing URL parameter \"id\"",
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			serveWorkflow(t, tt.mock, tt.handler, tt.setup(), tt.code, tt.out)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package injectors
+
+import (
+	"context"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type AuditInjector func(ctx context.Context) usecases.AuditUsecase
+
+func Audit(ctx context.Context) usecases.AuditUsecase {
+	repository := repositories.NewAuditRepository(lib.UseBadger(ctx))
+	usecase := usecases.NewAuditUsecase(repository)
+	return usecase
+}
+
+// actor returns the audit identity of the API key of the request, or an empty
+// string if the request was not authenticated with one.
+func actor(ctx context.Context) string {
+	if actor, ok := lib.UseActor(ctx); ok {
+		return "key:" + actor.Name
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package injectors
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type BookingInjector func(ctx context.Context) usecases.BookingUsecase
+
+func Booking(ctx context.Context) usecases.BookingUsecase {
+	usecase := usecases.NewBookingUsecase(
+		repositories.NewBookingRepository(lib.UseBadger(ctx)),
+		usecases.WithBookingClock(func() time.Time { return lib.UseTime(ctx) }),
+	)
+	return usecase
+}
+
+// holder returns the name of the API key of the request, which bookings are
+// held by, or an empty string if the request was not authenticated with one.
+func holder(ctx context.Context) string {
+	if actor, ok := lib.UseActor(ctx); ok {
+		return actor.Name
+	}
+	return ""
+}
@@ -2,17 +2,34 @@ package injectors
 
 import (
 	"context"
+	"time"
 
 	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
 	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/metrics"
 )
 
 type DriverInjector func(ctx context.Context) usecases.DriverUsecase
 
 func Driver(ctx context.Context) usecases.DriverUsecase {
+	db := lib.UseBadger(ctx)
 	generate := lib.UseDriverTokenGenerator(ctx)
-	repository := repositories.NewDriverRepository(lib.UseBadger(ctx))
-	usecase := usecases.NewDriverUsecase(repository, generate)
+	repository := repositories.NewDriverRepository(db)
+	opts := []usecases.DriverUsecaseOption{
+		usecases.WithClock(func() time.Time { return lib.UseTime(ctx) }),
+		usecases.WithLease(lib.UseDriverLease(ctx)),
+		usecases.WithAudit(actor(ctx)),
+		usecases.WithBookings(repositories.NewBookingRepository(db), holder(ctx)),
+		usecases.WithDispatcher(holder(ctx)),
+		usecases.WithOrigin(lib.UseOrigin(ctx)),
+	}
+	if registry := metrics.UseRegistry(ctx); registry != nil {
+		opts = append(opts, usecases.WithObserver(registry))
+	}
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		opts = append(opts, usecases.WithNotifier(notifier))
+	}
+	usecase := usecases.NewDriverUsecase(repository, generate, opts...)
 	return usecase
 }
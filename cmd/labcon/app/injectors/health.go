@@ -0,0 +1,17 @@
+package injectors
+
+import (
+	"context"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type HealthInjector func(ctx context.Context) usecases.HealthUsecase
+
+func Health(ctx context.Context) usecases.HealthUsecase {
+	repository := repositories.NewHealthRepository(lib.UseBadger(ctx))
+	usecase := usecases.NewHealthUsecase(repository)
+	return usecase
+}
@@ -0,0 +1,27 @@
+package injectors
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type ScheduleInjector func(ctx context.Context) usecases.ScheduleUsecase
+
+func Schedule(ctx context.Context) usecases.ScheduleUsecase {
+	opts := []usecases.ScheduleUsecaseOption{
+		usecases.WithScheduleClock(func() time.Time { return lib.UseTime(ctx) }),
+		usecases.WithScheduleOwner(holder(ctx)),
+	}
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		opts = append(opts, usecases.WithScheduleNotifier(notifier))
+	}
+	usecase := usecases.NewScheduleUsecase(
+		repositories.NewScheduleRepository(lib.UseBadger(ctx)),
+		opts...,
+	)
+	return usecase
+}
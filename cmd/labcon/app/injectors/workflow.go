@@ -0,0 +1,30 @@
+package injectors
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type WorkflowInjector func(ctx context.Context) usecases.WorkflowUsecase
+
+func Workflow(ctx context.Context) usecases.WorkflowUsecase {
+	db := lib.UseBadger(ctx)
+	opts := []usecases.WorkflowUsecaseOption{
+		usecases.WithWorkflowClock(func() time.Time { return lib.UseTime(ctx) }),
+		usecases.WithRunOwner(holder(ctx)),
+	}
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		opts = append(opts, usecases.WithRunNotifier(notifier))
+	}
+	usecase := usecases.NewWorkflowUsecase(
+		repositories.NewWorkflowRepository(db),
+		repositories.NewRunRepository(db),
+		Driver(ctx),
+		opts...,
+	)
+	return usecase
+}
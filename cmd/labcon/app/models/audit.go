@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ktnyt/labcon/driver"
+)
+
+type AuditAction string
+
+const (
+	AuditRegister   AuditAction = "register"
+	AuditDispatch   AuditAction = "dispatch"
+	AuditStatus     AuditAction = "status"
+	AuditCancel     AuditAction = "cancel"
+	AuditDisconnect AuditAction = "disconnect"
+	AuditInfo       AuditAction = "info"
+)
+
+// AuditEntry records an action taken on a driver. For status changes, Op is
+// the operation that the driver completed, if any, and Status its outcome.
+type AuditEntry struct {
+	ID     string        `json:"id" msgpack:"-"`
+	Time   time.Time     `json:"time"`
+	Actor  string        `json:"actor"`
+	Action AuditAction   `json:"action"`
+	Driver string        `json:"driver"`
+	Op     *driver.Op    `json:"op,omitempty" msgpack:",omitempty"`
+	Status driver.Status `json:"status,omitempty" msgpack:",omitempty"`
+}
+
+// AuditQuery selects audit entries. Empty fields match any entry.
+type AuditQuery struct {
+	Driver string
+	Actor  string
+	Action AuditAction
+
+	// Since and Until select entries in the half-open interval [Since, Until).
+	Since time.Time
+	Until time.Time
+
+	// Limit is the maximum number of entries, or zero for no limit.
+	Limit int
+}
+
+// Match reports whether the entry is selected by the query.
+func (query AuditQuery) Match(entry AuditEntry) bool {
+	switch {
+	case query.Driver != "" && entry.Driver != query.Driver:
+		return false
+	case query.Actor != "" && entry.Actor != query.Actor:
+		return false
+	case query.Action != "" && entry.Action != query.Action:
+		return false
+	case !query.Since.IsZero() && entry.Time.Before(query.Since):
+		return false
+	case !query.Until.IsZero() && !entry.Time.Before(query.Until):
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrBookingRange    = errors.New("booking must end after it starts")
+	ErrBookingPast     = errors.New("booking must end in the future")
+	ErrBookingConflict = errors.New("driver is already booked")
+)
+
+// Booking reserves a driver for the holder of an API key from Start until
+// End. Only the holder, and the workflow runs and schedules it owns, may
+// dispatch operations to the driver during the booking.
+type Booking struct {
+	ID      string    `json:"id" msgpack:"-"`
+	Driver  string    `json:"driver" msgpack:"-"`
+	Holder  string    `json:"holder"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Note    string    `json:"note,omitempty" msgpack:",omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func (booking Booking) Validate() error {
+	if !booking.End.After(booking.Start) {
+		return ErrBookingRange
+	}
+	return nil
+}
+
+// Overlaps reports whether the booking overlaps the half-open interval
+// [start, end).
+func (booking Booking) Overlaps(start, end time.Time) bool {
+	return booking.Start.Before(end) && start.Before(booking.End)
+}
+
+// Active reports whether the booking holds at t.
+func (booking Booking) Active(t time.Time) bool {
+	return !t.Before(booking.Start) && t.Before(booking.End)
+}
+
+func (booking Booking) String() string {
+	return fmt.Sprintf("booking %s of driver %q by %q from %s to %s", booking.ID, booking.Driver, booking.Holder, booking.Start.Format(time.RFC3339), booking.End.Format(time.RFC3339))
+}
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/ktnyt/labcon/driver"
+import (
+	"time"
+
+	"github.com/ktnyt/labcon/driver"
+)
 
 type DriverModel struct {
 	Name   string `msgpack:"-"`
@@ -8,6 +12,32 @@ type DriverModel struct {
 	State  interface{}
 	Status driver.Status
 	Op     *driver.Op `msgpack:",omitempty"`
+
+	// Labels and Metadata describe the driver for people. They are given
+	// when the driver registers, and may be edited by admins.
+	Labels   map[string]string `msgpack:",omitempty"`
+	Metadata driver.Metadata   `msgpack:",omitempty"`
+
+	// Seen is when the driver last contacted the server. It is only recorded
+	// if drivers are leased.
+	Seen time.Time `msgpack:",omitempty"`
+
+	// Dispatched is when the current operation was dispatched. It is only
+	// recorded if operations are observed.
+	Dispatched time.Time `msgpack:",omitempty"`
+
+	// Dispatcher is the name of the API key that dispatched the current
+	// operation, or empty if it was dispatched without one.
+	Dispatcher string `msgpack:",omitempty"`
+
+	// Origin is the workflow run or schedule that dispatched the current
+	// operation, e.g. "run/12", or empty if it was dispatched by a request.
+	Origin string `msgpack:",omitempty"`
+}
+
+// Info returns the labels and metadata of the driver.
+func (model DriverModel) Info() driver.Info {
+	return driver.Info{Labels: model.Labels, Metadata: model.Metadata}
 }
 
 func NewDriver(name, token string, state interface{}) DriverModel {
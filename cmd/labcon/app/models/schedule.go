@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/cron"
+	"github.com/ktnyt/labcon/driver"
+)
+
+var (
+	ErrScheduleKind    = errors.New("schedule must have exactly one of cron and every")
+	ErrInterval        = errors.New("every must be at least a second")
+	ErrUnknownTimezone = errors.New("unknown timezone")
+)
+
+// MaxFirings is the number of most recent firings kept with a schedule.
+const MaxFirings = 100
+
+// Schedule dispatches an operation to a driver at the times given by either a
+// cron expression, as described in package cron, or an interval. Cron
+// expressions are evaluated in Timezone, or the local time of the server if it
+// is empty, and intervals are counted from when the schedule is put. Disabled
+// schedules do not fire until they are enabled again.
+//
+// Owner, Next and Firings are kept by the server: Owner is the name of the API
+// key that put the schedule, on whose behalf its operations are dispatched,
+// Next is when the schedule fires next, and Firings the most recent firings,
+// oldest first.
+type Schedule struct {
+	Name     string    `json:"name" msgpack:"-"`
+	Driver   string    `json:"driver"`
+	Op       driver.Op `json:"op"`
+	Cron     string    `json:"cron,omitempty" msgpack:",omitempty"`
+	Every    Duration  `json:"every,omitempty" msgpack:",omitempty"`
+	Timezone string    `json:"timezone,omitempty" msgpack:",omitempty"`
+	Disabled bool      `json:"disabled,omitempty" msgpack:",omitempty"`
+
+	Owner   string     `json:"owner,omitempty" msgpack:",omitempty"`
+	Next    *time.Time `json:"next,omitempty" msgpack:",omitempty"`
+	Firings []Firing   `json:"firings,omitempty" msgpack:",omitempty"`
+}
+
+type FiringResult string
+
+const (
+	FiringDispatched FiringResult = "dispatched"
+	FiringSkipped    FiringResult = "skipped"
+	FiringFailed     FiringResult = "failed"
+)
+
+// Firing records when a schedule was due and what became of it. A firing is
+// skipped if the driver is missing, not ready for the operation or booked, or
+// if the server was not running when it was due, and failed if the operation
+// could not be dispatched otherwise. Reason explains skips and failures.
+type Firing struct {
+	Due    time.Time    `json:"due"`
+	Time   time.Time    `json:"time"`
+	Result FiringResult `json:"result"`
+	Reason string       `json:"reason,omitempty" msgpack:",omitempty"`
+}
+
+func (schedule Schedule) Validate() error {
+	if schedule.Driver == "" {
+		return ErrMissingDriver
+	}
+	if schedule.Op.Name == "" {
+		return ErrMissingOp
+	}
+	if (schedule.Cron == "") == (schedule.Every == 0) {
+		return ErrScheduleKind
+	}
+	if schedule.Cron != "" {
+		if _, err := cron.Parse(schedule.Cron); err != nil {
+			return fmt.Errorf("cron: %w", err)
+		}
+	}
+	if schedule.Every != 0 && time.Duration(schedule.Every) < time.Second {
+		return ErrInterval
+	}
+	if _, err := schedule.location(); err != nil {
+		return fmt.Errorf("%w %q", ErrUnknownTimezone, schedule.Timezone)
+	}
+	return nil
+}
+
+func (schedule Schedule) location() (*time.Location, error) {
+	if schedule.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(schedule.Timezone)
+}
+
+// NextAfter returns the first time after t at which the schedule fires, or
+// nil if it never does. Intervals are counted from the given time.
+func (schedule Schedule) NextAfter(t time.Time) *time.Time {
+	if schedule.Every > 0 {
+		next := t.Add(time.Duration(schedule.Every))
+		return &next
+	}
+	c, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil
+	}
+	loc, err := schedule.location()
+	if err != nil {
+		return nil
+	}
+	next := c.Next(t.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+	next = next.In(t.Location())
+	return &next
+}
+
+// Record appends a firing, dropping the oldest firings beyond MaxFirings.
+func (schedule *Schedule) Record(firing Firing) {
+	schedule.Firings = append(schedule.Firings, firing)
+	if n := len(schedule.Firings) - MaxFirings; n > 0 {
+		schedule.Firings = append([]Firing(nil), schedule.Firings[n:]...)
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+var ErrSelectorSyntax = errors.New("invalid label selector")
+
+type SelectorOp string
+
+const (
+	SelectorEquals    SelectorOp = "="
+	SelectorNotEquals SelectorOp = "!="
+	SelectorExists    SelectorOp = "exists"
+	SelectorNotExists SelectorOp = "!exists"
+)
+
+// Requirement is a requirement on a label of a driver.
+type Requirement struct {
+	Key   string
+	Op    SelectorOp
+	Value string
+}
+
+// Matches reports whether the labels meet the requirement.
+func (req Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[req.Key]
+	switch req.Op {
+	case SelectorEquals:
+		return ok && value == req.Value
+	case SelectorNotEquals:
+		return !ok || value != req.Value
+	case SelectorExists:
+		return ok
+	case SelectorNotExists:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// Selector selects drivers by their labels. A driver is selected if its labels
+// meet every requirement, so the empty selector selects every driver.
+type Selector []Requirement
+
+// ParseSelector parses a comma separated list of requirements, each of which
+// is one of "key=value", "key!=value", "key" for a label to be present and
+// "!key" for a label to be absent, e.g. "room=302,kind!=pipettor".
+func ParseSelector(s string) (Selector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var selector Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var req Requirement
+		switch {
+		case strings.Contains(term, "!="):
+			i := strings.Index(term, "!=")
+			req = Requirement{Key: term[:i], Op: SelectorNotEquals, Value: term[i+2:]}
+		case strings.Contains(term, "="):
+			i := strings.Index(term, "=")
+			req = Requirement{Key: term[:i], Op: SelectorEquals, Value: term[i+1:]}
+		case strings.HasPrefix(term, "!"):
+			req = Requirement{Key: term[1:], Op: SelectorNotExists}
+		default:
+			req = Requirement{Key: term, Op: SelectorExists}
+		}
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+		if !lib.ValidLabel(req.Key) {
+			return nil, fmt.Errorf("%w: invalid key in %q", ErrSelectorSyntax, term)
+		}
+		if (req.Op == SelectorEquals || req.Op == SelectorNotEquals) && !lib.ValidLabel(req.Value) {
+			return nil, fmt.Errorf("%w: invalid value in %q", ErrSelectorSyntax, term)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// Matches reports whether the labels meet every requirement of the selector.
+func (selector Selector) Matches(labels map[string]string) bool {
+	for _, req := range selector {
+		if !req.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
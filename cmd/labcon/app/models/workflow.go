@@ -0,0 +1,243 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/expr"
+	"github.com/ktnyt/labcon/driver"
+)
+
+var (
+	ErrNoSteps          = errors.New("workflow has no steps")
+	ErrStepKind         = errors.New("step must have exactly one of dispatch, wait, delay and loop")
+	ErrMissingDriver    = errors.New("step has no driver")
+	ErrMissingOp        = errors.New("dispatch step has no operation name")
+	ErrMissingCondition = errors.New("wait step has no condition")
+	ErrLoopCount        = errors.New("loop count must be positive")
+	ErrNegativeDuration = errors.New("duration must not be negative")
+)
+
+// Duration is a time.Duration written as a string such as "30m" in JSON and
+// YAML.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Workflow is a sequence of steps run one after another.
+type Workflow struct {
+	Name        string `json:"name" msgpack:"-"`
+	Description string `json:"description,omitempty" msgpack:",omitempty"`
+	Steps       []Step `json:"steps"`
+}
+
+// Step is one of a dispatch, a wait, a delay or a loop. Name is an optional
+// label for the step.
+type Step struct {
+	Name     string        `json:"name,omitempty" msgpack:",omitempty"`
+	Dispatch *DispatchStep `json:"dispatch,omitempty" msgpack:",omitempty"`
+	Wait     *WaitStep     `json:"wait,omitempty" msgpack:",omitempty"`
+	Delay    *Duration     `json:"delay,omitempty" msgpack:",omitempty"`
+	Loop     *LoopStep     `json:"loop,omitempty" msgpack:",omitempty"`
+}
+
+// DispatchStep dispatches an operation to a driver, waiting until the driver
+// is idle to do so, and then waits for the driver to complete it unless NoWait
+// is set. The run fails if the driver completes it with an error.
+type DispatchStep struct {
+	Driver string    `json:"driver"`
+	Op     driver.Op `json:"op"`
+	NoWait bool      `json:"no_wait,omitempty" msgpack:",omitempty"`
+}
+
+// WaitStep waits until the condition holds for the state of a driver. The run
+// fails if the condition does not hold within Timeout, unless it is zero.
+// Conditions are written as described in package expr.
+type WaitStep struct {
+	Driver  string   `json:"driver"`
+	Until   string   `json:"until"`
+	Timeout Duration `json:"timeout,omitempty" msgpack:",omitempty"`
+}
+
+// LoopStep runs its steps Count times.
+type LoopStep struct {
+	Count int    `json:"count"`
+	Steps []Step `json:"steps"`
+}
+
+func (workflow Workflow) Validate() error {
+	return validateSteps(workflow.Steps, "steps")
+}
+
+func validateSteps(steps []Step, path string) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("%s: %w", path, ErrNoSteps)
+	}
+	for i, step := range steps {
+		if err := step.validate(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (step Step) validate(path string) error {
+	kinds := 0
+	for _, set := range []bool{step.Dispatch != nil, step.Wait != nil, step.Delay != nil, step.Loop != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("%s: %w", path, ErrStepKind)
+	}
+
+	switch {
+	case step.Dispatch != nil:
+		if step.Dispatch.Driver == "" {
+			return fmt.Errorf("%s: %w", path, ErrMissingDriver)
+		}
+		if step.Dispatch.Op.Name == "" {
+			return fmt.Errorf("%s: %w", path, ErrMissingOp)
+		}
+	case step.Wait != nil:
+		if step.Wait.Driver == "" {
+			return fmt.Errorf("%s: %w", path, ErrMissingDriver)
+		}
+		if step.Wait.Until == "" {
+			return fmt.Errorf("%s: %w", path, ErrMissingCondition)
+		}
+		if _, err := expr.Parse(step.Wait.Until); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if step.Wait.Timeout < 0 {
+			return fmt.Errorf("%s: timeout: %w", path, ErrNegativeDuration)
+		}
+	case step.Delay != nil:
+		if *step.Delay < 0 {
+			return fmt.Errorf("%s: delay: %w", path, ErrNegativeDuration)
+		}
+	case step.Loop != nil:
+		if step.Loop.Count < 1 {
+			return fmt.Errorf("%s: %w", path, ErrLoopCount)
+		}
+		return validateSteps(step.Loop.Steps, path+".loop.steps")
+	}
+	return nil
+}
+
+// Instruction is a step of a compiled workflow. A loop compiles to its steps
+// followed by an instruction for the loop itself, which jumps Back to the
+// first of them.
+type Instruction struct {
+	Step Step
+	Back int
+}
+
+// Compile flattens the steps of the workflow into instructions, so that the
+// progress of a run is an index into them.
+func (workflow Workflow) Compile() []Instruction {
+	return compile(nil, workflow.Steps)
+}
+
+func compile(program []Instruction, steps []Step) []Instruction {
+	for _, step := range steps {
+		if step.Loop != nil {
+			back := len(program)
+			program = compile(program, step.Loop.Steps)
+			program = append(program, Instruction{Step: step, Back: back})
+			continue
+		}
+		program = append(program, Instruction{Step: step})
+	}
+	return program
+}
+
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunPaused    RunStatus = "paused"
+	RunCompleted RunStatus = "completed"
+	RunFailed    RunStatus = "failed"
+	RunAborted   RunStatus = "aborted"
+)
+
+// Done reports whether a run with the status has finished for good.
+func (status RunStatus) Done() bool {
+	return status == RunCompleted || status == RunFailed || status == RunAborted
+}
+
+// RunModel is the progress of a run of a workflow. The run keeps a copy of
+// the workflow as it was when the run started.
+type RunModel struct {
+	ID         string    `json:"id" msgpack:"-"`
+	Workflow   string    `json:"workflow"`
+	Definition Workflow  `json:"definition"`
+	Status     RunStatus `json:"status"`
+
+	// Owner is the name of the API key that started the run, on whose behalf
+	// its operations are dispatched, or empty if it was started without one.
+	Owner string `json:"owner,omitempty" msgpack:",omitempty"`
+
+	// PC is the index of the current instruction of the compiled workflow,
+	// and Counters the number of iterations completed by the loops in
+	// progress, by the index of their instructions.
+	PC       int         `json:"pc"`
+	Counters map[int]int `json:"counters,omitempty" msgpack:",omitempty"`
+
+	// Dispatching is set while the operation of the current dispatch step is
+	// being dispatched, which is done outside of the updates of the run so
+	// that retried updates never dispatch it twice. Dispatched is set once
+	// the operation has been dispatched.
+	Dispatching bool `json:"dispatching,omitempty" msgpack:",omitempty"`
+	Dispatched  bool `json:"dispatched,omitempty" msgpack:",omitempty"`
+
+	// Deadline is when the current delay or wait step times out. It is set
+	// when the step starts, and replaced by the time Remaining while the run
+	// is paused.
+	Deadline  *time.Time `json:"deadline,omitempty" msgpack:",omitempty"`
+	Remaining *Duration  `json:"remaining,omitempty" msgpack:",omitempty"`
+
+	Error    string     `json:"error,omitempty" msgpack:",omitempty"`
+	Created  time.Time  `json:"created"`
+	Updated  time.Time  `json:"updated"`
+	Finished *time.Time `json:"finished,omitempty" msgpack:",omitempty"`
+}
+
+func NewRun(workflow Workflow, now time.Time) RunModel {
+	return RunModel{
+		Workflow:   workflow.Name,
+		Definition: workflow,
+		Status:     RunRunning,
+		Created:    now,
+		Updated:    now,
+	}
+}
+
+// Current returns the current instruction, or false if the run is past the
+// last one.
+func (run RunModel) Current() (Instruction, bool) {
+	program := run.Definition.Compile()
+	if run.PC < 0 || run.PC >= len(program) {
+		return Instruction{}, false
+	}
+	return program[run.PC], true
+}
@@ -0,0 +1,8 @@
+package repositories
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type AuditRepository interface {
+	Append(entry models.AuditEntry) (models.AuditEntry, error)
+	Each(query models.AuditQuery, f func(entry models.AuditEntry) error) error
+}
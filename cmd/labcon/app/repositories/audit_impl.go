@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/vmihailenco/msgpack"
+)
+
+// maxAppendAttempts bounds the retries of appends that conflict with
+// concurrent appends.
+const maxAppendAttempts = 10
+
+// AuditRepositoryImpl stores audit entries under keys ordered by time. There
+// is no way to update or delete entries.
+type AuditRepositoryImpl struct {
+	db *badger.DB
+}
+
+func NewAuditRepository(db *badger.DB) AuditRepository {
+	return AuditRepositoryImpl{
+		db: db,
+	}
+}
+
+func auditKey(id string) []byte {
+	return []byte(fmt.Sprintf("audit/%s", id))
+}
+
+func (repo AuditRepositoryImpl) Key(id string) []byte {
+	return auditKey(id)
+}
+
+// appendAudit stores the entry in the transaction and returns its ID, which is
+// derived from its time so that entries are listed in chronological order.
+func appendAudit(txn *badger.Txn, entry models.AuditEntry) (string, error) {
+	val, err := msgpack.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	for seq := 0; ; seq++ {
+		id := fmt.Sprintf("%020d-%04d", entry.Time.UnixNano(), seq)
+		key := auditKey(id)
+		if _, err := txn.Get(key); err == nil {
+			continue
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return "", err
+		}
+		return id, txn.Set(key, val)
+	}
+}
+
+// Append stores the entry and returns it with its ID.
+func (repo AuditRepositoryImpl) Append(entry models.AuditEntry) (models.AuditEntry, error) {
+	for attempt := 1; ; attempt++ {
+		err := repo.db.Update(func(txn *badger.Txn) error {
+			id, err := appendAudit(txn, entry)
+			entry.ID = id
+			return err
+		})
+		if !errors.Is(err, badger.ErrConflict) || attempt >= maxAppendAttempts {
+			return entry, err
+		}
+	}
+}
+
+// Each calls f with the entries selected by the query in chronological order
+// until f returns an error.
+func (repo AuditRepositoryImpl) Each(query models.AuditQuery, f func(entry models.AuditEntry) error) error {
+	return repo.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("audit/")
+		start := prefix
+		if !query.Since.IsZero() {
+			start = repo.Key(fmt.Sprintf("%020d", query.Since.UnixNano()))
+		}
+
+		count := 0
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			entry := models.AuditEntry{ID: strings.TrimPrefix(string(item.Key()), string(prefix))}
+			if err := item.Value(func(val []byte) error {
+				return msgpack.Unmarshal(val, &entry)
+			}); err != nil {
+				return err
+			}
+
+			if !query.Until.IsZero() && !entry.Time.Before(query.Until) {
+				return nil
+			}
+			if !query.Match(entry) {
+				continue
+			}
+			if err := f(entry); err != nil {
+				return err
+			}
+			if count++; query.Limit > 0 && count >= query.Limit {
+				return nil
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package repositories_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+func TestAuditEach(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewAuditRepository(db)
+
+	base := time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC)
+	fixtures := []models.AuditEntry{
+		{Time: base, Actor: "driver:foo", Action: models.AuditRegister, Driver: "foo"},
+		{Time: base.Add(time.Minute), Actor: "key:alice", Action: models.AuditDispatch, Driver: "foo", Op: &driver.Op{Name: "spin"}},
+		// Entries at the same time must keep the order of appends.
+		{Time: base.Add(time.Minute), Actor: "driver:bar", Action: models.AuditRegister, Driver: "bar"},
+		{Time: base.Add(2 * time.Minute), Actor: "driver:foo", Action: models.AuditStatus, Driver: "foo", Op: &driver.Op{Name: "spin"}, Status: driver.Idle},
+		{Time: base.Add(3 * time.Minute), Actor: "key:bob", Action: models.AuditDisconnect, Driver: "bar"},
+	}
+
+	entries := make([]models.AuditEntry, len(fixtures))
+	for i, entry := range fixtures {
+		if entries[i], err = repo.Append(entry); err != nil {
+			t.Fatalf("failed to append audit entry in fixture: %v", err)
+		}
+		if entries[i].ID == "" {
+			t.Fatalf("appended audit entry %d has no ID", i)
+		}
+	}
+
+	cases := []struct {
+		query models.AuditQuery
+		out   []models.AuditEntry
+	}{
+		{
+			query: models.AuditQuery{},
+			out:   entries,
+		},
+		{
+			query: models.AuditQuery{Driver: "foo"},
+			out:   []models.AuditEntry{entries[0], entries[1], entries[3]},
+		},
+		{
+			query: models.AuditQuery{Actor: "key:alice"},
+			out:   []models.AuditEntry{entries[1]},
+		},
+		{
+			query: models.AuditQuery{Action: models.AuditRegister},
+			out:   []models.AuditEntry{entries[0], entries[2]},
+		},
+		{
+			query: models.AuditQuery{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)},
+			out:   []models.AuditEntry{entries[1], entries[2], entries[3]},
+		},
+		{
+			query: models.AuditQuery{Driver: "foo", Limit: 2},
+			out:   []models.AuditEntry{entries[0], entries[1]},
+		},
+		{
+			query: models.AuditQuery{Driver: "baz"},
+			out:   []models.AuditEntry{},
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			out := []models.AuditEntry{}
+			err := repo.Each(tt.query, func(entry models.AuditEntry) error {
+				out = append(out, entry)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("%T.Each(%v): %v", repo, tt.query, err)
+			}
+			if ops := utils.ObjDiff(tt.out, out); ops != nil {
+				t.Errorf("%T.Each(%v):\n%s", repo, tt.query, utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+}
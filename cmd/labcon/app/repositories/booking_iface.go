@@ -0,0 +1,10 @@
+package repositories
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type BookingRepository interface {
+	List(driver string) ([]models.Booking, error)
+	Create(booking models.Booking) (models.Booking, error)
+	Fetch(driver, id string) (models.Booking, error)
+	Delete(driver, id string) error
+}
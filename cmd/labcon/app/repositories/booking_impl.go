@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/vmihailenco/msgpack"
+)
+
+// bookingSeqKey holds the ID of the last booking created. Every creation
+// writes it, so that concurrent creations conflict and are checked for
+// overlaps one after another.
+var bookingSeqKey = []byte("seq/booking")
+
+// BookingRepositoryImpl stores bookings by driver under sequential IDs.
+type BookingRepositoryImpl struct {
+	db *badger.DB
+}
+
+func NewBookingRepository(db *badger.DB) BookingRepository {
+	return BookingRepositoryImpl{
+		db: db,
+	}
+}
+
+func (repo BookingRepositoryImpl) Prefix(driver string) []byte {
+	return []byte(fmt.Sprintf("booking/%s/", driver))
+}
+
+func (repo BookingRepositoryImpl) Key(driver, id string) []byte {
+	return []byte(fmt.Sprintf("booking/%s/%s", driver, id))
+}
+
+// List returns the bookings of the driver in the order they start.
+func (repo BookingRepositoryImpl) List(driver string) ([]models.Booking, error) {
+	var bookings []models.Booking
+	err := repo.db.View(func(txn *badger.Txn) error {
+		var err error
+		bookings, err = repo.list(txn, driver)
+		return err
+	})
+	return bookings, err
+}
+
+// Create stores the booking and returns it with its ID. It fails with
+// models.ErrBookingConflict if the booking overlaps another booking of the
+// driver.
+func (repo BookingRepositoryImpl) Create(booking models.Booking) (models.Booking, error) {
+	val, err := msgpack.Marshal(booking)
+	if err != nil {
+		return booking, err
+	}
+
+	err = repo.retry(func(txn *badger.Txn) error {
+		bookings, err := repo.list(txn, booking.Driver)
+		if err != nil {
+			return err
+		}
+		for _, other := range bookings {
+			if other.Overlaps(booking.Start, booking.End) {
+				return fmt.Errorf("%w: %s", models.ErrBookingConflict, other)
+			}
+		}
+
+		var seq uint64
+		item, err := txn.Get(bookingSeqKey)
+		switch {
+		case err == nil:
+			if err := item.Value(func(val []byte) error {
+				seq, err = strconv.ParseUint(string(val), 10, 64)
+				return err
+			}); err != nil {
+				return err
+			}
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return err
+		}
+
+		booking.ID = strconv.FormatUint(seq+1, 10)
+		if err := txn.Set(bookingSeqKey, []byte(booking.ID)); err != nil {
+			return err
+		}
+		return txn.Set(repo.Key(booking.Driver, booking.ID), val)
+	})
+	return booking, err
+}
+
+func (repo BookingRepositoryImpl) Fetch(driver, id string) (models.Booking, error) {
+	booking := models.Booking{ID: id, Driver: driver}
+	err := repo.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(repo.Key(driver, id))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return msgpack.Unmarshal(val, &booking)
+		})
+	})
+	return booking, err
+}
+
+func (repo BookingRepositoryImpl) Delete(driver, id string) error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		key := repo.Key(driver, id)
+		if _, err := txn.Get(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+func (repo BookingRepositoryImpl) list(txn *badger.Txn, driver string) ([]models.Booking, error) {
+	bookings := []models.Booking{}
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := repo.Prefix(driver)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		booking := models.Booking{
+			ID:     strings.TrimPrefix(string(item.Key()), string(prefix)),
+			Driver: driver,
+		}
+		if err := item.Value(func(val []byte) error {
+			return msgpack.Unmarshal(val, &booking)
+		}); err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].Start.Before(bookings[j].Start)
+	})
+	return bookings, nil
+}
+
+// retry runs the transaction again if it conflicts with another.
+func (repo BookingRepositoryImpl) retry(f func(txn *badger.Txn) error) error {
+	for attempt := 1; ; attempt++ {
+		err := repo.db.Update(f)
+		if !errors.Is(err, badger.ErrConflict) || attempt >= maxUpdateAttempts {
+			return err
+		}
+	}
+}
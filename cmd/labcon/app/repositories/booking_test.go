@@ -0,0 +1,83 @@
+package repositories_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestBooking(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewBookingRepository(db)
+
+	at := func(hour int) time.Time {
+		return time.Date(2022, 4, 1, hour, 0, 0, 0, time.UTC)
+	}
+	book := func(driver, holder string, start, end int) (models.Booking, error) {
+		return repo.Create(models.Booking{Driver: driver, Holder: holder, Start: at(start), End: at(end)})
+	}
+
+	for i, tt := range []struct {
+		driver     string
+		start, end int
+		id         string
+	}{
+		{"confocal", 13, 15, "1"},
+		{"confocal", 9, 11, "2"},
+		{"confocal", 11, 13, "3"},
+		{"sequencer", 9, 17, "4"},
+	} {
+		booking, err := book(tt.driver, "alice", tt.start, tt.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if booking.ID != tt.id {
+			t.Errorf("booking %d has ID %q, expected %q", i, booking.ID, tt.id)
+		}
+	}
+
+	// The conflicting booking is named.
+	_, err = book("confocal", "bob", 14, 16)
+	if !errors.Is(err, models.ErrBookingConflict) {
+		t.Fatalf("%T.Create(booking) = (_, %v), expected %v", repo, err, models.ErrBookingConflict)
+	}
+	if expected := "driver is already booked: booking 1 of driver \"confocal\" by \"alice\" from 2022-04-01T13:00:00Z to 2022-04-01T15:00:00Z"; err.Error() != expected {
+		t.Errorf("%T.Create(booking) = (_, %q), expected %q", repo, err, expected)
+	}
+
+	bookings, err := repo.List("confocal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 3 || bookings[0].ID != "2" || bookings[1].ID != "3" || bookings[2].ID != "1" {
+		t.Errorf("%T.List(%q) returned bookings out of order: %v", repo, "confocal", bookings)
+	}
+
+	booking, err := repo.Fetch("confocal", "1")
+	if err != nil || booking.Driver != "confocal" || booking.Holder != "alice" || !booking.Start.Equal(at(13)) {
+		t.Errorf("%T.Fetch(%q, %q) = (%v, %v)", repo, "confocal", "1", booking, err)
+	}
+	if _, err := repo.Fetch("sequencer", "1"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Fetch(%q, %q) = (_, %v), expected %v", repo, "sequencer", "1", err, lib.ErrNotFound)
+	}
+
+	if err := repo.Delete("confocal", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("confocal", "1"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Delete(%q, %q) = %v, expected %v", repo, "confocal", "1", err, lib.ErrNotFound)
+	}
+	if _, err := book("confocal", "bob", 14, 16); err != nil {
+		t.Errorf("%T.Create(booking) after cancellation = (_, %v)", repo, err)
+	}
+}
@@ -2,10 +2,13 @@ package repositories
 
 import "github.com/ktnyt/labcon/cmd/labcon/app/models"
 
+// DriverRepository stores drivers. The audit entries given with a change are
+// appended to the audit log in the same transaction as the change.
 type DriverRepository interface {
 	List() ([]string, error)
-	Create(name, token string, state interface{}) error
+	Create(driver models.DriverModel, audit ...models.AuditEntry) error
 	Fetch(name string) (models.DriverModel, error)
-	Update(driver models.DriverModel) error
-	Delete(name string) error
+	Update(driver models.DriverModel, audit ...models.AuditEntry) error
+	Modify(name string, f func(driver *models.DriverModel) error, audit ...*models.AuditEntry) (models.DriverModel, error)
+	Delete(name string, audit ...models.AuditEntry) error
 }
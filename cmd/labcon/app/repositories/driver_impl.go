@@ -43,9 +43,9 @@ func (repo DriverRepositoryImpl) Key(name string) []byte {
 	return []byte(fmt.Sprintf("driver/%s", name))
 }
 
-func (repo DriverRepositoryImpl) Create(name string, token string, state interface{}) error {
-	return repo.db.Update(func(txn *badger.Txn) error {
-		key := repo.Key(name)
+func (repo DriverRepositoryImpl) Create(driver models.DriverModel, audit ...models.AuditEntry) error {
+	return repo.retry(func(txn *badger.Txn) error {
+		key := repo.Key(driver.Name)
 		_, err := txn.Get(key)
 		if !errors.Is(err, badger.ErrKeyNotFound) {
 			if err == nil {
@@ -53,12 +53,14 @@ func (repo DriverRepositoryImpl) Create(name string, token string, state interfa
 			}
 			return err
 		}
-		driver := models.NewDriver(name, token, state)
 		val, err := msgpack.Marshal(driver)
 		if err != nil {
 			return err
 		}
-		return txn.Set(key, val)
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+		return appendAudits(txn, audit)
 	})
 }
 
@@ -80,18 +82,64 @@ func (repo DriverRepositoryImpl) Fetch(name string) (models.DriverModel, error)
 	return driver, err
 }
 
-func (repo DriverRepositoryImpl) Update(driver models.DriverModel) error {
-	return repo.db.Update(func(txn *badger.Txn) error {
+func (repo DriverRepositoryImpl) Update(driver models.DriverModel, audit ...models.AuditEntry) error {
+	return repo.retry(func(txn *badger.Txn) error {
+		val, err := msgpack.Marshal(driver)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(repo.Key(driver.Name), val); err != nil {
+			return err
+		}
+		return appendAudits(txn, audit)
+	})
+}
+
+// Modify reads the driver, applies f to it and stores the result in a single
+// transaction, together with the audit entries. The entries are appended once
+// f returns, so that f may fill them in from the driver read. Nothing is stored if f returns an error, which is then
+// returned. lib.ErrNotFound is returned if there is no such driver, so that
+// drivers deleted concurrently are not stored again.
+func (repo DriverRepositoryImpl) Modify(name string, f func(driver *models.DriverModel) error, audit ...*models.AuditEntry) (models.DriverModel, error) {
+	var driver models.DriverModel
+	err := repo.retry(func(txn *badger.Txn) error {
+		key := repo.Key(name)
+		item, err := txn.Get(key)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		driver = models.DriverModel{Name: name}
+		if err := item.Value(func(val []byte) error {
+			return msgpack.Unmarshal(val, &driver)
+		}); err != nil {
+			return err
+		}
+
+		if err := f(&driver); err != nil {
+			return err
+		}
 		val, err := msgpack.Marshal(driver)
 		if err != nil {
 			return err
 		}
-		return txn.Set(repo.Key(driver.Name), val)
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+		for _, entry := range audit {
+			if _, err := appendAudit(txn, *entry); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	return driver, err
 }
 
-func (repo DriverRepositoryImpl) Delete(name string) error {
-	return repo.db.Update(func(txn *badger.Txn) error {
+func (repo DriverRepositoryImpl) Delete(name string, audit ...models.AuditEntry) error {
+	return repo.retry(func(txn *badger.Txn) error {
 		key := repo.Key(name)
 		if _, err := txn.Get(key); err != nil {
 			if errors.Is(err, badger.ErrKeyNotFound) {
@@ -99,10 +147,33 @@ func (repo DriverRepositoryImpl) Delete(name string) error {
 			}
 			return err
 		}
-		err := txn.Delete(key)
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return lib.ErrNotFound
+		if err := txn.Delete(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
 		}
-		return err
+		return appendAudits(txn, audit)
 	})
 }
+
+// retry runs the transaction again if it conflicts with another, e.g. when
+// the driver it modifies or the audit entries appended in it are written
+// concurrently.
+func (repo DriverRepositoryImpl) retry(f func(txn *badger.Txn) error) error {
+	for attempt := 1; ; attempt++ {
+		err := repo.db.Update(f)
+		if !errors.Is(err, badger.ErrConflict) || attempt >= maxAppendAttempts {
+			return err
+		}
+	}
+}
+
+func appendAudits(txn *badger.Txn, audit []models.AuditEntry) error {
+	for _, entry := range audit {
+		if _, err := appendAudit(txn, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
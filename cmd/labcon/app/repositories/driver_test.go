@@ -2,12 +2,15 @@ package repositories_test
 
 import (
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/ktnyt/labcon/cmd/labcon/app/models"
 	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
 	"github.com/ktnyt/labcon/utils"
 )
 
@@ -48,9 +51,9 @@ func TestDriverCreate(t *testing.T) {
 
 	for i, tt := range cases {
 		lib.RunCase(t, i, func(t *testing.T) {
-			err := repo.Create(tt.name, tt.token, tt.state)
+			err := repo.Create(models.NewDriver(tt.name, tt.token, tt.state))
 			if !errors.Is(err, tt.err) {
-				t.Errorf("%T.Create(%q, token, state): %v, expected %v", repo, tt.name, err, tt.err)
+				t.Errorf("%T.Create(driver %q): %v, expected %v", repo, tt.name, err, tt.err)
 			}
 		})
 	}
@@ -66,10 +69,10 @@ func TestDriverList(t *testing.T) {
 	repo := repositories.NewDriverRepository(db)
 
 	token := lib.Base32String(lib.NewToken(20))
-	if err := repo.Create("foo", token, "foo"); err != nil {
+	if err := repo.Create(models.NewDriver("foo", token, "foo")); err != nil {
 		t.Fatalf("failed to create driver in fixture: %v", err)
 	}
-	if err := repo.Create("bar", token, "bar"); err != nil {
+	if err := repo.Create(models.NewDriver("bar", token, "bar")); err != nil {
 		t.Fatalf("failed to create driver in fixture: %v", err)
 	}
 
@@ -108,7 +111,10 @@ func TestDriverFetch(t *testing.T) {
 	repo := repositories.NewDriverRepository(db)
 
 	token := lib.Base32String(lib.NewToken(20))
-	if err := repo.Create("foo", token, "foo"); err != nil {
+	model := models.NewDriver("foo", token, "foo")
+	model.Labels = map[string]string{"room": "302", "kind": "pipettor"}
+	model.Metadata = driver.Metadata{Location: "bench 3", Owner: "alice"}
+	if err := repo.Create(model); err != nil {
 		t.Fatalf("failed to create driver in fixture: %v", err)
 	}
 
@@ -117,7 +123,7 @@ func TestDriverFetch(t *testing.T) {
 		err error
 	}{
 		{
-			out: models.NewDriver("foo", token, "foo"),
+			out: model,
 			err: nil,
 		},
 		{
@@ -152,7 +158,7 @@ func TestDriverUpdate(t *testing.T) {
 	repo := repositories.NewDriverRepository(db)
 
 	token := lib.Base32String(lib.NewToken(20))
-	if err := repo.Create("foo", token, "foo"); err != nil {
+	if err := repo.Create(models.NewDriver("foo", token, "foo")); err != nil {
 		t.Fatalf("failed to create driver in fixture")
 	}
 
@@ -193,6 +199,110 @@ func TestDriverUpdate(t *testing.T) {
 	}
 }
 
+func TestDriverModify(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewDriverRepository(db)
+	audit := repositories.NewAuditRepository(db)
+
+	token := lib.Base32String(lib.NewToken(20))
+	if err := repo.Create(models.NewDriver("foo", token, 0)); err != nil {
+		t.Fatalf("failed to create driver in fixture: %v", err)
+	}
+
+	// Concurrent modifications are applied one after another. Each conflict
+	// means that another modification was stored, so fewer modifications than
+	// attempts always succeed.
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Modify("foo", func(driver *models.DriverModel) error {
+				driver.State = toInt(driver.State) + 1
+				return nil
+			}); err != nil {
+				t.Errorf("%T.Modify(%q, f): %v", repo, "foo", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	model, err := repo.Fetch("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toInt(model.State) != n {
+		t.Errorf("state = %v after %d concurrent modifications", model.State, n)
+	}
+
+	// Nothing is stored if f fails.
+	if _, err := repo.Modify("foo", func(driver *models.DriverModel) error {
+		driver.State = -1
+		return lib.ErrBusy
+	}, &models.AuditEntry{Action: models.AuditDispatch, Driver: "foo"}); !errors.Is(err, lib.ErrBusy) {
+		t.Errorf("%T.Modify(%q, f, entry): %v, expected %v", repo, "foo", err, lib.ErrBusy)
+	}
+	if model, _ := repo.Fetch("foo"); toInt(model.State) != n {
+		t.Errorf("state = %v after a failed modification", model.State)
+	}
+
+	// Entries are filled in from the driver read.
+	op := &driver.Op{Name: "spin"}
+	entry := &models.AuditEntry{Action: models.AuditCancel, Driver: "foo"}
+	if _, err := repo.Modify("foo", func(driver *models.DriverModel) error {
+		driver.Op = op
+		entry.Op = driver.Op
+		return nil
+	}, entry); err != nil {
+		t.Fatal(err)
+	}
+	entries := []models.AuditEntry{}
+	if err := audit.Each(models.AuditQuery{}, func(entry models.AuditEntry) error {
+		entry.ID = ""
+		entries = append(entries, entry)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(entries, []models.AuditEntry{*entry}); ops != nil {
+		t.Errorf("audit entries:\n%s", utils.JoinOps(ops, "\n"))
+	}
+
+	// Deleted drivers are not stored again.
+	if err := repo.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Modify("foo", func(driver *models.DriverModel) error { return nil }); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Modify(%q, f): %v, expected %v", repo, "foo", err, lib.ErrNotFound)
+	}
+	if _, err := repo.Fetch("foo"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Fetch(%q): %v, expected %v", repo, "foo", err, lib.ErrNotFound)
+	}
+}
+
+// toInt converts a number decoded from msgpack to an int.
+func toInt(v interface{}) int {
+	switch v := v.(type) {
+	case int8:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
 func TestDriverDelete(t *testing.T) {
 	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
 	db, err := badger.Open(opts)
@@ -203,7 +313,7 @@ func TestDriverDelete(t *testing.T) {
 	repo := repositories.NewDriverRepository(db)
 
 	token := lib.Base32String(lib.NewToken(20))
-	if err := repo.Create("foo", token, "foo"); err != nil {
+	if err := repo.Create(models.NewDriver("foo", token, "foo")); err != nil {
 		t.Fatalf("failed to create driver in fixture")
 	}
 
@@ -238,3 +348,57 @@ func TestDriverDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDriverAudit(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewDriverRepository(db)
+	audit := repositories.NewAuditRepository(db)
+
+	base := time.Date(2022, 4, 1, 9, 0, 0, 0, time.UTC)
+	register := models.AuditEntry{Time: base, Actor: "driver:foo", Action: models.AuditRegister, Driver: "foo"}
+	dispatch := models.AuditEntry{Time: base.Add(time.Minute), Actor: "key:alice", Action: models.AuditDispatch, Driver: "foo", Op: &driver.Op{Name: "spin"}}
+	disconnect := models.AuditEntry{Time: base.Add(2 * time.Minute), Actor: "driver:foo", Action: models.AuditDisconnect, Driver: "foo"}
+
+	token := lib.Base32String(lib.NewToken(20))
+	model := models.NewDriver("foo", token, "foo")
+	if err := repo.Create(model, register); err != nil {
+		t.Fatalf("%T.Create(driver %q, entry): %v", repo, "foo", err)
+	}
+	model.Status, model.Op = driver.Busy, dispatch.Op
+	if err := repo.Update(model, dispatch); err != nil {
+		t.Fatalf("%T.Update(driver %q, entry): %v", repo, "foo", err)
+	}
+	if err := repo.Delete("foo", disconnect); err != nil {
+		t.Fatalf("%T.Delete(%q, entry): %v", repo, "foo", err)
+	}
+
+	// Entries of failed changes are not appended.
+	if err := repo.Create(models.NewDriver("bar", token, "bar")); err != nil {
+		t.Fatalf("failed to create driver in fixture: %v", err)
+	}
+	if err := repo.Create(models.NewDriver("bar", token, "bar"), register); !errors.Is(err, lib.ErrAlreadyExists) {
+		t.Errorf("%T.Create(driver %q, entry): %v, expected %v", repo, "bar", err, lib.ErrAlreadyExists)
+	}
+	if err := repo.Delete("foo", disconnect); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Delete(%q, entry): %v, expected %v", repo, "foo", err, lib.ErrNotFound)
+	}
+
+	out := []models.AuditEntry{}
+	if err := audit.Each(models.AuditQuery{}, func(entry models.AuditEntry) error {
+		entry.ID = ""
+		out = append(out, entry)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []models.AuditEntry{register, dispatch, disconnect}
+	if ops := utils.ObjDiff(out, expected); ops != nil {
+		t.Errorf("audit entries:\n%s", utils.JoinOps(ops, "\n"))
+	}
+}
@@ -0,0 +1,5 @@
+package repositories
+
+type HealthRepository interface {
+	Probe() error
+}
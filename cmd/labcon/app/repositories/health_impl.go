@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+var errProbeMismatch = errors.New("probe read back a different value")
+
+type HealthRepositoryImpl struct {
+	db *badger.DB
+}
+
+func NewHealthRepository(db *badger.DB) HealthRepository {
+	return HealthRepositoryImpl{
+		db: db,
+	}
+}
+
+// Probe writes a random value, reads it back in a separate transaction and
+// deletes it. Each probe uses its own key so that concurrent probes do not
+// interfere.
+func (repo HealthRepositoryImpl) Probe() error {
+	token := lib.Base32String(lib.NewToken(10))
+	key := []byte(fmt.Sprintf("health/%s", token))
+	val := []byte(token)
+
+	if err := repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, val)
+	}); err != nil {
+		return fmt.Errorf("failed to write probe: %w", err)
+	}
+
+	if err := repo.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(p []byte) error {
+			if !bytes.Equal(p, val) {
+				return errProbeMismatch
+			}
+			return nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to read probe: %w", err)
+	}
+
+	if err := repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	}); err != nil {
+		return fmt.Errorf("failed to delete probe: %w", err)
+	}
+
+	return nil
+}
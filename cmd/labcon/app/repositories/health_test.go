@@ -0,0 +1,42 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+)
+
+func TestHealthProbe(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	repo := repositories.NewHealthRepository(db)
+
+	if err := repo.Probe(); err != nil {
+		t.Errorf("%T.Probe(): %v", repo, err)
+	}
+
+	// Probes must not leave keys behind.
+	if err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte("health/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			t.Errorf("probe left key %q", it.Item().Key())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Probe(); err == nil {
+		t.Errorf("%T.Probe() on a closed database: nil, expected an error", repo)
+	}
+}
@@ -0,0 +1,10 @@
+package repositories
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type RunRepository interface {
+	List() ([]models.RunModel, error)
+	Create(run models.RunModel) (models.RunModel, error)
+	Fetch(id string) (models.RunModel, error)
+	Update(id string, f func(run *models.RunModel) error) (models.RunModel, error)
+}
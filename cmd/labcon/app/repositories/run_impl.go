@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/vmihailenco/msgpack"
+)
+
+// maxUpdateAttempts bounds the retries of run updates that conflict with
+// concurrent updates.
+const maxUpdateAttempts = 10
+
+// runSeqKey holds the ID of the last run created.
+var runSeqKey = []byte("seq/run")
+
+// RunRepositoryImpl stores runs under sequential IDs.
+type RunRepositoryImpl struct {
+	db *badger.DB
+}
+
+func NewRunRepository(db *badger.DB) RunRepository {
+	return RunRepositoryImpl{
+		db: db,
+	}
+}
+
+func (repo RunRepositoryImpl) Key(id string) []byte {
+	return []byte(fmt.Sprintf("run/%s", id))
+}
+
+// List returns every run in the order they were created.
+func (repo RunRepositoryImpl) List() ([]models.RunModel, error) {
+	runs := []models.RunModel{}
+	err := repo.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("run/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			run := models.RunModel{ID: strings.TrimPrefix(string(item.Key()), string(prefix))}
+			if err := item.Value(func(val []byte) error {
+				return msgpack.Unmarshal(val, &run)
+			}); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+		}
+		return nil
+	})
+
+	// Keys are ordered as strings, so "10" comes before "9".
+	sort.SliceStable(runs, func(i, j int) bool {
+		a, _ := strconv.ParseUint(runs[i].ID, 10, 64)
+		b, _ := strconv.ParseUint(runs[j].ID, 10, 64)
+		return a < b
+	})
+	return runs, err
+}
+
+// Create stores the run and returns it with its ID.
+func (repo RunRepositoryImpl) Create(run models.RunModel) (models.RunModel, error) {
+	val, err := msgpack.Marshal(run)
+	if err != nil {
+		return run, err
+	}
+
+	err = repo.retry(func(txn *badger.Txn) error {
+		var seq uint64
+		item, err := txn.Get(runSeqKey)
+		switch {
+		case err == nil:
+			if err := item.Value(func(val []byte) error {
+				seq, err = strconv.ParseUint(string(val), 10, 64)
+				return err
+			}); err != nil {
+				return err
+			}
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return err
+		}
+
+		run.ID = strconv.FormatUint(seq+1, 10)
+		if err := txn.Set(runSeqKey, []byte(run.ID)); err != nil {
+			return err
+		}
+		return txn.Set(repo.Key(run.ID), val)
+	})
+	return run, err
+}
+
+func (repo RunRepositoryImpl) Fetch(id string) (models.RunModel, error) {
+	var run models.RunModel
+	err := repo.db.View(func(txn *badger.Txn) error {
+		var err error
+		run, err = repo.get(txn, id)
+		return err
+	})
+	return run, err
+}
+
+// Update reads the run, applies f to it and stores the result atomically. The
+// run is left untouched if f returns an error, which is then returned.
+func (repo RunRepositoryImpl) Update(id string, f func(run *models.RunModel) error) (models.RunModel, error) {
+	var run models.RunModel
+	err := repo.retry(func(txn *badger.Txn) error {
+		var err error
+		run, err = repo.get(txn, id)
+		if err != nil {
+			return err
+		}
+		if err := f(&run); err != nil {
+			return err
+		}
+		val, err := msgpack.Marshal(run)
+		if err != nil {
+			return err
+		}
+		return txn.Set(repo.Key(id), val)
+	})
+	return run, err
+}
+
+func (repo RunRepositoryImpl) get(txn *badger.Txn, id string) (models.RunModel, error) {
+	run := models.RunModel{ID: id}
+	item, err := txn.Get(repo.Key(id))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return run, lib.ErrNotFound
+		}
+		return run, err
+	}
+	err = item.Value(func(val []byte) error {
+		return msgpack.Unmarshal(val, &run)
+	})
+	return run, err
+}
+
+// retry runs the transaction again if it conflicts with another.
+func (repo RunRepositoryImpl) retry(f func(txn *badger.Txn) error) error {
+	for attempt := 1; ; attempt++ {
+		err := repo.db.Update(f)
+		if !errors.Is(err, badger.ErrConflict) || attempt >= maxUpdateAttempts {
+			return err
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package repositories
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type ScheduleRepository interface {
+	List() ([]models.Schedule, error)
+	Fetch(name string) (models.Schedule, error)
+	Put(schedule models.Schedule) error
+	Update(name string, f func(schedule *models.Schedule) error) (models.Schedule, error)
+	Delete(name string) error
+}
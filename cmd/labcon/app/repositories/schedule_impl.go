@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/vmihailenco/msgpack"
+)
+
+type ScheduleRepositoryImpl struct {
+	db *badger.DB
+}
+
+func NewScheduleRepository(db *badger.DB) ScheduleRepository {
+	return ScheduleRepositoryImpl{
+		db: db,
+	}
+}
+
+func (repo ScheduleRepositoryImpl) Key(name string) []byte {
+	return []byte(fmt.Sprintf("schedule/%s", name))
+}
+
+// List returns every schedule in the order of their names.
+func (repo ScheduleRepositoryImpl) List() ([]models.Schedule, error) {
+	schedules := []models.Schedule{}
+	err := repo.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("schedule/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			schedule := models.Schedule{Name: strings.TrimPrefix(string(item.Key()), string(prefix))}
+			if err := item.Value(func(val []byte) error {
+				return msgpack.Unmarshal(val, &schedule)
+			}); err != nil {
+				return err
+			}
+			schedules = append(schedules, schedule)
+		}
+		return nil
+	})
+	return schedules, err
+}
+
+func (repo ScheduleRepositoryImpl) Fetch(name string) (models.Schedule, error) {
+	var schedule models.Schedule
+	err := repo.db.View(func(txn *badger.Txn) error {
+		var err error
+		schedule, err = repo.get(txn, name)
+		return err
+	})
+	return schedule, err
+}
+
+// Put creates the schedule or replaces the schedule of the same name.
+func (repo ScheduleRepositoryImpl) Put(schedule models.Schedule) error {
+	val, err := msgpack.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	return repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(repo.Key(schedule.Name), val)
+	})
+}
+
+// Update reads the schedule, applies f to it and stores the result
+// atomically. The schedule is left untouched if f returns an error, which is
+// then returned.
+func (repo ScheduleRepositoryImpl) Update(name string, f func(schedule *models.Schedule) error) (models.Schedule, error) {
+	var schedule models.Schedule
+	err := repo.retry(func(txn *badger.Txn) error {
+		var err error
+		schedule, err = repo.get(txn, name)
+		if err != nil {
+			return err
+		}
+		if err := f(&schedule); err != nil {
+			return err
+		}
+		val, err := msgpack.Marshal(schedule)
+		if err != nil {
+			return err
+		}
+		return txn.Set(repo.Key(name), val)
+	})
+	return schedule, err
+}
+
+func (repo ScheduleRepositoryImpl) Delete(name string) error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		key := repo.Key(name)
+		if _, err := txn.Get(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+func (repo ScheduleRepositoryImpl) get(txn *badger.Txn, name string) (models.Schedule, error) {
+	schedule := models.Schedule{Name: name}
+	item, err := txn.Get(repo.Key(name))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return schedule, lib.ErrNotFound
+		}
+		return schedule, err
+	}
+	err = item.Value(func(val []byte) error {
+		return msgpack.Unmarshal(val, &schedule)
+	})
+	return schedule, err
+}
+
+// retry runs the transaction again if it conflicts with another.
+func (repo ScheduleRepositoryImpl) retry(f func(txn *badger.Txn) error) error {
+	for attempt := 1; ; attempt++ {
+		err := repo.db.Update(f)
+		if !errors.Is(err, badger.ErrConflict) || attempt >= maxUpdateAttempts {
+			return err
+		}
+	}
+}
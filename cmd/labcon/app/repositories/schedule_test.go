@@ -0,0 +1,90 @@
+package repositories_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+func testSchedule(name string) models.Schedule {
+	return models.Schedule{
+		Name:   name,
+		Driver: "reader",
+		Op:     driver.Op{Name: "read_od", Arg: map[string]interface{}{"wells": "A1"}},
+		Cron:   "*/10 0-6 * * *",
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewScheduleRepository(db)
+
+	if _, err := repo.Fetch("overnight"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Fetch(%q) = (_, %v), expected %v", repo, "overnight", err, lib.ErrNotFound)
+	}
+
+	for _, name := range []string{"overnight", "flush"} {
+		if err := repo.Put(testSchedule(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schedules, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(schedules, []models.Schedule{testSchedule("flush"), testSchedule("overnight")}); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	schedule, err := repo.Update("overnight", func(schedule *models.Schedule) error {
+		schedule.Next = &now
+		schedule.Record(models.Firing{Due: now, Time: now, Result: models.FiringSkipped, Reason: "busy"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := repo.Fetch("overnight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(fetched, schedule); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+
+	// Failed updates change nothing.
+	errAbort := errors.New("abort")
+	if _, err := repo.Update("overnight", func(schedule *models.Schedule) error {
+		schedule.Disabled = true
+		return errAbort
+	}); !errors.Is(err, errAbort) {
+		t.Errorf("%T.Update(%q, f) = (_, %v), expected %v", repo, "overnight", err, errAbort)
+	}
+	if fetched, _ := repo.Fetch("overnight"); fetched.Disabled {
+		t.Errorf("schedule is disabled after failed update")
+	}
+
+	if err := repo.Delete("overnight"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("overnight"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Delete(%q) = %v, expected %v", repo, "overnight", err, lib.ErrNotFound)
+	}
+	if _, err := repo.Update("overnight", func(*models.Schedule) error { return nil }); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Update(%q, f) = (_, %v), expected %v", repo, "overnight", err, lib.ErrNotFound)
+	}
+}
@@ -0,0 +1,9 @@
+package repositories
+
+// TokenRepository keeps the tokens of drivers registered on behalf of devices
+// by a bridge, so that the bridge can act for them across restarts.
+type TokenRepository interface {
+	Get(name string) (string, error)
+	Put(name, token string) error
+	Delete(name string) error
+}
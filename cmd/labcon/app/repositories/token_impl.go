@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type TokenRepositoryImpl struct {
+	db    *badger.DB
+	owner string
+}
+
+// NewTokenRepository returns a repository of the tokens held by the given
+// owner, e.g. "mqtt" for the MQTT bridge.
+func NewTokenRepository(db *badger.DB, owner string) TokenRepository {
+	return TokenRepositoryImpl{
+		db:    db,
+		owner: owner,
+	}
+}
+
+func (repo TokenRepositoryImpl) Key(name string) []byte {
+	return []byte(fmt.Sprintf("token/%s/%s", repo.owner, name))
+}
+
+func (repo TokenRepositoryImpl) Get(name string) (string, error) {
+	var token string
+	err := repo.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(repo.Key(name))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			token = string(val)
+			return nil
+		})
+	})
+	return token, err
+}
+
+func (repo TokenRepositoryImpl) Put(name, token string) error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(repo.Key(name), []byte(token))
+	})
+}
+
+// Delete removes the token of the named driver. Deleting a missing token is
+// not an error.
+func (repo TokenRepositoryImpl) Delete(name string) error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(repo.Key(name))
+	})
+}
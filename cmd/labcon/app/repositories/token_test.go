@@ -0,0 +1,50 @@
+package repositories_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestToken(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	mqtt := repositories.NewTokenRepository(db, "mqtt")
+	other := repositories.NewTokenRepository(db, "other")
+
+	if _, err := mqtt.Get("foo"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Get(%q) = (_, %v), expected %v", mqtt, "foo", err, lib.ErrNotFound)
+	}
+
+	if err := mqtt.Put("foo", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := mqtt.Get("foo")
+	if err != nil || token != "token" {
+		t.Errorf("%T.Get(%q) = (%q, %v), expected (%q, nil)", mqtt, "foo", token, err, "token")
+	}
+
+	// Owners do not see each other's tokens.
+	if _, err := other.Get("foo"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Get(%q) of another owner = (_, %v), expected %v", other, "foo", err, lib.ErrNotFound)
+	}
+
+	if err := mqtt.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mqtt.Get("foo"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Get(%q) after Delete = (_, %v), expected %v", mqtt, "foo", err, lib.ErrNotFound)
+	}
+	if err := mqtt.Delete("foo"); err != nil {
+		t.Errorf("%T.Delete(%q) of a missing token: %v", mqtt, "foo", err)
+	}
+}
@@ -0,0 +1,10 @@
+package repositories
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type WorkflowRepository interface {
+	List() ([]string, error)
+	Fetch(name string) (models.Workflow, error)
+	Put(workflow models.Workflow) error
+	Delete(name string) error
+}
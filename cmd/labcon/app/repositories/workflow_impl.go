@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/vmihailenco/msgpack"
+)
+
+type WorkflowRepositoryImpl struct {
+	db *badger.DB
+}
+
+func NewWorkflowRepository(db *badger.DB) WorkflowRepository {
+	return WorkflowRepositoryImpl{
+		db: db,
+	}
+}
+
+func (repo WorkflowRepositoryImpl) Key(name string) []byte {
+	return []byte(fmt.Sprintf("workflow/%s", name))
+}
+
+func (repo WorkflowRepositoryImpl) List() ([]string, error) {
+	names := []string{}
+	err := repo.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte("workflow/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			names = append(names, string(bytes.TrimPrefix(it.Item().Key(), prefix)))
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (repo WorkflowRepositoryImpl) Fetch(name string) (models.Workflow, error) {
+	workflow := models.Workflow{Name: name}
+	err := repo.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(repo.Key(name))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return msgpack.Unmarshal(val, &workflow)
+		})
+	})
+	return workflow, err
+}
+
+// Put creates the workflow or replaces the workflow of the same name. Runs
+// keep the workflow they started with.
+func (repo WorkflowRepositoryImpl) Put(workflow models.Workflow) error {
+	val, err := msgpack.Marshal(workflow)
+	if err != nil {
+		return err
+	}
+	return repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(repo.Key(workflow.Name), val)
+	})
+}
+
+func (repo WorkflowRepositoryImpl) Delete(name string) error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		key := repo.Key(name)
+		if _, err := txn.Get(key); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return lib.ErrNotFound
+			}
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
@@ -0,0 +1,135 @@
+package repositories_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+func testWorkflow(name string) models.Workflow {
+	delay := models.Duration(30 * time.Minute)
+	return models.Workflow{
+		Name: name,
+		Steps: []models.Step{
+			{Dispatch: &models.DispatchStep{Driver: "reader", Op: driver.Op{Name: "read", Arg: map[string]interface{}{"wells": "A1"}}}},
+			{Loop: &models.LoopStep{Count: 2, Steps: []models.Step{
+				{Wait: &models.WaitStep{Driver: "incubator", Until: "$.temperature > 36", Timeout: models.Duration(time.Minute)}},
+				{Delay: &delay},
+			}}},
+		},
+	}
+}
+
+func TestWorkflow(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewWorkflowRepository(db)
+
+	if _, err := repo.Fetch("assay"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Fetch(%q) = (_, %v), expected %v", repo, "assay", err, lib.ErrNotFound)
+	}
+
+	for _, name := range []string{"assay", "wash"} {
+		if err := repo.Put(testWorkflow(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workflow, err := repo.Fetch("assay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(workflow, testWorkflow("assay")); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+
+	names, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(names, []string{"assay", "wash"}); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+
+	if err := repo.Delete("assay"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("assay"); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Delete(%q) of a missing workflow: %v, expected %v", repo, "assay", err, lib.ErrNotFound)
+	}
+}
+
+func TestRun(t *testing.T) {
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	repo := repositories.NewRunRepository(db)
+
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		run, err := repo.Create(models.NewRun(testWorkflow("assay"), now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := strconv.Itoa(i + 1); run.ID != expected {
+			t.Errorf("%T.Create(run) = (%q, nil), expected ID %q", repo, run.ID, expected)
+		}
+	}
+
+	runs, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 10 || runs[1].ID != "2" || runs[9].ID != "10" {
+		t.Errorf("%T.List() returned runs out of order", repo)
+	}
+
+	deadline := now.Add(time.Minute)
+	run, err := repo.Update("2", func(run *models.RunModel) error {
+		run.PC = 2
+		run.Counters = map[int]int{3: 1}
+		run.Deadline = &deadline
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := repo.Fetch("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(fetched, run); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+
+	// Failed updates change nothing.
+	errAbort := errors.New("abort")
+	if _, err := repo.Update("2", func(run *models.RunModel) error {
+		run.PC = 3
+		return errAbort
+	}); !errors.Is(err, errAbort) {
+		t.Errorf("%T.Update(%q, f) = (_, %v), expected %v", repo, "2", err, errAbort)
+	}
+	if fetched, _ := repo.Fetch("2"); fetched.PC != 2 {
+		t.Errorf("run PC = %d after failed update, expected %d", fetched.PC, 2)
+	}
+
+	if _, err := repo.Update("11", func(*models.RunModel) error { return nil }); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.Update(%q, f) = (_, %v), expected %v", repo, "11", err, lib.ErrNotFound)
+	}
+}
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/repositories/booking_iface.go
+
+// Package repositories_mock is a generated GoMock package.
+package repositories_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockBookingRepository is a mock of BookingRepository interface.
+type MockBookingRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockBookingRepositoryMockRecorder
+}
+
+// MockBookingRepositoryMockRecorder is the mock recorder for MockBookingRepository.
+type MockBookingRepositoryMockRecorder struct {
+	mock *MockBookingRepository
+}
+
+// NewMockBookingRepository creates a new mock instance.
+func NewMockBookingRepository(ctrl *gomock.Controller) *MockBookingRepository {
+	mock := &MockBookingRepository{ctrl: ctrl}
+	mock.recorder = &MockBookingRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBookingRepository) EXPECT() *MockBookingRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockBookingRepository) Create(booking models.Booking) (models.Booking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", booking)
+	ret0, _ := ret[0].(models.Booking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockBookingRepositoryMockRecorder) Create(booking interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockBookingRepository)(nil).Create), booking)
+}
+
+// Delete mocks base method.
+func (m *MockBookingRepository) Delete(driver, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", driver, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockBookingRepositoryMockRecorder) Delete(driver, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockBookingRepository)(nil).Delete), driver, id)
+}
+
+// Fetch mocks base method.
+func (m *MockBookingRepository) Fetch(driver, id string) (models.Booking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", driver, id)
+	ret0, _ := ret[0].(models.Booking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockBookingRepositoryMockRecorder) Fetch(driver, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockBookingRepository)(nil).Fetch), driver, id)
+}
+
+// List mocks base method.
+func (m *MockBookingRepository) List(driver string) ([]models.Booking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", driver)
+	ret0, _ := ret[0].([]models.Booking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockBookingRepositoryMockRecorder) List(driver interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockBookingRepository)(nil).List), driver)
+}
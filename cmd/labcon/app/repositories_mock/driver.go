@@ -35,31 +35,41 @@ func (m *MockDriverRepository) EXPECT() *MockDriverRepositoryMockRecorder {
 }
 
 // Create mocks base method.
-func (m *MockDriverRepository) Create(name, token string, state interface{}) error {
+func (m *MockDriverRepository) Create(driver models.DriverModel, audit ...models.AuditEntry) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", name, token, state)
+	varargs := []interface{}{driver}
+	for _, a := range audit {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Create", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockDriverRepositoryMockRecorder) Create(name, token, state interface{}) *gomock.Call {
+func (mr *MockDriverRepositoryMockRecorder) Create(driver interface{}, audit ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDriverRepository)(nil).Create), name, token, state)
+	varargs := append([]interface{}{driver}, audit...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDriverRepository)(nil).Create), varargs...)
 }
 
 // Delete mocks base method.
-func (m *MockDriverRepository) Delete(name string) error {
+func (m *MockDriverRepository) Delete(name string, audit ...models.AuditEntry) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", name)
+	varargs := []interface{}{name}
+	for _, a := range audit {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Delete", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockDriverRepositoryMockRecorder) Delete(name interface{}) *gomock.Call {
+func (mr *MockDriverRepositoryMockRecorder) Delete(name interface{}, audit ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDriverRepository)(nil).Delete), name)
+	varargs := append([]interface{}{name}, audit...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDriverRepository)(nil).Delete), varargs...)
 }
 
 // Fetch mocks base method.
@@ -92,16 +102,41 @@ func (mr *MockDriverRepositoryMockRecorder) List() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDriverRepository)(nil).List))
 }
 
+// Modify mocks base method.
+func (m *MockDriverRepository) Modify(name string, f func(*models.DriverModel) error, audit ...*models.AuditEntry) (models.DriverModel, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{name, f}
+	for _, a := range audit {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Modify", varargs...)
+	ret0, _ := ret[0].(models.DriverModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Modify indicates an expected call of Modify.
+func (mr *MockDriverRepositoryMockRecorder) Modify(name, f interface{}, audit ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{name, f}, audit...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Modify", reflect.TypeOf((*MockDriverRepository)(nil).Modify), varargs...)
+}
+
 // Update mocks base method.
-func (m *MockDriverRepository) Update(driver models.DriverModel) error {
+func (m *MockDriverRepository) Update(driver models.DriverModel, audit ...models.AuditEntry) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Update", driver)
+	varargs := []interface{}{driver}
+	for _, a := range audit {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Update", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Update indicates an expected call of Update.
-func (mr *MockDriverRepositoryMockRecorder) Update(driver interface{}) *gomock.Call {
+func (mr *MockDriverRepositoryMockRecorder) Update(driver interface{}, audit ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockDriverRepository)(nil).Update), driver)
+	varargs := append([]interface{}{driver}, audit...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockDriverRepository)(nil).Update), varargs...)
 }
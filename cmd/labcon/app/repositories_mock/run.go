@@ -0,0 +1,95 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/repositories/run_iface.go
+
+// Package repositories_mock is a generated GoMock package.
+package repositories_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockRunRepository is a mock of RunRepository interface.
+type MockRunRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockRunRepositoryMockRecorder
+}
+
+// MockRunRepositoryMockRecorder is the mock recorder for MockRunRepository.
+type MockRunRepositoryMockRecorder struct {
+	mock *MockRunRepository
+}
+
+// NewMockRunRepository creates a new mock instance.
+func NewMockRunRepository(ctrl *gomock.Controller) *MockRunRepository {
+	mock := &MockRunRepository{ctrl: ctrl}
+	mock.recorder = &MockRunRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRunRepository) EXPECT() *MockRunRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRunRepository) Create(run models.RunModel) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", run)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRunRepositoryMockRecorder) Create(run interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRunRepository)(nil).Create), run)
+}
+
+// Fetch mocks base method.
+func (m *MockRunRepository) Fetch(id string) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", id)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockRunRepositoryMockRecorder) Fetch(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockRunRepository)(nil).Fetch), id)
+}
+
+// List mocks base method.
+func (m *MockRunRepository) List() ([]models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockRunRepositoryMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRunRepository)(nil).List))
+}
+
+// Update mocks base method.
+func (m *MockRunRepository) Update(id string, f func(*models.RunModel) error) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", id, f)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockRunRepositoryMockRecorder) Update(id, f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRunRepository)(nil).Update), id, f)
+}
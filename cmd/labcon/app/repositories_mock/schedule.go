@@ -0,0 +1,108 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/repositories/schedule_iface.go
+
+// Package repositories_mock is a generated GoMock package.
+package repositories_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockScheduleRepository is a mock of ScheduleRepository interface.
+type MockScheduleRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleRepositoryMockRecorder
+}
+
+// MockScheduleRepositoryMockRecorder is the mock recorder for MockScheduleRepository.
+type MockScheduleRepositoryMockRecorder struct {
+	mock *MockScheduleRepository
+}
+
+// NewMockScheduleRepository creates a new mock instance.
+func NewMockScheduleRepository(ctrl *gomock.Controller) *MockScheduleRepository {
+	mock := &MockScheduleRepository{ctrl: ctrl}
+	mock.recorder = &MockScheduleRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleRepository) EXPECT() *MockScheduleRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockScheduleRepository) Delete(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockScheduleRepositoryMockRecorder) Delete(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockScheduleRepository)(nil).Delete), name)
+}
+
+// Fetch mocks base method.
+func (m *MockScheduleRepository) Fetch(name string) (models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", name)
+	ret0, _ := ret[0].(models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockScheduleRepositoryMockRecorder) Fetch(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockScheduleRepository)(nil).Fetch), name)
+}
+
+// List mocks base method.
+func (m *MockScheduleRepository) List() ([]models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockScheduleRepositoryMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockScheduleRepository)(nil).List))
+}
+
+// Put mocks base method.
+func (m *MockScheduleRepository) Put(schedule models.Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", schedule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockScheduleRepositoryMockRecorder) Put(schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockScheduleRepository)(nil).Put), schedule)
+}
+
+// Update mocks base method.
+func (m *MockScheduleRepository) Update(name string, f func(*models.Schedule) error) (models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", name, f)
+	ret0, _ := ret[0].(models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockScheduleRepositoryMockRecorder) Update(name, f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockScheduleRepository)(nil).Update), name, f)
+}
@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/repositories/workflow_iface.go
+
+// Package repositories_mock is a generated GoMock package.
+package repositories_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockWorkflowRepository is a mock of WorkflowRepository interface.
+type MockWorkflowRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWorkflowRepositoryMockRecorder
+}
+
+// MockWorkflowRepositoryMockRecorder is the mock recorder for MockWorkflowRepository.
+type MockWorkflowRepositoryMockRecorder struct {
+	mock *MockWorkflowRepository
+}
+
+// NewMockWorkflowRepository creates a new mock instance.
+func NewMockWorkflowRepository(ctrl *gomock.Controller) *MockWorkflowRepository {
+	mock := &MockWorkflowRepository{ctrl: ctrl}
+	mock.recorder = &MockWorkflowRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWorkflowRepository) EXPECT() *MockWorkflowRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockWorkflowRepository) Delete(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockWorkflowRepositoryMockRecorder) Delete(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWorkflowRepository)(nil).Delete), name)
+}
+
+// Fetch mocks base method.
+func (m *MockWorkflowRepository) Fetch(name string) (models.Workflow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", name)
+	ret0, _ := ret[0].(models.Workflow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockWorkflowRepositoryMockRecorder) Fetch(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockWorkflowRepository)(nil).Fetch), name)
+}
+
+// List mocks base method.
+func (m *MockWorkflowRepository) List() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWorkflowRepositoryMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWorkflowRepository)(nil).List))
+}
+
+// Put mocks base method.
+func (m *MockWorkflowRepository) Put(workflow models.Workflow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", workflow)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockWorkflowRepositoryMockRecorder) Put(workflow interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockWorkflowRepository)(nil).Put), workflow)
+}
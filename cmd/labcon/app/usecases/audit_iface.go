@@ -0,0 +1,8 @@
+package usecases
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type AuditUsecase interface {
+	List(query models.AuditQuery) ([]models.AuditEntry, error)
+	Each(query models.AuditQuery, f func(entry models.AuditEntry) error) error
+}
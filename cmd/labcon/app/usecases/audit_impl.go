@@ -0,0 +1,29 @@
+package usecases
+
+import (
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+)
+
+type AuditUsecaseImpl struct {
+	repository repositories.AuditRepository
+}
+
+func NewAuditUsecase(repository repositories.AuditRepository) AuditUsecase {
+	return AuditUsecaseImpl{
+		repository: repository,
+	}
+}
+
+func (usecase AuditUsecaseImpl) List(query models.AuditQuery) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	err := usecase.repository.Each(query, func(entry models.AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+func (usecase AuditUsecaseImpl) Each(query models.AuditQuery, f func(entry models.AuditEntry) error) error {
+	return usecase.repository.Each(query, f)
+}
@@ -0,0 +1,14 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+type BookingUsecase interface {
+	List(driver string, from, to time.Time) ([]models.Booking, error)
+	Get(driver, id string) (models.Booking, error)
+	Create(booking models.Booking) (models.Booking, error)
+	Cancel(driver, id string) error
+}
@@ -0,0 +1,70 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+)
+
+type BookingUsecaseImpl struct {
+	repository repositories.BookingRepository
+	now        func() time.Time
+}
+
+// BookingUsecaseOption configures a BookingUsecaseImpl.
+type BookingUsecaseOption func(usecase *BookingUsecaseImpl)
+
+// WithBookingClock sets the function giving the current time.
+func WithBookingClock(now func() time.Time) BookingUsecaseOption {
+	return func(usecase *BookingUsecaseImpl) {
+		usecase.now = now
+	}
+}
+
+func NewBookingUsecase(repository repositories.BookingRepository, opts ...BookingUsecaseOption) BookingUsecase {
+	usecase := BookingUsecaseImpl{
+		repository: repository,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&usecase)
+	}
+	return usecase
+}
+
+// List returns the bookings of the driver that overlap [from, to), in the
+// order they start. A zero from or to leaves that end of the interval open.
+func (usecase BookingUsecaseImpl) List(driver string, from, to time.Time) ([]models.Booking, error) {
+	bookings, err := usecase.repository.List(driver)
+	if err != nil {
+		return nil, err
+	}
+	selected := bookings[:0]
+	for _, booking := range bookings {
+		if !from.IsZero() && !booking.End.After(from) || !to.IsZero() && !booking.Start.Before(to) {
+			continue
+		}
+		selected = append(selected, booking)
+	}
+	return selected, nil
+}
+
+func (usecase BookingUsecaseImpl) Get(driver, id string) (models.Booking, error) {
+	return usecase.repository.Fetch(driver, id)
+}
+
+// Create books the driver unless the booking is over already or overlaps
+// another booking of the driver.
+func (usecase BookingUsecaseImpl) Create(booking models.Booking) (models.Booking, error) {
+	now := usecase.now()
+	if !booking.End.After(now) {
+		return booking, models.ErrBookingPast
+	}
+	booking.Created = now
+	return usecase.repository.Create(booking)
+}
+
+func (usecase BookingUsecaseImpl) Cancel(driver, id string) error {
+	return usecase.repository.Delete(driver, id)
+}
@@ -1,16 +1,23 @@
 package usecases
 
-import "github.com/ktnyt/labcon/driver"
+import (
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/driver"
+)
 
 type DriverUsecase interface {
 	List() ([]string, error)
-	Register(name string, state interface{}) (string, error)
+	Summaries(selector models.Selector) ([]driver.Summary, error)
+	Register(params driver.RegisterParams) (string, error)
 	Authorize(name string, token string) error
+	Inspect(name string) (models.DriverModel, error)
 	GetState(name string) (interface{}, error)
 	SetState(name string, state interface{}) error
 	GetStatus(name string) (driver.Status, error)
 	SetStatus(name string, status driver.Status) error
 	GetOp(name string) (*driver.Op, error)
 	SetOp(name string, op driver.Op) error
+	CancelOp(name, dispatcher string, admin bool) error
+	SetInfo(name string, info driver.Info) error
 	Delete(name string) error
 }
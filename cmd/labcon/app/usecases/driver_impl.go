@@ -1,31 +1,237 @@
 package usecases
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
 	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
 	"github.com/ktnyt/labcon/driver"
 )
 
+// DriverObserver is notified of operations, e.g. to export metrics.
+type DriverObserver interface {
+	// Dispatched is called when an operation is dispatched to a driver.
+	Dispatched(name string, op driver.Op)
+
+	// Completed is called when a driver sets its status after an operation,
+	// with the time elapsed since the operation was dispatched, or zero if
+	// the dispatch time is unknown.
+	Completed(name string, op driver.Op, status driver.Status, elapsed time.Duration)
+}
+
+// DriverNotifier is notified whenever a driver is registered, changed or
+// deleted, e.g. to wake the streams watching it.
+type DriverNotifier interface {
+	Notify(name string)
+}
+
 type DriverUsecaseImpl struct {
 	repository repositories.DriverRepository
 	generate   func() string
+	now        func() time.Time
+	lease      time.Duration
+	observer   DriverObserver
+	notifier   DriverNotifier
+	audit      bool
+	actor      string
+	bookings   repositories.BookingRepository
+	holder     string
+	dispatcher string
+	origin     string
+}
+
+// DriverUsecaseOption configures a DriverUsecaseImpl.
+type DriverUsecaseOption func(usecase *DriverUsecaseImpl)
+
+// WithClock sets the function giving the current time.
+func WithClock(now func() time.Time) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.now = now
+	}
+}
+
+// WithLease reports drivers as lost once they have not registered, set their
+// state or status, or polled for operations for longer than the lease. The
+// lease is disabled if it is zero.
+func WithLease(lease time.Duration) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.lease = lease
+	}
 }
 
-func NewDriverUsecase(repository repositories.DriverRepository, generate func() string) DriverUsecase {
-	return DriverUsecaseImpl{
+// WithObserver sets the observer of operations. Dispatch times are recorded
+// so that the observer receives the duration of each operation.
+func WithObserver(observer DriverObserver) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.observer = observer
+	}
+}
+
+// WithNotifier sets the notifier of changes to drivers. Renewing the lease of
+// a driver is not a change, nor is the lease running out.
+func WithNotifier(notifier DriverNotifier) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.notifier = notifier
+	}
+}
+
+// WithAudit records registrations, dispatches, status changes, cancellations
+// and disconnections in the audit log on behalf of the given actor, together
+// with the changes to the drivers. If the actor is empty, actions taken by
+// drivers are attributed to the drivers themselves and other actions to
+// "anonymous".
+func WithAudit(actor string) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.audit = true
+		usecase.actor = actor
+	}
+}
+
+// WithBookings refuses operations dispatched to a driver while it is booked,
+// unless they are dispatched on behalf of the holder of the booking, i.e. the
+// name of the API key of the request, or of the owner of the workflow run or
+// schedule dispatching them. Operations dispatched on behalf of no one are
+// refused too.
+func WithBookings(repository repositories.BookingRepository, holder string) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.bookings = repository
+		usecase.holder = holder
+	}
+}
+
+// WithDispatcher records the name of the API key on whose behalf operations
+// are dispatched, so that cancellations can be limited to the dispatcher.
+func WithDispatcher(name string) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.dispatcher = name
+	}
+}
+
+// WithOrigin records the workflow run or schedule on whose behalf operations
+// are dispatched, so that it can recognize its operations.
+func WithOrigin(origin string) DriverUsecaseOption {
+	return func(usecase *DriverUsecaseImpl) {
+		usecase.origin = origin
+	}
+}
+
+func NewDriverUsecase(repository repositories.DriverRepository, generate func() string, opts ...DriverUsecaseOption) DriverUsecase {
+	usecase := DriverUsecaseImpl{
 		repository: repository,
 		generate:   generate,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&usecase)
 	}
+	return usecase
+}
+
+// renew records that the driver contacted the server if drivers are leased.
+func (usecase DriverUsecaseImpl) renew(model *models.DriverModel) {
+	if usecase.lease > 0 {
+		model.Seen = usecase.now()
+	}
+}
+
+// status returns the status of the driver, which is Lost if its lease has
+// expired.
+func (usecase DriverUsecaseImpl) status(model models.DriverModel) driver.Status {
+	if usecase.lease > 0 && usecase.now().Sub(model.Seen) > usecase.lease {
+		return driver.Lost
+	}
+	return model.Status
+}
+
+func (usecase DriverUsecaseImpl) notify(name string) {
+	if usecase.notifier != nil {
+		usecase.notifier.Notify(name)
+	}
+}
+
+// record returns the audit entries to store with a change to a driver, which
+// is the given entry if auditing is enabled and none otherwise. The entry is
+// attributed to the driver it concerns if byDriver is set and the actor is
+// unknown.
+func (usecase DriverUsecaseImpl) record(entry models.AuditEntry, byDriver bool) []models.AuditEntry {
+	if !usecase.audit {
+		return nil
+	}
+
+	entry.Time = usecase.now()
+	entry.Actor = usecase.actor
+	if entry.Actor == "" {
+		entry.Actor = "anonymous"
+		if byDriver {
+			entry.Actor = "driver:" + entry.Driver
+		}
+	}
+
+	return []models.AuditEntry{entry}
+}
+
+// refs returns pointers to the entries, to be filled in while a driver is
+// modified.
+func refs(entries []models.AuditEntry) []*models.AuditEntry {
+	pointers := make([]*models.AuditEntry, len(entries))
+	for i := range entries {
+		pointers[i] = &entries[i]
+	}
+	return pointers
 }
 
 func (usecase DriverUsecaseImpl) List() ([]string, error) {
 	return usecase.repository.List()
 }
 
-func (usecase DriverUsecaseImpl) Register(name string, state interface{}) (string, error) {
+// Summaries returns summaries of the drivers selected by their labels, in
+// order of their names.
+func (usecase DriverUsecaseImpl) Summaries(selector models.Selector) ([]driver.Summary, error) {
+	names, err := usecase.repository.List()
+	if err != nil {
+		return nil, err
+	}
+	summaries := []driver.Summary{}
+	for _, name := range names {
+		model, err := usecase.repository.Fetch(name)
+		if err != nil {
+			// Drivers disconnected in the meantime are no longer listed.
+			if errors.Is(err, lib.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if !selector.Matches(model.Labels) {
+			continue
+		}
+		summaries = append(summaries, driver.Summary{
+			Name:   name,
+			Status: usecase.status(model),
+			Op:     model.Op,
+			Info:   model.Info(),
+		})
+	}
+	return summaries, nil
+}
+
+func (usecase DriverUsecaseImpl) Register(params driver.RegisterParams) (string, error) {
+	name := params.Name
 	token := usecase.generate()
-	err := usecase.repository.Create(name, token, state)
-	return token, err
+	model := models.NewDriver(name, token, params.State)
+	model.Labels = params.Labels
+	model.Metadata = params.Metadata
+	usecase.renew(&model)
+
+	entry := models.AuditEntry{Action: models.AuditRegister, Driver: name}
+	if err := usecase.repository.Create(model, usecase.record(entry, true)...); err != nil {
+		return token, err
+	}
+
+	usecase.notify(name)
+	return token, nil
 }
 
 func (usecase DriverUsecaseImpl) Authorize(name string, token string) error {
@@ -39,18 +245,33 @@ func (usecase DriverUsecaseImpl) Authorize(name string, token string) error {
 	return nil
 }
 
+// Inspect returns the state, status and pending operation of a driver read at
+// once, without renewing its lease. The token is left empty.
+func (usecase DriverUsecaseImpl) Inspect(name string) (models.DriverModel, error) {
+	model, err := usecase.repository.Fetch(name)
+	if err != nil {
+		return model, err
+	}
+	model.Token = ""
+	model.Status = usecase.status(model)
+	return model, nil
+}
+
 func (usecase DriverUsecaseImpl) GetState(name string) (interface{}, error) {
 	model, err := usecase.repository.Fetch(name)
 	return model.State, err
 }
 
 func (usecase DriverUsecaseImpl) SetState(name string, state interface{}) error {
-	model, err := usecase.repository.Fetch(name)
-	if err != nil {
+	if _, err := usecase.repository.Modify(name, func(model *models.DriverModel) error {
+		model.State = state
+		usecase.renew(model)
+		return nil
+	}); err != nil {
 		return err
 	}
-	model.State = state
-	return usecase.repository.Update(model)
+	usecase.notify(name)
+	return nil
 }
 
 func (usecase DriverUsecaseImpl) GetStatus(name string) (driver.Status, error) {
@@ -58,40 +279,167 @@ func (usecase DriverUsecaseImpl) GetStatus(name string) (driver.Status, error) {
 	if err != nil {
 		return driver.Error, err
 	}
-	return model.Status, nil
+	return usecase.status(model), nil
 }
 
 func (usecase DriverUsecaseImpl) SetStatus(name string, status driver.Status) error {
-	model, err := usecase.repository.Fetch(name)
-	if err != nil {
+	var op *driver.Op
+	var dispatched time.Time
+	entries := usecase.record(models.AuditEntry{Action: models.AuditStatus, Driver: name, Status: status}, true)
+	if _, err := usecase.repository.Modify(name, func(model *models.DriverModel) error {
+		op, dispatched = model.Op, model.Dispatched
+		for i := range entries {
+			entries[i].Op = op
+		}
+		model.Status = status
+		model.Op = nil
+		model.Dispatched = time.Time{}
+		model.Dispatcher = ""
+		model.Origin = ""
+		usecase.renew(model)
+		return nil
+	}, refs(entries)...); err != nil {
 		return err
 	}
-	model.Status = status
-	model.Op = nil
-	return usecase.repository.Update(model)
+	if usecase.observer != nil && op != nil {
+		var elapsed time.Duration
+		if !dispatched.IsZero() {
+			elapsed = usecase.now().Sub(dispatched)
+		}
+		usecase.observer.Completed(name, *op, status, elapsed)
+	}
+
+	usecase.notify(name)
+	return nil
 }
 
+// GetOp returns the operation dispatched to the driver. The lease is renewed
+// in the same transaction as the operation is read, so that renewals never
+// overwrite operations dispatched concurrently.
 func (usecase DriverUsecaseImpl) GetOp(name string) (*driver.Op, error) {
-	model, err := usecase.repository.Fetch(name)
+	if usecase.lease <= 0 {
+		model, err := usecase.repository.Fetch(name)
+		return model.Op, err
+	}
+	model, err := usecase.repository.Modify(name, func(model *models.DriverModel) error {
+		usecase.renew(model)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	return model.Op, nil
 }
 
-func (usecase DriverUsecaseImpl) SetOp(name string, op driver.Op) error {
-	model, err := usecase.repository.Fetch(name)
+// checkBooking returns an error naming the booking of the driver that holds
+// now if it is held by someone else.
+func (usecase DriverUsecaseImpl) checkBooking(name string) error {
+	if usecase.bookings == nil {
+		return nil
+	}
+	bookings, err := usecase.bookings.List(name)
 	if err != nil {
 		return err
 	}
-	if model.Status != driver.Idle || model.Op != nil {
-		return lib.ErrAlreadyExists
+	now := usecase.now()
+	for _, booking := range bookings {
+		if booking.Active(now) && booking.Holder != usecase.holder {
+			return fmt.Errorf("%w: %s", lib.ErrBooked, booking)
+		}
 	}
-	model.Status = driver.Busy
-	model.Op = &op
-	return usecase.repository.Update(model)
+	return nil
+}
+
+// SetOp dispatches the operation to the driver and sets it Busy. Drivers must
+// be Idle or in Error after a failed operation, and have no pending operation,
+// or lib.ErrBusy is returned.
+func (usecase DriverUsecaseImpl) SetOp(name string, op driver.Op) error {
+	entry := models.AuditEntry{Action: models.AuditDispatch, Driver: name, Op: &op}
+	if _, err := usecase.repository.Modify(name, func(model *models.DriverModel) error {
+		if err := usecase.checkBooking(name); err != nil {
+			return err
+		}
+		if usecase.status(*model) == driver.Lost {
+			return fmt.Errorf("%w: driver is lost", lib.ErrBusy)
+		}
+		// Drivers report failed operations with Error and take the next.
+		if (model.Status != driver.Idle && model.Status != driver.Error) || model.Op != nil {
+			return lib.ErrBusy
+		}
+		model.Status = driver.Busy
+		model.Op = &op
+		model.Dispatcher = usecase.dispatcher
+		model.Origin = usecase.origin
+		if usecase.observer != nil {
+			model.Dispatched = usecase.now()
+		}
+		return nil
+	}, refs(usecase.record(entry, false))...); err != nil {
+		return err
+	}
+	if usecase.observer != nil {
+		usecase.observer.Dispatched(name, op)
+	}
+
+	usecase.notify(name)
+	return nil
+}
+
+// CancelOp withdraws the operation dispatched to the driver and sets it Idle.
+// A driver already running the operation is not stopped by this. Unless admin
+// is set, only operations dispatched with the API key named by dispatcher, or
+// without an API key if it is empty, are withdrawn and lib.ErrForbidden is
+// returned for others.
+func (usecase DriverUsecaseImpl) CancelOp(name, dispatcher string, admin bool) error {
+	entries := usecase.record(models.AuditEntry{Action: models.AuditCancel, Driver: name}, false)
+	if _, err := usecase.repository.Modify(name, func(model *models.DriverModel) error {
+		if model.Op == nil {
+			return fmt.Errorf("%w: no operation to cancel", lib.ErrNotFound)
+		}
+		if !admin && model.Dispatcher != dispatcher {
+			if dispatcher == "" {
+				return fmt.Errorf("%w: the operation was dispatched with an API key", lib.ErrForbidden)
+			}
+			return fmt.Errorf("%w: the operation was dispatched with another API key", lib.ErrForbidden)
+		}
+		for i := range entries {
+			entries[i].Op = model.Op
+		}
+		model.Status = driver.Idle
+		model.Op = nil
+		model.Dispatched = time.Time{}
+		model.Dispatcher = ""
+		model.Origin = ""
+		return nil
+	}, refs(entries)...); err != nil {
+		return err
+	}
+
+	usecase.notify(name)
+	return nil
+}
+
+// SetInfo replaces the labels and metadata of a driver.
+func (usecase DriverUsecaseImpl) SetInfo(name string, info driver.Info) error {
+	entry := models.AuditEntry{Action: models.AuditInfo, Driver: name}
+	if _, err := usecase.repository.Modify(name, func(model *models.DriverModel) error {
+		model.Labels = info.Labels
+		model.Metadata = info.Metadata
+		return nil
+	}, refs(usecase.record(entry, false))...); err != nil {
+		return err
+	}
+
+	usecase.notify(name)
+	return nil
 }
 
 func (usecase DriverUsecaseImpl) Delete(name string) error {
-	return usecase.repository.Delete(name)
+	entry := models.AuditEntry{Action: models.AuditDisconnect, Driver: name}
+	if err := usecase.repository.Delete(name, usecase.record(entry, true)...); err != nil {
+		return err
+	}
+
+	usecase.notify(name)
+	return nil
 }
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/ktnyt/labcon/cmd/labcon/app/models"
@@ -15,6 +17,31 @@ import (
 	"github.com/ktnyt/labcon/utils"
 )
 
+// newDriverRepository returns a mock repository whose Modify fetches the
+// driver, applies the modification and updates the driver, so that the
+// changes made can be expected on Fetch and Update.
+func newDriverRepository(ctrl *gomock.Controller) *repositories_mock.MockDriverRepository {
+	repository := repositories_mock.NewMockDriverRepository(ctrl)
+	repository.EXPECT().
+		Modify(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(name string, f func(driver *models.DriverModel) error, refs ...*models.AuditEntry) (models.DriverModel, error) {
+			model, err := repository.Fetch(name)
+			if err != nil {
+				return model, err
+			}
+			if err := f(&model); err != nil {
+				return model, err
+			}
+			audit := make([]models.AuditEntry, len(refs))
+			for i, entry := range refs {
+				audit[i] = *entry
+			}
+			return model, repository.Update(model, audit...)
+		}).
+		AnyTimes()
+	return repository
+}
+
 func TestDriverList(t *testing.T) {
 	token := lib.Base32String(lib.NewToken(20))
 
@@ -50,7 +77,7 @@ func TestDriverList(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -69,6 +96,104 @@ func TestDriverList(t *testing.T) {
 	}
 }
 
+func TestDriverSummaries(t *testing.T) {
+	foo := models.DriverModel{
+		Name:     "foo",
+		Status:   driver.Idle,
+		Labels:   map[string]string{"room": "302", "kind": "reader"},
+		Metadata: driver.Metadata{Location: "bench 3", Owner: "alice"},
+	}
+	bar := models.DriverModel{
+		Name:   "bar",
+		Status: driver.Busy,
+		Op:     &driver.Op{Name: "aspirate"},
+		Labels: map[string]string{"room": "302", "kind": "pipettor"},
+	}
+
+	cases := []struct {
+		selector string
+		out      []driver.Summary
+	}{
+		{
+			selector: "",
+			out: []driver.Summary{
+				{Name: "bar", Status: driver.Busy, Op: bar.Op, Info: bar.Info()},
+				{Name: "foo", Status: driver.Idle, Info: foo.Info()},
+			},
+		},
+		{
+			selector: "room=302,kind!=pipettor",
+			out: []driver.Summary{
+				{Name: "foo", Status: driver.Idle, Info: foo.Info()},
+			},
+		},
+		{
+			selector: "owner",
+			out:      []driver.Summary{},
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.selector, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := newDriverRepository(ctrl)
+			repository.EXPECT().List().Return([]string{"bar", "baz", "foo"}, nil).Times(1)
+			repository.EXPECT().Fetch("bar").Return(bar, nil).Times(1)
+			// baz is disconnected while the drivers are listed.
+			repository.EXPECT().Fetch("baz").Return(models.DriverModel{}, lib.ErrNotFound).Times(1)
+			repository.EXPECT().Fetch("foo").Return(foo, nil).Times(1)
+
+			selector, err := models.ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			usecase := usecases.NewDriverUsecase(repository, func() string { return "" })
+			out, err := usecase.Summaries(selector)
+			if err != nil {
+				t.Fatalf("%T.Summaries(%q) = (_, %v): expecting (_, nil)", usecase, tt.selector, err)
+			}
+			if ops := utils.ObjDiff(out, tt.out); ops != nil {
+				t.Error(utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+}
+
+func TestDriverSetInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	info := driver.Info{
+		Labels:   map[string]string{"room": "302"},
+		Metadata: driver.Metadata{Model: "Infinite 200", Serial: "1510003123"},
+	}
+
+	repository := newDriverRepository(ctrl)
+	repository.EXPECT().
+		Fetch("foo").
+		Return(models.DriverModel{Name: "foo", State: "foo", Status: driver.Idle}, nil).
+		Times(1)
+	repository.EXPECT().
+		Update(models.DriverModel{Name: "foo", State: "foo", Status: driver.Idle, Labels: info.Labels, Metadata: info.Metadata}).
+		Return(nil).
+		Times(1)
+	repository.EXPECT().
+		Fetch("bar").
+		Return(models.DriverModel{}, lib.ErrNotFound).
+		Times(1)
+
+	usecase := usecases.NewDriverUsecase(repository, func() string { return "" })
+	if err := usecase.SetInfo("foo", info); err != nil {
+		t.Errorf("%T.SetInfo(\"foo\", info) = %v: expecting nil", usecase, err)
+	}
+	if err := usecase.SetInfo("bar", info); !errors.Is(err, lib.ErrNotFound) {
+		t.Errorf("%T.SetInfo(\"bar\", info) = %v: expecting %v", usecase, err, lib.ErrNotFound)
+	}
+}
+
 func TestDriverRegister(t *testing.T) {
 	token := lib.Base32String(lib.NewToken(20))
 
@@ -79,7 +204,7 @@ func TestDriverRegister(t *testing.T) {
 		{
 			mock: func(repository *repositories_mock.MockDriverRepository) {
 				repository.EXPECT().
-					Create("foo", token, "foo").
+					Create(models.NewDriver("foo", token, "foo")).
 					Return(nil).
 					Times(1)
 			},
@@ -88,7 +213,7 @@ func TestDriverRegister(t *testing.T) {
 		{
 			mock: func(repository *repositories_mock.MockDriverRepository) {
 				repository.EXPECT().
-					Create("foo", token, "foo").
+					Create(models.NewDriver("foo", token, "foo")).
 					Return(lib.ErrNotFound).
 					Times(1)
 			},
@@ -101,14 +226,14 @@ func TestDriverRegister(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
-			out, err := usecase.Register("foo", "foo")
+			out, err := usecase.Register(driver.RegisterParams{Name: "foo", State: "foo"})
 
 			if out != token || !errors.Is(err, tt.err) {
-				t.Errorf("usecase.Register(\"foo\", \"foo\") = (%s, %v): expected (%s, %v)", out, err, token, tt.err)
+				t.Errorf("usecase.Register(params) = (%s, %v): expected (%s, %v)", out, err, token, tt.err)
 			}
 		})
 	}
@@ -159,7 +284,7 @@ func TestDriverAuthorize(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return "" })
@@ -210,7 +335,7 @@ func TestDriverGetState(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -304,7 +429,7 @@ func TestDriverSetState(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -355,7 +480,7 @@ func TestDriverGetStatus(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -443,7 +568,7 @@ func TestDriverSetStatus(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -502,7 +627,7 @@ func TestDriverGetOp(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -565,6 +690,34 @@ func TestDriverSetOp(t *testing.T) {
 			},
 			err: lib.ErrNotFound,
 		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Token:  token,
+						State:  "foo",
+						Status: driver.Error,
+						Op:     nil,
+					}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{
+						Name:   "foo",
+						Token:  token,
+						State:  "foo",
+						Status: driver.Busy,
+						Op: &driver.Op{
+							Name: "op",
+							Arg:  "arg",
+						},
+					}).
+					Return(nil).
+					Times(1)
+			},
+			err: nil,
+		},
 		{
 			mock: func(repository *repositories_mock.MockDriverRepository) {
 				repository.EXPECT().
@@ -578,7 +731,7 @@ func TestDriverSetOp(t *testing.T) {
 					}, nil).
 					Times(1)
 			},
-			err: lib.ErrAlreadyExists,
+			err: lib.ErrBusy,
 		},
 		{
 			mock: func(repository *repositories_mock.MockDriverRepository) {
@@ -596,7 +749,7 @@ func TestDriverSetOp(t *testing.T) {
 					}, nil).
 					Times(1)
 			},
-			err: lib.ErrAlreadyExists,
+			err: lib.ErrBusy,
 		},
 	}
 
@@ -605,7 +758,7 @@ func TestDriverSetOp(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -662,7 +815,7 @@ func TestDriverDelete(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			repository := repositories_mock.NewMockDriverRepository(ctrl)
+			repository := newDriverRepository(ctrl)
 			tt.mock(repository)
 
 			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
@@ -674,3 +827,702 @@ func TestDriverDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDriverLease(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	lease := time.Minute
+
+	cases := []struct {
+		mock func(repository *repositories_mock.MockDriverRepository)
+		call func(usecase usecases.DriverUsecase) (driver.Status, error)
+		out  driver.Status
+		err  error
+	}{
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Idle,
+						Seen:   now.Add(-lease),
+					}, nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) (driver.Status, error) {
+				return usecase.GetStatus("foo")
+			},
+			out: driver.Idle,
+			err: nil,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Busy,
+						Seen:   now.Add(-lease - time.Second),
+					}, nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) (driver.Status, error) {
+				return usecase.GetStatus("foo")
+			},
+			out: driver.Lost,
+			err: nil,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Idle,
+						Seen:   now.Add(-lease - time.Second),
+					}, nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) (driver.Status, error) {
+				return driver.Lost, usecase.SetOp("foo", driver.Op{Name: "foo"})
+			},
+			out: driver.Lost,
+			err: lib.ErrBusy,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Idle,
+						Seen:   now.Add(-time.Hour),
+					}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Idle,
+						Seen:   now,
+					}).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) (driver.Status, error) {
+				_, err := usecase.GetOp("foo")
+				return driver.Idle, err
+			},
+			out: driver.Idle,
+			err: nil,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Create(models.DriverModel{
+						Name:   "foo",
+						Token:  "token",
+						Status: driver.Idle,
+						Seen:   now,
+					}).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) (driver.Status, error) {
+				_, err := usecase.Register(driver.RegisterParams{Name: "foo"})
+				return driver.Idle, err
+			},
+			out: driver.Idle,
+			err: nil,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := newDriverRepository(ctrl)
+			tt.mock(repository)
+
+			usecase := usecases.NewDriverUsecase(
+				repository,
+				func() string { return "token" },
+				usecases.WithClock(func() time.Time { return now }),
+				usecases.WithLease(lease),
+			)
+			out, err := tt.call(usecase)
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: %v, expected %v", err, tt.err)
+			}
+
+			if out != tt.out {
+				t.Errorf("status = %v: expected %v", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestDriverCancelOp(t *testing.T) {
+	token := lib.Base32String(lib.NewToken(20))
+
+	cases := []struct {
+		dispatcher string
+		admin      bool
+		mock       func(repository *repositories_mock.MockDriverRepository)
+		err        error
+	}{
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Token:  token,
+						State:  "foo",
+						Status: driver.Busy,
+						Op: &driver.Op{
+							Name: "op",
+							Arg:  "arg",
+						},
+					}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{
+						Name:   "foo",
+						Token:  token,
+						State:  "foo",
+						Status: driver.Idle,
+						Op:     nil,
+					}).
+					Return(nil).
+					Times(1)
+			},
+			err: nil,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{}, lib.ErrNotFound).
+					Times(1)
+			},
+			err: lib.ErrNotFound,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Token:  token,
+						State:  "foo",
+						Status: driver.Idle,
+						Op:     nil,
+					}, nil).
+					Times(1)
+			},
+			err: lib.ErrNotFound,
+		},
+		{
+			dispatcher: "bob",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:       "foo",
+						Status:     driver.Busy,
+						Op:         &driver.Op{Name: "op"},
+						Dispatcher: "bob",
+					}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Idle,
+					}).
+					Return(nil).
+					Times(1)
+			},
+			err: nil,
+		},
+		{
+			dispatcher: "bob",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:       "foo",
+						Status:     driver.Busy,
+						Op:         &driver.Op{Name: "op"},
+						Dispatcher: "alice",
+					}, nil).
+					Times(1)
+			},
+			err: lib.ErrForbidden,
+		},
+		{
+			dispatcher: "bob",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Busy,
+						Op:     &driver.Op{Name: "op"},
+					}, nil).
+					Times(1)
+			},
+			err: lib.ErrForbidden,
+		},
+		{
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:       "foo",
+						Status:     driver.Busy,
+						Op:         &driver.Op{Name: "op"},
+						Dispatcher: "alice",
+					}, nil).
+					Times(1)
+			},
+			err: lib.ErrForbidden,
+		},
+		{
+			dispatcher: "facility",
+			admin:      true,
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{
+						Name:       "foo",
+						Status:     driver.Busy,
+						Op:         &driver.Op{Name: "op"},
+						Dispatcher: "alice",
+					}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{
+						Name:   "foo",
+						Status: driver.Idle,
+					}).
+					Return(nil).
+					Times(1)
+			},
+			err: nil,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := newDriverRepository(ctrl)
+			tt.mock(repository)
+
+			usecase := usecases.NewDriverUsecase(repository, func() string { return token })
+			err := usecase.CancelOp("foo", tt.dispatcher, tt.admin)
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%T.CancelOp(\"foo\", %q, %t): %v, expected %v", usecase, tt.dispatcher, tt.admin, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDriverDispatcher(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	op := &driver.Op{Name: "op"}
+	repository := newDriverRepository(ctrl)
+	gomock.InOrder(
+		repository.EXPECT().
+			Fetch("foo").
+			Return(models.DriverModel{Name: "foo", Status: driver.Idle}, nil).
+			Times(1),
+		repository.EXPECT().
+			Update(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op, Dispatcher: "bob"}).
+			Return(nil).
+			Times(1),
+		repository.EXPECT().
+			Fetch("foo").
+			Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op, Dispatcher: "bob"}, nil).
+			Times(1),
+		repository.EXPECT().
+			Update(models.DriverModel{Name: "foo", Status: driver.Idle}).
+			Return(nil).
+			Times(1),
+	)
+
+	usecase := usecases.NewDriverUsecase(
+		repository,
+		func() string { return "token" },
+		usecases.WithDispatcher("bob"),
+	)
+
+	if err := usecase.SetOp("foo", *op); err != nil {
+		t.Errorf("%T.SetOp(\"foo\", op): %v", usecase, err)
+	}
+	if err := usecase.SetStatus("foo", driver.Idle); err != nil {
+		t.Errorf("%T.SetStatus(\"foo\", driver.Idle): %v", usecase, err)
+	}
+}
+
+func TestDriverAudit(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	op := &driver.Op{Name: "op", Arg: "arg"}
+
+	cases := []struct {
+		actor string
+		mock  func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry)
+		call  func(usecase usecases.DriverUsecase) error
+		out   models.AuditEntry
+	}{
+		{
+			actor: "",
+			mock: func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry) {
+				repository.EXPECT().
+					Create(models.NewDriver("foo", "token", nil), entry).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				_, err := usecase.Register(driver.RegisterParams{Name: "foo"})
+				return err
+			},
+			out: models.AuditEntry{Time: now, Actor: "driver:foo", Action: models.AuditRegister, Driver: "foo"},
+		},
+		{
+			actor: "key:alice",
+			mock: func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Idle}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}, entry).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.SetOp("foo", *op)
+			},
+			out: models.AuditEntry{Time: now, Actor: "key:alice", Action: models.AuditDispatch, Driver: "foo", Op: op},
+		},
+		{
+			actor: "",
+			mock: func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Idle}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}, entry).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.SetOp("foo", *op)
+			},
+			out: models.AuditEntry{Time: now, Actor: "anonymous", Action: models.AuditDispatch, Driver: "foo", Op: op},
+		},
+		{
+			actor: "",
+			mock: func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Error}, entry).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.SetStatus("foo", driver.Error)
+			},
+			out: models.AuditEntry{Time: now, Actor: "driver:foo", Action: models.AuditStatus, Driver: "foo", Op: op, Status: driver.Error},
+		},
+		{
+			actor: "key:bob",
+			mock: func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Idle}, entry).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.CancelOp("foo", "", false)
+			},
+			out: models.AuditEntry{Time: now, Actor: "key:bob", Action: models.AuditCancel, Driver: "foo", Op: op},
+		},
+		{
+			actor: "key:bob",
+			mock: func(repository *repositories_mock.MockDriverRepository, entry models.AuditEntry) {
+				repository.EXPECT().
+					Delete("foo", entry).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.Delete("foo")
+			},
+			out: models.AuditEntry{Time: now, Actor: "key:bob", Action: models.AuditDisconnect, Driver: "foo"},
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := newDriverRepository(ctrl)
+			tt.mock(repository, tt.out)
+
+			usecase := usecases.NewDriverUsecase(
+				repository,
+				func() string { return "token" },
+				usecases.WithClock(func() time.Time { return now }),
+				usecases.WithAudit(tt.actor),
+			)
+
+			if err := tt.call(usecase); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDriverBooking(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	op := driver.Op{Name: "op", Arg: "arg"}
+	bookings := []models.Booking{
+		{ID: "1", Driver: "foo", Holder: "alice", Start: now.Add(-2 * time.Hour), End: now},
+		{ID: "2", Driver: "foo", Holder: "bob", Start: now, End: now.Add(time.Hour)},
+	}
+
+	cases := []struct {
+		holder string
+		err    error
+	}{
+		{holder: "bob", err: nil},
+		{holder: "alice", err: lib.ErrBooked},
+		{holder: "", err: lib.ErrBooked},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.holder, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := newDriverRepository(ctrl)
+			repository.EXPECT().
+				Fetch("foo").
+				Return(models.DriverModel{Name: "foo", Status: driver.Idle}, nil).
+				Times(1)
+			if tt.err == nil {
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Busy, Op: &op}).
+					Return(nil).
+					Times(1)
+			}
+
+			repo := repositories_mock.NewMockBookingRepository(ctrl)
+			repo.EXPECT().
+				List("foo").
+				Return(bookings, nil).
+				Times(1)
+
+			usecase := usecases.NewDriverUsecase(
+				repository,
+				func() string { return "token" },
+				usecases.WithClock(func() time.Time { return now }),
+				usecases.WithBookings(repo, tt.holder),
+			)
+
+			err := usecase.SetOp("foo", op)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("usecase.SetOp(%q, op) = %v, expected %v", "foo", err, tt.err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "booking 2 of driver \"foo\" by \"bob\"") {
+				t.Errorf("usecase.SetOp(%q, op) = %v, expected the booking to be named", "foo", err)
+			}
+		})
+	}
+}
+
+type notifications []string
+
+func (n *notifications) Notify(name string) {
+	*n = append(*n, name)
+}
+
+func TestDriverNotify(t *testing.T) {
+	op := &driver.Op{Name: "op", Arg: "arg"}
+
+	cases := []struct {
+		label string
+		mock  func(repository *repositories_mock.MockDriverRepository)
+		call  func(usecase usecases.DriverUsecase) error
+		out   notifications
+	}{
+		{
+			label: "register",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Create(models.NewDriver("foo", "token", nil)).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				_, err := usecase.Register(driver.RegisterParams{Name: "foo"})
+				return err
+			},
+			out: notifications{"foo"},
+		},
+		{
+			label: "set state",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Idle}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", State: "state", Status: driver.Idle}).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.SetState("foo", "state")
+			},
+			out: notifications{"foo"},
+		},
+		{
+			label: "set op",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Idle}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}).
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.SetOp("foo", *op)
+			},
+			out: notifications{"foo"},
+		},
+		{
+			label: "get op",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}, nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				_, err := usecase.GetOp("foo")
+				return err
+			},
+			out: nil,
+		},
+		{
+			label: "delete",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Delete("foo").
+					Return(nil).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				return usecase.Delete("foo")
+			},
+			out: notifications{"foo"},
+		},
+		{
+			label: "failed update",
+			mock: func(repository *repositories_mock.MockDriverRepository) {
+				repository.EXPECT().
+					Fetch("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: op}, nil).
+					Times(1)
+				repository.EXPECT().
+					Update(models.DriverModel{Name: "foo", Status: driver.Idle}).
+					Return(lib.ErrUnknown).
+					Times(1)
+			},
+			call: func(usecase usecases.DriverUsecase) error {
+				if err := usecase.SetStatus("foo", driver.Idle); !errors.Is(err, lib.ErrUnknown) {
+					return fmt.Errorf("expected %v, got %v", lib.ErrUnknown, err)
+				}
+				return nil
+			},
+			out: nil,
+		},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.label, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := newDriverRepository(ctrl)
+			tt.mock(repository)
+
+			var out notifications
+			usecase := usecases.NewDriverUsecase(
+				repository,
+				func() string { return "token" },
+				usecases.WithNotifier(&out),
+			)
+
+			if err := tt.call(usecase); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(out, tt.out) {
+				t.Errorf("notified %q: expected %q", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestDriverInspect(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	op := &driver.Op{Name: "op", Arg: "arg"}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repository := newDriverRepository(ctrl)
+	repository.EXPECT().
+		Fetch("foo").
+		Return(models.DriverModel{Name: "foo", Token: "token", State: "state", Status: driver.Busy, Op: op, Seen: now.Add(-time.Minute)}, nil).
+		Times(1)
+
+	usecase := usecases.NewDriverUsecase(
+		repository,
+		func() string { return "token" },
+		usecases.WithClock(func() time.Time { return now }),
+		usecases.WithLease(30*time.Second),
+	)
+
+	model, err := usecase.Inspect("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := models.DriverModel{Name: "foo", State: "state", Status: driver.Lost, Op: op, Seen: now.Add(-time.Minute)}
+	if ops := utils.ObjDiff(model, out); ops != nil {
+		t.Errorf("usecase.Inspect(%q):\n%s", "foo", utils.JoinOps(ops, "\n"))
+	}
+}
@@ -0,0 +1,5 @@
+package usecases
+
+type HealthUsecase interface {
+	CheckStorage() error
+}
@@ -0,0 +1,19 @@
+package usecases
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+
+type HealthUsecaseImpl struct {
+	repository repositories.HealthRepository
+}
+
+func NewHealthUsecase(repository repositories.HealthRepository) HealthUsecase {
+	return HealthUsecaseImpl{
+		repository: repository,
+	}
+}
+
+// CheckStorage checks that the storage backend can be written to and read
+// from.
+func (usecase HealthUsecaseImpl) CheckStorage() error {
+	return usecase.repository.Probe()
+}
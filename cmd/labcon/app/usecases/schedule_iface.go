@@ -0,0 +1,10 @@
+package usecases
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type ScheduleUsecase interface {
+	List() ([]models.Schedule, error)
+	Get(name string) (models.Schedule, error)
+	Put(schedule models.Schedule) (models.Schedule, error)
+	Delete(name string) error
+}
@@ -0,0 +1,105 @@
+package usecases
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+type ScheduleUsecaseImpl struct {
+	repository repositories.ScheduleRepository
+	now        func() time.Time
+	notifier   DriverNotifier
+	owner      string
+}
+
+// ScheduleUsecaseOption configures a ScheduleUsecaseImpl.
+type ScheduleUsecaseOption func(usecase *ScheduleUsecaseImpl)
+
+// WithScheduleClock sets the function giving the current time.
+func WithScheduleClock(now func() time.Time) ScheduleUsecaseOption {
+	return func(usecase *ScheduleUsecaseImpl) {
+		usecase.now = now
+	}
+}
+
+// WithScheduleNotifier sets the notifier of changes to schedules, which are
+// notified as "schedule/{name}" so that the scheduler wakes to reconsider
+// them.
+func WithScheduleNotifier(notifier DriverNotifier) ScheduleUsecaseOption {
+	return func(usecase *ScheduleUsecaseImpl) {
+		usecase.notifier = notifier
+	}
+}
+
+// WithScheduleOwner sets the name of the API key on whose behalf schedules
+// are put, which the scheduler then dispatches their operations on behalf of.
+func WithScheduleOwner(name string) ScheduleUsecaseOption {
+	return func(usecase *ScheduleUsecaseImpl) {
+		usecase.owner = name
+	}
+}
+
+func NewScheduleUsecase(repository repositories.ScheduleRepository, opts ...ScheduleUsecaseOption) ScheduleUsecase {
+	usecase := ScheduleUsecaseImpl{
+		repository: repository,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&usecase)
+	}
+	return usecase
+}
+
+func (usecase ScheduleUsecaseImpl) notify(name string) {
+	if usecase.notifier != nil {
+		usecase.notifier.Notify("schedule/" + name)
+	}
+}
+
+func (usecase ScheduleUsecaseImpl) List() ([]models.Schedule, error) {
+	return usecase.repository.List()
+}
+
+func (usecase ScheduleUsecaseImpl) Get(name string) (models.Schedule, error) {
+	return usecase.repository.Fetch(name)
+}
+
+// Put creates the schedule or replaces the schedule of the same name, keeping
+// its firings, and returns it with the time it fires next. The schedule is
+// owned by whoever puts it last. Owner, Next and Firings of the given schedule
+// are ignored.
+func (usecase ScheduleUsecaseImpl) Put(schedule models.Schedule) (models.Schedule, error) {
+	now := usecase.now()
+	schedule.Owner = usecase.owner
+	schedule.Next, schedule.Firings = nil, nil
+	if !schedule.Disabled {
+		schedule.Next = schedule.NextAfter(now)
+	}
+
+	stored, err := usecase.repository.Update(schedule.Name, func(stored *models.Schedule) error {
+		firings := stored.Firings
+		*stored = schedule
+		stored.Firings = firings
+		return nil
+	})
+	if errors.Is(err, lib.ErrNotFound) {
+		stored, err = schedule, usecase.repository.Put(schedule)
+	}
+	if err != nil {
+		return stored, err
+	}
+	usecase.notify(schedule.Name)
+	return stored, nil
+}
+
+func (usecase ScheduleUsecaseImpl) Delete(name string) error {
+	if err := usecase.repository.Delete(name); err != nil {
+		return err
+	}
+	usecase.notify(name)
+	return nil
+}
@@ -0,0 +1,16 @@
+package usecases
+
+import "github.com/ktnyt/labcon/cmd/labcon/app/models"
+
+type WorkflowUsecase interface {
+	List() ([]string, error)
+	Get(name string) (models.Workflow, error)
+	Put(workflow models.Workflow) error
+	Delete(name string) error
+	Start(name string) (models.RunModel, error)
+	ListRuns() ([]models.RunModel, error)
+	GetRun(id string) (models.RunModel, error)
+	Pause(id string) (models.RunModel, error)
+	Resume(id string) (models.RunModel, error)
+	Abort(id string) (models.RunModel, error)
+}
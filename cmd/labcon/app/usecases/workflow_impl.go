@@ -0,0 +1,190 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+var (
+	ErrRunStatus = errors.New("run cannot do this in its current status")
+)
+
+type WorkflowUsecaseImpl struct {
+	workflows repositories.WorkflowRepository
+	runs      repositories.RunRepository
+	drivers   DriverUsecase
+	now       func() time.Time
+	notifier  DriverNotifier
+	owner     string
+}
+
+// WorkflowUsecaseOption configures a WorkflowUsecaseImpl.
+type WorkflowUsecaseOption func(usecase *WorkflowUsecaseImpl)
+
+// WithWorkflowClock sets the function giving the current time.
+func WithWorkflowClock(now func() time.Time) WorkflowUsecaseOption {
+	return func(usecase *WorkflowUsecaseImpl) {
+		usecase.now = now
+	}
+}
+
+// WithRunNotifier sets the notifier of changes to runs, which are notified as
+// "run/{id}" so that the workflow engine wakes to advance them.
+func WithRunNotifier(notifier DriverNotifier) WorkflowUsecaseOption {
+	return func(usecase *WorkflowUsecaseImpl) {
+		usecase.notifier = notifier
+	}
+}
+
+// WithRunOwner sets the name of the API key on whose behalf runs are started,
+// which the workflow engine then dispatches their operations on behalf of.
+func WithRunOwner(name string) WorkflowUsecaseOption {
+	return func(usecase *WorkflowUsecaseImpl) {
+		usecase.owner = name
+	}
+}
+
+// NewWorkflowUsecase returns a usecase managing workflows and their runs. The
+// drivers are used to cancel the operations of aborted runs.
+func NewWorkflowUsecase(workflows repositories.WorkflowRepository, runs repositories.RunRepository, drivers DriverUsecase, opts ...WorkflowUsecaseOption) WorkflowUsecase {
+	usecase := WorkflowUsecaseImpl{
+		workflows: workflows,
+		runs:      runs,
+		drivers:   drivers,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(&usecase)
+	}
+	return usecase
+}
+
+func (usecase WorkflowUsecaseImpl) notify(run models.RunModel) {
+	if usecase.notifier != nil {
+		usecase.notifier.Notify("run/" + run.ID)
+	}
+}
+
+func (usecase WorkflowUsecaseImpl) List() ([]string, error) {
+	return usecase.workflows.List()
+}
+
+func (usecase WorkflowUsecaseImpl) Get(name string) (models.Workflow, error) {
+	return usecase.workflows.Fetch(name)
+}
+
+func (usecase WorkflowUsecaseImpl) Put(workflow models.Workflow) error {
+	return usecase.workflows.Put(workflow)
+}
+
+func (usecase WorkflowUsecaseImpl) Delete(name string) error {
+	return usecase.workflows.Delete(name)
+}
+
+// Start creates a run of the named workflow, which the workflow engine then
+// advances.
+func (usecase WorkflowUsecaseImpl) Start(name string) (models.RunModel, error) {
+	workflow, err := usecase.workflows.Fetch(name)
+	if err != nil {
+		return models.RunModel{}, err
+	}
+	run := models.NewRun(workflow, usecase.now())
+	run.Owner = usecase.owner
+	run, err = usecase.runs.Create(run)
+	if err != nil {
+		return run, err
+	}
+	usecase.notify(run)
+	return run, nil
+}
+
+func (usecase WorkflowUsecaseImpl) ListRuns() ([]models.RunModel, error) {
+	return usecase.runs.List()
+}
+
+func (usecase WorkflowUsecaseImpl) GetRun(id string) (models.RunModel, error) {
+	return usecase.runs.Fetch(id)
+}
+
+// Pause stops the run from advancing. An operation it has dispatched goes on,
+// and the time left in its current delay or wait is kept for when it resumes.
+func (usecase WorkflowUsecaseImpl) Pause(id string) (models.RunModel, error) {
+	return usecase.update(id, models.RunRunning, func(run *models.RunModel, now time.Time) {
+		run.Status = models.RunPaused
+		if run.Deadline != nil {
+			remaining := models.Duration(run.Deadline.Sub(now))
+			if remaining < 0 {
+				remaining = 0
+			}
+			run.Deadline, run.Remaining = nil, &remaining
+		}
+	})
+}
+
+func (usecase WorkflowUsecaseImpl) Resume(id string) (models.RunModel, error) {
+	return usecase.update(id, models.RunPaused, func(run *models.RunModel, now time.Time) {
+		run.Status = models.RunRunning
+		if run.Remaining != nil {
+			deadline := now.Add(time.Duration(*run.Remaining))
+			run.Deadline, run.Remaining = &deadline, nil
+		}
+	})
+}
+
+// Abort ends a running or paused run. An operation it has dispatched and is
+// waiting for is cancelled if the driver has yet to complete it. Operations
+// that the workflow engine dispatches while the run is aborted are cancelled
+// by the engine.
+func (usecase WorkflowUsecaseImpl) Abort(id string) (models.RunModel, error) {
+	run, err := usecase.update(id, "", func(run *models.RunModel, now time.Time) {
+		run.Status = models.RunAborted
+		run.Finished = &now
+	})
+	if err != nil || !run.Dispatched && !run.Dispatching {
+		return run, err
+	}
+
+	current, ok := run.Current()
+	if !ok || current.Step.Dispatch == nil {
+		return run, nil
+	}
+	step := current.Step.Dispatch
+	model, err := usecase.drivers.Inspect(step.Driver)
+	if errors.Is(err, lib.ErrNotFound) {
+		return run, nil
+	}
+	if err != nil {
+		return run, err
+	}
+	if model.Op == nil || model.Origin != "run/"+run.ID {
+		return run, nil
+	}
+	if err := usecase.drivers.CancelOp(step.Driver, run.Owner, false); err != nil && !errors.Is(err, lib.ErrNotFound) {
+		return run, fmt.Errorf("failed to cancel operation %q of driver %q: %w", step.Op.Name, step.Driver, err)
+	}
+	return run, nil
+}
+
+// update applies f to the run if it has the given status, or has yet to
+// finish if the status is empty.
+func (usecase WorkflowUsecaseImpl) update(id string, status models.RunStatus, f func(run *models.RunModel, now time.Time)) (models.RunModel, error) {
+	run, err := usecase.runs.Update(id, func(run *models.RunModel) error {
+		if run.Status.Done() || status != "" && run.Status != status {
+			return fmt.Errorf("%w: run %s is %s", ErrRunStatus, id, run.Status)
+		}
+		now := usecase.now()
+		f(run, now)
+		run.Updated = now
+		return nil
+	})
+	if err != nil {
+		return run, err
+	}
+	usecase.notify(run)
+	return run, nil
+}
@@ -0,0 +1,249 @@
+package usecases_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases_mock"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+// newRunRepository returns a mock repository whose Update applies the update
+// to the given run.
+func newRunRepository(ctrl *gomock.Controller, run models.RunModel) *repositories_mock.MockRunRepository {
+	repository := repositories_mock.NewMockRunRepository(ctrl)
+	repository.EXPECT().
+		Update(run.ID, gomock.Any()).
+		DoAndReturn(func(id string, f func(run *models.RunModel) error) (models.RunModel, error) {
+			err := f(&run)
+			return run, err
+		}).
+		Times(1)
+	return repository
+}
+
+func durationPtr(d time.Duration) *models.Duration {
+	duration := models.Duration(d)
+	return &duration
+}
+
+func TestWorkflowPause(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	deadline := now.Add(30 * time.Second)
+	passed := now.Add(-time.Second)
+
+	cases := []struct {
+		in  models.RunModel
+		out models.RunModel
+		err error
+	}{
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunRunning},
+			out: models.RunModel{ID: "1", Status: models.RunPaused, Updated: now},
+			err: nil,
+		},
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunRunning, Deadline: &deadline},
+			out: models.RunModel{ID: "1", Status: models.RunPaused, Remaining: durationPtr(30 * time.Second), Updated: now},
+			err: nil,
+		},
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunRunning, Deadline: &passed},
+			out: models.RunModel{ID: "1", Status: models.RunPaused, Remaining: durationPtr(0), Updated: now},
+			err: nil,
+		},
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunPaused, Remaining: durationPtr(time.Second)},
+			out: models.RunModel{ID: "1", Status: models.RunPaused, Remaining: durationPtr(time.Second)},
+			err: usecases.ErrRunStatus,
+		},
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunCompleted},
+			out: models.RunModel{ID: "1", Status: models.RunCompleted},
+			err: usecases.ErrRunStatus,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			runs := newRunRepository(ctrl, tt.in)
+			drivers := usecases_mock.NewMockDriverUsecase(ctrl)
+
+			usecase := usecases.NewWorkflowUsecase(nil, runs, drivers, usecases.WithWorkflowClock(func() time.Time { return now }))
+			out, err := usecase.Pause("1")
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%T.Pause(\"1\") = %v: expected %v", usecase, err, tt.err)
+			}
+			if diff := utils.ObjDiff(out, tt.out); diff != nil {
+				t.Errorf("%T.Pause(\"1\") mismatch:\n%s", usecase, utils.JoinOps(diff, "\n"))
+			}
+		})
+	}
+}
+
+func TestWorkflowResume(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	deadline := now.Add(30 * time.Second)
+
+	cases := []struct {
+		in  models.RunModel
+		out models.RunModel
+		err error
+	}{
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunPaused},
+			out: models.RunModel{ID: "1", Status: models.RunRunning, Updated: now},
+			err: nil,
+		},
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunPaused, Remaining: durationPtr(30 * time.Second)},
+			out: models.RunModel{ID: "1", Status: models.RunRunning, Deadline: &deadline, Updated: now},
+			err: nil,
+		},
+		{
+			in:  models.RunModel{ID: "1", Status: models.RunRunning},
+			out: models.RunModel{ID: "1", Status: models.RunRunning},
+			err: usecases.ErrRunStatus,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			runs := newRunRepository(ctrl, tt.in)
+			drivers := usecases_mock.NewMockDriverUsecase(ctrl)
+
+			usecase := usecases.NewWorkflowUsecase(nil, runs, drivers, usecases.WithWorkflowClock(func() time.Time { return now }))
+			out, err := usecase.Resume("1")
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%T.Resume(\"1\") = %v: expected %v", usecase, err, tt.err)
+			}
+			if diff := utils.ObjDiff(out, tt.out); diff != nil {
+				t.Errorf("%T.Resume(\"1\") mismatch:\n%s", usecase, utils.JoinOps(diff, "\n"))
+			}
+		})
+	}
+}
+
+func TestWorkflowAbort(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	op := driver.Op{Name: "aspirate"}
+	definition := models.Workflow{
+		Name:  "prep",
+		Steps: []models.Step{{Dispatch: &models.DispatchStep{Driver: "foo", Op: op}}},
+	}
+
+	cases := []struct {
+		in   models.RunModel
+		mock func(drivers *usecases_mock.MockDriverUsecase)
+		err  error
+	}{
+		{
+			in:   models.RunModel{ID: "1", Definition: definition, Status: models.RunRunning},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {},
+			err:  nil,
+		},
+		{
+			in: models.RunModel{ID: "1", Definition: definition, Status: models.RunRunning, Owner: "alice", Dispatched: true},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {
+				drivers.EXPECT().
+					Inspect("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: &op, Dispatcher: "alice", Origin: "run/1"}, nil).
+					Times(1)
+				drivers.EXPECT().
+					CancelOp("foo", "alice", false).
+					Return(nil).
+					Times(1)
+			},
+			err: nil,
+		},
+		{
+			in: models.RunModel{ID: "1", Definition: definition, Status: models.RunPaused, Dispatching: true},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {
+				drivers.EXPECT().
+					Inspect("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: &op, Origin: "run/1"}, nil).
+					Times(1)
+				drivers.EXPECT().
+					CancelOp("foo", "", false).
+					Return(lib.ErrNotFound).
+					Times(1)
+			},
+			err: nil,
+		},
+		{
+			in: models.RunModel{ID: "1", Definition: definition, Status: models.RunRunning, Dispatched: true},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {
+				drivers.EXPECT().
+					Inspect("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: &op, Origin: "run/2"}, nil).
+					Times(1)
+			},
+			err: nil,
+		},
+		{
+			in: models.RunModel{ID: "1", Definition: definition, Status: models.RunRunning, Dispatched: true},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {
+				drivers.EXPECT().
+					Inspect("foo").
+					Return(models.DriverModel{}, lib.ErrNotFound).
+					Times(1)
+			},
+			err: nil,
+		},
+		{
+			in: models.RunModel{ID: "1", Definition: definition, Status: models.RunRunning, Dispatched: true},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {
+				drivers.EXPECT().
+					Inspect("foo").
+					Return(models.DriverModel{Name: "foo", Status: driver.Busy, Op: &op, Origin: "run/1"}, nil).
+					Times(1)
+				drivers.EXPECT().
+					CancelOp("foo", "", false).
+					Return(lib.ErrUnknown).
+					Times(1)
+			},
+			err: lib.ErrUnknown,
+		},
+		{
+			in:   models.RunModel{ID: "1", Definition: definition, Status: models.RunFailed, Dispatched: true},
+			mock: func(drivers *usecases_mock.MockDriverUsecase) {},
+			err:  usecases.ErrRunStatus,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			runs := newRunRepository(ctrl, tt.in)
+			drivers := usecases_mock.NewMockDriverUsecase(ctrl)
+			tt.mock(drivers)
+
+			usecase := usecases.NewWorkflowUsecase(nil, runs, drivers, usecases.WithWorkflowClock(func() time.Time { return now }))
+			out, err := usecase.Abort("1")
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%T.Abort(\"1\") = %v: expected %v", usecase, err, tt.err)
+			}
+			if tt.err == nil && (out.Status != models.RunAborted || out.Finished == nil || !out.Finished.Equal(now)) {
+				t.Errorf("%T.Abort(\"1\") = %+v: expected the run to be aborted at %v", usecase, out, now)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/usecases/audit_iface.go
+
+// Package usecases_mock is a generated GoMock package.
+package usecases_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockAuditUsecase is a mock of AuditUsecase interface.
+type MockAuditUsecase struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditUsecaseMockRecorder
+}
+
+// MockAuditUsecaseMockRecorder is the mock recorder for MockAuditUsecase.
+type MockAuditUsecaseMockRecorder struct {
+	mock *MockAuditUsecase
+}
+
+// NewMockAuditUsecase creates a new mock instance.
+func NewMockAuditUsecase(ctrl *gomock.Controller) *MockAuditUsecase {
+	mock := &MockAuditUsecase{ctrl: ctrl}
+	mock.recorder = &MockAuditUsecaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditUsecase) EXPECT() *MockAuditUsecaseMockRecorder {
+	return m.recorder
+}
+
+// Each mocks base method.
+func (m *MockAuditUsecase) Each(query models.AuditQuery, f func(models.AuditEntry) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Each", query, f)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Each indicates an expected call of Each.
+func (mr *MockAuditUsecaseMockRecorder) Each(query, f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Each", reflect.TypeOf((*MockAuditUsecase)(nil).Each), query, f)
+}
+
+// List mocks base method.
+func (m *MockAuditUsecase) List(query models.AuditQuery) ([]models.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", query)
+	ret0, _ := ret[0].([]models.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAuditUsecaseMockRecorder) List(query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAuditUsecase)(nil).List), query)
+}
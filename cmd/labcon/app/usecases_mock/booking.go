@@ -0,0 +1,95 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/usecases/booking_iface.go
+
+// Package usecases_mock is a generated GoMock package.
+package usecases_mock
+
+import (
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockBookingUsecase is a mock of BookingUsecase interface.
+type MockBookingUsecase struct {
+	ctrl     *gomock.Controller
+	recorder *MockBookingUsecaseMockRecorder
+}
+
+// MockBookingUsecaseMockRecorder is the mock recorder for MockBookingUsecase.
+type MockBookingUsecaseMockRecorder struct {
+	mock *MockBookingUsecase
+}
+
+// NewMockBookingUsecase creates a new mock instance.
+func NewMockBookingUsecase(ctrl *gomock.Controller) *MockBookingUsecase {
+	mock := &MockBookingUsecase{ctrl: ctrl}
+	mock.recorder = &MockBookingUsecaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBookingUsecase) EXPECT() *MockBookingUsecaseMockRecorder {
+	return m.recorder
+}
+
+// Cancel mocks base method.
+func (m *MockBookingUsecase) Cancel(driver, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", driver, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockBookingUsecaseMockRecorder) Cancel(driver, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockBookingUsecase)(nil).Cancel), driver, id)
+}
+
+// Create mocks base method.
+func (m *MockBookingUsecase) Create(booking models.Booking) (models.Booking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", booking)
+	ret0, _ := ret[0].(models.Booking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockBookingUsecaseMockRecorder) Create(booking interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockBookingUsecase)(nil).Create), booking)
+}
+
+// Get mocks base method.
+func (m *MockBookingUsecase) Get(driver, id string) (models.Booking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", driver, id)
+	ret0, _ := ret[0].(models.Booking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockBookingUsecaseMockRecorder) Get(driver, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockBookingUsecase)(nil).Get), driver, id)
+}
+
+// List mocks base method.
+func (m *MockBookingUsecase) List(driver string, from, to time.Time) ([]models.Booking, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", driver, from, to)
+	ret0, _ := ret[0].([]models.Booking)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockBookingUsecaseMockRecorder) List(driver, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockBookingUsecase)(nil).List), driver, from, to)
+}
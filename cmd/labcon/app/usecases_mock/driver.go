@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
 	driver "github.com/ktnyt/labcon/driver"
 )
 
@@ -48,6 +49,20 @@ func (mr *MockDriverUsecaseMockRecorder) Authorize(name, token interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockDriverUsecase)(nil).Authorize), name, token)
 }
 
+// CancelOp mocks base method.
+func (m *MockDriverUsecase) CancelOp(name, dispatcher string, admin bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelOp", name, dispatcher, admin)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelOp indicates an expected call of CancelOp.
+func (mr *MockDriverUsecaseMockRecorder) CancelOp(name, dispatcher, admin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelOp", reflect.TypeOf((*MockDriverUsecase)(nil).CancelOp), name, dispatcher, admin)
+}
+
 // Delete mocks base method.
 func (m *MockDriverUsecase) Delete(name string) error {
 	m.ctrl.T.Helper()
@@ -107,6 +122,21 @@ func (mr *MockDriverUsecaseMockRecorder) GetStatus(name interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatus", reflect.TypeOf((*MockDriverUsecase)(nil).GetStatus), name)
 }
 
+// Inspect mocks base method.
+func (m *MockDriverUsecase) Inspect(name string) (models.DriverModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Inspect", name)
+	ret0, _ := ret[0].(models.DriverModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Inspect indicates an expected call of Inspect.
+func (mr *MockDriverUsecaseMockRecorder) Inspect(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inspect", reflect.TypeOf((*MockDriverUsecase)(nil).Inspect), name)
+}
+
 // List mocks base method.
 func (m *MockDriverUsecase) List() ([]string, error) {
 	m.ctrl.T.Helper()
@@ -123,18 +153,32 @@ func (mr *MockDriverUsecaseMockRecorder) List() *gomock.Call {
 }
 
 // Register mocks base method.
-func (m *MockDriverUsecase) Register(name string, state interface{}) (string, error) {
+func (m *MockDriverUsecase) Register(params driver.RegisterParams) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Register", name, state)
+	ret := m.ctrl.Call(m, "Register", params)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Register indicates an expected call of Register.
-func (mr *MockDriverUsecaseMockRecorder) Register(name, state interface{}) *gomock.Call {
+func (mr *MockDriverUsecaseMockRecorder) Register(params interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockDriverUsecase)(nil).Register), name, state)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockDriverUsecase)(nil).Register), params)
+}
+
+// SetInfo mocks base method.
+func (m *MockDriverUsecase) SetInfo(name string, info driver.Info) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetInfo", name, info)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetInfo indicates an expected call of SetInfo.
+func (mr *MockDriverUsecaseMockRecorder) SetInfo(name, info interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInfo", reflect.TypeOf((*MockDriverUsecase)(nil).SetInfo), name, info)
 }
 
 // SetOp mocks base method.
@@ -178,3 +222,18 @@ func (mr *MockDriverUsecaseMockRecorder) SetStatus(name, status interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStatus", reflect.TypeOf((*MockDriverUsecase)(nil).SetStatus), name, status)
 }
+
+// Summaries mocks base method.
+func (m *MockDriverUsecase) Summaries(selector models.Selector) ([]driver.Summary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Summaries", selector)
+	ret0, _ := ret[0].([]driver.Summary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Summaries indicates an expected call of Summaries.
+func (mr *MockDriverUsecaseMockRecorder) Summaries(selector interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Summaries", reflect.TypeOf((*MockDriverUsecase)(nil).Summaries), selector)
+}
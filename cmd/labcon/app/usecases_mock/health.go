@@ -0,0 +1,48 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/usecases/health_iface.go
+
+// Package usecases_mock is a generated GoMock package.
+package usecases_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockHealthUsecase is a mock of HealthUsecase interface.
+type MockHealthUsecase struct {
+	ctrl     *gomock.Controller
+	recorder *MockHealthUsecaseMockRecorder
+}
+
+// MockHealthUsecaseMockRecorder is the mock recorder for MockHealthUsecase.
+type MockHealthUsecaseMockRecorder struct {
+	mock *MockHealthUsecase
+}
+
+// NewMockHealthUsecase creates a new mock instance.
+func NewMockHealthUsecase(ctrl *gomock.Controller) *MockHealthUsecase {
+	mock := &MockHealthUsecase{ctrl: ctrl}
+	mock.recorder = &MockHealthUsecaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHealthUsecase) EXPECT() *MockHealthUsecaseMockRecorder {
+	return m.recorder
+}
+
+// CheckStorage mocks base method.
+func (m *MockHealthUsecase) CheckStorage() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckStorage")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckStorage indicates an expected call of CheckStorage.
+func (mr *MockHealthUsecaseMockRecorder) CheckStorage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckStorage", reflect.TypeOf((*MockHealthUsecase)(nil).CheckStorage))
+}
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/usecases/schedule_iface.go
+
+// Package usecases_mock is a generated GoMock package.
+package usecases_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockScheduleUsecase is a mock of ScheduleUsecase interface.
+type MockScheduleUsecase struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleUsecaseMockRecorder
+}
+
+// MockScheduleUsecaseMockRecorder is the mock recorder for MockScheduleUsecase.
+type MockScheduleUsecaseMockRecorder struct {
+	mock *MockScheduleUsecase
+}
+
+// NewMockScheduleUsecase creates a new mock instance.
+func NewMockScheduleUsecase(ctrl *gomock.Controller) *MockScheduleUsecase {
+	mock := &MockScheduleUsecase{ctrl: ctrl}
+	mock.recorder = &MockScheduleUsecaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduleUsecase) EXPECT() *MockScheduleUsecaseMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockScheduleUsecase) Delete(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockScheduleUsecaseMockRecorder) Delete(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockScheduleUsecase)(nil).Delete), name)
+}
+
+// Get mocks base method.
+func (m *MockScheduleUsecase) Get(name string) (models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", name)
+	ret0, _ := ret[0].(models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockScheduleUsecaseMockRecorder) Get(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockScheduleUsecase)(nil).Get), name)
+}
+
+// List mocks base method.
+func (m *MockScheduleUsecase) List() ([]models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockScheduleUsecaseMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockScheduleUsecase)(nil).List))
+}
+
+// Put mocks base method.
+func (m *MockScheduleUsecase) Put(schedule models.Schedule) (models.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", schedule)
+	ret0, _ := ret[0].(models.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockScheduleUsecaseMockRecorder) Put(schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockScheduleUsecase)(nil).Put), schedule)
+}
@@ -0,0 +1,183 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: cmd/labcon/app/usecases/workflow_iface.go
+
+// Package usecases_mock is a generated GoMock package.
+package usecases_mock
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	models "github.com/ktnyt/labcon/cmd/labcon/app/models"
+)
+
+// MockWorkflowUsecase is a mock of WorkflowUsecase interface.
+type MockWorkflowUsecase struct {
+	ctrl     *gomock.Controller
+	recorder *MockWorkflowUsecaseMockRecorder
+}
+
+// MockWorkflowUsecaseMockRecorder is the mock recorder for MockWorkflowUsecase.
+type MockWorkflowUsecaseMockRecorder struct {
+	mock *MockWorkflowUsecase
+}
+
+// NewMockWorkflowUsecase creates a new mock instance.
+func NewMockWorkflowUsecase(ctrl *gomock.Controller) *MockWorkflowUsecase {
+	mock := &MockWorkflowUsecase{ctrl: ctrl}
+	mock.recorder = &MockWorkflowUsecaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWorkflowUsecase) EXPECT() *MockWorkflowUsecaseMockRecorder {
+	return m.recorder
+}
+
+// Abort mocks base method.
+func (m *MockWorkflowUsecase) Abort(id string) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Abort", id)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Abort indicates an expected call of Abort.
+func (mr *MockWorkflowUsecaseMockRecorder) Abort(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Abort", reflect.TypeOf((*MockWorkflowUsecase)(nil).Abort), id)
+}
+
+// Delete mocks base method.
+func (m *MockWorkflowUsecase) Delete(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockWorkflowUsecaseMockRecorder) Delete(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWorkflowUsecase)(nil).Delete), name)
+}
+
+// Get mocks base method.
+func (m *MockWorkflowUsecase) Get(name string) (models.Workflow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", name)
+	ret0, _ := ret[0].(models.Workflow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockWorkflowUsecaseMockRecorder) Get(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockWorkflowUsecase)(nil).Get), name)
+}
+
+// GetRun mocks base method.
+func (m *MockWorkflowUsecase) GetRun(id string) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRun", id)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRun indicates an expected call of GetRun.
+func (mr *MockWorkflowUsecaseMockRecorder) GetRun(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRun", reflect.TypeOf((*MockWorkflowUsecase)(nil).GetRun), id)
+}
+
+// List mocks base method.
+func (m *MockWorkflowUsecase) List() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWorkflowUsecaseMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWorkflowUsecase)(nil).List))
+}
+
+// ListRuns mocks base method.
+func (m *MockWorkflowUsecase) ListRuns() ([]models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRuns")
+	ret0, _ := ret[0].([]models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRuns indicates an expected call of ListRuns.
+func (mr *MockWorkflowUsecaseMockRecorder) ListRuns() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRuns", reflect.TypeOf((*MockWorkflowUsecase)(nil).ListRuns))
+}
+
+// Pause mocks base method.
+func (m *MockWorkflowUsecase) Pause(id string) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause", id)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockWorkflowUsecaseMockRecorder) Pause(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockWorkflowUsecase)(nil).Pause), id)
+}
+
+// Put mocks base method.
+func (m *MockWorkflowUsecase) Put(workflow models.Workflow) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", workflow)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockWorkflowUsecaseMockRecorder) Put(workflow interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockWorkflowUsecase)(nil).Put), workflow)
+}
+
+// Resume mocks base method.
+func (m *MockWorkflowUsecase) Resume(id string) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resume", id)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockWorkflowUsecaseMockRecorder) Resume(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockWorkflowUsecase)(nil).Resume), id)
+}
+
+// Start mocks base method.
+func (m *MockWorkflowUsecase) Start(name string) (models.RunModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start", name)
+	ret0, _ := ret[0].(models.RunModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockWorkflowUsecaseMockRecorder) Start(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockWorkflowUsecase)(nil).Start), name)
+}
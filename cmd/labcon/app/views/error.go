@@ -0,0 +1,15 @@
+package views
+
+import (
+	"net/http"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func NotFoundView(w http.ResponseWriter, r *http.Request) {
+	lib.WriteError(w, r.Context(), http.StatusNotFound, nil)
+}
+
+func MethodNotAllowedView(w http.ResponseWriter, r *http.Request) {
+	lib.WriteError(w, r.Context(), http.StatusMethodNotAllowed, nil)
+}
@@ -0,0 +1,12 @@
+package views
+
+import (
+	"net/http"
+
+	"github.com/ktnyt/labcon/cmd/labcon/openapi"
+)
+
+func OpenAPIView(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi.Document)
+}
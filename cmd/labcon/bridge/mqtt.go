@@ -0,0 +1,441 @@
+// Package bridge connects drivers to other protocols through the same usecases
+// as the REST controllers.
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+)
+
+// mqttQoS is the quality of service of every subscription and publication,
+// so that commands and mirrored values are delivered at least once.
+const mqttQoS = 1
+
+// mqttPollInterval is how often drivers are mirrored if the server has no
+// notifier.
+const mqttPollInterval = time.Second
+
+var (
+	errNotBridged    = errors.New("driver was not registered over MQTT")
+	errInvalidStatus = errors.New("invalid driver status")
+)
+
+var mqttStatuses = map[driver.Status]bool{
+	driver.Idle:  true,
+	driver.Busy:  true,
+	driver.Lost:  true,
+	driver.Error: true,
+}
+
+// MQTT mirrors drivers to an MQTT broker and accepts commands from it. Under
+// the prefix, e.g. "labcon", each driver has the retained topics
+//
+//	labcon/{name}/state    the state as JSON
+//	labcon/{name}/status   the status, e.g. idle
+//	labcon/{name}/pending  the pending operation as JSON, or empty
+//
+// which are cleared when the driver is deleted. Clients of the broker dispatch
+// operations by publishing them as JSON to labcon/{name}/op. The broker cannot
+// tell the bridge who published them, so they are dispatched on behalf of the
+// actor given with WithActor, or anonymously without one. If API keys are
+// required, as given with WithAuthRequired, operations are refused unless the
+// bridge has an actor, and access to the op topics should be limited by the
+// broker.
+//
+// Devices that only speak MQTT register as drivers by publishing their state
+// as JSON to labcon/{name}/register, after which they publish their state to
+// labcon/{name}/state/set, their status to labcon/{name}/status/set and
+// anything to labcon/{name}/disconnect to delete themselves. The bridge keeps
+// their driver tokens, so only drivers registered over MQTT can be changed
+// this way. Registering again updates the state of a driver registered over
+// MQTT.
+//
+// Commands that fail are reported as JSON on labcon/{name}/error.
+type MQTT struct {
+	opts     *mqtt.ClientOptions
+	inject   injectors.DriverInjector
+	tokens   repositories.TokenRepository
+	prefix   string
+	actor    *lib.Actor
+	required bool
+}
+
+// MQTTOption configures an MQTT bridge.
+type MQTTOption func(bridge *MQTT)
+
+// WithActor sets the actor on whose behalf operations published over MQTT are
+// dispatched.
+func WithActor(actor lib.Actor) MQTTOption {
+	return func(bridge *MQTT) {
+		bridge.actor = &actor
+	}
+}
+
+// WithAuthRequired refuses operations published over MQTT if the bridge has no
+// actor, as requests without an API key are refused over HTTP.
+func WithAuthRequired(required bool) MQTTOption {
+	return func(bridge *MQTT) {
+		bridge.required = required
+	}
+}
+
+// NewMQTT returns a bridge connecting to the broker with the given client
+// options. The tokens of drivers registered over MQTT are kept in tokens.
+func NewMQTT(opts *mqtt.ClientOptions, inject injectors.DriverInjector, tokens repositories.TokenRepository, prefix string, options ...MQTTOption) *MQTT {
+	bridge := &MQTT{
+		opts:   opts,
+		inject: inject,
+		tokens: tokens,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+	for _, option := range options {
+		option(bridge)
+	}
+	return bridge
+}
+
+// mqttError is published when a command fails.
+type mqttError struct {
+	Topic   string `json:"topic"`
+	Message string `json:"message"`
+}
+
+// mirror is what was last published for a driver.
+type mirror struct {
+	state, status, pending []byte
+}
+
+// Run connects to the broker and bridges it until the context is done. The
+// context provides the values that the HTTP middleware sets for requests,
+// such as the database, the drainer and the notifier.
+func (bridge *MQTT) Run(ctx context.Context) error {
+	logger := lib.UseLogger(ctx)
+
+	opts := *bridge.opts
+	opts.SetOrderMatters(false)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		if err := bridge.subscribe(ctx, client); err != nil {
+			logger.Err(err).Msg("failed to subscribe to MQTT commands")
+		}
+	})
+
+	client := mqtt.NewClient(&opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+	}
+	defer client.Disconnect(250)
+
+	var changed <-chan struct{}
+	var poll <-chan time.Time
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		ch, unsubscribe := notifier.SubscribeAll()
+		defer unsubscribe()
+		changed = ch
+	} else {
+		ticker := time.NewTicker(mqttPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	// Leases run out without notifications.
+	var renew <-chan time.Time
+	if lease := lib.UseDriverLease(ctx); lease > 0 {
+		ticker := time.NewTicker(lease / 2)
+		defer ticker.Stop()
+		renew = ticker.C
+	}
+
+	mirrors := make(map[string]mirror)
+	for {
+		if err := bridge.sync(ctx, client, mirrors); err != nil {
+			logger.Err(err).Msg("failed to mirror drivers to MQTT")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		case <-poll:
+		case <-renew:
+		}
+	}
+}
+
+// sync publishes the drivers that changed since they were last published and
+// clears the topics of deleted drivers.
+func (bridge *MQTT) sync(ctx context.Context, client mqtt.Client, mirrors map[string]mirror) error {
+	logger := lib.UseLogger(ctx)
+	usecase := bridge.inject(ctx)
+
+	names, err := usecase.List()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !validTopicLevel(name) {
+			logger.Warn().Msgf("driver %q cannot be mirrored to MQTT", name)
+			continue
+		}
+		seen[name] = true
+
+		model, err := usecase.Inspect(name)
+		if errors.Is(err, lib.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		next, err := newMirror(model)
+		if err != nil {
+			return fmt.Errorf("failed to encode driver %q: %w", name, err)
+		}
+
+		prev := mirrors[name]
+		for _, topic := range []struct {
+			suffix     string
+			prev, next []byte
+		}{
+			{"state", prev.state, next.state},
+			{"status", prev.status, next.status},
+			{"pending", prev.pending, next.pending},
+		} {
+			if topic.prev != nil && bytes.Equal(topic.prev, topic.next) {
+				continue
+			}
+			if err := publish(client, bridge.topic(name, topic.suffix), true, topic.next); err != nil {
+				return err
+			}
+		}
+		mirrors[name] = next
+	}
+
+	for name := range mirrors {
+		if seen[name] {
+			continue
+		}
+		// An empty retained message deletes the retained message.
+		for _, suffix := range []string{"state", "status", "pending"} {
+			if err := publish(client, bridge.topic(name, suffix), true, []byte{}); err != nil {
+				return err
+			}
+		}
+		delete(mirrors, name)
+	}
+
+	return nil
+}
+
+func newMirror(model models.DriverModel) (mirror, error) {
+	state, err := json.Marshal(model.State)
+	if err != nil {
+		return mirror{}, err
+	}
+	pending := []byte{}
+	if model.Op != nil {
+		if pending, err = json.Marshal(model.Op); err != nil {
+			return mirror{}, err
+		}
+	}
+	return mirror{state: state, status: []byte(model.Status), pending: pending}, nil
+}
+
+func publish(client mqtt.Client, topic string, retained bool, payload []byte) error {
+	token := client.Publish(topic, mqttQoS, retained, payload)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to publish to %q: %w", topic, token.Error())
+	}
+	return nil
+}
+
+func (bridge *MQTT) topic(name, suffix string) string {
+	return fmt.Sprintf("%s/%s/%s", bridge.prefix, name, suffix)
+}
+
+// subscribe subscribes to the command topics of every driver.
+func (bridge *MQTT) subscribe(ctx context.Context, client mqtt.Client) error {
+	commands := map[string]func(usecase usecases.DriverUsecase, name string, payload []byte) error{
+		"op":         bridge.dispatch,
+		"register":   bridge.register,
+		"state/set":  bridge.setState,
+		"status/set": bridge.setStatus,
+		"disconnect": bridge.disconnect,
+	}
+
+	// New drivers and operations are refused while the server drains, as
+	// over HTTP.
+	draining := map[string]bool{"op": true, "register": true}
+
+	filters := make(map[string]byte)
+	for suffix := range commands {
+		filters[bridge.topic("+", suffix)] = mqttQoS
+	}
+
+	token := client.SubscribeMultiple(filters, func(client mqtt.Client, msg mqtt.Message) {
+		name, suffix, ok := bridge.parse(msg.Topic())
+		command, known := commands[suffix]
+		if !ok || !known {
+			return
+		}
+
+		// Operations are dispatched on behalf of the actor of the bridge.
+		commandCtx := ctx
+		if suffix == "op" && bridge.actor != nil {
+			commandCtx = lib.WithActor(ctx, *bridge.actor)
+		}
+
+		err := lib.ErrDraining
+		if !draining[suffix] || !lib.UseDrainer(ctx).Draining() {
+			err = command(bridge.inject(commandCtx), name, msg.Payload())
+		}
+		if err != nil {
+			logger := lib.UseLogger(ctx)
+			logger.Warn().Err(err).Str("topic", msg.Topic()).Msg("failed to handle MQTT command")
+
+			p, _ := json.Marshal(mqttError{Topic: msg.Topic(), Message: err.Error()})
+			client.Publish(bridge.topic(name, "error"), mqttQoS, false, p)
+		}
+	})
+	token.Wait()
+	return token.Error()
+}
+
+// parse splits a command topic into the driver name and the command.
+func (bridge *MQTT) parse(topic string) (string, string, bool) {
+	rest := strings.TrimPrefix(topic, bridge.prefix+"/")
+	if rest == topic {
+		return "", "", false
+	}
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func (bridge *MQTT) dispatch(usecase usecases.DriverUsecase, name string, payload []byte) error {
+	if bridge.required && bridge.actor == nil {
+		return fmt.Errorf("failed to dispatch for driver %q: %w", name, lib.ErrMissingAPIKey)
+	}
+	var op driver.Op
+	if err := json.Unmarshal(payload, &op); err != nil {
+		return fmt.Errorf("failed to dispatch for driver %q: %w", name, err)
+	}
+	if err := lib.Validate(op); err != nil {
+		return fmt.Errorf("failed to dispatch for driver %q: %w", name, err)
+	}
+	if err := usecase.SetOp(name, op); err != nil {
+		return fmt.Errorf("failed to dispatch for driver %q: %w", name, err)
+	}
+	return nil
+}
+
+func (bridge *MQTT) register(usecase usecases.DriverUsecase, name string, payload []byte) error {
+	var state interface{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return fmt.Errorf("failed to register driver %q: %w", name, err)
+	}
+	params := driver.RegisterParams{Name: name, State: state}
+	if err := lib.Validate(params); err != nil {
+		return fmt.Errorf("failed to register driver %q: %w", name, err)
+	}
+
+	if err := bridge.authorize(usecase, name); err == nil {
+		if err := usecase.SetState(name, state); err != nil {
+			return fmt.Errorf("failed to register driver %q: %w", name, err)
+		}
+		return nil
+	}
+
+	token, err := usecase.Register(params)
+	if err != nil {
+		return fmt.Errorf("failed to register driver %q: %w", name, err)
+	}
+	if err := bridge.tokens.Put(name, token); err != nil {
+		return fmt.Errorf("failed to register driver %q: %w", name, err)
+	}
+	return nil
+}
+
+func (bridge *MQTT) setState(usecase usecases.DriverUsecase, name string, payload []byte) error {
+	if err := bridge.authorize(usecase, name); err != nil {
+		return fmt.Errorf("failed to set state for driver %q: %w", name, err)
+	}
+	var state interface{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return fmt.Errorf("failed to set state for driver %q: %w", name, err)
+	}
+	if err := usecase.SetState(name, state); err != nil {
+		return fmt.Errorf("failed to set state for driver %q: %w", name, err)
+	}
+	return nil
+}
+
+// setStatus accepts the status either as plain text or as a JSON string.
+func (bridge *MQTT) setStatus(usecase usecases.DriverUsecase, name string, payload []byte) error {
+	if err := bridge.authorize(usecase, name); err != nil {
+		return fmt.Errorf("failed to set status for driver %q: %w", name, err)
+	}
+	value := strings.Trim(strings.TrimSpace(string(payload)), `"`)
+	status := driver.Status(value)
+	if !mqttStatuses[status] {
+		return fmt.Errorf("failed to set status for driver %q: %w %q", name, errInvalidStatus, value)
+	}
+	if err := usecase.SetStatus(name, status); err != nil {
+		return fmt.Errorf("failed to set status for driver %q: %w", name, err)
+	}
+	return nil
+}
+
+func (bridge *MQTT) disconnect(usecase usecases.DriverUsecase, name string, payload []byte) error {
+	if err := bridge.authorize(usecase, name); err != nil {
+		return fmt.Errorf("failed to disconnect driver %q: %w", name, err)
+	}
+	if err := usecase.Delete(name); err != nil {
+		return fmt.Errorf("failed to disconnect driver %q: %w", name, err)
+	}
+	if err := bridge.tokens.Delete(name); err != nil {
+		return fmt.Errorf("failed to disconnect driver %q: %w", name, err)
+	}
+	return nil
+}
+
+// authorize checks that the driver was registered over MQTT and still holds
+// the token the bridge keeps for it.
+func (bridge *MQTT) authorize(usecase usecases.DriverUsecase, name string) error {
+	token, err := bridge.tokens.Get(name)
+	if errors.Is(err, lib.ErrNotFound) {
+		return errNotBridged
+	}
+	if err != nil {
+		return err
+	}
+	if err := usecase.Authorize(name, token); err != nil {
+		if errors.Is(err, lib.ErrForbidden) {
+			return errNotBridged
+		}
+		return err
+	}
+	return nil
+}
+
+// validTopicLevel reports whether a driver name can be used as a single level
+// of a topic name.
+func validTopicLevel(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/+#")
+}
@@ -0,0 +1,263 @@
+package bridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/bridge"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	mqtt "github.com/mochi-co/mqtt/server"
+	"github.com/mochi-co/mqtt/server/listeners"
+	"github.com/mochi-co/mqtt/server/listeners/auth"
+)
+
+// newTestBroker starts an in-process broker and returns its address.
+func newTestBroker(t *testing.T) string {
+	t.Helper()
+
+	// The broker cannot report the address it listens on, so reserve a free
+	// port first.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	server := mqtt.NewServer(nil)
+	tcp := listeners.NewTCP("t1", addr)
+	if err := server.AddListener(tcp, &listeners.Config{Auth: new(auth.Allow)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return "tcp://" + addr
+}
+
+func newTestClient(t *testing.T, broker, id string) paho.Client {
+	t.Helper()
+
+	opts := paho.NewClientOptions().AddBroker(broker).SetClientID(id)
+	client := paho.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+	return client
+}
+
+// recorder keeps the last message of each topic it is subscribed to.
+type recorder struct {
+	t        *testing.T
+	messages chan paho.Message
+	last     map[string]string
+}
+
+func newRecorder(t *testing.T, client paho.Client, filter string) *recorder {
+	t.Helper()
+
+	rec := &recorder{t: t, messages: make(chan paho.Message, 100), last: make(map[string]string)}
+	token := client.Subscribe(filter, 1, func(client paho.Client, msg paho.Message) {
+		rec.messages <- msg
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	return rec
+}
+
+// expect waits until the last message of the topic has the given payload.
+func (rec *recorder) expect(topic, payload string) {
+	rec.t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		if got, ok := rec.last[topic]; ok && got == payload {
+			return
+		}
+		select {
+		case msg := <-rec.messages:
+			rec.last[msg.Topic()] = string(msg.Payload())
+		case <-timeout:
+			rec.t.Fatalf("topic %q has %q: expected %q", topic, rec.last[topic], payload)
+		}
+	}
+}
+
+func publish(t *testing.T, client paho.Client, topic, payload string) {
+	t.Helper()
+	if token := client.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+}
+
+// startBridge runs a bridge to the broker until the test ends and returns the
+// context it runs with.
+func startBridge(t *testing.T, broker string, options ...bridge.MQTTOption) context.Context {
+	t.Helper()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = lib.WithBadger(ctx, db)
+	ctx = lib.WithDriverTokenGenerator(ctx, func() string { return "token" })
+	ctx = lib.WithNotifier(ctx, lib.NewNotifier())
+
+	b := bridge.NewMQTT(
+		paho.NewClientOptions().AddBroker(broker).SetClientID("labcon"),
+		injectors.Driver,
+		repositories.NewTokenRepository(db, "mqtt"),
+		"labcon",
+		options...,
+	)
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+		db.Close()
+	})
+
+	return ctx
+}
+
+func TestMQTT(t *testing.T) {
+	broker := newTestBroker(t)
+	ctx := startBridge(t, broker)
+
+	client := newTestClient(t, broker, "client")
+	rec := newRecorder(t, client, "labcon/#")
+
+	// Drivers registered through the usecase are mirrored.
+	usecase := injectors.Driver(ctx)
+	if _, err := usecase.Register(driver.RegisterParams{Name: "foo", State: map[string]interface{}{"volume": 1.5}}); err != nil {
+		t.Fatal(err)
+	}
+	rec.expect("labcon/foo/state", `{"volume":1.5}`)
+	rec.expect("labcon/foo/status", "idle")
+
+	// Operations are dispatched over MQTT.
+	publish(t, client, "labcon/foo/op", `{"name":"aspirate","arg":10}`)
+	rec.expect("labcon/foo/status", "busy")
+	rec.expect("labcon/foo/pending", `{"name":"aspirate","arg":10}`)
+
+	op, err := usecase.GetOp("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op == nil || op.Name != "aspirate" {
+		t.Errorf("GetOp returned %v: expected the operation dispatched over MQTT", op)
+	}
+
+	publish(t, client, "labcon/foo/op", `{"name":"dispense"}`)
+	rec.expect("labcon/foo/error", `{"topic":"labcon/foo/op","message":"failed to dispatch for driver \"foo\": busy"}`)
+
+	// Drivers registered elsewhere cannot be changed over MQTT.
+	publish(t, client, "labcon/foo/status/set", "idle")
+	rec.expect("labcon/foo/error", `{"topic":"labcon/foo/status/set","message":"failed to set status for driver \"foo\": driver was not registered over MQTT"}`)
+
+	// Devices register over MQTT.
+	publish(t, client, "labcon/bar/register", `{"temperature":25}`)
+	rec.expect("labcon/bar/state", `{"temperature":25}`)
+	rec.expect("labcon/bar/status", "idle")
+
+	publish(t, client, "labcon/bar/state/set", `{"temperature":37}`)
+	rec.expect("labcon/bar/state", `{"temperature":37}`)
+
+	publish(t, client, "labcon/bar/register", `{"temperature":4}`)
+	rec.expect("labcon/bar/state", `{"temperature":4}`)
+
+	publish(t, client, "labcon/bar/status/set", "warm")
+	rec.expect("labcon/bar/error", `{"topic":"labcon/bar/status/set","message":"failed to set status for driver \"bar\": invalid driver status \"warm\""}`)
+
+	publish(t, client, "labcon/bar/status/set", "error")
+	rec.expect("labcon/bar/status", "error")
+
+	status, err := usecase.GetStatus("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != driver.Error {
+		t.Errorf("GetStatus returned %q: expected %q", status, driver.Error)
+	}
+
+	// Disconnecting clears the retained topics.
+	publish(t, client, "labcon/bar/disconnect", "")
+	rec.expect("labcon/bar/state", "")
+	rec.expect("labcon/bar/status", "")
+
+	names, err := usecase.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := json.Marshal(names); string(p) != `["foo"]` {
+		t.Errorf("List returned %s: expected %s", p, `["foo"]`)
+	}
+}
+
+func TestMQTTAuth(t *testing.T) {
+	broker := newTestBroker(t)
+	client := newTestClient(t, broker, "client")
+	rec := newRecorder(t, client, "labcon/#")
+
+	// Operations are refused without an actor if API keys are required.
+	ctx := startBridge(t, broker, bridge.WithAuthRequired(true))
+	usecase := injectors.Driver(ctx)
+	if _, err := usecase.Register(driver.RegisterParams{Name: "foo", State: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	rec.expect("labcon/foo/status", "idle")
+
+	publish(t, client, "labcon/foo/op", `{"name":"aspirate"}`)
+	rec.expect("labcon/foo/error", `{"topic":"labcon/foo/op","message":"failed to dispatch for driver \"foo\": missing API key"}`)
+
+	status, err := usecase.GetStatus("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != driver.Idle {
+		t.Errorf("GetStatus returned %q: expected %q", status, driver.Idle)
+	}
+}
+
+func TestMQTTActor(t *testing.T) {
+	broker := newTestBroker(t)
+	client := newTestClient(t, broker, "client")
+	rec := newRecorder(t, client, "labcon/#")
+
+	// Operations are dispatched on behalf of the actor of the bridge.
+	ctx := startBridge(t, broker, bridge.WithAuthRequired(true), bridge.WithActor(lib.Actor{Name: "bridge", Role: lib.RoleUser}))
+	usecase := injectors.Driver(ctx)
+	if _, err := usecase.Register(driver.RegisterParams{Name: "foo", State: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	rec.expect("labcon/foo/status", "idle")
+
+	publish(t, client, "labcon/foo/op", `{"name":"aspirate"}`)
+	rec.expect("labcon/foo/status", "busy")
+
+	model, err := usecase.Inspect("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Dispatcher != "bridge" {
+		t.Errorf("Dispatcher = %q: expected %q", model.Dispatcher, "bridge")
+	}
+}
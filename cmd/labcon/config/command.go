@@ -0,0 +1,301 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a configuration value that can be overridden by an environment
+// variable and a flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(config *Config, value string) error
+
+	// isBool allows the flag to be given without a value.
+	isBool bool
+}
+
+// flagValue is a flag.Value calling set for each occurrence of the flag.
+type flagValue struct {
+	set    func(value string) error
+	isBool bool
+}
+
+func (value flagValue) String() string     { return "" }
+func (value flagValue) Set(s string) error { return value.set(s) }
+func (value flagValue) IsBoolFlag() bool   { return value.isBool }
+
+var settings = []setting{
+	{
+		env:   "LABCON_ADDR",
+		flag:  "addr",
+		usage: "address to listen on",
+		set: func(config *Config, value string) error {
+			config.Addr = value
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_GRPC_ADDR",
+		flag:  "grpc-addr",
+		usage: "address to serve the gRPC API on, or empty to disable it",
+		set: func(config *Config, value string) error {
+			config.GRPCAddr = value
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_MQTT_BROKER",
+		flag:  "mqtt-broker",
+		usage: "URL of the MQTT broker to bridge drivers to, or empty to disable it",
+		set: func(config *Config, value string) error {
+			config.MQTT.Broker = value
+			return nil
+		},
+	},
+	{
+		env:   "TLS_CERT",
+		flag:  "tls-cert",
+		usage: "server certificate file",
+		set: func(config *Config, value string) error {
+			config.TLS.Cert = value
+			return nil
+		},
+	},
+	{
+		env:   "TLS_KEY",
+		flag:  "tls-key",
+		usage: "server key file",
+		set: func(config *Config, value string) error {
+			config.TLS.Key = value
+			return nil
+		},
+	},
+	{
+		env:   "TLS_CLIENT_CA",
+		flag:  "tls-client-ca",
+		usage: "CA file to verify client certificates with",
+		set: func(config *Config, value string) error {
+			config.TLS.ClientCA = value
+			return nil
+		},
+	},
+	{
+		env:   "TLS_CLIENT_AUTH",
+		flag:  "tls-client-auth",
+		usage: `"require" to demand client certificates`,
+		set: func(config *Config, value string) error {
+			config.TLS.RequireClientCert = value == "require"
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_STORAGE",
+		flag:  "storage",
+		usage: "storage backend: memory or badger",
+		set: func(config *Config, value string) error {
+			config.Storage.Backend = value
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_STORAGE_PATH",
+		flag:  "storage-path",
+		usage: "directory of the badger storage backend",
+		set: func(config *Config, value string) error {
+			config.Storage.Path = value
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_CORS_ORIGINS",
+		flag:  "cors-origins",
+		usage: "comma separated list of allowed CORS origins",
+		set: func(config *Config, value string) error {
+			config.CORS.AllowedOrigins = splitList(value)
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_LOG_LEVEL",
+		flag:  "log-level",
+		usage: "log level: trace, debug, info, warn or error",
+		set: func(config *Config, value string) error {
+			config.Log.Level = value
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_LOG_FORMAT",
+		flag:  "log-format",
+		usage: "log format: console or json",
+		set: func(config *Config, value string) error {
+			config.Log.Format = value
+			return nil
+		},
+	},
+	{
+		env:   "LABCON_REQUEST_TIMEOUT",
+		flag:  "request-timeout",
+		usage: "time limit for handling a request",
+		set: func(config *Config, value string) (err error) {
+			config.RequestTimeout, err = time.ParseDuration(value)
+			return err
+		},
+	},
+	{
+		env:   "LABCON_DRIVER_LEASE",
+		flag:  "driver-lease",
+		usage: "time after which silent drivers are reported lost, or 0 to disable",
+		set: func(config *Config, value string) (err error) {
+			config.Lease.Driver, err = time.ParseDuration(value)
+			return err
+		},
+	},
+	{
+		env:   "LABCON_SHUTDOWN_DRAIN",
+		flag:  "shutdown-drain",
+		usage: "time to keep serving drivers after SIGINT or SIGTERM before shutting down",
+		set: func(config *Config, value string) (err error) {
+			config.Shutdown.Drain, err = time.ParseDuration(value)
+			return err
+		},
+	},
+	{
+		env:   "LABCON_SHUTDOWN_TIMEOUT",
+		flag:  "shutdown-timeout",
+		usage: "time to wait for requests in flight when shutting down",
+		set: func(config *Config, value string) (err error) {
+			config.Shutdown.Timeout, err = time.ParseDuration(value)
+			return err
+		},
+	},
+	{
+		env:   "LABCON_AUTH_REQUIRED",
+		flag:  "auth-required",
+		usage: "reject requests without a valid API key",
+		set: func(config *Config, value string) (err error) {
+			config.Auth.Required, err = strconv.ParseBool(value)
+			return err
+		},
+		isBool: true,
+	},
+	{
+		env:   "LABCON_METRICS_STATE",
+		flag:  "metrics-state",
+		usage: "export numeric driver state fields as metrics",
+		set: func(config *Config, value string) (err error) {
+			config.Metrics.State, err = strconv.ParseBool(value)
+			return err
+		},
+		isBool: true,
+	},
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Command is the parsed command line of the server.
+type Command struct {
+	Config Config
+
+	// PrintConfig asks for the configuration to be printed instead of
+	// starting the server.
+	PrintConfig bool
+}
+
+// ParseCommand builds the configuration from the defaults, the configuration
+// file, environment variables and flags, in increasing order of precedence,
+// and validates it. The configuration file is given by the -config flag or
+// LABCON_CONFIG. HOST and PORT are honored for compatibility if LABCON_ADDR
+// is not set.
+func ParseCommand(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Command, error) {
+	path, _ := lookupEnv("LABCON_CONFIG")
+	fs.StringVar(&path, "config", path, "path to the configuration file ($LABCON_CONFIG)")
+
+	var cmd Command
+	fs.BoolVar(&cmd.PrintConfig, "print-config", false, "print the configuration and exit")
+
+	var overrides []func(config *Config) error
+	for _, s := range settings {
+		s := s
+		usage := fmt.Sprintf("%s ($%s)", s.usage, s.env)
+		set := func(value string) error {
+			if err := s.set(&Config{}, value); err != nil {
+				return err
+			}
+			overrides = append(overrides, func(config *Config) error {
+				return s.set(config, value)
+			})
+			return nil
+		}
+		fs.Var(flagValue{set: set, isBool: s.isBool}, s.flag, usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Command{}, err
+	}
+
+	config := Default()
+	if path != "" {
+		var err error
+		if config, err = Load(path); err != nil {
+			return Command{}, fmt.Errorf("failed to load %q: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&config, lookupEnv); err != nil {
+		return Command{}, err
+	}
+
+	for _, override := range overrides {
+		if err := override(&config); err != nil {
+			return Command{}, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return Command{}, err
+	}
+
+	cmd.Config = config
+	return cmd, nil
+}
+
+func applyEnv(config *Config, lookupEnv func(string) (string, bool)) error {
+	if _, ok := lookupEnv("LABCON_ADDR"); !ok {
+		host, hasHost := lookupEnv("HOST")
+		port, hasPort := lookupEnv("PORT")
+		if !hasPort || port == "" {
+			port = "5000"
+		}
+		if hasHost || hasPort {
+			config.Addr = net.JoinHostPort(host, port)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(config, value); err != nil {
+			return fmt.Errorf("invalid $%s: %w", s.env, err)
+		}
+	}
+
+	return nil
+}
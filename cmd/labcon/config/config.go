@@ -0,0 +1,366 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrMissingAddr       = errors.New("missing listen address")
+	ErrSameGRPCAddr      = errors.New("gRPC address must differ from the HTTP address")
+	ErrMissingTLSPair    = errors.New("TLS certificate and key must be given together")
+	ErrClientCertWithout = errors.New("client certificates cannot be required without a client CA")
+	ErrUnknownBackend    = errors.New("unknown storage backend")
+	ErrMissingPath       = errors.New("missing storage path")
+	ErrUnknownLogLevel   = errors.New("unknown log level")
+	ErrUnknownLogFormat  = errors.New("unknown log format")
+	ErrNegativeDuration  = errors.New("duration must not be negative")
+	ErrMissingKeyName    = errors.New("missing API key name")
+	ErrDuplicateKeyName  = errors.New("duplicate API key name")
+	ErrMissingKey        = errors.New("missing API key")
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrNoAPIKeys         = errors.New("API keys are required but none are configured")
+	ErrInvalidMQTTPrefix = errors.New("MQTT topic prefix must not contain wildcards")
+	ErrUnknownMQTTKey    = errors.New("MQTT API key is not one of the configured API keys")
+)
+
+// Storage backends.
+const (
+	Memory = "memory"
+	Badger = "badger"
+)
+
+// Log formats.
+const (
+	Console = "console"
+	JSON    = "json"
+)
+
+// Config is the configuration of the labcon server.
+type Config struct {
+	// Addr is the address to listen on.
+	Addr string `yaml:"addr"`
+
+	// GRPCAddr is the address to serve the gRPC API on. The gRPC API is
+	// disabled if it is empty.
+	GRPCAddr string `yaml:"grpc_addr"`
+
+	TLS     TLSConfig     `yaml:"tls"`
+	Storage StorageConfig `yaml:"storage"`
+	CORS    CORSConfig    `yaml:"cors"`
+	Log     LogConfig     `yaml:"log"`
+
+	// RequestTimeout is the time limit for handling a request, which is
+	// unlimited if it is zero. Waits for driver states are not limited.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
+	Lease    LeaseConfig    `yaml:"lease"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	MQTT     MQTTConfig     `yaml:"mqtt"`
+}
+
+// TLSConfig configures HTTPS. TLS is disabled if no certificate is given.
+type TLSConfig struct {
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	ClientCA string `yaml:"client_ca"`
+
+	// RequireClientCert demands a certificate signed by ClientCA from every
+	// client.
+	RequireClientCert bool `yaml:"require_client_cert"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (config TLSConfig) Enabled() bool {
+	return config.Cert != ""
+}
+
+// StorageConfig configures where drivers are stored.
+type StorageConfig struct {
+	// Backend is either "memory", which loses everything on shutdown, or
+	// "badger", which persists to Path.
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
+}
+
+// CORSConfig configures cross-origin requests.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAge           int      `yaml:"max_age"`
+}
+
+// LogConfig configures logging.
+type LogConfig struct {
+	// Level is a zerolog level name such as "debug" or "info".
+	Level string `yaml:"level"`
+
+	// Format is either "console" for human readable output or "json".
+	Format string `yaml:"format"`
+}
+
+// LeaseConfig configures how long entities are held without contact.
+type LeaseConfig struct {
+	// Driver is how long a driver may go without contacting the server before
+	// it is reported as lost. Drivers are never lost if it is zero.
+	Driver time.Duration `yaml:"driver"`
+}
+
+// AuthConfig configures API key authentication.
+type AuthConfig struct {
+	// Required rejects requests without a valid API key.
+	Required bool `yaml:"required"`
+
+	APIKeys []lib.APIKey `yaml:"api_keys"`
+}
+
+// ShutdownConfig configures how the server shuts down on SIGINT or SIGTERM.
+type ShutdownConfig struct {
+	// Drain is how long the server keeps serving drivers, while refusing new
+	// drivers and operations, before it stops accepting connections.
+	Drain time.Duration `yaml:"drain"`
+
+	// Timeout is how long the server waits for requests in flight to finish
+	// once it stops accepting connections.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// MetricsConfig configures the metrics served at /metrics.
+type MetricsConfig struct {
+	// State exports the numeric and boolean fields of driver states as
+	// gauges.
+	State bool `yaml:"state"`
+}
+
+// MQTTConfig configures the bridge mirroring drivers to an MQTT broker. The
+// bridge is disabled if no broker is given.
+type MQTTConfig struct {
+	// Broker is the URL of the broker, e.g. "tcp://localhost:1883".
+	Broker string `yaml:"broker"`
+
+	// Prefix is the first level of the topics of drivers.
+	Prefix string `yaml:"prefix"`
+
+	ClientID string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// APIKey is the name of the API key on whose behalf operations published
+	// over MQTT are dispatched. If API keys are required, operations cannot
+	// be dispatched over MQTT without it.
+	APIKey string `yaml:"api_key"`
+}
+
+// Enabled reports whether the server should bridge drivers to MQTT.
+func (config MQTTConfig) Enabled() bool {
+	return config.Broker != ""
+}
+
+// Default returns the default configuration.
+func Default() Config {
+	return Config{
+		Addr: ":5000",
+		Storage: StorageConfig{
+			Backend: Memory,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedHeaders: []string{
+				"X-PINGOTHER",
+				"Accept",
+				"Authorization",
+				"Content-Type",
+				"X-CSRF-Token",
+				"X-Driver-Token",
+			},
+			AllowCredentials: true,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: Console,
+		},
+		RequestTimeout: 60 * time.Second,
+		Shutdown: ShutdownConfig{
+			Drain:   5 * time.Second,
+			Timeout: 30 * time.Second,
+		},
+		MQTT: MQTTConfig{
+			Prefix:   "labcon",
+			ClientID: "labcon",
+		},
+	}
+}
+
+// Load reads the configuration file at the given path over the defaults.
+func Load(path string) (Config, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(p)
+}
+
+// Parse parses a YAML configuration over the defaults. Unknown fields are
+// rejected.
+func Parse(p []byte) (Config, error) {
+	config := Default()
+	if err := yaml.UnmarshalWithOptions(p, &config, yaml.Strict()); err != nil {
+		return Config{}, err
+	}
+	config.fillDefaults()
+	return config, nil
+}
+
+// fillDefaults restores the defaults of settings omitted from sections that
+// are present in a configuration file, as each section is decoded as a whole.
+// Booleans cannot be told apart from omitted ones and keep their zero value.
+func (config *Config) fillDefaults() {
+	defaults := Default()
+	if config.Storage.Backend == "" {
+		config.Storage.Backend = defaults.Storage.Backend
+	}
+	if config.CORS.AllowedOrigins == nil {
+		config.CORS.AllowedOrigins = defaults.CORS.AllowedOrigins
+	}
+	if config.CORS.AllowedHeaders == nil {
+		config.CORS.AllowedHeaders = defaults.CORS.AllowedHeaders
+	}
+	if config.Log.Level == "" {
+		config.Log.Level = defaults.Log.Level
+	}
+	if config.Log.Format == "" {
+		config.Log.Format = defaults.Log.Format
+	}
+	if config.Shutdown.Timeout == 0 {
+		config.Shutdown.Timeout = defaults.Shutdown.Timeout
+	}
+	if config.MQTT.Prefix == "" {
+		config.MQTT.Prefix = defaults.MQTT.Prefix
+	}
+	if config.MQTT.ClientID == "" {
+		config.MQTT.ClientID = defaults.MQTT.ClientID
+	}
+}
+
+// Validate checks the configuration for errors.
+func (config Config) Validate() error {
+	if config.Addr == "" {
+		return ErrMissingAddr
+	}
+	if config.GRPCAddr == config.Addr {
+		return ErrSameGRPCAddr
+	}
+
+	if (config.TLS.Cert == "") != (config.TLS.Key == "") {
+		return fmt.Errorf("tls: %w", ErrMissingTLSPair)
+	}
+	if config.TLS.RequireClientCert && config.TLS.ClientCA == "" {
+		return fmt.Errorf("tls: %w", ErrClientCertWithout)
+	}
+
+	switch config.Storage.Backend {
+	case Memory:
+	case Badger:
+		if config.Storage.Path == "" {
+			return fmt.Errorf("storage: %w", ErrMissingPath)
+		}
+	default:
+		return fmt.Errorf("storage: %w %q", ErrUnknownBackend, config.Storage.Backend)
+	}
+
+	if _, err := zerolog.ParseLevel(config.Log.Level); err != nil || config.Log.Level == "" {
+		return fmt.Errorf("log: %w %q", ErrUnknownLogLevel, config.Log.Level)
+	}
+	switch config.Log.Format {
+	case Console, JSON:
+	default:
+		return fmt.Errorf("log: %w %q", ErrUnknownLogFormat, config.Log.Format)
+	}
+
+	if config.RequestTimeout < 0 {
+		return fmt.Errorf("request_timeout: %w", ErrNegativeDuration)
+	}
+	if config.Lease.Driver < 0 {
+		return fmt.Errorf("lease: driver: %w", ErrNegativeDuration)
+	}
+	if config.Shutdown.Drain < 0 {
+		return fmt.Errorf("shutdown: drain: %w", ErrNegativeDuration)
+	}
+	if config.Shutdown.Timeout < 0 {
+		return fmt.Errorf("shutdown: timeout: %w", ErrNegativeDuration)
+	}
+	if strings.ContainsAny(config.MQTT.Prefix, "+#") {
+		return fmt.Errorf("mqtt: %w %q", ErrInvalidMQTTPrefix, config.MQTT.Prefix)
+	}
+	if config.MQTT.APIKey != "" && !hasKeyName(config.Auth.APIKeys, config.MQTT.APIKey) {
+		return fmt.Errorf("mqtt: %w %q", ErrUnknownMQTTKey, config.MQTT.APIKey)
+	}
+
+	return config.Auth.Validate()
+}
+
+func hasKeyName(keys []lib.APIKey, name string) bool {
+	for _, key := range keys {
+		if key.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the auth configuration for errors.
+func (config AuthConfig) Validate() error {
+	if config.Required && len(config.APIKeys) == 0 {
+		return fmt.Errorf("auth: %w", ErrNoAPIKeys)
+	}
+
+	names := make(map[string]bool)
+	for i, key := range config.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("auth: API key %d: %w", i+1, ErrMissingKeyName)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("auth: API key %q: %w", key.Name, ErrDuplicateKeyName)
+		}
+		names[key.Name] = true
+
+		if key.Key == "" {
+			return fmt.Errorf("auth: API key %q: %w", key.Name, ErrMissingKey)
+		}
+		switch key.Role {
+		case lib.RoleAdmin, lib.RoleUser:
+		default:
+			return fmt.Errorf("auth: API key %q: %w %q", key.Name, ErrUnknownRole, key.Role)
+		}
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets hidden, for
+// printing.
+func (config Config) Redacted() Config {
+	if config.MQTT.Password != "" {
+		config.MQTT.Password = "REDACTED"
+	}
+	if config.Auth.APIKeys == nil {
+		return config
+	}
+	keys := make([]lib.APIKey, len(config.Auth.APIKeys))
+	for i, key := range config.Auth.APIKeys {
+		key.Key = "REDACTED"
+		keys[i] = key
+	}
+	config.Auth.APIKeys = keys
+	return config
+}
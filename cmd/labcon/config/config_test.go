@@ -0,0 +1,242 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/config"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		in  string
+		err error
+	}{
+		{
+			in:  "",
+			err: nil,
+		},
+		{
+			in: strings.Join([]string{
+				"storage: {backend: badger, path: /var/lib/labcon}",
+				"lease: {driver: 30s}",
+				"auth:",
+				"  required: true",
+				"  api_keys: [{name: alice, key: secret, role: admin}]",
+			}, "\n"),
+			err: nil,
+		},
+		{
+			in:  "addr: ''",
+			err: config.ErrMissingAddr,
+		},
+		{
+			in:  "grpc_addr: ':5000'",
+			err: config.ErrSameGRPCAddr,
+		},
+		{
+			in:  "tls: {cert: server.pem}",
+			err: config.ErrMissingTLSPair,
+		},
+		{
+			in:  "tls: {cert: server.pem, key: server.key, require_client_cert: true}",
+			err: config.ErrClientCertWithout,
+		},
+		{
+			in:  "storage: {backend: sqlite}",
+			err: config.ErrUnknownBackend,
+		},
+		{
+			in:  "storage: {backend: badger}",
+			err: config.ErrMissingPath,
+		},
+		{
+			in:  "log: {level: ''}",
+			err: nil,
+		},
+		{
+			in:  "log: {level: verbose}",
+			err: config.ErrUnknownLogLevel,
+		},
+		{
+			in:  "log: {format: xml}",
+			err: config.ErrUnknownLogFormat,
+		},
+		{
+			in:  "lease: {driver: -1s}",
+			err: config.ErrNegativeDuration,
+		},
+		{
+			in:  "shutdown: {drain: -5s}",
+			err: config.ErrNegativeDuration,
+		},
+		{
+			in:  "auth: {required: true}",
+			err: config.ErrNoAPIKeys,
+		},
+		{
+			in:  "auth: {api_keys: [{name: alice, key: secret, role: admin}, {name: alice, key: other, role: user}]}",
+			err: config.ErrDuplicateKeyName,
+		},
+		{
+			in:  "auth: {api_keys: [{name: alice, role: admin}]}",
+			err: config.ErrMissingKey,
+		},
+		{
+			in:  "auth: {api_keys: [{name: alice, key: secret, role: root}]}",
+			err: config.ErrUnknownRole,
+		},
+		{
+			in:  "mqtt: {broker: 'tcp://localhost:1883', prefix: 'labcon/#'}",
+			err: config.ErrInvalidMQTTPrefix,
+		},
+		{
+			in:  "mqtt: {api_key: bridge}",
+			err: config.ErrUnknownMQTTKey,
+		},
+		{
+			in:  "{auth: {api_keys: [{name: bridge, key: secret, role: user}]}, mqtt: {api_key: bridge}}",
+			err: nil,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			cfg, err := config.Parse([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.Validate(); !errors.Is(err, tt.err) {
+				t.Errorf("cfg.Validate() = %v, expected %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseUnknownField(t *testing.T) {
+	if _, err := config.Parse([]byte("port: 5000")); err == nil {
+		t.Errorf("config.Parse(in) = (_, nil), expected an error for an unknown field")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labcon.yaml")
+	if err := os.WriteFile(path, []byte(strings.Join([]string{
+		"addr: :8000",
+		"log: {level: debug}",
+		"request_timeout: 10s",
+		"lease: {driver: 1m}",
+	}, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		args  []string
+		env   map[string]string
+		check func(t *testing.T, cmd config.Command)
+		err   bool
+	}{
+		{
+			args: []string{},
+			env:  map[string]string{},
+			check: func(t *testing.T, cmd config.Command) {
+				if cmd.Config.Addr != ":5000" || cmd.PrintConfig {
+					t.Errorf("unexpected command: %+v", cmd)
+				}
+			},
+		},
+		{
+			args: []string{"-config", path},
+			env:  map[string]string{"LABCON_LOG_LEVEL": "warn"},
+			check: func(t *testing.T, cmd config.Command) {
+				if cmd.Config.Addr != ":8000" {
+					t.Errorf("addr = %q, expected %q from the file", cmd.Config.Addr, ":8000")
+				}
+				if cmd.Config.Log.Level != "warn" {
+					t.Errorf("log level = %q, expected %q from the environment", cmd.Config.Log.Level, "warn")
+				}
+			},
+		},
+		{
+			args: []string{"-request-timeout", "5s", "-print-config"},
+			env:  map[string]string{"LABCON_CONFIG": path, "LABCON_REQUEST_TIMEOUT": "20s"},
+			check: func(t *testing.T, cmd config.Command) {
+				if cmd.Config.RequestTimeout != 5*time.Second {
+					t.Errorf("request timeout = %v, expected %v from the flag", cmd.Config.RequestTimeout, 5*time.Second)
+				}
+				if cmd.Config.Lease.Driver != time.Minute {
+					t.Errorf("driver lease = %v, expected %v from the file", cmd.Config.Lease.Driver, time.Minute)
+				}
+				if !cmd.PrintConfig {
+					t.Errorf("expected PrintConfig to be set")
+				}
+			},
+		},
+		{
+			args: []string{"-grpc-addr", ":5001"},
+			env:  map[string]string{},
+			check: func(t *testing.T, cmd config.Command) {
+				if cmd.Config.GRPCAddr != ":5001" {
+					t.Errorf("gRPC addr = %q, expected %q from the flag", cmd.Config.GRPCAddr, ":5001")
+				}
+			},
+		},
+		{
+			args: []string{},
+			env:  map[string]string{"LABCON_MQTT_BROKER": "tcp://localhost:1883"},
+			check: func(t *testing.T, cmd config.Command) {
+				if cmd.Config.MQTT.Broker != "tcp://localhost:1883" {
+					t.Errorf("MQTT broker = %q, expected %q from the environment", cmd.Config.MQTT.Broker, "tcp://localhost:1883")
+				}
+				if cmd.Config.MQTT.Prefix != "labcon" {
+					t.Errorf("MQTT prefix = %q, expected the default %q", cmd.Config.MQTT.Prefix, "labcon")
+				}
+			},
+		},
+		{
+			args: []string{},
+			env:  map[string]string{"HOST": "127.0.0.1", "PORT": "8080"},
+			check: func(t *testing.T, cmd config.Command) {
+				if cmd.Config.Addr != "127.0.0.1:8080" {
+					t.Errorf("addr = %q, expected %q", cmd.Config.Addr, "127.0.0.1:8080")
+				}
+			},
+		},
+		{
+			args: []string{"-driver-lease", "forever"},
+			env:  map[string]string{},
+			err:  true,
+		},
+		{
+			args: []string{"-storage", "badger"},
+			env:  map[string]string{},
+			err:  true,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			fs := flag.NewFlagSet("labcon", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			}
+
+			cmd, err := config.ParseCommand(fs, tt.args, lookupEnv)
+			if (err != nil) != tt.err {
+				t.Fatalf("config.ParseCommand(fs, %v, lookupEnv) = (_, %v)", tt.args, err)
+			}
+			if err == nil {
+				tt.check(t, cmd)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package cron parses cron expressions of five fields,
+//
+//	minute hour day-of-month month day-of-week
+//
+// such as "*/10 0-6 * * *" for every ten minutes from midnight to 7 AM. Each
+// field is a comma separated list of values, ranges such as 1-5 and *, each
+// optionally followed by a step such as /10. Months and days of the week may
+// also be written as jan-dec and sun-sat, and Sunday as either 0 or 7. As in
+// the cron of Unix, a time matches if its day matches either the day of the
+// month or the day of the week when both are restricted. The descriptors
+// @yearly, @monthly, @weekly, @daily and @hourly stand for their usual
+// expressions.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSyntax = errors.New("invalid cron expression")
+)
+
+// maxYears bounds the search for the next time, so that expressions such as
+// "0 0 30 2 *" that never match do not loop forever.
+const maxYears = 5
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	src    string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domAny and dowAny are set if the day fields are *, in which case the
+	// day is matched by the other field alone.
+	domAny bool
+	dowAny bool
+}
+
+// Parse parses a cron expression.
+func Parse(src string) (*Schedule, error) {
+	spec := strings.TrimSpace(src)
+	if expanded, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrSyntax, len(fields))
+	}
+
+	schedule := &Schedule{src: src}
+	var err error
+	if schedule.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// Sunday is both 0 and 7.
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domAny = strings.HasPrefix(fields[2], "*")
+	schedule.dowAny = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+// String returns the source of the expression.
+func (schedule *Schedule) String() string {
+	return schedule.src
+}
+
+// Next returns the first time after t that matches the schedule, in the
+// location of t, or the zero time if there is none within a few years.
+func (schedule *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(schedule.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !schedule.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(schedule.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(schedule.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (schedule *Schedule) matchDay(t time.Time) bool {
+	dom := has(schedule.dom, t.Day())
+	dow := has(schedule.dow, int(t.Weekday()))
+	if schedule.domAny || schedule.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
+
+// parse returns the set of values of the field as a bit set.
+func (f field) parse(src string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(src, ",") {
+		lo, hi, step := f.min, f.max, 1
+
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, f.errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// A single value with a step, such as 5/15, runs to the
+				// end of the range.
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, f.errorf("invalid range %q", rng)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(src string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(src, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(src)
+	if err != nil {
+		return 0, f.errorf("invalid value %q", src)
+	}
+	if v < f.min || v > f.max {
+		return 0, f.errorf("%d is out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (f field) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s", ErrSyntax, f.name, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,73 @@
+package cron_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/cron"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestNext(t *testing.T) {
+	// A Friday.
+	from := time.Date(2022, 4, 1, 12, 34, 56, 0, time.UTC)
+
+	cases := []struct {
+		in  string
+		out time.Time
+	}{
+		{`* * * * *`, time.Date(2022, 4, 1, 12, 35, 0, 0, time.UTC)},
+		{`*/10 0-6 * * *`, time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)},
+		{`0 7 * * *`, time.Date(2022, 4, 2, 7, 0, 0, 0, time.UTC)},
+		{`40 12 * * *`, time.Date(2022, 4, 1, 12, 40, 0, 0, time.UTC)},
+		{`5/15 * * * *`, time.Date(2022, 4, 1, 12, 35, 0, 0, time.UTC)},
+		{`0 9 * * mon-fri`, time.Date(2022, 4, 4, 9, 0, 0, 0, time.UTC)},
+		{`0 0 * * 7`, time.Date(2022, 4, 3, 0, 0, 0, 0, time.UTC)},
+		{`0 0 1 jan,jul *`, time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{`0 0 13 * fri`, time.Date(2022, 4, 8, 0, 0, 0, 0, time.UTC)},
+		{`0 0 29 2 *`, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{`0 0 30 2 *`, time.Time{}},
+		{`@daily`, time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)},
+		{`@hourly`, time.Date(2022, 4, 1, 13, 0, 0, 0, time.UTC)},
+		{`@monthly`, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			schedule, err := cron.Parse(tt.in)
+			if err != nil {
+				t.Fatalf("cron.Parse(%q) = (_, %v)", tt.in, err)
+			}
+			if out := schedule.Next(from); !out.Equal(tt.out) {
+				t.Errorf("cron.Parse(%q).Next(%v) = %v, expected %v", tt.in, from, out, tt.out)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []string{
+		``,
+		`* * * *`,
+		`* * * * * *`,
+		`60 * * * *`,
+		`* 24 * * *`,
+		`* * 0 * *`,
+		`* * * 13 *`,
+		`* * * * 8`,
+		`5-1 * * * *`,
+		`*/0 * * * *`,
+		`a * * * *`,
+		`* * * foo *`,
+		`@often`,
+	}
+
+	for i, in := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if _, err := cron.Parse(in); !errors.Is(err, cron.ErrSyntax) {
+				t.Errorf("cron.Parse(%q) = (_, %v), expected %v", in, err, cron.ErrSyntax)
+			}
+		})
+	}
+}
@@ -0,0 +1,668 @@
+// Package expr evaluates conditions over driver states, such as
+//
+//	$.temperature >= 36.5 && $.door == "closed"
+//
+// A path starts at the state with $ and selects fields with .name or
+// ["name"] and array elements with [index]. Paths to missing fields yield
+// null. Paths, numbers, strings, true, false and null are compared with ==,
+// !=, <, <=, > and >=, and conditions are combined with &&, || and ! and
+// grouped with parentheses. A path on its own is true unless it yields null,
+// false, zero or an empty string. Ordering values of different types is
+// false rather than an error, so that conditions on fields that are yet to be
+// set simply do not hold.
+//
+// Numbers may be computed with +, -, * and / and the functions abs, min and
+// max, as in
+//
+//	abs($.temperature - 37) <= 0.5
+//
+// Arithmetic on values other than numbers, and division by zero, yield null.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSyntax = errors.New("syntax error")
+)
+
+// Expr is a parsed expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses an expression.
+func Parse(src string) (*Expr, error) {
+	p := &parser{src: src}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval reports whether the expression holds for the state, which is a value
+// decoded from JSON or msgpack.
+func (e *Expr) Eval(state interface{}) bool {
+	return truthy(e.root.eval(state))
+}
+
+type node interface {
+	eval(state interface{}) interface{}
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n literal) eval(state interface{}) interface{} {
+	return n.value
+}
+
+// path selects a value by field names, which are strings, and array indices,
+// which are ints.
+type path []interface{}
+
+func (n path) eval(state interface{}) interface{} {
+	value := state
+	for _, key := range n {
+		value = index(value, key)
+		if value == nil {
+			return nil
+		}
+	}
+	return value
+}
+
+func index(value interface{}, key interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if name, ok := key.(string); ok {
+			return v[name]
+		}
+	case map[interface{}]interface{}:
+		if name, ok := key.(string); ok {
+			return v[name]
+		}
+	case []interface{}:
+		if i, ok := key.(int); ok && i >= 0 && i < len(v) {
+			return v[i]
+		}
+	}
+	return nil
+}
+
+type negate struct {
+	operand node
+}
+
+func (n negate) eval(state interface{}) interface{} {
+	if f, ok := toFloat(n.operand.eval(state)); ok {
+		return -f
+	}
+	return nil
+}
+
+type arithmetic struct {
+	op          string
+	left, right node
+}
+
+func (n arithmetic) eval(state interface{}) interface{} {
+	x, ok := toFloat(n.left.eval(state))
+	if !ok {
+		return nil
+	}
+	y, ok := toFloat(n.right.eval(state))
+	if !ok {
+		return nil
+	}
+	switch n.op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	default:
+		if y == 0 {
+			return nil
+		}
+		return x / y
+	}
+}
+
+// functions take numbers and return a number.
+var functions = map[string]struct {
+	arity int
+	f     func(args []float64) float64
+}{
+	"abs": {1, func(args []float64) float64 { return math.Abs(args[0]) }},
+	"min": {2, func(args []float64) float64 { return math.Min(args[0], args[1]) }},
+	"max": {2, func(args []float64) float64 { return math.Max(args[0], args[1]) }},
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (n call) eval(state interface{}) interface{} {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		f, ok := toFloat(arg.eval(state))
+		if !ok {
+			return nil
+		}
+		args[i] = f
+	}
+	return functions[n.name].f(args)
+}
+
+type not struct {
+	operand node
+}
+
+func (n not) eval(state interface{}) interface{} {
+	return !truthy(n.operand.eval(state))
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n logical) eval(state interface{}) interface{} {
+	left := truthy(n.left.eval(state))
+	if n.op == "&&" {
+		return left && truthy(n.right.eval(state))
+	}
+	return left || truthy(n.right.eval(state))
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n comparison) eval(state interface{}) interface{} {
+	left, right := n.left.eval(state), n.right.eval(state)
+	switch n.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	}
+
+	c, ok := compare(left, right)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two numbers or two strings.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	}
+	return 0, false
+}
+
+// toFloat converts numbers of any type, as msgpack decodes integers to the
+// smallest type that holds them.
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	}
+	if f, ok := toFloat(value); ok {
+		return f != 0
+	}
+	return true
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokRoot
+	tokDot
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (tok token) String() string {
+	if tok.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(tok.text)
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %d: %s", ErrSyntax, p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// next scans the next token. Scanning errors are reported as they are reached
+// by the parser.
+func (p *parser) next() {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '$':
+		p.pos++
+		p.tok = token{kind: tokRoot, text: "$", pos: start}
+	case c == '.':
+		p.pos++
+		p.tok = token{kind: tokDot, text: ".", pos: start}
+	case c == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+	case c == '[':
+		p.pos++
+		p.tok = token{kind: tokLBracket, text: "[", pos: start}
+	case c == ']':
+		p.pos++
+		p.tok = token{kind: tokRBracket, text: "]", pos: start}
+	case c == '"' || c == '\'':
+		p.scanString(c)
+	case c >= '0' && c <= '9':
+		p.scanNumber()
+	case isIdentStart(c):
+		for p.pos < len(p.src) && isIdentPart(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+	default:
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return
+			}
+		}
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	}
+}
+
+func (p *parser) scanString(quote byte) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != quote {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokString, text: p.src[start:], pos: start}
+		return
+	}
+	p.pos++
+	p.tok = token{kind: tokString, text: p.src[start:p.pos], pos: start}
+}
+
+func (p *parser) scanNumber() {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) && strings.ContainsRune("0123456789.eE+-", rune(p.src[p.pos])) {
+		// A sign only belongs to the number right after an exponent.
+		if c := p.src[p.pos]; (c == '+' || c == '-') && !strings.ContainsRune("eE", rune(p.src[p.pos-1])) {
+			break
+		}
+		p.pos++
+	}
+	p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "!" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return left, nil
+	}
+	switch op := p.tok.text; op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return comparison{op: op, left: left, right: right}, nil
+	default:
+		return left, nil
+	}
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/") {
+		op := p.tok.text
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negate{operand: operand}, nil
+	}
+	return p.parseOperand()
+}
+
+// parseCall parses the arguments of a function call, starting at the opening
+// parenthesis.
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	p.next()
+
+	var args []node
+	for p.tok.kind != tokRParen {
+		if len(args) > 0 {
+			if p.tok.kind != tokOp || p.tok.text != "," {
+				return nil, p.errorf("expected \",\" or \")\" but got %s", p.tok)
+			}
+			p.next()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) != fn.arity {
+		return nil, p.errorf("%s takes %d arguments but got %d", name.text, fn.arity, len(args))
+	}
+	p.next()
+	return call{name: name.text, args: args}, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected \")\" but got %s", p.tok)
+		}
+		p.next()
+		return inner, nil
+
+	case tokRoot:
+		p.next()
+		return p.parsePath()
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok)
+		}
+		p.next()
+		return literal{value: f}, nil
+
+	case tokString:
+		s, err := unquote(tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid string %s", tok)
+		}
+		p.next()
+		return literal{value: s}, nil
+
+	case tokIdent:
+		p.next()
+		if p.tok.kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "true":
+			return literal{value: true}, nil
+		case "false":
+			return literal{value: false}, nil
+		case "null":
+			return literal{value: nil}, nil
+		}
+		return nil, p.errorf("unknown name %s, paths start with $", tok)
+
+	default:
+		return nil, p.errorf("unexpected %s", tok)
+	}
+}
+
+func (p *parser) parsePath() (node, error) {
+	var keys path
+	for {
+		switch p.tok.kind {
+		case tokDot:
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected a field name but got %s", p.tok)
+			}
+			keys = append(keys, p.tok.text)
+			p.next()
+
+		case tokLBracket:
+			p.next()
+			switch tok := p.tok; tok.kind {
+			case tokString:
+				s, err := unquote(tok.text)
+				if err != nil {
+					return nil, p.errorf("invalid string %s", tok)
+				}
+				keys = append(keys, s)
+			case tokNumber:
+				i, err := strconv.Atoi(tok.text)
+				if err != nil || i < 0 {
+					return nil, p.errorf("invalid index %s", tok)
+				}
+				keys = append(keys, i)
+			default:
+				return nil, p.errorf("expected a field name or index but got %s", tok)
+			}
+			p.next()
+			if p.tok.kind != tokRBracket {
+				return nil, p.errorf("expected \"]\" but got %s", p.tok)
+			}
+			p.next()
+
+		default:
+			return keys, nil
+		}
+	}
+}
+
+// unquote decodes a string in single or double quotes with Go escapes.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", ErrSyntax
+	}
+	if s[0] == '\'' {
+		s = `"` + strings.ReplaceAll(strings.ReplaceAll(s[1:len(s)-1], `\'`, `'`), `"`, `\"`) + `"`
+	}
+	return strconv.Unquote(s)
+}
@@ -0,0 +1,110 @@
+package expr_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ktnyt/labcon/cmd/labcon/expr"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestEval(t *testing.T) {
+	state := map[string]interface{}{
+		"temperature": 36.8,
+		"count":       int8(3),
+		"door":        "closed",
+		"ready":       true,
+		"empty":       "",
+		"plates":      []interface{}{"a", "b"},
+		"nested": map[interface{}]interface{}{
+			"rpm":        uint16(1200),
+			"fan speed":  2,
+			"set-points": []interface{}{37.0},
+		},
+	}
+
+	cases := []struct {
+		in  string
+		out bool
+	}{
+		{`$.temperature >= 36.5`, true},
+		{`$.temperature < 36.5`, false},
+		{`$.count == 3`, true},
+		{`$.count != 3`, false},
+		{`$.door == "closed"`, true},
+		{`$.door == 'open'`, false},
+		{`$.door > "a"`, true},
+		{`$.ready`, true},
+		{`!$.ready`, false},
+		{`$.empty`, false},
+		{`$.missing`, false},
+		{`$.missing == null`, true},
+		{`$.missing > 1`, false},
+		{`$.door > 1`, false},
+		{`$.plates[1] == "b"`, true},
+		{`$.plates[2] == null`, true},
+		{`$["plates"][0] == "a"`, true},
+		{`$.nested.rpm > 1000`, true},
+		{`$.nested["fan speed"] == 2`, true},
+		{`$.nested["set-points"][0] == 37`, true},
+		{`$.nested == null`, false},
+		{`$.door == "closed" && $.temperature > 37`, false},
+		{`$.door == "closed" || $.temperature > 37`, true},
+		{`!($.door == "open" || $.count < 0)`, true},
+		{`$.count > 2 && $.count < 4 || false`, true},
+		{`$.temperature >= -1e3`, true},
+		{`true`, true},
+		{`abs($.temperature - 37) <= 0.5`, true},
+		{`abs(37 - $.temperature) < 0.1`, false},
+		{`$.count * 2 + 1 == 7`, true},
+		{`$.count - -1 == 4`, true},
+		{`-$.count == -3`, true},
+		{`$.nested.rpm / 60 == 20`, true},
+		{`$.count / 0 == null`, true},
+		{`$.door + 1 == null`, true},
+		{`max($.count, 5) - min($.count, 5) == 2`, true},
+		{`abs($.missing) > -1`, false},
+		{`1e-3 * 1000 == 1`, true},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			e, err := expr.Parse(tt.in)
+			if err != nil {
+				t.Fatalf("expr.Parse(%q) = (_, %v)", tt.in, err)
+			}
+			if out := e.Eval(state); out != tt.out {
+				t.Errorf("expr.Parse(%q).Eval(state) = %t, expected %t", tt.in, out, tt.out)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []string{
+		``,
+		`temperature > 1`,
+		`$.`,
+		`$.a >`,
+		`$.a == == 1`,
+		`($.a`,
+		`$[1.5]`,
+		`$["a"`,
+		`$.a == "unterminated`,
+		`$.a = 1`,
+		`$.a 1`,
+		`$.a - `,
+		`sqrt($.a) > 1`,
+		`abs($.a, 1) > 1`,
+		`max($.a) > 1`,
+		`abs($.a`,
+	}
+
+	for i, in := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if _, err := expr.Parse(in); !errors.Is(err, expr.ErrSyntax) {
+				t.Errorf("expr.Parse(%q) = (_, %v), expected %v", in, err, expr.ErrSyntax)
+			}
+		})
+	}
+}
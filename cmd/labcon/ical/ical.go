@@ -0,0 +1,109 @@
+// Package ical writes calendars in the iCalendar format of RFC 5545, so that
+// bookings can be subscribed to from calendar applications.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar data.
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineLength is the length in octets beyond which lines are folded.
+const maxLineLength = 75
+
+const timeFormat = "20060102T150405Z"
+
+// Event is an event of a calendar, written as a VEVENT component.
+type Event struct {
+	UID         string
+	Stamp       time.Time
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+}
+
+// Calendar is a calendar of events. Name is shown by calendar applications
+// that support the X-WR-CALNAME property.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// WriteTo writes the calendar to w.
+func (calendar Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &writer{w: bufio.NewWriter(w)}
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", "-//labcon//bookings//EN")
+	cw.line("CALSCALE", "GREGORIAN")
+	if calendar.Name != "" {
+		cw.line("X-WR-CALNAME", escape(calendar.Name))
+	}
+	for _, event := range calendar.Events {
+		cw.line("BEGIN", "VEVENT")
+		cw.line("UID", escape(event.UID))
+		cw.line("DTSTAMP", event.Stamp.UTC().Format(timeFormat))
+		cw.line("DTSTART", event.Start.UTC().Format(timeFormat))
+		cw.line("DTEND", event.End.UTC().Format(timeFormat))
+		cw.line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			cw.line("DESCRIPTION", escape(event.Description))
+		}
+		cw.line("END", "VEVENT")
+	}
+	cw.line("END", "VCALENDAR")
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// escape escapes a text value.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`;`, `\;`,
+		`,`, `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+type writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// line writes a content line, folding it so that no line is longer than
+// maxLineLength octets without splitting a UTF-8 sequence.
+func (cw *writer) line(name, value string) {
+	s := name + ":" + value
+	limit := maxLineLength
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		cw.write(s[:i] + "\r\n ")
+		s = s[i:]
+		// Continuation lines start with a space.
+		limit = maxLineLength - 1
+	}
+	cw.write(s + "\r\n")
+}
+
+func (cw *writer) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
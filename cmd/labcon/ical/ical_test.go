@@ -0,0 +1,60 @@
+package ical_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/ical"
+	"github.com/ktnyt/labcon/utils"
+)
+
+func TestCalendar(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	calendar := ical.Calendar{
+		Name: "confocal",
+		Events: []ical.Event{
+			{
+				UID:         "booking-1@labcon",
+				Stamp:       time.Date(2022, 4, 1, 9, 0, 0, 0, jst),
+				Start:       time.Date(2022, 4, 1, 13, 0, 0, 0, jst),
+				End:         time.Date(2022, 4, 1, 15, 30, 0, 0, jst),
+				Summary:     "confocal booked by alice",
+				Description: "live imaging; HeLa, 2 plates\nbring your own dishes and keep the stage incubator at 37 °C throughout",
+			},
+		},
+	}
+
+	b := &strings.Builder{}
+	if _, err := calendar.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//labcon//bookings//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:confocal",
+		"BEGIN:VEVENT",
+		"UID:booking-1@labcon",
+		"DTSTAMP:20220401T000000Z",
+		"DTSTART:20220401T040000Z",
+		"DTEND:20220401T063000Z",
+		"SUMMARY:confocal booked by alice",
+		`DESCRIPTION:live imaging\; HeLa\, 2 plates\nbring your own dishes and keep `,
+		" the stage incubator at 37 °C throughout",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	if ops := utils.ObjDiff(strings.Split(b.String(), "\r\n"), strings.Split(expected, "\r\n")); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+	for _, line := range strings.Split(b.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const ActorContextKey AppContextKey = "actor"
+
+var (
+	ErrMissingAPIKey = errors.New("missing API key")
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// Role is the role of an API key.
+type Role string
+
+const (
+	RoleAdmin Role = "admin"
+	RoleUser  Role = "user"
+)
+
+// APIKey is a key that clients present as a bearer token in the
+// Authorization header.
+type APIKey struct {
+	Name string `json:"name" yaml:"name"`
+	Key  string `json:"key" yaml:"key"`
+	Role Role   `json:"role" yaml:"role"`
+}
+
+// Actor identifies the client making a request.
+type Actor struct {
+	Name string
+	Role Role
+}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, ActorContextKey, actor)
+}
+
+// UseActor returns the actor of the request and whether the request was
+// authenticated with an API key.
+func UseActor(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(ActorContextKey).(Actor)
+	return actor, ok
+}
+
+// APIKeys authenticates requests bearing one of the given API keys. Requests
+// with an unknown key are rejected, as are requests without a key if required
+// is set, except for requests to the given public paths such as health probes.
+func APIKeys(keys []APIKey, required bool, public ...string) Middleware {
+	isPublic := func(path string) bool {
+		for _, p := range public {
+			if path == p {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			key, ok := BearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				if required && !isPublic(r.URL.Path) {
+					WriteError(w, ctx, http.StatusUnauthorized, ErrMissingAPIKey)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			actor, ok := LookupAPIKey(keys, key)
+			if !ok {
+				WriteError(w, ctx, http.StatusUnauthorized, ErrInvalidAPIKey)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithActor(ctx, actor)))
+		})
+	}
+}
+
+// LookupAPIKey returns the actor holding the given key, comparing keys in
+// constant time.
+func LookupAPIKey(keys []APIKey, key string) (Actor, bool) {
+	for _, apiKey := range keys {
+		if subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) == 1 {
+			return Actor{Name: apiKey.Name, Role: apiKey.Role}, true
+		}
+	}
+	return Actor{}, false
+}
+
+// BearerToken returns the token of an Authorization header value using the
+// bearer scheme.
+func BearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return header[len(prefix):], true
+}
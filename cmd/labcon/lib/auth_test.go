@@ -0,0 +1,90 @@
+package lib_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestAPIKeys(t *testing.T) {
+	keys := []lib.APIKey{
+		{Name: "alice", Key: "secret", Role: lib.RoleAdmin},
+		{Name: "bob", Key: "hunter2", Role: lib.RoleUser},
+	}
+
+	cases := []struct {
+		required bool
+		header   string
+		code     int
+		actor    *lib.Actor
+	}{
+		{
+			required: false,
+			header:   "",
+			code:     http.StatusOK,
+			actor:    nil,
+		},
+		{
+			required: true,
+			header:   "",
+			code:     http.StatusUnauthorized,
+			actor:    nil,
+		},
+		{
+			required: false,
+			header:   "Bearer secret",
+			code:     http.StatusOK,
+			actor:    &lib.Actor{Name: "alice", Role: lib.RoleAdmin},
+		},
+		{
+			required: true,
+			header:   "bearer hunter2",
+			code:     http.StatusOK,
+			actor:    &lib.Actor{Name: "bob", Role: lib.RoleUser},
+		},
+		{
+			required: false,
+			header:   "Bearer guess",
+			code:     http.StatusUnauthorized,
+			actor:    nil,
+		},
+		{
+			required: true,
+			header:   "Basic c2VjcmV0",
+			code:     http.StatusUnauthorized,
+			actor:    nil,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			var actor *lib.Actor
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if a, ok := lib.UseActor(r.Context()); ok {
+					actor = &a
+				}
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			lib.APIKeys(keys, tt.required)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("status = %d, expected %d", w.Code, tt.code)
+			}
+			switch {
+			case actor == nil && tt.actor != nil:
+				t.Errorf("no actor, expected %+v", *tt.actor)
+			case actor != nil && tt.actor == nil:
+				t.Errorf("actor = %+v, expected none", *actor)
+			case actor != nil && *actor != *tt.actor:
+				t.Errorf("actor = %+v, expected %+v", *actor, *tt.actor)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ktnyt/labcon/codec"
+)
+
+const CodecContextKey AppContextKey = "codec"
+
+var (
+	ErrContentType = errors.New("Content-Type is not application/json, application/msgpack or application/yaml")
+	ErrHTTPMethod  = errors.New("HTTP method does not have a body")
+)
+
+func WithCodec(ctx context.Context, c codec.Codec) context.Context {
+	return context.WithValue(ctx, CodecContextKey, c)
+}
+
+// UseCodec returns the codec negotiated for the response, or JSON if none
+// was negotiated.
+func UseCodec(ctx context.Context) codec.Codec {
+	if c, ok := ctx.Value(CodecContextKey).(codec.Codec); ok {
+		return c
+	}
+	return codec.JSON
+}
+
+// Negotiate selects the codec of responses from the Accept header.
+func Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		ctx := WithCodec(r.Context(), codec.Negotiate(r.Header.Get("Accept")))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ReadRequest decodes the request body into p according to its Content-Type.
+func ReadRequest(r *http.Request, p interface{}) error {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return ErrHTTPMethod
+	}
+
+	c, ok := codec.Lookup(r.Header.Get("Content-Type"))
+	if !ok {
+		return ErrContentType
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return io.EOF
+	}
+	return c.Unmarshal(body, p)
+}
+
+func WriteResponse(w http.ResponseWriter, ctx context.Context, p interface{}) {
+	WriteStatusResponse(w, ctx, http.StatusOK, p)
+}
+
+// WriteStatusResponse writes p in the negotiated codec with the given status
+// code, for responses that carry a body regardless of success.
+func WriteStatusResponse(w http.ResponseWriter, ctx context.Context, code int, p interface{}) {
+	c := UseCodec(ctx)
+	body, err := c.Marshal(p)
+	if err != nil {
+		logger := UseLogger(ctx)
+		logger.Error().Err(err).Msg("failed to process response")
+		WriteError(w, ctx, http.StatusInternalServerError, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.ContentType())
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const DrainerContextKey AppContextKey = "drainer"
+
+// DrainingHeader is set on every response once the server starts draining.
+const DrainingHeader = "X-Labcon-Draining"
+
+// Drainer signals that the server is shutting down. While draining, drivers
+// may finish their operations but no new drivers or operations are accepted.
+type Drainer struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func NewDrainer() *Drainer {
+	return &Drainer{done: make(chan struct{})}
+}
+
+// Drain starts draining. It may be called more than once.
+func (drainer *Drainer) Drain() {
+	drainer.once.Do(func() { close(drainer.done) })
+}
+
+// Done returns a channel that is closed once draining starts, for handlers
+// that hold a request open to return early.
+func (drainer *Drainer) Done() <-chan struct{} {
+	return drainer.done
+}
+
+// Draining reports whether draining has started.
+func (drainer *Drainer) Draining() bool {
+	select {
+	case <-drainer.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func WithDrainer(ctx context.Context, drainer *Drainer) context.Context {
+	return context.WithValue(ctx, DrainerContextKey, drainer)
+}
+
+// UseDrainer returns the drainer of the server, or a drainer that never
+// drains if there is none.
+func UseDrainer(ctx context.Context) *Drainer {
+	if drainer, ok := ctx.Value(DrainerContextKey).(*Drainer); ok {
+		return drainer
+	}
+	return NewDrainer()
+}
+
+// Drain marks responses with DrainingHeader and asks clients to close their
+// connections once the drainer starts draining.
+func Drain(drainer *Drainer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if drainer.Draining() {
+				w.Header().Set(DrainingHeader, "true")
+				w.Header().Set("Connection", "close")
+			}
+			next.ServeHTTP(w, r.WithContext(WithDrainer(r.Context(), drainer)))
+		})
+	}
+}
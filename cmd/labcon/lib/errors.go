@@ -9,5 +9,9 @@ var (
 	ErrNotFound      = errors.New("not found")
 	ErrUnauthorized  = errors.New("unauthorized")
 	ErrForbidden     = errors.New("forbidden")
+	ErrBusy          = errors.New("busy")
+	ErrBooked        = errors.New("driver is booked")
+	ErrDraining      = errors.New("server is shutting down")
+	ErrTimeout       = errors.New("timed out")
 	ErrUnknown       = errors.New("unknown error")
 )
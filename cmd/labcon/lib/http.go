@@ -1,7 +1,102 @@
 package lib
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
 
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ErrorResponse is the envelope of every error response of the API.
+type ErrorResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError describes a field of the request that failed validation.
+type FieldError struct {
+	Field      string `json:"field"`
+	Constraint string `json:"constraint"`
+	Param      string `json:"param,omitempty"`
+	Message    string `json:"message"`
+}
+
+// ErrorCode returns the machine readable code for an error response with the
+// given status code and error.
+func ErrorCode(code int, err error) string {
+	var validationErr ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return "validation_failed"
+	case errors.Is(err, ErrBusy):
+		return "busy"
+	case errors.Is(err, ErrBooked):
+		return "booked"
+	case errors.Is(err, ErrDraining):
+		return "draining"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrAlreadyExists):
+		return "already_exists"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	default:
+		return strings.ToLower(strings.ReplaceAll(http.StatusText(code), " ", "_"))
+	}
+}
+
+// NewErrorResponse creates the error response for the given status code and
+// error. The message is the status text if err is nil, and the request ID is
+// taken from the context if the RequestID middleware is in use.
+func NewErrorResponse(ctx context.Context, code int, err error) ErrorResponse {
+	res := ErrorResponse{
+		Code:      ErrorCode(code, err),
+		Message:   http.StatusText(code),
+		RequestID: middleware.GetReqID(ctx),
+	}
+	if err != nil {
+		res.Message = err.Error()
+	}
+
+	var validationErr ValidationError
+	if errors.As(err, &validationErr) {
+		res.Details = validationErr.Details()
+	}
+
+	return res
+}
+
+// WriteError writes an ErrorResponse with the given status code in the
+// negotiated codec. Internal errors should be logged and passed as nil so that
+// only the status text is exposed to the client.
+func WriteError(w http.ResponseWriter, ctx context.Context, code int, err error) {
+	c := UseCodec(ctx)
+	body, merr := c.Marshal(NewErrorResponse(ctx, code, err))
+	if merr != nil {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// HTTPError writes a response with the given status code and its status text.
+// Error status codes are written as an ErrorResponse.
 func HTTPError(w http.ResponseWriter, code int) {
-	http.Error(w, http.StatusText(code), code)
+	if code < http.StatusBadRequest {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	WriteError(w, context.Background(), code, nil)
 }
@@ -0,0 +1,29 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const DriverLeaseContextKey AppContextKey = "driver_lease"
+
+func WithDriverLease(ctx context.Context, lease time.Duration) context.Context {
+	return context.WithValue(ctx, DriverLeaseContextKey, lease)
+}
+
+// UseDriverLease returns how long a driver may go without contacting the
+// server before it is reported as lost, or zero if drivers are never lost.
+func UseDriverLease(ctx context.Context) time.Duration {
+	lease, _ := ctx.Value(DriverLeaseContextKey).(time.Duration)
+	return lease
+}
+
+func DriverLease(lease time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithDriverLease(r.Context(), lease)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
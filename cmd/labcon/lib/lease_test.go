@@ -0,0 +1,28 @@
+package lib_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestDriverLease(t *testing.T) {
+	if lease := lib.UseDriverLease(context.Background()); lease != 0 {
+		t.Errorf("lib.UseDriverLease(ctx) = %v, expected 0 without the middleware", lease)
+	}
+
+	var lease time.Duration
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lease = lib.UseDriverLease(r.Context())
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	lib.DriverLease(time.Minute)(next).ServeHTTP(httptest.NewRecorder(), r)
+	if lease != time.Minute {
+		t.Errorf("lib.UseDriverLease(ctx) = %v, expected %v", lease, time.Minute)
+	}
+}
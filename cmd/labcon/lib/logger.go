@@ -9,15 +9,22 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func Logger(logger zerolog.Logger) func(http.Handler) http.Handler {
+// RequestObserver is called by Logger with each handled request, its status
+// code, the number of bytes written in the response and the time taken.
+type RequestObserver func(r *http.Request, status, size int, elapsed time.Duration)
+
+func Logger(logger zerolog.Logger, observers ...RequestObserver) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			c := logger.With()
 			c = c.Str("protocol", r.Proto)
 			c = c.Str("method", r.Method)
 			c = c.Str("url", r.URL.String())
+			if id := middleware.GetReqID(r.Context()); id != "" {
+				c = c.Str("request_id", id)
+			}
 
-			logger = c.Logger()
+			logger := c.Logger()
 
 			ctx := logger.WithContext(r.Context())
 
@@ -25,7 +32,11 @@ func Logger(logger zerolog.Logger) func(http.Handler) http.Handler {
 
 			t := time.Now()
 			defer func() {
-				logger.Info().Dur("elapsed", time.Since(t)).Msg(http.StatusText(ww.Status()))
+				elapsed := time.Since(t)
+				logger.Info().Dur("elapsed", elapsed).Msg(http.StatusText(ww.Status()))
+				for _, observe := range observers {
+					observe(r, ww.Status(), ww.BytesWritten(), elapsed)
+				}
 			}()
 
 			next.ServeHTTP(ww, r.WithContext(ctx))
@@ -41,20 +52,20 @@ type Adaptor zerolog.Logger
 
 func (adaptor Adaptor) Errorf(format string, args ...interface{}) {
 	logger := zerolog.Logger(adaptor)
-	logger.Error().Msgf(format, args)
+	logger.Error().Msgf(format, args...)
 }
 
 func (adaptor Adaptor) Warningf(format string, args ...interface{}) {
 	logger := zerolog.Logger(adaptor)
-	logger.Warn().Msgf(format, args)
+	logger.Warn().Msgf(format, args...)
 }
 
 func (adaptor Adaptor) Infof(format string, args ...interface{}) {
 	logger := zerolog.Logger(adaptor)
-	logger.Info().Msgf(format, args)
+	logger.Info().Msgf(format, args...)
 }
 
 func (adaptor Adaptor) Debugf(format string, args ...interface{}) {
 	logger := zerolog.Logger(adaptor)
-	logger.Debug().Msgf(format, args)
+	logger.Debug().Msgf(format, args...)
 }
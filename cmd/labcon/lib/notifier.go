@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const NotifierContextKey AppContextKey = "notifier"
+
+// Notifier tells subscribers that a driver has changed. Notifications carry no
+// data and are coalesced, so subscribers read the driver again when notified
+// and a slow subscriber never holds up the one who changed the driver. Changes
+// to workflow runs and schedules are notified too, as "run/{id}" and
+// "schedule/{name}", to wake the workflow engine and the scheduler.
+type Notifier struct {
+	mu       sync.Mutex
+	subs     map[string]map[chan struct{}]struct{}
+	prefixes map[string]map[chan struct{}]struct{}
+	all      map[chan struct{}]struct{}
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{
+		subs:     make(map[string]map[chan struct{}]struct{}),
+		prefixes: make(map[string]map[chan struct{}]struct{}),
+		all:      make(map[chan struct{}]struct{}),
+	}
+}
+
+// Notify wakes the subscribers of the named driver, of the prefixes of the
+// name and of all drivers.
+func (notifier *Notifier) Notify(name string) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	for ch := range notifier.subs[name] {
+		wake(ch)
+	}
+	for prefix, subs := range notifier.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			for ch := range subs {
+				wake(ch)
+			}
+		}
+	}
+	for ch := range notifier.all {
+		wake(ch)
+	}
+}
+
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe returns a channel that receives a value after the named driver
+// changes, and a function to unsubscribe. Changes made after Subscribe returns
+// are never missed, so a subscriber should read the driver only after
+// subscribing.
+func (notifier *Notifier) Subscribe(name string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	if notifier.subs[name] == nil {
+		notifier.subs[name] = make(map[chan struct{}]struct{})
+	}
+	notifier.subs[name][ch] = struct{}{}
+
+	return ch, func() {
+		notifier.mu.Lock()
+		defer notifier.mu.Unlock()
+
+		delete(notifier.subs[name], ch)
+		if len(notifier.subs[name]) == 0 {
+			delete(notifier.subs, name)
+		}
+	}
+}
+
+// SubscribePrefix is like Subscribe for changes to anything notified with a
+// name starting with the prefix, such as "run/" for the workflow runs.
+func (notifier *Notifier) SubscribePrefix(prefix string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	if notifier.prefixes[prefix] == nil {
+		notifier.prefixes[prefix] = make(map[chan struct{}]struct{})
+	}
+	notifier.prefixes[prefix][ch] = struct{}{}
+
+	return ch, func() {
+		notifier.mu.Lock()
+		defer notifier.mu.Unlock()
+
+		delete(notifier.prefixes[prefix], ch)
+		if len(notifier.prefixes[prefix]) == 0 {
+			delete(notifier.prefixes, prefix)
+		}
+	}
+}
+
+// SubscribeAll is like Subscribe for changes to any driver, including drivers
+// registered after subscribing.
+func (notifier *Notifier) SubscribeAll() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	notifier.all[ch] = struct{}{}
+
+	return ch, func() {
+		notifier.mu.Lock()
+		defer notifier.mu.Unlock()
+
+		delete(notifier.all, ch)
+	}
+}
+
+func WithNotifier(ctx context.Context, notifier *Notifier) context.Context {
+	return context.WithValue(ctx, NotifierContextKey, notifier)
+}
+
+// UseNotifier returns the notifier of the server, or nil if there is none.
+func UseNotifier(ctx context.Context) *Notifier {
+	notifier, _ := ctx.Value(NotifierContextKey).(*Notifier)
+	return notifier
+}
+
+func Notifications(notifier *Notifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithNotifier(r.Context(), notifier)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
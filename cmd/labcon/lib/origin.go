@@ -0,0 +1,18 @@
+package lib
+
+import "context"
+
+const OriginContextKey AppContextKey = "origin"
+
+// WithOrigin marks the operations dispatched with the context as dispatched
+// by the given workflow run or schedule, e.g. "run/12".
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, OriginContextKey, origin)
+}
+
+// UseOrigin returns the workflow run or schedule dispatching operations, or
+// an empty string if they are dispatched by a request.
+func UseOrigin(ctx context.Context) string {
+	origin, _ := ctx.Value(OriginContextKey).(string)
+	return origin
+}
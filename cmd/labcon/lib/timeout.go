@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Timeout limits the time for handling a request, responding with 504 Gateway
+// Timeout once it runs out, unless the timeout is zero. Requests to paths
+// matching one of the exempt patterns, as in path.Match, are not limited,
+// e.g. because they are held open for as long as the client asks to.
+func Timeout(timeout time.Duration, exempt ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		limited := middleware.Timeout(timeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, pattern := range exempt {
+				if ok, _ := path.Match(pattern, r.URL.Path); ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package lib_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+func TestTimeout(t *testing.T) {
+	// The handler takes longer than the timeout unless it is cut short.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	handler := lib.Timeout(10*time.Millisecond, "/driver/*/state/wait")(next)
+
+	cases := []struct {
+		path string
+		code int
+	}{
+		{path: "/driver/foo/state", code: http.StatusGatewayTimeout},
+		{path: "/driver/foo/state/wait", code: http.StatusOK},
+		{path: "/driver/foo/bar/state/wait", code: http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range cases {
+		lib.RunCase(t, tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.code {
+				t.Errorf("GET %s responded with %d, expected %d", tt.path, w.Code, tt.code)
+			}
+		})
+	}
+}
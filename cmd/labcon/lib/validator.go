@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"regexp"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -18,12 +19,25 @@ var validate *validator.Validate
 func init() {
 	validate = validator.New()
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
-		fieldName := fld.Tag.Get("json")
+		fieldName := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
 		if fieldName == "-" {
 			return ""
 		}
 		return fieldName
 	})
+	validate.RegisterValidation("label", func(fl validator.FieldLevel) bool {
+		return ValidLabel(fl.Field().String())
+	})
+}
+
+// labelPattern matches label keys and values.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidLabel reports whether s may be the key or value of a label: up to 63
+// letters, digits, '-', '_', '.' and '/', starting and ending with a letter or
+// digit.
+func ValidLabel(s string) bool {
+	return labelPattern.MatchString(s)
 }
 
 type CustomValidator interface {
@@ -48,6 +62,24 @@ func (err ValidationError) Error() string {
 	return strings.Join(msgs, "\n")
 }
 
+// Details returns the failed fields as FieldError values.
+func (err ValidationError) Details() []FieldError {
+	details := make([]FieldError, len(err))
+	for i, field := range err {
+		details[i] = FieldError{
+			Field:      field.Field(),
+			Constraint: field.Tag(),
+			Param:      field.Param(),
+			Message: fmt.Sprintf(
+				"validation failed on field %q for constraint %q",
+				field.Field(),
+				field.Tag(),
+			),
+		}
+	}
+	return details
+}
+
 // Validate validates an object using the global validator.
 func Validate(p interface{}) error {
 	if err := validate.Struct(p); err != nil {
@@ -1,68 +1,337 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/goccy/go-yaml"
 	"github.com/ktnyt/labcon/cmd/labcon/app"
 	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/bridge"
+	"github.com/ktnyt/labcon/cmd/labcon/config"
 	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/metrics"
+	"github.com/ktnyt/labcon/cmd/labcon/rpc"
+	"github.com/ktnyt/labcon/cmd/labcon/scheduler"
+	"github.com/ktnyt/labcon/cmd/labcon/workflow"
+	"github.com/ktnyt/labcon/labconpb"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+func newLogger(logConfig config.LogConfig) zerolog.Logger {
+	var w io.Writer = os.Stderr
+	if logConfig.Format == config.Console {
+		w = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	}
+	level, _ := zerolog.ParseLevel(logConfig.Level)
+	return zerolog.New(w).Level(level).With().Timestamp().Logger()
+}
+
 func main() {
-	w := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
-	logger := log.Output(w).Level(zerolog.TraceLevel)
+	cmd, err := config.ParseCommand(flag.NewFlagSet("labcon", flag.ExitOnError), os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "labcon: %v\n", err)
+		os.Exit(2)
+	}
 
-	r := chi.NewMux()
+	cfg := cmd.Config
+	if cmd.PrintConfig {
+		p, err := yaml.MarshalWithOptions(cfg.Redacted(), yaml.Indent(2))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "labcon: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(p)
+		return
+	}
 
+	logger := newLogger(cfg.Log)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, logger); err != nil {
+		logger.Fatal().Err(err).Msg("server failed")
+	}
+}
+
+// run serves until the context is done, and then drains and shuts down the
+// server. Errors in setting up or starting the server are returned at once.
+func run(ctx context.Context, cfg config.Config, logger zerolog.Logger) error {
 	corsOpts := cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{
-			"X-PINGOTHER",
-			"Accept",
-			"Authorization",
-			"Content-Type",
-			"X-CSRF-Token",
-			"X-Driver-Token",
-		},
-		AllowCredentials: true,
-	}
-
-	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(lib.Adaptor(logger))
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   []string{lib.DrainingHeader},
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}
+
+	opts := badger.DefaultOptions(cfg.Storage.Path).WithLogger(lib.Adaptor(logger))
+	if cfg.Storage.Backend == config.Memory {
+		opts = opts.WithInMemory(true)
+	}
 	db, err := badger.Open(opts)
 	if err != nil {
-		logger.Err(err).Msg("failed to open database")
+		return fmt.Errorf("failed to open database: %w", err)
 	}
-	defer db.Close()
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Err(err).Msg("failed to close database")
+		}
+	}()
 
+	drainer := lib.NewDrainer()
+	notifier := lib.NewNotifier()
+	registry := metrics.NewRegistry(metrics.WithStateGauges(cfg.Metrics.State))
+
+	r := chi.NewMux()
 	r.Use(
-		lib.Logger(logger),
+		middleware.RequestID,
+		lib.Logger(logger, registry.ObserveRequest),
+		lib.Negotiate,
 		cors.Handler(corsOpts),
+		lib.Drain(drainer),
+		lib.APIKeys(cfg.Auth.APIKeys, cfg.Auth.Required, "/healthz", "/readyz"),
 		lib.Badger(db),
 		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+		lib.DriverLease(cfg.Lease.Driver),
+		lib.Notifications(notifier),
+		metrics.Middleware(registry),
 		lib.CurrentTime,
-		middleware.Timeout(time.Second*60),
+		lib.Timeout(cfg.RequestTimeout, app.UntimedPaths...),
 		middleware.Recoverer,
 	)
 
 	a := app.NewApp(injectors.Driver)
 	a.Setup(r)
 
-	host := os.Getenv("HOST")
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5000"
+	server := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: r,
+	}
+
+	if cfg.TLS.Enabled() {
+		server.TLSConfig, err = lib.TLSConfig(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.ClientCA, cfg.TLS.RequireClientCert)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		if cfg.TLS.Enabled() {
+			errs <- server.ListenAndServeTLS("", "")
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	// The gRPC server shares the storage, drainer and notifier of the HTTP
+	// server, so that both APIs see and wake on the same drivers.
+	var grpcServer *grpc.Server
+	var grpcErrs chan error
+	if cfg.GRPCAddr != "" {
+		lis, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+
+		unary, stream := rpc.Interceptors(
+			rpc.Logger(logger),
+			rpc.APIKeys(cfg.Auth.APIKeys, cfg.Auth.Required),
+			rpc.Context(func(ctx context.Context) context.Context {
+				ctx = lib.WithDrainer(ctx, drainer)
+				ctx = lib.WithBadger(ctx, db)
+				ctx = lib.WithDriverTokenGenerator(ctx, lib.DefaultTokenGenerator)
+				ctx = lib.WithDriverLease(ctx, cfg.Lease.Driver)
+				ctx = lib.WithNotifier(ctx, notifier)
+				ctx = metrics.WithRegistry(ctx, registry)
+				return ctx
+			}),
+		)
+		opts := []grpc.ServerOption{grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream)}
+		if server.TLSConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(server.TLSConfig)))
+		}
+
+		grpcServer = grpc.NewServer(opts...)
+		labconpb.RegisterDriverServiceServer(grpcServer, rpc.NewServer(injectors.Driver))
+
+		grpcErrs = make(chan error, 1)
+		go func() {
+			grpcErrs <- grpcServer.Serve(lis)
+		}()
+	}
+
+	// The MQTT bridge, the workflow engine and the scheduler share them too,
+	// and stop once the server is drained.
+	servicesCtx, stopServices := context.WithCancel(context.Background())
+	defer stopServices()
+	servicesCtx = lib.WithDrainer(servicesCtx, drainer)
+	servicesCtx = lib.WithBadger(servicesCtx, db)
+	servicesCtx = lib.WithDriverTokenGenerator(servicesCtx, lib.DefaultTokenGenerator)
+	servicesCtx = lib.WithDriverLease(servicesCtx, cfg.Lease.Driver)
+	servicesCtx = lib.WithNotifier(servicesCtx, notifier)
+	servicesCtx = metrics.WithRegistry(servicesCtx, registry)
+
+	var bridgeDone chan struct{}
+	if cfg.MQTT.Enabled() {
+		opts := mqtt.NewClientOptions().
+			AddBroker(cfg.MQTT.Broker).
+			SetClientID(cfg.MQTT.ClientID).
+			SetUsername(cfg.MQTT.Username).
+			SetPassword(cfg.MQTT.Password).
+			SetAutoReconnect(true).
+			SetConnectRetry(true)
+
+		bridgeLogger := logger.With().Str("protocol", "mqtt").Logger()
+		bridgeCtx := bridgeLogger.WithContext(servicesCtx)
+
+		tokens := repositories.NewTokenRepository(db, "mqtt")
+		bridgeOpts := []bridge.MQTTOption{bridge.WithAuthRequired(cfg.Auth.Required)}
+		for _, key := range cfg.Auth.APIKeys {
+			if key.Name == cfg.MQTT.APIKey {
+				bridgeOpts = append(bridgeOpts, bridge.WithActor(lib.Actor{Name: key.Name, Role: key.Role}))
+			}
+		}
+		b := bridge.NewMQTT(opts, injectors.Driver, tokens, cfg.MQTT.Prefix, bridgeOpts...)
+
+		bridgeDone = make(chan struct{})
+		go func() {
+			defer close(bridgeDone)
+			if err := b.Run(bridgeCtx); err != nil {
+				logger.Err(err).Msg("MQTT bridge stopped")
+			}
+		}()
+	}
+
+	engineLogger := logger.With().Str("component", "workflow").Logger()
+	engineCtx := engineLogger.WithContext(servicesCtx)
+	engine := workflow.NewEngine(injectors.Driver, repositories.NewRunRepository(db))
+	engineDone := make(chan struct{})
+	go func() {
+		defer close(engineDone)
+		if err := engine.Run(engineCtx); err != nil {
+			logger.Err(err).Msg("workflow engine stopped")
+		}
+	}()
+
+	schedulerLogger := logger.With().Str("component", "scheduler").Logger()
+	schedulerCtx := schedulerLogger.WithContext(servicesCtx)
+	sched := scheduler.NewScheduler(injectors.Driver, repositories.NewScheduleRepository(db))
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if err := sched.Run(schedulerCtx); err != nil {
+			logger.Err(err).Msg("scheduler stopped")
+		}
+	}()
+
+	logger.Info().Str("addr", cfg.Addr).Str("grpc_addr", cfg.GRPCAddr).Str("mqtt_broker", cfg.MQTT.Broker).Bool("tls", cfg.TLS.Enabled()).Str("storage", cfg.Storage.Backend).Msg("server started")
+
+	if _, err := lib.SdNotify("READY=1"); err != nil {
+		logger.Warn().Err(err).Msg("failed to notify systemd")
+	}
+	if interval := lib.SdWatchdogInterval(); interval > 0 {
+		watchdogCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go watchdog(watchdogCtx, interval/2, repositories.NewHealthRepository(db).Probe, logger)
+	}
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve: %w", err)
+	case err := <-grpcErrs:
+		return fmt.Errorf("failed to serve gRPC: %w", err)
+	case <-ctx.Done():
 	}
-	addr := fmt.Sprintf("%s:%s", host, port)
 
-	http.ListenAndServe(addr, r)
+	// Keep serving drivers so that they can finish their operations while
+	// new drivers and operations are refused.
+	logger.Info().Dur("drain", cfg.Shutdown.Drain).Msg("draining")
+	drainer.Drain()
+	if _, err := lib.SdNotify("STOPPING=1"); err != nil {
+		logger.Warn().Err(err).Msg("failed to notify systemd")
+	}
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve: %w", err)
+	case err := <-grpcErrs:
+		return fmt.Errorf("failed to serve gRPC: %w", err)
+	case <-time.After(cfg.Shutdown.Drain):
+	}
+
+	logger.Info().Dur("timeout", cfg.Shutdown.Timeout).Msg("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancel()
+	stopServices()
+	if bridgeDone != nil {
+		<-bridgeDone
+	}
+	<-engineDone
+	<-schedulerDone
+	if grpcServer != nil {
+		// Streams end once draining starts, so only unary calls in flight
+		// are waited for.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+
+	logger.Info().Msg("server stopped")
+	return nil
+}
+
+// watchdog notifies systemd at every tick as long as the storage backend
+// passes the probe, so that a server with broken storage gets restarted.
+func watchdog(ctx context.Context, interval time.Duration, probe func() error, logger zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := probe(); err != nil {
+			logger.Err(err).Msg("storage check failed, withholding watchdog notification")
+			continue
+		}
+		if _, err := lib.SdNotify("WATCHDOG=1"); err != nil {
+			logger.Warn().Err(err).Msg("failed to notify systemd watchdog")
+		}
+	}
 }
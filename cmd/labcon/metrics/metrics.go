@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DefaultBuckets are the histogram buckets for request durations.
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// OperationBuckets are the histogram buckets for operation durations,
+	// which range from a moment to hours.
+	OperationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+)
+
+// Label is a name and value pair of a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a gauge computed at scrape time.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// vec holds the series of a metric by label values.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+
+	// Histogram series count observations per bucket.
+	counts []uint64
+	count  uint64
+}
+
+func newVec(name, help string, labels ...string) *vec {
+	return &vec{name: name, help: help, labels: labels, series: make(map[string]*series)}
+}
+
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []*series {
+	list := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].values, "\xff") < strings.Join(list[j].values, "\xff")
+	})
+	return list
+}
+
+func (v *vec) labelsOf(s *series) []Label {
+	labels := make([]Label, len(v.labels))
+	for i, name := range v.labels {
+		labels[i] = Label{Name: name, Value: s.values[i]}
+	}
+	return labels
+}
+
+// Counter is a monotonically increasing value per combination of labels.
+type Counter struct {
+	vec *vec
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{vec: newVec(name, help, labels...)}
+}
+
+// Add adds delta to the series with the given label values.
+func (c *Counter) Add(delta float64, values ...string) {
+	c.vec.mu.Lock()
+	defer c.vec.mu.Unlock()
+	c.vec.get(values).value += delta
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.vec.mu.Lock()
+	defer c.vec.mu.Unlock()
+
+	writeHeader(w, c.vec.name, c.vec.help, "counter")
+	for _, s := range c.vec.sorted() {
+		writeSample(w, c.vec.name, c.vec.labelsOf(s), s.value)
+	}
+}
+
+// Histogram counts observations in buckets per combination of labels.
+type Histogram struct {
+	vec     *vec
+	buckets []float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{vec: newVec(name, help, labels...), buckets: buckets}
+}
+
+// Observe records a value in the series with the given label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.vec.mu.Lock()
+	defer h.vec.mu.Unlock()
+
+	s := h.vec.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.vec.mu.Lock()
+	defer h.vec.mu.Unlock()
+
+	writeHeader(w, h.vec.name, h.vec.help, "histogram")
+	for _, s := range h.vec.sorted() {
+		labels := h.vec.labelsOf(s)
+		for i, bound := range h.buckets {
+			le := Label{Name: "le", Value: formatFloat(bound)}
+			writeSample(w, h.vec.name+"_bucket", append(labels, le), float64(s.counts[i]))
+		}
+		inf := Label{Name: "le", Value: "+Inf"}
+		writeSample(w, h.vec.name+"_bucket", append(labels, inf), float64(s.count))
+		writeSample(w, h.vec.name+"_sum", labels, s.value)
+		writeSample(w, h.vec.name+"_count", labels, float64(s.count))
+	}
+}
+
+// WriteGauge writes a gauge whose samples are computed at scrape time.
+func WriteGauge(w io.Writer, name, help string, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, name, help, "gauge")
+	for _, sample := range samples {
+		writeSample(bw, name, sample.Labels, sample.Value)
+	}
+	return bw.Flush()
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels []Label, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label.Name, escapeLabel(label.Value))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,117 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/metrics"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	cases := []struct {
+		opts    []metrics.RegistryOption
+		drivers []metrics.DriverSample
+		out     []string
+	}{
+		{
+			opts: nil,
+			drivers: []metrics.DriverSample{
+				{Name: "foo", Status: driver.Busy, State: map[string]interface{}{"volume": 10}},
+			},
+			out: []string{
+				`labcon_operations_dispatched_total{driver="foo",op="aspirate"} 2`,
+				`labcon_operations_completed_total{driver="foo",op="aspirate"} 1`,
+				`labcon_operations_failed_total{driver="foo",op="aspirate"} 1`,
+				`labcon_operation_duration_seconds_bucket{driver="foo",op="aspirate",le="1"} 0`,
+				`labcon_operation_duration_seconds_bucket{driver="foo",op="aspirate",le="5"} 1`,
+				`labcon_operation_duration_seconds_bucket{driver="foo",op="aspirate",le="+Inf"} 1`,
+				`labcon_operation_duration_seconds_sum{driver="foo",op="aspirate"} 2`,
+				`labcon_operation_duration_seconds_count{driver="foo",op="aspirate"} 1`,
+				`# TYPE labcon_drivers gauge`,
+				`labcon_drivers{status="busy"} 1`,
+				`labcon_drivers{status="lost"} 0`,
+				`labcon_driver_status{driver="foo",status="busy"} 1`,
+				`labcon_driver_status{driver="foo",status="idle"} 0`,
+			},
+		},
+		{
+			opts: []metrics.RegistryOption{metrics.WithStateGauges(true)},
+			drivers: []metrics.DriverSample{
+				{Name: "foo", Status: driver.Idle, State: map[string]interface{}{
+					"volume": int8(10),
+					"tip":    true,
+					"label":  "A1",
+					"plate":  map[string]interface{}{"temperature": 37.5},
+				}},
+				{Name: "bar\"", Status: driver.Lost, State: 3.0},
+			},
+			out: []string{
+				`labcon_drivers{status="lost"} 1`,
+				`labcon_driver_state{driver="foo",field="plate.temperature"} 37.5`,
+				`labcon_driver_state{driver="foo",field="tip"} 1`,
+				`labcon_driver_state{driver="foo",field="volume"} 10`,
+				`labcon_driver_state{driver="bar\"",field=""} 3`,
+			},
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			registry := metrics.NewRegistry(tt.opts...)
+			op := driver.Op{Name: "aspirate"}
+			registry.Dispatched("foo", op)
+			registry.Completed("foo", op, driver.Idle, 2*time.Second)
+			registry.Dispatched("foo", op)
+			registry.Completed("foo", op, driver.Error, 0)
+
+			b := &strings.Builder{}
+			if err := registry.Write(b, tt.drivers); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(b.String(), "\n")
+			for _, want := range tt.out {
+				found := false
+				for _, line := range lines {
+					if line == want {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("missing line %q in:\n%s", want, b.String())
+				}
+			}
+			if strings.Contains(b.String(), "label") {
+				t.Errorf("non-numeric state field exported:\n%s", b.String())
+			}
+		})
+	}
+}
+
+func TestWriteGauge(t *testing.T) {
+	samples := []metrics.Sample{
+		{Value: 1},
+		{Labels: []metrics.Label{{Name: "path", Value: "C:\\data\n"}}, Value: 0.5},
+	}
+
+	b := &strings.Builder{}
+	if err := metrics.WriteGauge(b, "test_gauge", "A test\ngauge.", samples); err != nil {
+		t.Fatal(err)
+	}
+
+	out := strings.Join([]string{
+		`# HELP test_gauge A test\ngauge.`,
+		`# TYPE test_gauge gauge`,
+		`test_gauge 1`,
+		`test_gauge{path="C:\\data\n"} 0.5`,
+		``,
+	}, "\n")
+	if b.String() != out {
+		t.Errorf("mismatch in output:\n%s", utils.JoinOps(utils.LineDiff(b.String(), out), "\n"))
+	}
+}
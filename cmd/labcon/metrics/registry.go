@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+)
+
+const RegistryContextKey lib.AppContextKey = "metrics_registry"
+
+var statuses = []driver.Status{driver.Idle, driver.Busy, driver.Lost, driver.Error}
+
+// Registry holds the metrics of the server.
+type Registry struct {
+	requests        *Counter
+	requestDuration *Histogram
+	responseSize    *Counter
+	dispatched      *Counter
+	completed       *Counter
+	failed          *Counter
+	opDuration      *Histogram
+
+	exportState bool
+}
+
+// RegistryOption configures a Registry.
+type RegistryOption func(registry *Registry)
+
+// WithStateGauges exports the numeric and boolean fields of driver states as
+// gauges.
+func WithStateGauges(enabled bool) RegistryOption {
+	return func(registry *Registry) {
+		registry.exportState = enabled
+	}
+}
+
+func NewRegistry(opts ...RegistryOption) *Registry {
+	registry := &Registry{
+		requests: NewCounter(
+			"labcon_http_requests_total",
+			"Number of HTTP requests by method, route and status code.",
+			"method", "route", "code",
+		),
+		requestDuration: NewHistogram(
+			"labcon_http_request_duration_seconds",
+			"Time taken to handle HTTP requests by method and route.",
+			DefaultBuckets,
+			"method", "route",
+		),
+		responseSize: NewCounter(
+			"labcon_http_response_size_bytes_total",
+			"Number of bytes written in HTTP responses by method and route.",
+			"method", "route",
+		),
+		dispatched: NewCounter(
+			"labcon_operations_dispatched_total",
+			"Number of operations dispatched by driver and operation.",
+			"driver", "op",
+		),
+		completed: NewCounter(
+			"labcon_operations_completed_total",
+			"Number of operations completed successfully by driver and operation.",
+			"driver", "op",
+		),
+		failed: NewCounter(
+			"labcon_operations_failed_total",
+			"Number of operations that failed by driver and operation.",
+			"driver", "op",
+		),
+		opDuration: NewHistogram(
+			"labcon_operation_duration_seconds",
+			"Time from dispatch to completion of operations, i.e. how long drivers stay busy, by driver and operation.",
+			OperationBuckets,
+			"driver", "op",
+		),
+	}
+	for _, opt := range opts {
+		opt(registry)
+	}
+	return registry
+}
+
+// ObserveRequest records a handled HTTP request. It is meant to be given to
+// lib.Logger, which wraps the response writer to capture the status and size.
+// Requests are labeled by route pattern rather than path to keep the number of
+// series bounded.
+func (registry *Registry) ObserveRequest(r *http.Request, status, size int, elapsed time.Duration) {
+	route := "unmatched"
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+	}
+	registry.requests.Inc(r.Method, route, strconv.Itoa(status))
+	registry.requestDuration.Observe(elapsed.Seconds(), r.Method, route)
+	registry.responseSize.Add(float64(size), r.Method, route)
+}
+
+// Dispatched records an operation dispatched to a driver.
+func (registry *Registry) Dispatched(name string, op driver.Op) {
+	registry.dispatched.Inc(name, op.Name)
+}
+
+// Completed records an operation that a driver finished with the given
+// status. The duration is not recorded if it is unknown.
+func (registry *Registry) Completed(name string, op driver.Op, status driver.Status, elapsed time.Duration) {
+	if status == driver.Error {
+		registry.failed.Inc(name, op.Name)
+	} else {
+		registry.completed.Inc(name, op.Name)
+	}
+	if elapsed > 0 {
+		registry.opDuration.Observe(elapsed.Seconds(), name, op.Name)
+	}
+}
+
+// DriverSample is the state of a driver at scrape time.
+type DriverSample struct {
+	Name   string
+	Status driver.Status
+	State  interface{}
+}
+
+// Write writes all metrics in the Prometheus text format, including gauges
+// computed from the given drivers.
+func (registry *Registry) Write(w io.Writer, drivers []DriverSample) error {
+	bw := bufio.NewWriter(w)
+	registry.requests.write(bw)
+	registry.requestDuration.write(bw)
+	registry.responseSize.write(bw)
+	registry.dispatched.write(bw)
+	registry.completed.write(bw)
+	registry.failed.write(bw)
+	registry.opDuration.write(bw)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	counts := make(map[driver.Status]int)
+	status := []Sample{}
+	for _, d := range drivers {
+		counts[d.Status]++
+		for _, s := range statuses {
+			status = append(status, Sample{
+				Labels: []Label{{"driver", d.Name}, {"status", string(s)}},
+				Value:  boolValue(d.Status == s),
+			})
+		}
+	}
+
+	totals := make([]Sample, len(statuses))
+	for i, s := range statuses {
+		totals[i] = Sample{Labels: []Label{{"status", string(s)}}, Value: float64(counts[s])}
+	}
+
+	if err := WriteGauge(w, "labcon_drivers", "Number of drivers by status.", totals); err != nil {
+		return err
+	}
+	if err := WriteGauge(w, "labcon_driver_status", "Status of each driver, which is 1 for the current status and 0 otherwise.", status); err != nil {
+		return err
+	}
+
+	if !registry.exportState {
+		return nil
+	}
+
+	state := []Sample{}
+	for _, d := range drivers {
+		for _, field := range flatten("", d.State) {
+			state = append(state, Sample{
+				Labels: []Label{{"driver", d.Name}, {"field", field.name}},
+				Value:  field.value,
+			})
+		}
+	}
+	return WriteGauge(w, "labcon_driver_state", "Numeric and boolean fields of driver states, named by their path.", state)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type field struct {
+	name  string
+	value float64
+}
+
+// flatten returns the numeric and boolean values in v sorted by their dotted
+// path. A scalar state has the empty path.
+func flatten(prefix string, v interface{}) []field {
+	switch v := v.(type) {
+	case bool:
+		return []field{{prefix, boolValue(v)}}
+	case float64:
+		return []field{{prefix, v}}
+	case float32:
+		return []field{{prefix, float64(v)}}
+	case int:
+		return []field{{prefix, float64(v)}}
+	case int8:
+		return []field{{prefix, float64(v)}}
+	case int16:
+		return []field{{prefix, float64(v)}}
+	case int32:
+		return []field{{prefix, float64(v)}}
+	case int64:
+		return []field{{prefix, float64(v)}}
+	case uint:
+		return []field{{prefix, float64(v)}}
+	case uint8:
+		return []field{{prefix, float64(v)}}
+	case uint16:
+		return []field{{prefix, float64(v)}}
+	case uint32:
+		return []field{{prefix, float64(v)}}
+	case uint64:
+		return []field{{prefix, float64(v)}}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := []field{}
+		for _, key := range keys {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			fields = append(fields, flatten(name, v[key])...)
+		}
+		return fields
+	default:
+		return nil
+	}
+}
+
+func WithRegistry(ctx context.Context, registry *Registry) context.Context {
+	return context.WithValue(ctx, RegistryContextKey, registry)
+}
+
+// UseRegistry returns the registry of the server, or nil if metrics are not
+// collected.
+func UseRegistry(ctx context.Context) *Registry {
+	registry, _ := ctx.Value(RegistryContextKey).(*Registry)
+	return registry
+}
+
+func Middleware(registry *Registry) lib.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithRegistry(r.Context(), registry)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Package openapi holds the OpenAPI document describing the HTTP API of the
+// labcon server. The document is maintained by hand next to app.Setup, which
+// is checked against it by the tests of the app package.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var Document []byte
+
+// methods are the keys of a path item that are operations.
+var methods = map[string]bool{
+	"get":     true,
+	"put":     true,
+	"post":    true,
+	"delete":  true,
+	"options": true,
+	"head":    true,
+	"patch":   true,
+	"trace":   true,
+}
+
+// Operations returns the operations in the document as "METHOD /path" with
+// paths in the document's template syntax, e.g. "GET /driver/{name}/state".
+func Operations() ([]string, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(Document, &doc); err != nil {
+		return nil, err
+	}
+
+	ops := []string{}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if methods[method] {
+				ops = append(ops, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(ops)
+	return ops, nil
+}
@@ -0,0 +1,67 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ktnyt/labcon/cmd/labcon/openapi"
+)
+
+// refs returns the values of every $ref in v.
+func refs(v interface{}) []string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		list := []string{}
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				list = append(list, ref)
+				continue
+			}
+			list = append(list, refs(value)...)
+		}
+		return list
+	case []interface{}:
+		list := []string{}
+		for _, value := range v {
+			list = append(list, refs(value)...)
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+func TestDocument(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openapi.Document, &doc); err != nil {
+		t.Fatalf("failed to parse OpenAPI document: %v", err)
+	}
+
+	for _, ref := range refs(doc) {
+		if !strings.HasPrefix(ref, "#/") {
+			t.Errorf("$ref %q is not local to the document", ref)
+			continue
+		}
+		var node interface{} = doc
+		for _, name := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, ok := node.(map[string]interface{})
+			if !ok {
+				node = nil
+				break
+			}
+			node = m[name]
+		}
+		if node == nil {
+			t.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+
+	ops, err := openapi.Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) == 0 {
+		t.Error("no operations in the OpenAPI document")
+	}
+}
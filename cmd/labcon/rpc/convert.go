@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/labconpb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var statuses = map[driver.Status]labconpb.Status{
+	driver.Idle:  labconpb.Status_STATUS_IDLE,
+	driver.Busy:  labconpb.Status_STATUS_BUSY,
+	driver.Lost:  labconpb.Status_STATUS_LOST,
+	driver.Error: labconpb.Status_STATUS_ERROR,
+}
+
+func toStatus(status driver.Status) labconpb.Status {
+	return statuses[status]
+}
+
+func fromStatus(status labconpb.Status) (driver.Status, bool) {
+	for s, pb := range statuses {
+		if pb == status {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// toValue converts a decoded state or argument to a protobuf value by way of
+// JSON, so that it reads the same as in a REST response.
+func toValue(v interface{}) (*structpb.Value, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value := &structpb.Value{}
+	if err := protojson.Unmarshal(p, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// fromValue converts a protobuf value to the form decoded from a JSON body. An
+// unset value is nil.
+func fromValue(value *structpb.Value) interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.AsInterface()
+}
+
+func toOp(op *driver.Op) (*labconpb.Op, error) {
+	if op == nil {
+		return nil, nil
+	}
+	arg, err := toValue(op.Arg)
+	if err != nil {
+		return nil, err
+	}
+	return &labconpb.Op{Name: op.Name, Arg: arg}, nil
+}
+
+func fromOp(op *labconpb.Op) driver.Op {
+	if op == nil {
+		return driver.Op{}
+	}
+	return driver.Op{Name: op.Name, Arg: fromValue(op.Arg)}
+}
+
+func fromMetadata(metadata *labconpb.Metadata) driver.Metadata {
+	if metadata == nil {
+		return driver.Metadata{}
+	}
+	return driver.Metadata{
+		Location: metadata.Location,
+		Model:    metadata.Model,
+		Serial:   metadata.Serial,
+		Owner:    metadata.Owner,
+	}
+}
+
+func toSnapshot(model models.DriverModel) (*labconpb.Snapshot, error) {
+	state, err := toValue(model.State)
+	if err != nil {
+		return nil, err
+	}
+	op, err := toOp(model.Op)
+	if err != nil {
+		return nil, err
+	}
+	return &labconpb.Snapshot{
+		Name:   model.Name,
+		State:  state,
+		Status: toStatus(model.Status),
+		Op:     op,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Middleware prepares the context of a call, as lib.Middleware does for HTTP
+// requests, or rejects the call with an error.
+type Middleware func(ctx context.Context, method string) (context.Context, error)
+
+// Interceptors returns interceptors that run the middleware in order before
+// each call, log the call once it ends and turn panics into INTERNAL errors.
+func Interceptors(middlewares ...Middleware) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	prepare := func(ctx context.Context, method string) (context.Context, error) {
+		for _, middleware := range middlewares {
+			var err error
+			if ctx, err = middleware(ctx, method); err != nil {
+				return ctx, err
+			}
+		}
+		return ctx, nil
+	}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		t := time.Now()
+		defer func() { err = finish(ctx, recover(), err, t) }()
+
+		if ctx, err = prepare(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := ss.Context()
+		t := time.Now()
+		defer func() { err = finish(ctx, recover(), err, t) }()
+
+		if ctx, err = prepare(ctx, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, serverStream{ServerStream: ss, ctx: ctx})
+	}
+
+	return unary, stream
+}
+
+// finish logs the end of a call with the logger set by the Logger
+// middleware, and converts a recovered panic into an INTERNAL error.
+func finish(ctx context.Context, recovered interface{}, err error, t time.Time) error {
+	logger := lib.UseLogger(ctx)
+	if recovered != nil {
+		logger.Error().Interface("panic", recovered).Msg("recovered from panic")
+		err = status.Error(codes.Internal, "internal error")
+	}
+	logger.Info().Dur("elapsed", time.Since(t)).Msg(status.Code(err).String())
+	return err
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// Logger sets a logger annotated with the method of the call.
+func Logger(logger zerolog.Logger) Middleware {
+	return func(ctx context.Context, method string) (context.Context, error) {
+		logger := logger.With().Str("protocol", "grpc").Str("method", method).Logger()
+		return logger.WithContext(ctx), nil
+	}
+}
+
+// APIKeys authenticates calls bearing one of the given API keys in the
+// "authorization" metadata. Calls with an unknown key are rejected, as are
+// calls without a key if required is set.
+func APIKeys(keys []lib.APIKey, required bool) Middleware {
+	return func(ctx context.Context, method string) (context.Context, error) {
+		key, ok := lib.BearerToken(firstMetadata(ctx, "authorization"))
+		if !ok {
+			if required {
+				return ctx, status.Error(codes.Unauthenticated, lib.ErrMissingAPIKey.Error())
+			}
+			return ctx, nil
+		}
+
+		actor, ok := lib.LookupAPIKey(keys, key)
+		if !ok {
+			return ctx, status.Error(codes.Unauthenticated, lib.ErrInvalidAPIKey.Error())
+		}
+		return lib.WithActor(ctx, actor), nil
+	}
+}
+
+// Context sets the values that the HTTP middleware sets for requests, such as
+// the database and the drainer.
+func Context(with func(ctx context.Context) context.Context) Middleware {
+	return func(ctx context.Context, method string) (context.Context, error) {
+		return with(ctx), nil
+	}
+}
+
+// firstMetadata returns the first value of the incoming metadata with the
+// given key, or an empty string.
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerName returns the common name of the verified client certificate of the
+// call, or an empty string if the client did not present one.
+func peerName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+	chains := info.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	return chains[0][0].Subject.CommonName
+}
@@ -0,0 +1,382 @@
+// Package rpc serves the driver API over gRPC with the same usecases as the
+// REST controllers.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/labconpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// pollInterval is how often streams read the driver again if the server has no
+// notifier.
+const pollInterval = time.Second
+
+var (
+	errMissingName   = status.Error(codes.InvalidArgument, "missing driver name")
+	errMissingToken  = status.Error(codes.Unauthenticated, "missing x-driver-token metadata")
+	errInvalidStatus = status.Error(codes.InvalidArgument, "invalid driver status")
+)
+
+type Server struct {
+	labconpb.UnimplementedDriverServiceServer
+
+	inject injectors.DriverInjector
+}
+
+func NewServer(inject injectors.DriverInjector) *Server {
+	return &Server{inject: inject}
+}
+
+func (server *Server) List(ctx context.Context, req *labconpb.ListRequest) (*labconpb.ListResponse, error) {
+	usecase := server.inject(ctx)
+
+	names, err := usecase.List()
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to list drivers")
+	}
+	return &labconpb.ListResponse{Names: names}, nil
+}
+
+func (server *Server) Register(ctx context.Context, req *labconpb.RegisterRequest) (*labconpb.RegisterResponse, error) {
+	usecase := server.inject(ctx)
+
+	if lib.UseDrainer(ctx).Draining() {
+		return nil, statusError(ctx, lib.ErrDraining, "failed to register driver")
+	}
+
+	params := driver.RegisterParams{
+		Name:  req.Name,
+		State: fromValue(req.State),
+		Info:  driver.Info{Labels: req.Labels, Metadata: fromMetadata(req.Metadata)},
+	}
+	if err := lib.Validate(params); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	token, err := usecase.Register(params)
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to register driver %q", params.Name)
+	}
+	return &labconpb.RegisterResponse{Token: token}, nil
+}
+
+func (server *Server) GetState(ctx context.Context, req *labconpb.GetStateRequest) (*labconpb.GetStateResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	state, err := usecase.GetState(req.Name)
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to get state for driver %q", req.Name)
+	}
+
+	value, err := toValue(state)
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to get state for driver %q", req.Name)
+	}
+	return &labconpb.GetStateResponse{State: value}, nil
+}
+
+func (server *Server) SetState(ctx context.Context, req *labconpb.SetStateRequest) (*labconpb.SetStateResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	if err := authorize(ctx, usecase, req.Name, "set state"); err != nil {
+		return nil, err
+	}
+
+	if err := usecase.SetState(req.Name, fromValue(req.State)); err != nil {
+		return nil, statusError(ctx, err, "failed to set state for driver %q", req.Name)
+	}
+	return &labconpb.SetStateResponse{}, nil
+}
+
+func (server *Server) GetStatus(ctx context.Context, req *labconpb.GetStatusRequest) (*labconpb.GetStatusResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	value, err := usecase.GetStatus(req.Name)
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to get status for driver %q", req.Name)
+	}
+	return &labconpb.GetStatusResponse{Status: toStatus(value)}, nil
+}
+
+func (server *Server) SetStatus(ctx context.Context, req *labconpb.SetStatusRequest) (*labconpb.SetStatusResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	if err := authorize(ctx, usecase, req.Name, "set status"); err != nil {
+		return nil, err
+	}
+
+	value, ok := fromStatus(req.Status)
+	if !ok {
+		return nil, errInvalidStatus
+	}
+
+	if err := usecase.SetStatus(req.Name, value); err != nil {
+		return nil, statusError(ctx, err, "failed to set status for driver %q", req.Name)
+	}
+	return &labconpb.SetStatusResponse{}, nil
+}
+
+func (server *Server) GetOp(ctx context.Context, req *labconpb.GetOpRequest) (*labconpb.GetOpResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	if err := authorize(ctx, usecase, req.Name, "get operation"); err != nil {
+		return nil, err
+	}
+
+	op, err := usecase.GetOp(req.Name)
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to get operation for driver %q", req.Name)
+	}
+
+	pb, err := toOp(op)
+	if err != nil {
+		return nil, statusError(ctx, err, "failed to get operation for driver %q", req.Name)
+	}
+	return &labconpb.GetOpResponse{Op: pb}, nil
+}
+
+func (server *Server) SetOp(ctx context.Context, req *labconpb.SetOpRequest) (*labconpb.SetOpResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	if lib.UseDrainer(ctx).Draining() {
+		return nil, statusError(ctx, lib.ErrDraining, "failed to dispatch for driver %q", req.Name)
+	}
+
+	op := fromOp(req.Op)
+	if err := lib.Validate(op); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := usecase.SetOp(req.Name, op); err != nil {
+		return nil, statusError(ctx, err, "failed to dispatch for driver %q", req.Name)
+	}
+	return &labconpb.SetOpResponse{}, nil
+}
+
+func (server *Server) CancelOp(ctx context.Context, req *labconpb.CancelOpRequest) (*labconpb.CancelOpResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	// Admins may cancel any operation, and others only their own. Calls
+	// without an API key may cancel operations dispatched without one, which
+	// are all operations if no API keys are configured.
+	actor, _ := lib.UseActor(ctx)
+
+	if err := usecase.CancelOp(req.Name, actor.Name, actor.Role == lib.RoleAdmin); err != nil {
+		return nil, statusError(ctx, err, "failed to cancel operation for driver %q", req.Name)
+	}
+	return &labconpb.CancelOpResponse{}, nil
+}
+
+func (server *Server) Delete(ctx context.Context, req *labconpb.DeleteRequest) (*labconpb.DeleteResponse, error) {
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return nil, errMissingName
+	}
+
+	if err := authorize(ctx, usecase, req.Name, "disconnect"); err != nil {
+		return nil, err
+	}
+
+	if err := usecase.Delete(req.Name); err != nil {
+		return nil, statusError(ctx, err, "failed to disconnect driver %q", req.Name)
+	}
+	return &labconpb.DeleteResponse{}, nil
+}
+
+func (server *Server) Watch(req *labconpb.WatchRequest, stream labconpb.DriverService_WatchServer) error {
+	ctx := stream.Context()
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return errMissingName
+	}
+
+	var last *labconpb.Snapshot
+	return follow(ctx, req.Name, func() error {
+		model, err := usecase.Inspect(req.Name)
+		if err != nil {
+			return statusError(ctx, err, "failed to watch driver %q", req.Name)
+		}
+
+		snapshot, err := toSnapshot(model)
+		if err != nil {
+			return statusError(ctx, err, "failed to watch driver %q", req.Name)
+		}
+
+		if proto.Equal(snapshot, last) {
+			return nil
+		}
+		last = snapshot
+		return stream.Send(snapshot)
+	})
+}
+
+func (server *Server) NextOperation(req *labconpb.NextOperationRequest, stream labconpb.DriverService_NextOperationServer) error {
+	ctx := stream.Context()
+	usecase := server.inject(ctx)
+
+	if req.Name == "" {
+		return errMissingName
+	}
+
+	if err := authorize(ctx, usecase, req.Name, "get operation"); err != nil {
+		return err
+	}
+
+	// last is the operation sent last, which is cleared once the driver
+	// completes it. An operation is also sent if it differs from last, in
+	// case its completion and the next dispatch were notified at once.
+	var last *labconpb.Op
+	return follow(ctx, req.Name, func() error {
+		op, err := usecase.GetOp(req.Name)
+		if err != nil {
+			return statusError(ctx, err, "failed to get operation for driver %q", req.Name)
+		}
+
+		if op == nil {
+			last = nil
+			return nil
+		}
+
+		pb, err := toOp(op)
+		if err != nil {
+			return statusError(ctx, err, "failed to get operation for driver %q", req.Name)
+		}
+		if proto.Equal(pb, last) {
+			return nil
+		}
+		if err := stream.Send(pb); err != nil {
+			return err
+		}
+		last = pb
+		return nil
+	})
+}
+
+// follow calls f now and whenever the named driver may have changed, until f
+// fails, the call ends or the server starts draining. f is also called at half
+// the driver lease, so that expired leases are seen and streams polling for
+// operations keep their lease alive.
+func follow(ctx context.Context, name string, f func() error) error {
+	var changed <-chan struct{}
+	var poll <-chan time.Time
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		ch, unsubscribe := notifier.Subscribe(name)
+		defer unsubscribe()
+		changed = ch
+	} else {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	var renew <-chan time.Time
+	if lease := lib.UseDriverLease(ctx); lease > 0 {
+		ticker := time.NewTicker(lease / 2)
+		defer ticker.Stop()
+		renew = ticker.C
+	}
+
+	drainer := lib.UseDrainer(ctx)
+
+	for {
+		if err := f(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-drainer.Done():
+			return status.Error(codes.Unavailable, lib.ErrDraining.Error())
+		case <-changed:
+		case <-poll:
+		case <-renew:
+		}
+	}
+}
+
+// authorize checks that the call is made by the driver with the given name,
+// identified either by its x-driver-token metadata or by a verified client
+// certificate whose common name matches the driver name.
+func authorize(ctx context.Context, usecase usecases.DriverUsecase, name, action string) error {
+	token := firstMetadata(ctx, "x-driver-token")
+	if token == "" {
+		if peerName(ctx) == name {
+			return nil
+		}
+		return errMissingToken
+	}
+
+	if err := usecase.Authorize(name, token); err != nil {
+		return statusError(ctx, err, "failed to authorize driver %q in %s", name, action)
+	}
+	return nil
+}
+
+// statusError converts an error returned by a usecase into a gRPC status. The
+// message is prefixed as in REST error responses. Unexpected errors are logged
+// and reported as INTERNAL without details.
+func statusError(ctx context.Context, err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+
+	var code codes.Code
+	switch {
+	case errors.Is(err, lib.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, lib.ErrAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, lib.ErrBusy), errors.Is(err, lib.ErrBooked):
+		code = codes.FailedPrecondition
+	case errors.Is(err, lib.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, lib.ErrDraining):
+		code = codes.Unavailable
+	default:
+		logger := lib.UseLogger(ctx)
+		logger.Err(err).Msg(msg)
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	return status.Errorf(code, "%s: %v", msg, err)
+}
@@ -0,0 +1,381 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/rpc"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/labconpb"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestClient serves the gRPC API over an in-memory connection and returns
+// a client for it along with the drainer of the server.
+func newTestClient(t *testing.T, db *badger.DB, keys []lib.APIKey, required bool) (labconpb.DriverServiceClient, *lib.Drainer) {
+	t.Helper()
+
+	drainer := lib.NewDrainer()
+	notifier := lib.NewNotifier()
+
+	unary, stream := rpc.Interceptors(
+		rpc.Logger(zerolog.Nop()),
+		rpc.APIKeys(keys, required),
+		rpc.Context(func(ctx context.Context) context.Context {
+			ctx = lib.WithDrainer(ctx, drainer)
+			ctx = lib.WithBadger(ctx, db)
+			ctx = lib.WithDriverTokenGenerator(ctx, func() string { return "token" })
+			ctx = lib.WithNotifier(ctx, notifier)
+			return ctx
+		}),
+	)
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+	labconpb.RegisterDriverServiceServer(server, rpc.NewServer(injectors.Driver))
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return labconpb.NewDriverServiceClient(conn), drainer
+}
+
+func mustValue(t *testing.T, v interface{}) *structpb.Value {
+	t.Helper()
+	value, err := structpb.NewValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-driver-token", token)
+}
+
+func withAPIKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+key)
+}
+
+func expectCode(t *testing.T, call string, err error, code codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != code {
+		t.Errorf("%s returned %v: expected code %v", call, err, code)
+	}
+}
+
+func TestServer(t *testing.T) {
+	keys := []lib.APIKey{
+		{Name: "facility", Key: "facility-key", Role: lib.RoleAdmin},
+		{Name: "alice", Key: "alice-key", Role: lib.RoleUser},
+		{Name: "bob", Key: "bob-key", Role: lib.RoleUser},
+	}
+	client, _ := newTestClient(t, newTestDB(t), keys, false)
+	ctx := context.Background()
+
+	state := mustValue(t, map[string]interface{}{"volume": 1.5})
+	res, err := client.Register(ctx, &labconpb.RegisterRequest{Name: "foo", State: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Token != "token" {
+		t.Errorf("Register returned token %q: expected %q", res.Token, "token")
+	}
+
+	_, err = client.Register(ctx, &labconpb.RegisterRequest{Name: "foo", State: state})
+	expectCode(t, "Register of a duplicate driver", err, codes.AlreadyExists)
+
+	_, err = client.Register(ctx, &labconpb.RegisterRequest{Name: "bar"})
+	expectCode(t, "Register without state", err, codes.InvalidArgument)
+
+	list, err := client.List(ctx, &labconpb.ListRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Names) != 1 || list.Names[0] != "foo" {
+		t.Errorf("List returned %q: expected %q", list.Names, []string{"foo"})
+	}
+
+	_, err = client.SetState(ctx, &labconpb.SetStateRequest{Name: "foo", State: state})
+	expectCode(t, "SetState without token", err, codes.Unauthenticated)
+
+	_, err = client.SetState(withToken(ctx, "wrong"), &labconpb.SetStateRequest{Name: "foo", State: state})
+	expectCode(t, "SetState with a wrong token", err, codes.PermissionDenied)
+
+	state = mustValue(t, map[string]interface{}{"volume": 2.5})
+	if _, err := client.SetState(withToken(ctx, "token"), &labconpb.SetStateRequest{Name: "foo", State: state}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.GetState(ctx, &labconpb.GetStateRequest{Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got.State, state) {
+		t.Errorf("GetState returned %v: expected %v", got.State, state)
+	}
+
+	_, err = client.GetState(ctx, &labconpb.GetStateRequest{Name: "bar"})
+	expectCode(t, "GetState of an unknown driver", err, codes.NotFound)
+
+	op := &labconpb.Op{Name: "aspirate", Arg: mustValue(t, map[string]interface{}{"volume": 10.0})}
+	if _, err := client.SetOp(withAPIKey(ctx, "alice-key"), &labconpb.SetOpRequest{Name: "foo", Op: op}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.SetOp(ctx, &labconpb.SetOpRequest{Name: "foo", Op: op})
+	expectCode(t, "SetOp to a busy driver", err, codes.FailedPrecondition)
+
+	_, err = client.SetOp(ctx, &labconpb.SetOpRequest{Name: "foo", Op: &labconpb.Op{}})
+	expectCode(t, "SetOp without an operation name", err, codes.InvalidArgument)
+
+	status, err := client.GetStatus(ctx, &labconpb.GetStatusRequest{Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != labconpb.Status_STATUS_BUSY {
+		t.Errorf("GetStatus returned %v: expected %v", status.Status, labconpb.Status_STATUS_BUSY)
+	}
+
+	pending, err := client.GetOp(withToken(ctx, "token"), &labconpb.GetOpRequest{Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(pending.Op, op) {
+		t.Errorf("GetOp returned %v: expected %v", pending.Op, op)
+	}
+
+	_, err = client.CancelOp(ctx, &labconpb.CancelOpRequest{Name: "foo"})
+	expectCode(t, "CancelOp without an API key of an operation dispatched with one", err, codes.PermissionDenied)
+
+	_, err = client.CancelOp(withAPIKey(ctx, "bob-key"), &labconpb.CancelOpRequest{Name: "foo"})
+	expectCode(t, "CancelOp of an operation dispatched by another API key", err, codes.PermissionDenied)
+
+	if _, err := client.CancelOp(withAPIKey(ctx, "alice-key"), &labconpb.CancelOpRequest{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.CancelOp(withAPIKey(ctx, "alice-key"), &labconpb.CancelOpRequest{Name: "foo"})
+	expectCode(t, "CancelOp without an operation", err, codes.NotFound)
+
+	if _, err := client.SetOp(withAPIKey(ctx, "bob-key"), &labconpb.SetOpRequest{Name: "foo", Op: op}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CancelOp(withAPIKey(ctx, "facility-key"), &labconpb.CancelOpRequest{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.SetOp(ctx, &labconpb.SetOpRequest{Name: "foo", Op: op}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CancelOp(ctx, &labconpb.CancelOpRequest{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.SetStatus(withToken(ctx, "token"), &labconpb.SetStatusRequest{Name: "foo"})
+	expectCode(t, "SetStatus without a status", err, codes.InvalidArgument)
+
+	if _, err := client.SetStatus(withToken(ctx, "token"), &labconpb.SetStatusRequest{Name: "foo", Status: labconpb.Status_STATUS_ERROR}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Delete(withToken(ctx, "token"), &labconpb.DeleteRequest{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetStatus(ctx, &labconpb.GetStatusRequest{Name: "foo"})
+	expectCode(t, "GetStatus of a deleted driver", err, codes.NotFound)
+}
+
+func TestServerRegisterInfo(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestClient(t, db, nil, false)
+	ctx := context.Background()
+
+	state := mustValue(t, map[string]interface{}{"volume": 1.5})
+	if _, err := client.Register(ctx, &labconpb.RegisterRequest{
+		Name:     "foo",
+		State:    state,
+		Labels:   map[string]string{"room": "302"},
+		Metadata: &labconpb.Metadata{Model: "Infinite 200", Serial: "1510003123"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := repositories.NewDriverRepository(db).Fetch("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := driver.Info{
+		Labels:   map[string]string{"room": "302"},
+		Metadata: driver.Metadata{Model: "Infinite 200", Serial: "1510003123"},
+	}
+	if !reflect.DeepEqual(model.Info(), expected) {
+		t.Errorf("driver has info %+v: expected %+v", model.Info(), expected)
+	}
+
+	_, err = client.Register(ctx, &labconpb.RegisterRequest{Name: "bar", State: state, Labels: map[string]string{"room": "3 02"}})
+	expectCode(t, "Register with an invalid label", err, codes.InvalidArgument)
+}
+
+func TestServerCancelOpWithoutAPIKeys(t *testing.T) {
+	client, _ := newTestClient(t, newTestDB(t), nil, false)
+	ctx := context.Background()
+
+	state := mustValue(t, map[string]interface{}{"volume": 1.5})
+	if _, err := client.Register(ctx, &labconpb.RegisterRequest{Name: "foo", State: state}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SetOp(ctx, &labconpb.SetOpRequest{Name: "foo", Op: &labconpb.Op{Name: "aspirate"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.CancelOp(ctx, &labconpb.CancelOpRequest{Name: "foo"}); err != nil {
+		t.Errorf("CancelOp returned %v: expected no error", err)
+	}
+
+	_, err := client.CancelOp(ctx, &labconpb.CancelOpRequest{Name: "foo"})
+	expectCode(t, "CancelOp without an operation", err, codes.NotFound)
+}
+
+func TestServerAPIKeys(t *testing.T) {
+	client, _ := newTestClient(t, newTestDB(t), []lib.APIKey{{Name: "alice", Key: "alice-key", Role: lib.RoleAdmin}}, true)
+	ctx := context.Background()
+
+	_, err := client.List(ctx, &labconpb.ListRequest{})
+	expectCode(t, "List without an API key", err, codes.Unauthenticated)
+
+	_, err = client.List(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer bob-key"), &labconpb.ListRequest{})
+	expectCode(t, "List with an unknown API key", err, codes.Unauthenticated)
+
+	if _, err := client.List(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice-key"), &labconpb.ListRequest{}); err != nil {
+		t.Errorf("List with a valid API key returned %v", err)
+	}
+}
+
+func TestServerWatch(t *testing.T) {
+	client, drainer := newTestClient(t, newTestDB(t), nil, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state := mustValue(t, "foo")
+	if _, err := client.Register(ctx, &labconpb.RegisterRequest{Name: "foo", State: state}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.Watch(ctx, &labconpb.WatchRequest{Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(want *labconpb.Snapshot) {
+		t.Helper()
+		got, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(got, want) {
+			t.Errorf("Watch sent %v: expected %v", got, want)
+		}
+	}
+
+	expect(&labconpb.Snapshot{Name: "foo", State: state, Status: labconpb.Status_STATUS_IDLE})
+
+	op := &labconpb.Op{Name: "op", Arg: mustValue(t, nil)}
+	if _, err := client.SetOp(ctx, &labconpb.SetOpRequest{Name: "foo", Op: op}); err != nil {
+		t.Fatal(err)
+	}
+	expect(&labconpb.Snapshot{Name: "foo", State: state, Status: labconpb.Status_STATUS_BUSY, Op: op})
+
+	state = mustValue(t, "bar")
+	if _, err := client.SetState(withToken(ctx, "token"), &labconpb.SetStateRequest{Name: "foo", State: state}); err != nil {
+		t.Fatal(err)
+	}
+	expect(&labconpb.Snapshot{Name: "foo", State: state, Status: labconpb.Status_STATUS_BUSY, Op: op})
+
+	drainer.Drain()
+	_, err = stream.Recv()
+	expectCode(t, "Watch after draining", err, codes.Unavailable)
+}
+
+func TestServerNextOperation(t *testing.T) {
+	client, _ := newTestClient(t, newTestDB(t), nil, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Register(ctx, &labconpb.RegisterRequest{Name: "foo", State: mustValue(t, "foo")}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.NextOperation(ctx, &labconpb.NextOperationRequest{Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectCode(t, "NextOperation without token", err, codes.Unauthenticated)
+
+	stream, err = client.NextOperation(withToken(ctx, "token"), &labconpb.NextOperationRequest{Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		op := &labconpb.Op{Name: name, Arg: mustValue(t, name)}
+		if _, err := client.SetOp(ctx, &labconpb.SetOpRequest{Name: "foo", Op: op}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(got, op) {
+			t.Errorf("NextOperation sent %v: expected %v", got, op)
+		}
+
+		if _, err := client.SetStatus(withToken(ctx, "token"), &labconpb.SetStatusRequest{Name: "foo", Status: labconpb.Status_STATUS_IDLE}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := client.Delete(withToken(ctx, "token"), &labconpb.DeleteRequest{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectCode(t, "NextOperation after deletion", err, codes.NotFound)
+}
@@ -0,0 +1,214 @@
+// Package scheduler fires schedules, dispatching their operations to drivers
+// when they are due. Schedules are stored with the time they fire next, so
+// the scheduler carries on with them after a restart.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+)
+
+const (
+	// DefaultInterval is how often schedules are checked if nothing wakes
+	// the scheduler earlier.
+	DefaultInterval = time.Minute
+
+	// DefaultGrace is how late a firing may be before it is skipped as
+	// missed, e.g. because the server was not running when it was due.
+	DefaultGrace = time.Minute
+)
+
+// errNotDue leaves a schedule as it is without storing it again.
+var errNotDue = errors.New("schedule is not due")
+
+type Scheduler struct {
+	inject    injectors.DriverInjector
+	schedules repositories.ScheduleRepository
+	now       func() time.Time
+	interval  time.Duration
+	grace     time.Duration
+}
+
+// SchedulerOption configures a Scheduler.
+type SchedulerOption func(scheduler *Scheduler)
+
+// WithClock sets the function giving the current time.
+func WithClock(now func() time.Time) SchedulerOption {
+	return func(scheduler *Scheduler) {
+		scheduler.now = now
+	}
+}
+
+// WithInterval sets how often schedules are checked if nothing wakes the
+// scheduler earlier.
+func WithInterval(interval time.Duration) SchedulerOption {
+	return func(scheduler *Scheduler) {
+		scheduler.interval = interval
+	}
+}
+
+// WithGrace sets how late a firing may be before it is skipped as missed.
+func WithGrace(grace time.Duration) SchedulerOption {
+	return func(scheduler *Scheduler) {
+		scheduler.grace = grace
+	}
+}
+
+func NewScheduler(inject injectors.DriverInjector, schedules repositories.ScheduleRepository, opts ...SchedulerOption) *Scheduler {
+	scheduler := &Scheduler{
+		inject:    inject,
+		schedules: schedules,
+		now:       time.Now,
+		interval:  DefaultInterval,
+		grace:     DefaultGrace,
+	}
+	for _, opt := range opts {
+		opt(scheduler)
+	}
+	return scheduler
+}
+
+// Run fires the schedules as they become due until the context is done. It
+// wakes whenever the notifier of the context reports a change to a schedule,
+// when the next schedule is due, and at the interval of the scheduler.
+func (scheduler *Scheduler) Run(ctx context.Context) error {
+	logger := lib.UseLogger(ctx)
+
+	var wake <-chan struct{}
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		ch, unsubscribe := notifier.SubscribePrefix("schedule/")
+		defer unsubscribe()
+		wake = ch
+	}
+
+	ticker := time.NewTicker(scheduler.interval)
+	defer ticker.Stop()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		next, err := scheduler.Fire(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Err(err).Msg("failed to fire schedules")
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var deadline <-chan time.Time
+		if !next.IsZero() {
+			timer.Reset(next.Sub(scheduler.now()))
+			deadline = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-deadline:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Fire fires every schedule that is due, and returns the earliest time at
+// which a schedule is due next, or the zero time if there is none. Nothing
+// fires while the server drains.
+func (scheduler *Scheduler) Fire(ctx context.Context) (time.Time, error) {
+	if lib.UseDrainer(ctx).Draining() {
+		return time.Time{}, nil
+	}
+
+	schedules, err := scheduler.schedules.List()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	var errs []error
+	for _, schedule := range schedules {
+		schedule, err := scheduler.fire(ctx, schedule.Name)
+		if err != nil {
+			// Schedules deleted in the meantime are no longer due.
+			if !errors.Is(err, lib.ErrNotFound) {
+				errs = append(errs, fmt.Errorf("schedule %q: %w", schedule.Name, err))
+			}
+			continue
+		}
+		if !schedule.Disabled && schedule.Next != nil && (next.IsZero() || schedule.Next.Before(next)) {
+			next = *schedule.Next
+		}
+	}
+	if len(errs) > 0 {
+		return next, errs[0]
+	}
+	return next, nil
+}
+
+// fire fires the schedule if it is due. The schedule moves on to its next
+// time before the operation is dispatched, so that a schedule fires at most
+// once for each time it is due, and the firing is recorded once the dispatch
+// has been attempted. The operation is dispatched on behalf of the owner of
+// the schedule.
+func (scheduler *Scheduler) fire(ctx context.Context, name string) (models.Schedule, error) {
+	var due, now time.Time
+	schedule, err := scheduler.schedules.Update(name, func(schedule *models.Schedule) error {
+		now = scheduler.now()
+		if schedule.Disabled || schedule.Next == nil || schedule.Next.After(now) {
+			return errNotDue
+		}
+		due = *schedule.Next
+		schedule.Next = schedule.NextAfter(now)
+		return nil
+	})
+	if errors.Is(err, errNotDue) {
+		return schedule, nil
+	}
+	if err != nil {
+		return schedule, err
+	}
+
+	firing := models.Firing{Due: due, Time: now, Result: models.FiringDispatched}
+	if late := now.Sub(due); late > scheduler.grace {
+		firing.Result = models.FiringSkipped
+		firing.Reason = fmt.Sprintf("missed by %s", late.Truncate(time.Second))
+	} else {
+		ctx = lib.WithOrigin(ctx, "schedule/"+name)
+		if schedule.Owner != "" {
+			// Only the name of the key is needed to dispatch on its behalf.
+			ctx = lib.WithActor(ctx, lib.Actor{Name: schedule.Owner})
+		}
+		dispatch(scheduler.inject(ctx), schedule, &firing)
+	}
+
+	return scheduler.schedules.Update(name, func(schedule *models.Schedule) error {
+		schedule.Record(firing)
+		return nil
+	})
+}
+
+// dispatch dispatches the operation of the schedule and sets the result of
+// the firing. Drivers that are missing, not ready for an operation or booked
+// are skipped.
+func dispatch(drivers usecases.DriverUsecase, schedule models.Schedule, firing *models.Firing) {
+	switch err := drivers.SetOp(schedule.Driver, schedule.Op); {
+	case err == nil:
+	case errors.Is(err, lib.ErrNotFound), errors.Is(err, lib.ErrBusy), errors.Is(err, lib.ErrBooked):
+		firing.Result = models.FiringSkipped
+		firing.Reason = fmt.Sprintf("driver %q: %v", schedule.Driver, err)
+	default:
+		firing.Result = models.FiringFailed
+		firing.Reason = fmt.Sprintf("driver %q: %v", schedule.Driver, err)
+	}
+}
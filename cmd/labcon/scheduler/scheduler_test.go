@@ -0,0 +1,212 @@
+package scheduler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/scheduler"
+	"github.com/ktnyt/labcon/driver"
+)
+
+type testEnv struct {
+	t         *testing.T
+	ctx       context.Context
+	now       time.Time
+	scheduler *scheduler.Scheduler
+	drivers   usecases.DriverUsecase
+	usecase   usecases.ScheduleUsecase
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	env := &testEnv{t: t, now: time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)}
+	env.ctx = lib.WithBadger(context.Background(), db)
+	env.ctx = lib.WithDriverTokenGenerator(env.ctx, lib.DefaultTokenGenerator)
+	env.ctx = lib.WithTime(env.ctx, env.now)
+
+	clock := func() time.Time { return env.now }
+	env.scheduler = scheduler.NewScheduler(injectors.Driver, repositories.NewScheduleRepository(db), scheduler.WithClock(clock))
+	env.drivers = injectors.Driver(env.ctx)
+	env.usecase = usecases.NewScheduleUsecase(repositories.NewScheduleRepository(db), usecases.WithScheduleClock(clock))
+
+	for _, name := range []string{"reader", "washer"} {
+		if _, err := env.drivers.Register(driver.RegisterParams{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env
+}
+
+func (env *testEnv) put(schedule models.Schedule) {
+	env.t.Helper()
+	if err := schedule.Validate(); err != nil {
+		env.t.Fatal(err)
+	}
+	if _, err := env.usecase.Put(schedule); err != nil {
+		env.t.Fatal(err)
+	}
+}
+
+// fire fires the schedules and checks the next time a schedule is due.
+func (env *testEnv) fire(next time.Time) {
+	env.t.Helper()
+	out, err := env.scheduler.Fire(env.ctx)
+	if err != nil {
+		env.t.Fatalf("scheduler.Fire(ctx): %v", err)
+	}
+	if !out.Equal(next) {
+		env.t.Fatalf("scheduler.Fire(ctx) = %v, expected %v", out, next)
+	}
+}
+
+// firings checks the results of the firings of a schedule.
+func (env *testEnv) firings(name string, results ...models.FiringResult) []models.Firing {
+	env.t.Helper()
+	schedule, err := env.usecase.Get(name)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	if len(schedule.Firings) != len(results) {
+		env.t.Fatalf("schedule %q fired %d times, expected %d", name, len(schedule.Firings), len(results))
+	}
+	for i, firing := range schedule.Firings {
+		if firing.Result != results[i] {
+			env.t.Errorf("firing %d of schedule %q is %s (%s), expected %s", i, name, firing.Result, firing.Reason, results[i])
+		}
+	}
+	return schedule.Firings
+}
+
+func TestScheduler(t *testing.T) {
+	env := newTestEnv(t)
+	env.put(models.Schedule{
+		Name:   "overnight",
+		Driver: "reader",
+		Op:     driver.Op{Name: "read_od"},
+		Every:  models.Duration(10 * time.Minute),
+	})
+	env.put(models.Schedule{
+		Name:     "flush",
+		Driver:   "washer",
+		Op:       driver.Op{Name: "flush"},
+		Cron:     "0 7 * * *",
+		Timezone: "UTC",
+	})
+
+	next := env.now.Add(10 * time.Minute)
+	env.fire(next)
+	env.firings("overnight")
+
+	env.now = next
+	next = env.now.Add(10 * time.Minute)
+	env.fire(next)
+	env.firings("overnight", models.FiringDispatched)
+	if op, _ := env.drivers.GetOp("reader"); op == nil || op.Name != "read_od" {
+		t.Fatalf("reader has operation %v, expected %q", op, "read_od")
+	}
+
+	// The reader is still busy with the last operation.
+	env.now = next
+	next = env.now.Add(10 * time.Minute)
+	env.fire(next)
+	firings := env.firings("overnight", models.FiringDispatched, models.FiringSkipped)
+	if !strings.Contains(firings[1].Reason, "busy") {
+		t.Errorf("firing skipped for %q, expected the reader to be busy", firings[1].Reason)
+	}
+	if err := env.drivers.SetStatus("reader", driver.Idle); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server was down overnight.
+	env.now = time.Date(2022, 4, 2, 7, 0, 30, 0, time.UTC)
+	env.fire(env.now.Add(10 * time.Minute))
+	firings = env.firings("overnight", models.FiringDispatched, models.FiringSkipped, models.FiringSkipped)
+	if !strings.Contains(firings[2].Reason, "missed") {
+		t.Errorf("firing skipped for %q, expected it to be missed", firings[2].Reason)
+	}
+	firings = env.firings("flush", models.FiringDispatched)
+	if due := time.Date(2022, 4, 2, 7, 0, 0, 0, time.UTC); !firings[0].Due.Equal(due) {
+		t.Errorf("flush was due at %v, expected %v", firings[0].Due, due)
+	}
+
+	// Disabled schedules do not fire, and keep their firings.
+	env.put(models.Schedule{
+		Name:     "flush",
+		Driver:   "washer",
+		Op:       driver.Op{Name: "flush"},
+		Cron:     "0 7 * * *",
+		Timezone: "UTC",
+		Disabled: true,
+	})
+	env.now = time.Date(2022, 4, 3, 7, 0, 0, 0, time.UTC)
+	env.fire(env.now.Add(10 * time.Minute))
+	env.firings("flush", models.FiringDispatched)
+}
+
+func TestSchedulerMissingDriver(t *testing.T) {
+	env := newTestEnv(t)
+	env.put(models.Schedule{
+		Name:   "shake",
+		Driver: "shaker",
+		Op:     driver.Op{Name: "shake"},
+		Every:  models.Duration(time.Hour),
+	})
+
+	env.now = env.now.Add(time.Hour)
+	env.fire(env.now.Add(time.Hour))
+	env.firings("shake", models.FiringSkipped)
+
+	// Nothing fires while the server drains.
+	drainer := lib.NewDrainer()
+	drainer.Drain()
+	env.ctx = lib.WithDrainer(env.ctx, drainer)
+	env.now = env.now.Add(time.Hour)
+	env.fire(time.Time{})
+	env.firings("shake", models.FiringSkipped)
+}
+
+func TestSchedulerOwner(t *testing.T) {
+	env := newTestEnv(t)
+	env.usecase = usecases.NewScheduleUsecase(
+		repositories.NewScheduleRepository(lib.UseBadger(env.ctx)),
+		usecases.WithScheduleClock(func() time.Time { return env.now }),
+		usecases.WithScheduleOwner("alice"),
+	)
+	env.put(models.Schedule{
+		Name:   "overnight",
+		Driver: "reader",
+		Op:     driver.Op{Name: "read_od"},
+		Every:  models.Duration(10 * time.Minute),
+	})
+	if schedule, _ := env.usecase.Get("overnight"); schedule.Owner != "alice" {
+		t.Errorf("schedule owned by %q, expected %q", schedule.Owner, "alice")
+	}
+
+	// Operations are dispatched on behalf of the owner of the schedule.
+	env.now = env.now.Add(10 * time.Minute)
+	env.fire(env.now.Add(10 * time.Minute))
+	env.firings("overnight", models.FiringDispatched)
+	model, err := env.drivers.Inspect("reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Dispatcher != "alice" || model.Origin != "schedule/overnight" {
+		t.Errorf("reader has an operation dispatched by %q from %q, expected %q from %q", model.Dispatcher, model.Origin, "alice", "schedule/overnight")
+	}
+}
@@ -0,0 +1,414 @@
+// Package workflow advances the runs of workflows. Runs are stored with their
+// progress, so the engine carries on with them after a restart.
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/expr"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+)
+
+// DefaultInterval is how often runs are checked if nothing wakes the engine
+// earlier.
+const DefaultInterval = 5 * time.Second
+
+// errUnchanged leaves a run as it is without storing it again.
+var errUnchanged = errors.New("run unchanged")
+
+type Engine struct {
+	inject   injectors.DriverInjector
+	runs     repositories.RunRepository
+	now      func() time.Time
+	interval time.Duration
+}
+
+// EngineOption configures an Engine.
+type EngineOption func(engine *Engine)
+
+// WithClock sets the function giving the current time.
+func WithClock(now func() time.Time) EngineOption {
+	return func(engine *Engine) {
+		engine.now = now
+	}
+}
+
+// WithInterval sets how often runs are checked if nothing wakes the engine
+// earlier.
+func WithInterval(interval time.Duration) EngineOption {
+	return func(engine *Engine) {
+		engine.interval = interval
+	}
+}
+
+func NewEngine(inject injectors.DriverInjector, runs repositories.RunRepository, opts ...EngineOption) *Engine {
+	engine := &Engine{
+		inject:   inject,
+		runs:     runs,
+		now:      time.Now,
+		interval: DefaultInterval,
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	return engine
+}
+
+// Run advances the running runs until the context is done. It wakes whenever
+// the notifier of the context reports a change to a driver or a run, when a
+// delay or wait times out, and at the interval of the engine. Only the runs
+// that were running when it last woke are advanced on changes to drivers, and
+// every run is read again on changes to runs and at the interval.
+func (engine *Engine) Run(ctx context.Context) error {
+	logger := lib.UseLogger(ctx)
+
+	var runsChanged, changed <-chan struct{}
+	if notifier := lib.UseNotifier(ctx); notifier != nil {
+		ch, unsubscribe := notifier.SubscribePrefix("run/")
+		defer unsubscribe()
+		runsChanged = ch
+
+		ch, unsubscribe = notifier.SubscribeAll()
+		defer unsubscribe()
+		changed = ch
+	}
+
+	ticker := time.NewTicker(engine.interval)
+	defer ticker.Stop()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var active []string
+	all := true
+	for {
+		var next time.Time
+		var err error
+		if all {
+			active, next, err = engine.advanceAll(ctx)
+		} else {
+			active, next, err = engine.advanceActive(ctx, active)
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Err(err).Msg("failed to advance workflow runs")
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var deadline <-chan time.Time
+		if !next.IsZero() {
+			timer.Reset(next.Sub(engine.now()))
+			deadline = timer.C
+		}
+
+		all = true
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-runsChanged:
+		case <-changed:
+			all = false
+		case <-deadline:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Advance takes every running run as far as it can go, and returns the
+// earliest time at which a delay or wait of a run times out, or the zero time
+// if there is none.
+func (engine *Engine) Advance(ctx context.Context) (time.Time, error) {
+	_, next, err := engine.advanceAll(ctx)
+	return next, err
+}
+
+// advanceAll is like Advance, and also returns the IDs of the runs that are
+// still running.
+func (engine *Engine) advanceAll(ctx context.Context) ([]string, time.Time, error) {
+	runs, err := engine.runs.List()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return engine.advanceRuns(ctx, runs, nil)
+}
+
+// advanceActive is like advanceAll for the runs with the given IDs. Runs that
+// are gone are skipped.
+func (engine *Engine) advanceActive(ctx context.Context, ids []string) ([]string, time.Time, error) {
+	runs := make([]models.RunModel, 0, len(ids))
+	var errs []error
+	for _, id := range ids {
+		run, err := engine.runs.Fetch(id)
+		if errors.Is(err, lib.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %s: %w", id, err))
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return engine.advanceRuns(ctx, runs, errs)
+}
+
+func (engine *Engine) advanceRuns(ctx context.Context, runs []models.RunModel, errs []error) ([]string, time.Time, error) {
+	draining := lib.UseDrainer(ctx).Draining()
+
+	var active []string
+	var next time.Time
+	for _, run := range runs {
+		if run.Status != models.RunRunning {
+			continue
+		}
+		run, err := engine.advance(ctx, draining, run)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %s: %w", run.ID, err))
+		}
+		if run.Status != models.RunRunning {
+			continue
+		}
+		active = append(active, run.ID)
+		if err == nil && run.Deadline != nil {
+			if next.IsZero() || run.Deadline.Before(next) {
+				next = *run.Deadline
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return active, next, errs[0]
+	}
+	return active, next, nil
+}
+
+// advance executes the instructions of a run until it has to wait. The
+// operations of the run are dispatched on behalf of its owner.
+func (engine *Engine) advance(ctx context.Context, draining bool, run models.RunModel) (models.RunModel, error) {
+	id := run.ID
+	ctx = lib.WithOrigin(ctx, "run/"+id)
+	if run.Owner != "" {
+		// Only the name of the key is needed to dispatch on its behalf.
+		ctx = lib.WithActor(ctx, lib.Actor{Name: run.Owner})
+	}
+	drivers := engine.inject(ctx)
+	for {
+		run, err := engine.runs.Update(id, func(run *models.RunModel) error {
+			if run.Status != models.RunRunning {
+				return errUnchanged
+			}
+			now := engine.now()
+			moved, err := engine.exec(run, drivers, draining, now)
+			if err != nil {
+				return err
+			}
+			if !moved {
+				return errUnchanged
+			}
+			run.Updated = now
+			return nil
+		})
+		if err != nil && !errors.Is(err, errUnchanged) {
+			return run, err
+		}
+		// No operations are dispatched while the server is shutting down, so
+		// that the run picks up where it left off after a restart.
+		if run.Status == models.RunRunning && run.Dispatching && !draining {
+			moved, err := engine.dispatch(drivers, run)
+			if err != nil || !moved {
+				return run, err
+			}
+			continue
+		}
+		if err != nil {
+			return run, nil
+		}
+	}
+}
+
+// dispatch dispatches the operation of a run marked as dispatching, and then
+// records the outcome in the run. It reports whether the run changed. The
+// operation is cancelled if the run was aborted in the meantime.
+func (engine *Engine) dispatch(drivers usecases.DriverUsecase, run models.RunModel) (bool, error) {
+	ins, _ := run.Current()
+	step := ins.Step.Dispatch
+	origin := "run/" + run.ID
+
+	var failure error
+	err := drivers.SetOp(step.Driver, step.Op)
+	switch {
+	case errors.Is(err, lib.ErrNotFound):
+		failure = fmt.Errorf("driver %q: %w", step.Driver, err)
+	case errors.Is(err, lib.ErrBusy), errors.Is(err, lib.ErrBooked):
+		// The operation may have been dispatched before the server stopped.
+		// Drivers booked by others are waited for like busy drivers.
+		model, err := drivers.Inspect(step.Driver)
+		if err != nil || model.Op == nil || model.Origin != origin {
+			return false, nil
+		}
+	case err != nil:
+		return false, err
+	}
+
+	pc := run.PC
+	run, err = engine.runs.Update(run.ID, func(run *models.RunModel) error {
+		if run.PC != pc || !run.Dispatching {
+			return errUnchanged
+		}
+		now := engine.now()
+		if failure != nil {
+			// Paused runs fail once they resume.
+			if run.Status != models.RunRunning {
+				return errUnchanged
+			}
+			fail(run, failure, now)
+		}
+		run.Dispatching = false
+		run.Dispatched = failure == nil
+		run.Updated = now
+		return nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if run.Status == models.RunAborted && failure == nil {
+		model, err := drivers.Inspect(step.Driver)
+		if err != nil || model.Op == nil || model.Origin != origin {
+			return false, nil
+		}
+		if err := drivers.CancelOp(step.Driver, run.Owner, false); err != nil && !errors.Is(err, lib.ErrNotFound) {
+			return false, fmt.Errorf("failed to cancel operation %q of driver %q: %w", step.Op.Name, step.Driver, err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// exec executes the current instruction of a run, and reports whether the run
+// changed. Errors are only returned if the run could not be checked, and the
+// run is checked again later. The run fails if a step does.
+func (engine *Engine) exec(run *models.RunModel, drivers usecases.DriverUsecase, draining bool, now time.Time) (bool, error) {
+	ins, ok := run.Current()
+	if !ok {
+		run.Status = models.RunCompleted
+		run.Finished = &now
+		return true, nil
+	}
+
+	switch step := ins.Step; {
+	case step.Dispatch != nil:
+		return dispatchStep(run, drivers, draining, step.Dispatch, now)
+
+	case step.Wait != nil:
+		if run.Deadline == nil && step.Wait.Timeout > 0 {
+			deadline := now.Add(time.Duration(step.Wait.Timeout))
+			run.Deadline = &deadline
+			return true, nil
+		}
+		e, err := expr.Parse(step.Wait.Until)
+		if err != nil {
+			fail(run, err, now)
+			return true, nil
+		}
+		state, err := drivers.GetState(step.Wait.Driver)
+		if err != nil && !errors.Is(err, lib.ErrNotFound) {
+			return false, err
+		}
+		if err == nil && e.Eval(state) {
+			next(run)
+			return true, nil
+		}
+		if run.Deadline != nil && !now.Before(*run.Deadline) {
+			fail(run, fmt.Errorf("timed out waiting for driver %q until %s", step.Wait.Driver, e), now)
+			return true, nil
+		}
+		return false, nil
+
+	case step.Delay != nil:
+		if run.Deadline == nil {
+			deadline := now.Add(time.Duration(*step.Delay))
+			run.Deadline = &deadline
+			return true, nil
+		}
+		if now.Before(*run.Deadline) {
+			return false, nil
+		}
+		next(run)
+		return true, nil
+
+	default:
+		if run.Counters == nil {
+			run.Counters = make(map[int]int)
+		}
+		run.Counters[run.PC]++
+		if run.Counters[run.PC] < step.Loop.Count {
+			run.PC = ins.Back
+			return true, nil
+		}
+		delete(run.Counters, run.PC)
+		next(run)
+		return true, nil
+	}
+}
+
+// dispatchStep marks the run as dispatching the operation of a step, which
+// the engine then dispatches once the driver takes it, and waits for the
+// driver to complete it.
+func dispatchStep(run *models.RunModel, drivers usecases.DriverUsecase, draining bool, step *models.DispatchStep, now time.Time) (bool, error) {
+	if !run.Dispatched {
+		if run.Dispatching || draining {
+			return false, nil
+		}
+		run.Dispatching = true
+		return true, nil
+	}
+	if step.NoWait {
+		next(run)
+		return true, nil
+	}
+
+	model, err := drivers.Inspect(step.Driver)
+	if errors.Is(err, lib.ErrNotFound) {
+		fail(run, fmt.Errorf("driver %q disconnected during operation %q", step.Driver, step.Op.Name), now)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case model.Op != nil, model.Status == driver.Busy, model.Status == driver.Lost:
+		return false, nil
+	case model.Status == driver.Error:
+		fail(run, fmt.Errorf("driver %q failed operation %q", step.Driver, step.Op.Name), now)
+		return true, nil
+	default:
+		next(run)
+		return true, nil
+	}
+}
+
+func next(run *models.RunModel) {
+	run.PC++
+	run.Dispatching = false
+	run.Dispatched = false
+	run.Deadline = nil
+}
+
+func fail(run *models.RunModel, err error, now time.Time) {
+	run.Status = models.RunFailed
+	run.Error = err.Error()
+	run.Finished = &now
+}
@@ -0,0 +1,405 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/goccy/go-yaml"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/app/models"
+	"github.com/ktnyt/labcon/cmd/labcon/app/repositories"
+	"github.com/ktnyt/labcon/cmd/labcon/app/usecases"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labcon/workflow"
+	"github.com/ktnyt/labcon/driver"
+)
+
+const testWorkflow = `
+steps:
+  - name: read plate
+    dispatch: {driver: reader, op: {name: read}}
+  - loop:
+      count: 2
+      steps:
+        - wait: {driver: incubator, until: "$.temperature >= 37", timeout: 1m}
+        - delay: 10m
+  - dispatch: {driver: arm, op: {name: move, arg: {to: incubator}}, no_wait: true}
+`
+
+type testEnv struct {
+	t        *testing.T
+	ctx      context.Context
+	now      time.Time
+	engine   *workflow.Engine
+	db       *badger.DB
+	runs     repositories.RunRepository
+	drivers  usecases.DriverUsecase
+	usecase  usecases.WorkflowUsecase
+	workflow models.Workflow
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	env := &testEnv{t: t, now: time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)}
+	env.ctx = lib.WithBadger(context.Background(), db)
+	env.ctx = lib.WithDriverTokenGenerator(env.ctx, lib.DefaultTokenGenerator)
+	env.ctx = lib.WithTime(env.ctx, env.now)
+
+	clock := func() time.Time { return env.now }
+	env.db = db
+	env.runs = repositories.NewRunRepository(db)
+	env.engine = workflow.NewEngine(injectors.Driver, env.runs, workflow.WithClock(clock))
+	env.drivers = injectors.Driver(env.ctx)
+	env.usecase = usecases.NewWorkflowUsecase(
+		repositories.NewWorkflowRepository(db),
+		repositories.NewRunRepository(db),
+		env.drivers,
+		usecases.WithWorkflowClock(clock),
+	)
+
+	// Workflows are submitted as YAML, which is decoded through JSON.
+	p, err := yaml.YAMLToJSON([]byte(testWorkflow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(p, &env.workflow); err != nil {
+		t.Fatal(err)
+	}
+	env.workflow.Name = "assay"
+	if err := env.workflow.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.usecase.Put(env.workflow); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"reader", "incubator", "arm"} {
+		if _, err := env.drivers.Register(driver.RegisterParams{Name: name, State: map[string]interface{}{"temperature": 25}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env
+}
+
+// advance advances the runs and checks the run and the next deadline.
+func (env *testEnv) advance(id string, status models.RunStatus, pc int, next time.Duration) models.RunModel {
+	env.t.Helper()
+
+	deadline, err := env.engine.Advance(env.ctx)
+	if err != nil {
+		env.t.Fatalf("engine.Advance(ctx): %v", err)
+	}
+	run, err := env.usecase.GetRun(id)
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	if run.Status != status || run.PC != pc {
+		env.t.Fatalf("run is %s at %d (%s), expected %s at %d", run.Status, run.PC, run.Error, status, pc)
+	}
+	if expected := env.now.Add(next); next > 0 && !deadline.Equal(expected) || next == 0 && !deadline.IsZero() {
+		env.t.Fatalf("engine.Advance(ctx) = %v, expected %v", deadline, next)
+	}
+	return run
+}
+
+func (env *testEnv) start() models.RunModel {
+	env.t.Helper()
+	run, err := env.usecase.Start("assay")
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	return run
+}
+
+func TestEngine(t *testing.T) {
+	env := newTestEnv(t)
+	run := env.start()
+
+	env.advance(run.ID, models.RunRunning, 0, 0)
+	if op, _ := env.drivers.GetOp("reader"); op == nil || op.Name != "read" {
+		t.Fatalf("reader has operation %v, expected %q", op, "read")
+	}
+
+	// The run waits for the reader to complete the operation.
+	env.advance(run.ID, models.RunRunning, 0, 0)
+	if err := env.drivers.SetStatus("reader", driver.Idle); err != nil {
+		t.Fatal(err)
+	}
+
+	// The incubator is too cold.
+	env.advance(run.ID, models.RunRunning, 1, time.Minute)
+	env.now = env.now.Add(30 * time.Second)
+	if err := env.drivers.SetState("incubator", map[string]interface{}{"temperature": 37.2}); err != nil {
+		t.Fatal(err)
+	}
+	env.advance(run.ID, models.RunRunning, 2, 10*time.Minute)
+
+	// A paused run keeps the time left in its delay.
+	env.now = env.now.Add(4 * time.Minute)
+	if run, err := env.usecase.Pause(run.ID); err != nil || run.Remaining == nil || *run.Remaining != models.Duration(6*time.Minute) {
+		t.Fatalf("Pause(%q) = (%v, %v), expected 6m remaining", run.ID, run.Remaining, err)
+	}
+	env.now = env.now.Add(time.Hour)
+	env.advance(run.ID, models.RunPaused, 2, 0)
+	if _, err := env.usecase.Resume(run.ID); err != nil {
+		t.Fatal(err)
+	}
+	env.advance(run.ID, models.RunRunning, 2, 6*time.Minute)
+
+	// The second iteration of the loop.
+	env.now = env.now.Add(6 * time.Minute)
+	env.advance(run.ID, models.RunRunning, 2, 10*time.Minute)
+	env.now = env.now.Add(10 * time.Minute)
+	run = env.advance(run.ID, models.RunCompleted, 5, 0)
+	if run.Finished == nil || !run.Finished.Equal(env.now) {
+		t.Errorf("run finished at %v, expected %v", run.Finished, env.now)
+	}
+	if op, _ := env.drivers.GetOp("arm"); op == nil || op.Name != "move" {
+		t.Errorf("arm has operation %v, expected %q", op, "move")
+	}
+
+	if _, err := env.usecase.Abort(run.ID); err == nil {
+		t.Errorf("Abort(%q) of a completed run: nil, expected an error", run.ID)
+	}
+}
+
+func TestEngineFailure(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The reader fails the operation.
+	run := env.start()
+	env.advance(run.ID, models.RunRunning, 0, 0)
+	if err := env.drivers.SetStatus("reader", driver.Error); err != nil {
+		t.Fatal(err)
+	}
+	run = env.advance(run.ID, models.RunFailed, 0, 0)
+	if !strings.Contains(run.Error, "failed operation") {
+		t.Errorf("run failed with %q, expected the reader to have failed", run.Error)
+	}
+
+	// The next run dispatches to the reader in spite of the error, and then
+	// waits for the incubator until it times out.
+	run = env.start()
+	env.advance(run.ID, models.RunRunning, 0, 0)
+	if err := env.drivers.SetStatus("reader", driver.Idle); err != nil {
+		t.Fatal(err)
+	}
+	env.advance(run.ID, models.RunRunning, 1, time.Minute)
+	env.now = env.now.Add(time.Minute)
+	run = env.advance(run.ID, models.RunFailed, 1, 0)
+	if !strings.Contains(run.Error, "timed out") {
+		t.Errorf("run failed with %q, expected a timeout", run.Error)
+	}
+}
+
+func TestEngineAbort(t *testing.T) {
+	env := newTestEnv(t)
+
+	run := env.start()
+	env.advance(run.ID, models.RunRunning, 0, 0)
+
+	run, err := env.usecase.Abort(run.ID)
+	if err != nil || run.Status != models.RunAborted {
+		t.Fatalf("Abort(%q) = (%s, %v), expected %s", run.ID, run.Status, err, models.RunAborted)
+	}
+	if model, _ := env.drivers.Inspect("reader"); model.Op != nil || model.Status != driver.Idle {
+		t.Errorf("reader is %s with operation %v, expected the operation to be cancelled", model.Status, model.Op)
+	}
+
+	// Aborted runs stay put.
+	env.advance(run.ID, models.RunAborted, 0, 0)
+	if _, err := env.usecase.Resume(run.ID); err == nil {
+		t.Errorf("Resume(%q) of an aborted run: nil, expected an error", run.ID)
+	}
+}
+
+func TestEngineOwnership(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The second run waits for the operation of the first instead of
+	// taking it for its own.
+	first, second := env.start(), env.start()
+	env.advance(first.ID, models.RunRunning, 0, 0)
+	if run := env.advance(second.ID, models.RunRunning, 0, 0); run.Dispatched {
+		t.Errorf("run %s took the operation of run %s", second.ID, first.ID)
+	}
+	if model, _ := env.drivers.Inspect("reader"); model.Origin != "run/"+first.ID {
+		t.Errorf("reader has an operation of %q, expected %q", model.Origin, "run/"+first.ID)
+	}
+
+	if err := env.drivers.SetStatus("reader", driver.Idle); err != nil {
+		t.Fatal(err)
+	}
+	env.advance(first.ID, models.RunRunning, 1, time.Minute)
+	if run := env.advance(second.ID, models.RunRunning, 0, time.Minute); !run.Dispatched {
+		t.Errorf("run %s did not dispatch once the reader was idle", second.ID)
+	}
+	if model, _ := env.drivers.Inspect("reader"); model.Origin != "run/"+second.ID {
+		t.Errorf("reader has an operation of %q, expected %q", model.Origin, "run/"+second.ID)
+	}
+}
+
+func TestEngineRecovery(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The server stopped after dispatching the operation of a run but before
+	// recording it.
+	run := env.start()
+	if _, err := env.runs.Update(run.ID, func(run *models.RunModel) error {
+		run.Dispatching = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	drivers := injectors.Driver(lib.WithOrigin(env.ctx, "run/"+run.ID))
+	if err := drivers.SetOp("reader", driver.Op{Name: "read"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if run := env.advance(run.ID, models.RunRunning, 0, 0); !run.Dispatched || run.Dispatching {
+		t.Errorf("run is dispatched %t and dispatching %t, expected the operation to be recorded", run.Dispatched, run.Dispatching)
+	}
+	if err := env.drivers.SetStatus("reader", driver.Idle); err != nil {
+		t.Fatal(err)
+	}
+	env.advance(run.ID, models.RunRunning, 1, time.Minute)
+}
+
+func TestEngineOwner(t *testing.T) {
+	env := newTestEnv(t)
+
+	usecase := usecases.NewWorkflowUsecase(
+		repositories.NewWorkflowRepository(env.db),
+		env.runs,
+		env.drivers,
+		usecases.WithWorkflowClock(func() time.Time { return env.now }),
+		usecases.WithRunOwner("alice"),
+	)
+	run, err := usecase.Start("assay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Owner != "alice" {
+		t.Errorf("run owned by %q, expected %q", run.Owner, "alice")
+	}
+	env.advance(run.ID, models.RunRunning, 0, 0)
+
+	// Operations are dispatched on behalf of the owner of the run.
+	if model, _ := env.drivers.Inspect("reader"); model.Dispatcher != "alice" {
+		t.Errorf("reader has an operation dispatched by %q, expected %q", model.Dispatcher, "alice")
+	}
+	audit := repositories.NewAuditRepository(env.db)
+	actors := []string{}
+	if err := audit.Each(models.AuditQuery{Action: models.AuditDispatch}, func(entry models.AuditEntry) error {
+		actors = append(actors, entry.Actor)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(actors) != 1 || actors[0] != "key:alice" {
+		t.Errorf("dispatches audited as %q, expected %q", actors, "key:alice")
+	}
+}
+
+func TestEngineBooking(t *testing.T) {
+	env := newTestEnv(t)
+
+	bookings := repositories.NewBookingRepository(env.db)
+	if _, err := bookings.Create(models.Booking{
+		Driver: "reader",
+		Holder: "alice",
+		Start:  env.now.Add(-time.Hour),
+		End:    env.now.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := func(owner string) models.RunModel {
+		usecase := usecases.NewWorkflowUsecase(
+			repositories.NewWorkflowRepository(env.db),
+			env.runs,
+			env.drivers,
+			usecases.WithWorkflowClock(func() time.Time { return env.now }),
+			usecases.WithRunOwner(owner),
+		)
+		run, err := usecase.Start("assay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return run
+	}
+
+	// Only the run of the holder of the booking dispatches to the reader.
+	bob, alice := start("bob"), start("alice")
+	if run := env.advance(bob.ID, models.RunRunning, 0, 0); run.Dispatched {
+		t.Errorf("run of %q dispatched to the reader booked by %q", "bob", "alice")
+	}
+	if run := env.advance(alice.ID, models.RunRunning, 0, 0); !run.Dispatched {
+		t.Errorf("run of %q did not dispatch to the reader booked by %q", "alice", "alice")
+	}
+}
+
+func TestEngineRun(t *testing.T) {
+	env := newTestEnv(t)
+
+	ctx, cancel := context.WithCancel(lib.WithNotifier(env.ctx, lib.NewNotifier()))
+	engine := workflow.NewEngine(injectors.Driver, env.runs, workflow.WithClock(func() time.Time { return env.now }), workflow.WithInterval(time.Hour))
+	done := make(chan error, 1)
+	go func() { done <- engine.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("engine.Run(ctx) = %v", err)
+		}
+	}()
+
+	// eventually waits until the run reaches the instruction.
+	eventually := func(id string, pc int) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			run, err := env.runs.Fetch(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.PC == pc && run.Dispatched == (pc == 0) {
+				return
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("run is at %d, expected %d", run.PC, pc)
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	// Runs are advanced when they start, and then as the drivers change.
+	run, err := injectors.Workflow(ctx).Start("assay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(run.ID, 0)
+
+	drivers := injectors.Driver(ctx)
+	if err := drivers.SetStatus("reader", driver.Idle); err != nil {
+		t.Fatal(err)
+	}
+	eventually(run.ID, 1)
+
+	if err := drivers.SetState("incubator", map[string]interface{}{"temperature": 37.2}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(run.ID, 2)
+}
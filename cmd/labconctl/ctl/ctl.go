@@ -0,0 +1,375 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/ktnyt/labcon"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+var (
+	ErrUsage          = errors.New("invalid usage")
+	ErrUnknownCommand = errors.New("unknown command")
+)
+
+// Env is the environment of a command.
+type Env struct {
+	Client *labcon.Client
+	Format Format
+	Stdout io.Writer
+}
+
+// runFunc runs a command with its positional arguments.
+type runFunc func(ctx context.Context, env Env, args []string) error
+
+// command is a subcommand. Its setup function defines the flags of the
+// command and returns the function to run once they are parsed.
+type command struct {
+	name  string
+	args  string
+	nargs int
+	help  string
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+var commands = []command{
+	{"list", "", 0, "list drivers and their status", listCommand},
+	{"get-state", "NAME", 1, "print the state of a driver", getStateCommand},
+	{"get-status", "NAME", 1, "print the status of a driver", getStatusCommand},
+	{"dispatch", "NAME OP [ARG]", 2, "dispatch an operation; ARG is parsed as YAML or JSON", dispatchCommand},
+	{"watch", "NAME", 1, "print the status and state of a driver whenever they change", watchCommand},
+	{"cancel", "NAME", 1, "cancel the operation dispatched to a driver", cancelCommand},
+	{"disconnect", "NAME", 1, "disconnect a driver", disconnectCommand},
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "usage: %s [flags] COMMAND [flags] [args]\n\ncommands:\n", fs.Name())
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-30s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.help)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	fs.PrintDefaults()
+}
+
+// Run runs labconctl with the given command line arguments, excluding the
+// program name.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("labconctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr, fs) }
+
+	server := fs.String("server", getenv("LABCON_SERVER", "http://localhost:5000"), "address of the labcon server ($LABCON_SERVER)")
+	output := fs.String("o", "table", "output format: json, yaml or table")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each request")
+	apiKey := fs.String("api-key", os.Getenv("LABCON_API_KEY"), "API key to authenticate with ($LABCON_API_KEY)")
+	caFile := fs.String("ca", "", "CA certificate to verify the server with")
+	certFile := fs.String("cert", "", "client certificate for mutual TLS")
+	keyFile := fs.String("key", "", "client key for mutual TLS")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := ParseFormat(*output)
+	if err != nil {
+		return err
+	}
+
+	opts := []labcon.ClientOption{
+		labcon.WithTimeout(*timeout),
+		labcon.WithUserAgent("labconctl"),
+	}
+	if *apiKey != "" {
+		opts = append(opts, labcon.WithAPIKey(*apiKey))
+	}
+	if *caFile != "" || *certFile != "" {
+		config, err := tlsConfig(*caFile, *certFile, *keyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, labcon.WithTLSConfig(config))
+	}
+
+	env := Env{
+		Client: labcon.NewClient(*server, opts...),
+		Format: format,
+		Stdout: stdout,
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	name := fs.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		sub := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		sub.SetOutput(stderr)
+		sub.Usage = func() {
+			fmt.Fprintf(stderr, "usage: labconctl %s [flags] %s\n", cmd.name, cmd.args)
+			sub.PrintDefaults()
+		}
+		run := cmd.setup(sub)
+		if err := sub.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+		if sub.NArg() < cmd.nargs {
+			sub.Usage()
+			return ErrUsage
+		}
+		return run(ctx, env, sub.Args())
+	}
+
+	fs.Usage()
+	return fmt.Errorf("%w %q", ErrUnknownCommand, name)
+}
+
+func getenv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func tlsConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		p, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(p) {
+			return nil, fmt.Errorf("no certificates found in %q", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// DriverSummary is a row of the list command.
+type DriverSummary struct {
+	Name   string        `json:"name"`
+	Status driver.Status `json:"status"`
+}
+
+// DriverList is the output of the list command.
+type DriverList []DriverSummary
+
+func (list DriverList) Header() []string {
+	return []string{"NAME", "STATUS"}
+}
+
+func (list DriverList) Rows() [][]string {
+	rows := make([][]string, len(list))
+	for i, summary := range list {
+		rows[i] = []string{summary.Name, string(summary.Status)}
+	}
+	return rows
+}
+
+func listCommand(fs *flag.FlagSet) runFunc {
+	selector := fs.String("l", "", "select drivers by their labels, e.g. room=302,kind!=pipettor")
+	return func(ctx context.Context, env Env, args []string) error {
+		summaries, err := env.Client.SummariesCtx(ctx, *selector)
+		if err != nil {
+			return err
+		}
+		sort.Slice(summaries, func(i, j int) bool {
+			return summaries[i].Name < summaries[j].Name
+		})
+
+		list := make(DriverList, len(summaries))
+		for i, summary := range summaries {
+			list[i] = DriverSummary{Name: summary.Name, Status: summary.Status}
+		}
+
+		return Write(env.Stdout, env.Format, list)
+	}
+}
+
+func getStateCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env Env, args []string) error {
+		state, err := getState(ctx, env.Client, args[0])
+		if err != nil {
+			return err
+		}
+		return Write(env.Stdout, env.Format, state)
+	}
+}
+
+func getStatusCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env Env, args []string) error {
+		status, err := env.Client.GetStatusCtx(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return Write(env.Stdout, env.Format, status)
+	}
+}
+
+// getState gets the state of a driver, keeping integers as integers so that
+// they are not printed as floating point numbers.
+func getState(ctx context.Context, client *labcon.Client, name string) (interface{}, error) {
+	var raw json.RawMessage
+	if err := client.GetStateCtx(ctx, name, &raw); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var state interface{}
+	if err := dec.Decode(&state); err != nil {
+		return nil, err
+	}
+	return normalize(state), nil
+}
+
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalize(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalize(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func dispatchCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env Env, args []string) error {
+		op := driver.Op{Name: args[1]}
+		if len(args) > 2 {
+			if err := yaml.Unmarshal([]byte(args[2]), &op.Arg); err != nil {
+				return fmt.Errorf("failed to parse argument: %w", err)
+			}
+		}
+		return env.Client.DispatchCtx(ctx, args[0], op)
+	}
+}
+
+func cancelCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, env Env, args []string) error {
+		return env.Client.CancelCtx(ctx, args[0])
+	}
+}
+
+// Snapshot is a single read of a driver by the watch command.
+type Snapshot struct {
+	Status driver.Status `json:"status"`
+	State  interface{}   `json:"state"`
+}
+
+func watchCommand(fs *flag.FlagSet) runFunc {
+	interval := fs.Duration("interval", time.Second, "polling interval")
+	diff := fs.Bool("diff", false, "print the difference from the previous read instead of the full snapshot")
+	count := fs.Int("count", 0, "exit after printing this many snapshots, or never if zero")
+
+	return func(ctx context.Context, env Env, args []string) error {
+		name := args[0]
+
+		var prev *Snapshot
+		for printed := 0; *count == 0 || printed < *count; {
+			state, err := getState(ctx, env.Client, name)
+			if err != nil {
+				return ignoreCanceled(ctx, err)
+			}
+			status, err := env.Client.GetStatusCtx(ctx, name)
+			if err != nil {
+				return ignoreCanceled(ctx, err)
+			}
+			curr := Snapshot{Status: status, State: state}
+
+			if prev == nil || !reflect.DeepEqual(*prev, curr) {
+				if err := writeSnapshot(env, prev, curr, *diff); err != nil {
+					return err
+				}
+				prev = &curr
+				printed++
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(*interval):
+			}
+		}
+		return nil
+	}
+}
+
+// ignoreCanceled returns nil if err was caused by the watch being stopped.
+func ignoreCanceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func writeSnapshot(env Env, prev *Snapshot, curr Snapshot, diff bool) error {
+	if !diff || prev == nil {
+		if err := Write(env.Stdout, env.Format, curr); err != nil {
+			return err
+		}
+		if env.Format != JSON {
+			fmt.Fprintln(env.Stdout, "---")
+		}
+		return nil
+	}
+
+	for _, op := range utils.ObjDiff(*prev, curr) {
+		// Skip the empty line after the final newline of both documents.
+		if op == utils.CommonLine("") {
+			continue
+		}
+		fmt.Fprintln(env.Stdout, op)
+	}
+	fmt.Fprintln(env.Stdout, "---")
+	return nil
+}
+
+func disconnectCommand(fs *flag.FlagSet) runFunc {
+	token := fs.String("token", os.Getenv("LABCON_TOKEN"), "token of the driver ($LABCON_TOKEN)")
+
+	return func(ctx context.Context, env Env, args []string) error {
+		return env.Client.DisconnectCtx(ctx, args[0], *token)
+	}
+}
@@ -0,0 +1,246 @@
+package ctl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/go-chi/chi/v5"
+	"github.com/ktnyt/labcon"
+	"github.com/ktnyt/labcon/cmd/labcon/app"
+	"github.com/ktnyt/labcon/cmd/labcon/app/injectors"
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/cmd/labconctl/ctl"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+	"github.com/rs/zerolog"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := chi.NewMux()
+	r.Use(
+		lib.Logger(zerolog.Nop()),
+		lib.Badger(db),
+		lib.DriverTokenGenerator(lib.DefaultTokenGenerator),
+		lib.APIKeys([]lib.APIKey{{Name: "facility", Key: "secret", Role: lib.RoleAdmin}}, false),
+	)
+	app.NewApp(injectors.Driver).Setup(r)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWrite(t *testing.T) {
+	list := ctl.DriverList{
+		{Name: "bar", Status: driver.Busy},
+		{Name: "foo", Status: driver.Idle},
+	}
+
+	cases := []struct {
+		format ctl.Format
+		in     interface{}
+		out    string
+	}{
+		{
+			format: ctl.Table,
+			in:     list,
+			out:    "NAME  STATUS\nbar   busy\nfoo   idle\n",
+		},
+		{
+			format: ctl.JSON,
+			in:     list,
+			out:    "[\n  {\n    \"name\": \"bar\",\n    \"status\": \"busy\"\n  },\n  {\n    \"name\": \"foo\",\n    \"status\": \"idle\"\n  }\n]\n",
+		},
+		{
+			format: ctl.YAML,
+			in:     list,
+			out:    "- name: bar\n  status: busy\n- name: foo\n  status: idle\n",
+		},
+		{
+			format: ctl.Table,
+			in:     map[string]interface{}{"volume": 10, "tip": true, "label": "A1"},
+			out:    "KEY     VALUE\nlabel   A1\ntip     true\nvolume  10\n",
+		},
+		{
+			format: ctl.Table,
+			in:     []int{1, 2},
+			out:    "- 1\n- 2\n",
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			b := &strings.Builder{}
+			if err := ctl.Write(b, tt.format, tt.in); err != nil {
+				t.Fatal(err)
+			}
+			if diff := utils.ObjDiff(b.String(), tt.out); diff != nil {
+				t.Errorf("mismatch in output:\n%s", utils.JoinOps(diff, "\n"))
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := newTestServer(t)
+	client := labcon.NewClient(server.URL)
+
+	if _, err := labcon.NewDriver(client, "foo", map[string]interface{}{"volume": 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RegisterWithInfo("baz", "idle", driver.Info{Labels: map[string]string{"room": "302"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		args []string
+		out  string
+		err  error
+	}{
+		{
+			args: []string{"list"},
+			out:  "NAME  STATUS\nbaz   idle\nfoo   idle\n",
+		},
+		{
+			args: []string{"list", "-l", "room=302"},
+			out:  "NAME  STATUS\nbaz   idle\n",
+		},
+		{
+			args: []string{"-o", "json", "get-state", "foo"},
+			out:  "{\n  \"volume\": 0\n}\n",
+		},
+		{
+			args: []string{"get-status", "foo"},
+			out:  "idle\n",
+		},
+		{
+			args: []string{"dispatch", "foo", "aspirate", "{volume: 10}"},
+			out:  "",
+		},
+		{
+			args: []string{"-o", "yaml", "watch", "-count", "1", "foo"},
+			out:  "status: busy\nstate:\n  volume: 0\n---\n",
+		},
+		{
+			args: []string{"dispatch", "foo", "aspirate"},
+			err:  labcon.ErrBusy,
+		},
+		{
+			args: []string{"cancel", "foo"},
+			out:  "",
+		},
+		{
+			args: []string{"dispatch", "foo", "aspirate"},
+			out:  "",
+		},
+		{
+			args: []string{"-api-key", "secret", "cancel", "foo"},
+			out:  "",
+		},
+		{
+			args: []string{"-api-key", "secret", "cancel", "foo"},
+			err:  labcon.ErrNotFound,
+		},
+		{
+			args: []string{"get-state", "bar"},
+			err:  labcon.ErrNotFound,
+		},
+		{
+			args: []string{"get-state"},
+			err:  ctl.ErrUsage,
+		},
+		{
+			args: []string{"frobnicate"},
+			err:  ctl.ErrUnknownCommand,
+		},
+		{
+			args: []string{"-o", "xml", "list"},
+			err:  ctl.ErrUnknownFormat,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			args := append([]string{"-server", server.URL}, tt.args...)
+			b := &strings.Builder{}
+			err := ctl.Run(context.Background(), args, b, io.Discard)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ctl.Run(%v) = %v, expected %v", tt.args, err, tt.err)
+			}
+			if b.String() != tt.out {
+				t.Errorf("mismatch in output:\n%s", utils.JoinOps(utils.LineDiff(b.String(), tt.out), "\n"))
+			}
+		})
+	}
+}
+
+func TestRunWatchDiff(t *testing.T) {
+	server := newTestServer(t)
+	client := labcon.NewClient(server.URL)
+
+	d, err := labcon.NewDriver(client, "foo", map[string]interface{}{"volume": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &syncBuffer{lines: make(chan string, 64)}
+	done := make(chan error)
+	go func() {
+		args := []string{"-server", server.URL, "watch", "-interval", "1ms", "-diff", "-count", "2", "foo"}
+		done <- ctl.Run(ctx, args, w, io.Discard)
+	}()
+
+	// Wait for the first snapshot before changing the state.
+	for line := range w.lines {
+		if line == "---\n" {
+			break
+		}
+	}
+	if err := d.SetState(map[string]interface{}{"volume": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	out := w.String()
+	diff := strings.Join([]string{
+		utils.CommonLine("status: idle").String(),
+		utils.CommonLine("state:").String(),
+		utils.DeleteLine("  volume: 0").String(),
+		utils.InsertLine("  volume: 10").String(),
+		"---",
+		"",
+	}, "\n")
+	if strings.Count(out, "---\n") != 2 || !strings.HasSuffix(out, diff) {
+		t.Errorf("expected a diff of the volume, got:\n%s", out)
+	}
+}
+
+type syncBuffer struct {
+	bytes.Buffer
+	lines chan string
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lines <- string(p)
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,116 @@
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown output format")
+)
+
+// Format is an output format.
+type Format string
+
+const (
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+	Table Format = "table"
+)
+
+// ParseFormat parses an output format name.
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case JSON, YAML, Table:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownFormat, s)
+	}
+}
+
+// Tabular is implemented by values with a table representation.
+type Tabular interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// Write writes v to w in the given format. Values that do not implement
+// Tabular are written as a KEY VALUE table if they are maps and as YAML
+// otherwise.
+func Write(w io.Writer, format Format, v interface{}) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(v)
+
+	case YAML:
+		p, err := yaml.MarshalWithOptions(v, yaml.Indent(2))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(p)
+		return err
+
+	case Table:
+		if m, ok := v.(map[string]interface{}); ok {
+			v = mapTable(m)
+		}
+		t, ok := v.(Tabular)
+		if !ok {
+			return Write(w, YAML, v)
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.Header(), "\t"))
+		for _, row := range t.Rows() {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+type mapTable map[string]interface{}
+
+func (m mapTable) Header() []string {
+	return []string{"KEY", "VALUE"}
+}
+
+func (m mapTable) Rows() [][]string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make([][]string, len(keys))
+	for i, key := range keys {
+		rows[i] = []string{key, formatValue(m[key])}
+	}
+	return rows
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return "-"
+	default:
+		p, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(p)
+	}
+}
@@ -0,0 +1,156 @@
+// Package codec provides the body encodings of the labcon HTTP API, which are
+// shared by the server and the client.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Codec encodes and decodes bodies of one media type. Struct fields are named
+// by their json tags in every codec.
+type Codec interface {
+	// ContentType is the media type written in the Content-Type header.
+	ContentType() string
+
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(p []byte, v interface{}) error
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	Msgpack Codec = msgpackCodec{}
+	YAML    Codec = yamlCodec{}
+)
+
+// codecs maps media types, including common aliases, to codecs.
+var codecs = map[string]Codec{
+	"application/json":      JSON,
+	"application/msgpack":   Msgpack,
+	"application/x-msgpack": Msgpack,
+	"application/yaml":      YAML,
+	"application/x-yaml":    YAML,
+	"text/yaml":             YAML,
+}
+
+// Lookup returns the codec of a Content-Type header value, ignoring its
+// parameters.
+func Lookup(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	codec, ok := codecs[strings.ToLower(mediaType)]
+	return codec, ok
+}
+
+// Negotiate returns the codec preferred by an Accept header value. JSON is
+// returned if the header is empty or accepts none of the codecs, so that
+// clients always get a response they can at least report.
+func Negotiate(accept string) Codec {
+	type candidate struct {
+		codec Codec
+		q     float64
+		index int
+	}
+
+	candidates := []candidate{}
+	for i, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+
+		switch mediaType = strings.ToLower(mediaType); mediaType {
+		case "*/*", "application/*":
+			candidates = append(candidates, candidate{JSON, q, i})
+		default:
+			if codec, ok := codecs[mediaType]; ok {
+				candidates = append(candidates, candidate{codec, q, i})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return JSON
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].codec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+// Marshal encodes v without escaping HTML and with a trailing newline, as
+// written by json.Encoder.
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonCodec) Unmarshal(p []byte, v interface{}) error {
+	return json.Unmarshal(p, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf).UseJSONTag(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes p into v. Integers in untyped values are decoded as int64
+// or uint64 and floats as float64 rather than the smallest fitting type.
+func (msgpackCodec) Unmarshal(p []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(p))
+	dec.UseJSONTag(true)
+	dec.UseDecodeInterfaceLoose(true)
+	return dec.Decode(v)
+}
+
+type yamlCodec struct{}
+
+func (yamlCodec) ContentType() string { return "application/yaml" }
+
+func (yamlCodec) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+// Unmarshal decodes p into v by way of JSON, so that values decode exactly as
+// they would from a JSON body, e.g. null into a nil pointer.
+func (yamlCodec) Unmarshal(p []byte, v interface{}) error {
+	j, err := yaml.YAMLToJSON(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
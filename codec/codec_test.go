@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+func TestLookup(t *testing.T) {
+	cases := []struct {
+		in    string
+		codec Codec
+		ok    bool
+	}{
+		{"application/json", JSON, true},
+		{"application/json; charset=utf-8", JSON, true},
+		{"application/msgpack", Msgpack, true},
+		{"application/x-msgpack", Msgpack, true},
+		{"Application/YAML", YAML, true},
+		{"application/x-yaml", YAML, true},
+		{"text/yaml", YAML, true},
+		{"text/plain", nil, false},
+		{"", nil, false},
+	}
+
+	for _, tt := range cases {
+		codec, ok := Lookup(tt.in)
+		if codec != tt.codec || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %v, %t: expected %v, %t", tt.in, codec, ok, tt.codec, tt.ok)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		in  string
+		out Codec
+	}{
+		{"", JSON},
+		{"*/*", JSON},
+		{"application/*", JSON},
+		{"text/html", JSON},
+		{"application/msgpack", Msgpack},
+		{"text/html, application/yaml", YAML},
+		{"application/json, application/msgpack", JSON},
+		{"application/json;q=0.5, application/msgpack", Msgpack},
+		{"application/yaml;q=0.8, */*;q=0.1", YAML},
+		{"application/msgpack;q=0, application/yaml;q=0.2", YAML},
+		{"application/msgpack;q=zero", JSON},
+	}
+
+	for _, tt := range cases {
+		if out := Negotiate(tt.in); out != tt.out {
+			t.Errorf("Negotiate(%q) = %v: expected %v", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	in := driver.Op{Name: "aspirate", Arg: map[string]interface{}{"volume": 10.5}}
+
+	for _, codec := range []Codec{JSON, Msgpack, YAML} {
+		p, err := codec.Marshal(in)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal: %v", codec.ContentType(), err)
+		}
+
+		var out driver.Op
+		if err := codec.Unmarshal(p, &out); err != nil {
+			t.Fatalf("%s: failed to unmarshal: %v", codec.ContentType(), err)
+		}
+		if ops := utils.ObjDiff(out, in); ops != nil {
+			t.Errorf("%s: round trip:\n%s", codec.ContentType(), utils.JoinOps(ops, "\n"))
+		}
+
+		p, err = codec.Marshal(nil)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal nil: %v", codec.ContentType(), err)
+		}
+
+		ptr := &driver.Op{}
+		if err := codec.Unmarshal(p, &ptr); err != nil {
+			t.Fatalf("%s: failed to unmarshal nil: %v", codec.ContentType(), err)
+		}
+		if ptr != nil {
+			t.Errorf("%s: nil decoded as %+v", codec.ContentType(), ptr)
+		}
+	}
+}
@@ -1,46 +1,186 @@
 package labcon
 
-import "github.com/ktnyt/labcon/driver"
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ktnyt/labcon/driver"
+)
 
 type Driver struct {
-	client *Client
-	name   string
-	token  string
+	client  *Client
+	name    string
+	session *session
+}
+
+// session holds the registration of a driver, which is replaced when the
+// driver reconnects.
+type session struct {
+	mu        sync.Mutex
+	token     string
+	state     interface{}
+	reconnect *RetryPolicy
+}
+
+func (s *session) get() (string, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, s.state
+}
+
+// DriverOption configures a Driver.
+type DriverOption func(driver *Driver)
+
+// WithReconnect makes the driver register itself again, with the state it
+// last set, when the server no longer knows it, e.g. after a restart of a
+// server without persistent storage. Registration is attempted according to
+// the given policy. A MaxAttempts of zero or less retries until the context
+// of the call is done. Registration is not retried if it fails with an error
+// that retrying cannot fix, e.g. because another driver took the name.
+func WithReconnect(policy RetryPolicy) DriverOption {
+	return func(driver *Driver) {
+		driver.session.reconnect = &policy
+	}
 }
 
-func NewDriver(client *Client, name string, state interface{}) (Driver, error) {
-	token, err := client.Register(name, state)
-	return Driver{
-		client: client,
-		name:   name,
-		token:  token,
-	}, err
+func NewDriver(client *Client, name string, state interface{}, opts ...DriverOption) (Driver, error) {
+	return NewDriverCtx(context.Background(), client, name, state, opts...)
+}
+
+func NewDriverCtx(ctx context.Context, client *Client, name string, state interface{}, opts ...DriverOption) (Driver, error) {
+	token, err := client.RegisterCtx(ctx, name, state)
+	d := Driver{
+		client:  client,
+		name:    name,
+		session: &session{token: token, state: state},
+	}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	return d, err
+}
+
+// Name returns the name of the driver.
+func (driver Driver) Name() string {
+	return driver.name
+}
+
+// Reconnect registers the driver again with the state it last set, retrying
+// according to the policy given to WithReconnect, or DefaultRetryPolicy, as
+// long as registration fails in transport or with a transient error status.
+func (driver Driver) Reconnect(ctx context.Context) error {
+	policy := DefaultRetryPolicy
+	if driver.session.reconnect != nil {
+		policy = *driver.session.reconnect
+	}
+
+	_, state := driver.session.get()
+	for attempt := 1; ; attempt++ {
+		token, err := driver.client.RegisterCtx(ctx, driver.name, state)
+		if err == nil {
+			driver.session.mu.Lock()
+			driver.session.token = token
+			driver.session.mu.Unlock()
+			return nil
+		}
+		if !retryable(err) || policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		if err := sleep(ctx, policy.Backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// authorized calls f with the token of the driver, reconnecting and calling f
+// again if the driver is lost and reconnection is enabled.
+func (driver Driver) authorized(ctx context.Context, f func(token string) error) error {
+	token, _ := driver.session.get()
+	err := f(token)
+	if driver.session.reconnect == nil || !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := driver.Reconnect(ctx); err != nil {
+		return err
+	}
+	token, _ = driver.session.get()
+	return f(token)
 }
 
 func (driver Driver) GetState(state interface{}) error {
-	return driver.client.GetState(driver.name, state)
+	return driver.GetStateCtx(context.Background(), state)
+}
+
+func (driver Driver) GetStateCtx(ctx context.Context, state interface{}) error {
+	return driver.authorized(ctx, func(string) error {
+		return driver.client.GetStateCtx(ctx, driver.name, state)
+	})
 }
 
 func (driver Driver) SetState(state interface{}) error {
-	return driver.client.SetState(driver.name, driver.token, state)
+	return driver.SetStateCtx(context.Background(), state)
+}
+
+func (driver Driver) SetStateCtx(ctx context.Context, state interface{}) error {
+	err := driver.authorized(ctx, func(token string) error {
+		return driver.client.SetStateCtx(ctx, driver.name, token, state)
+	})
+	if err == nil {
+		driver.session.mu.Lock()
+		driver.session.state = state
+		driver.session.mu.Unlock()
+	}
+	return err
 }
 
 func (driver Driver) GetStatus() (driver.Status, error) {
-	return driver.client.GetStatus(driver.name)
+	return driver.GetStatusCtx(context.Background())
+}
+
+func (driver Driver) GetStatusCtx(ctx context.Context) (status driver.Status, err error) {
+	err = driver.authorized(ctx, func(string) error {
+		status, err = driver.client.GetStatusCtx(ctx, driver.name)
+		return err
+	})
+	return status, err
 }
 
 func (driver Driver) SetStatus(status driver.Status) error {
-	return driver.client.SetStatus(driver.name, driver.token, status)
+	return driver.SetStatusCtx(context.Background(), status)
+}
+
+func (driver Driver) SetStatusCtx(ctx context.Context, status driver.Status) error {
+	return driver.authorized(ctx, func(token string) error {
+		return driver.client.SetStatusCtx(ctx, driver.name, token, status)
+	})
 }
 
 func (driver Driver) Operation() (*driver.Op, error) {
-	return driver.client.Operation(driver.name, driver.token)
+	return driver.OperationCtx(context.Background())
+}
+
+func (driver Driver) OperationCtx(ctx context.Context) (op *driver.Op, err error) {
+	err = driver.authorized(ctx, func(token string) error {
+		op, err = driver.client.OperationCtx(ctx, driver.name, token)
+		return err
+	})
+	return op, err
 }
 
 func (driver Driver) Dispatch(op driver.Op) error {
-	return driver.client.Dispatch(driver.name, op)
+	return driver.DispatchCtx(context.Background(), op)
+}
+
+func (driver Driver) DispatchCtx(ctx context.Context, op driver.Op) error {
+	return driver.client.DispatchCtx(ctx, driver.name, op)
 }
 
 func (driver Driver) Disconnect() error {
-	return driver.client.Disconnect(driver.name, driver.token)
+	return driver.DisconnectCtx(context.Background())
+}
+
+func (driver Driver) DisconnectCtx(ctx context.Context) error {
+	token, _ := driver.session.get()
+	return driver.client.DisconnectCtx(ctx, driver.name, token)
 }
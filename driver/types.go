@@ -14,7 +14,33 @@ type Op struct {
 	Arg  interface{} `json:"arg,omitempty"`
 }
 
+// Metadata describes the instrument behind a driver for the people using it.
+type Metadata struct {
+	Location string `json:"location,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+}
+
+// Info is what describes a driver besides its state. Labels are key-value
+// pairs that drivers are selected by, such as room=302 or kind=pipettor.
+// Keys and values are up to 63 letters, digits, '-', '_', '.' and '/',
+// starting and ending with a letter or digit.
+type Info struct {
+	Labels   map[string]string `json:"labels,omitempty" validate:"dive,keys,label,endkeys,label"`
+	Metadata Metadata          `json:"metadata"`
+}
+
 type RegisterParams struct {
 	Name  string      `json:"name" validate:"required"`
 	State interface{} `json:"state" validate:"required"`
+	Info
+}
+
+// Summary describes a driver in a list of drivers.
+type Summary struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Op     *Op    `json:"op,omitempty"`
+	Info
 }
@@ -1,8 +1,12 @@
 package labcon
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -142,3 +146,90 @@ func TestDriver(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDriverReconnect(t *testing.T) {
+	var handler atomic.Value
+	handler.Store(newTestHandler(t))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	d, err := NewDriver(client, "foo", "foo", WithReconnect(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SetState("bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart the server, losing all registrations.
+	handler.Store(newTestHandler(t))
+
+	op, err := d.Operation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op != nil {
+		t.Fatalf("driver op = %v, want nil", op)
+	}
+
+	var state string
+	if err := client.GetState("foo", &state); err != nil {
+		t.Fatal(err)
+	}
+
+	if state != "bar" {
+		t.Fatalf("client state = %q, want \"bar\"", state)
+	}
+
+	if err := d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDriverReconnectRefused(t *testing.T) {
+	// Once lost is set, the server has lost the driver and refuses to
+	// register it again.
+	var lost, attempts int32
+	handler := newTestHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&lost) == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/driver" {
+			atomic.AddInt32(&attempts, 1)
+			http.Error(w, "refused", http.StatusBadRequest)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	d, err := NewDriver(client, "foo", "foo", WithReconnect(RetryPolicy{
+		MaxAttempts:    0,
+		InitialBackoff: time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&lost, 1)
+
+	// Reconnection gives up at once instead of retrying forever.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := d.OperationCtx(ctx); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("driver.OperationCtx(ctx) = %v, want %v", err, ErrBadRequest)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("driver registered %d times, want 1", n)
+	}
+}
@@ -0,0 +1,98 @@
+package labcon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ktnyt/labcon/codec"
+)
+
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrBusy         = errors.New("busy")
+	ErrBooked       = errors.New("booked")
+	ErrDraining     = errors.New("server is shutting down")
+	ErrTimeout      = errors.New("timed out")
+)
+
+// StatusError is returned by Client methods when the server responds with an
+// error status. It matches the sentinel errors of this package with errors.Is
+// according to its status code, e.g. ErrNotFound for 404 Not Found. ErrBusy
+// matches the conflict raised when dispatching to a driver that is busy,
+// which also matches ErrConflict, and ErrBooked the conflict raised when the
+// driver is booked by another API key. ErrDraining matches the refusal of new
+// drivers and operations while the server shuts down, and ErrTimeout a wait
+// whose condition did not hold in time.
+type StatusError struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	Details    []FieldError `json:"details,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+}
+
+// FieldError describes a field of a request that failed validation.
+type FieldError struct {
+	Field      string `json:"field"`
+	Constraint string `json:"constraint"`
+	Param      string `json:"param,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (err *StatusError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%d %s", err.StatusCode, http.StatusText(err.StatusCode))
+	}
+	return err.Message
+}
+
+func (err *StatusError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return err.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return err.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return err.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return err.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return err.StatusCode == http.StatusConflict
+	case ErrBusy:
+		return err.StatusCode == http.StatusConflict && err.Code == "busy"
+	case ErrBooked:
+		return err.StatusCode == http.StatusConflict && err.Code == "booked"
+	case ErrDraining:
+		return err.StatusCode == http.StatusServiceUnavailable && err.Code == "draining"
+	case ErrTimeout:
+		return err.StatusCode == http.StatusRequestTimeout && err.Code == "timeout"
+	default:
+		return false
+	}
+}
+
+// newStatusError creates a StatusError from an error response decoded with
+// the given codec. Bodies that are not an error response are used as the
+// message verbatim.
+func newStatusError(code int, c codec.Codec, body []byte) *StatusError {
+	err := &StatusError{StatusCode: code}
+	if c.Unmarshal(body, err) != nil || err.Message == "" {
+		*err = StatusError{StatusCode: code, Message: string(body)}
+	}
+	return err
+}
+
+// wrapError annotates err with the failed action unless it is a StatusError,
+// whose message already describes the failure.
+func wrapError(err error, format string, args ...interface{}) error {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return err
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
@@ -0,0 +1,46 @@
+// Package deadline bounds blocking reads and writes on instrument connections
+// by a timeout and a context.
+package deadline
+
+import (
+	"context"
+	"time"
+)
+
+// Conn is implemented by connections whose reads and writes can time out,
+// such as *os.File and net.Conn.
+type Conn interface {
+	SetDeadline(t time.Time) error
+}
+
+// Watch sets the deadline of conn from the timeout and the context, and
+// interrupts blocked reads and writes once the context is done. The returned
+// function stops watching and clears the deadline.
+func Watch(ctx context.Context, conn Conn, timeout time.Duration) func() {
+	deadline, ok := ctx.Deadline()
+	if timeout > 0 {
+		if t := time.Now().Add(timeout); !ok || t.Before(deadline) {
+			deadline, ok = t, true
+		}
+	}
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		conn.SetDeadline(time.Time{})
+	}
+}
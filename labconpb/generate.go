@@ -0,0 +1,5 @@
+// Package labconpb contains the protocol buffer messages and gRPC service of
+// the labcon gRPC API, generated from labcon.proto.
+package labconpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative labcon.proto
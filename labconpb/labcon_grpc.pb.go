@@ -0,0 +1,572 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.1
+// source: labcon.proto
+
+package labconpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// DriverServiceClient is the client API for DriverService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DriverServiceClient interface {
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*GetStateResponse, error)
+	SetState(ctx context.Context, in *SetStateRequest, opts ...grpc.CallOption) (*SetStateResponse, error)
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+	SetStatus(ctx context.Context, in *SetStatusRequest, opts ...grpc.CallOption) (*SetStatusResponse, error)
+	GetOp(ctx context.Context, in *GetOpRequest, opts ...grpc.CallOption) (*GetOpResponse, error)
+	SetOp(ctx context.Context, in *SetOpRequest, opts ...grpc.CallOption) (*SetOpResponse, error)
+	CancelOp(ctx context.Context, in *CancelOpRequest, opts ...grpc.CallOption) (*CancelOpResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Watch sends the current snapshot of a driver and then a new snapshot
+	// whenever it changes. The stream ends with NOT_FOUND once the driver is
+	// deleted and with UNAVAILABLE when the server starts shutting down.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (DriverService_WatchClient, error)
+	// NextOperation sends each operation dispatched to the calling driver once,
+	// including one already pending when the stream starts. The driver reports
+	// completion with SetStatus as it would when polling. The stream keeps the
+	// driver's lease alive, and ends with UNAVAILABLE when the server starts
+	// shutting down.
+	NextOperation(ctx context.Context, in *NextOperationRequest, opts ...grpc.CallOption) (DriverService_NextOperationClient, error)
+}
+
+type driverServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDriverServiceClient(cc grpc.ClientConnInterface) DriverServiceClient {
+	return &driverServiceClient{cc}
+}
+
+func (c *driverServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*GetStateResponse, error) {
+	out := new(GetStateResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/GetState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) SetState(ctx context.Context, in *SetStateRequest, opts ...grpc.CallOption) (*SetStateResponse, error) {
+	out := new(SetStateResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/SetState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/GetStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) SetStatus(ctx context.Context, in *SetStatusRequest, opts ...grpc.CallOption) (*SetStatusResponse, error) {
+	out := new(SetStatusResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/SetStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) GetOp(ctx context.Context, in *GetOpRequest, opts ...grpc.CallOption) (*GetOpResponse, error) {
+	out := new(GetOpResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/GetOp", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) SetOp(ctx context.Context, in *SetOpRequest, opts ...grpc.CallOption) (*SetOpResponse, error) {
+	out := new(SetOpResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/SetOp", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) CancelOp(ctx context.Context, in *CancelOpRequest, opts ...grpc.CallOption) (*CancelOpResponse, error) {
+	out := new(CancelOpResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/CancelOp", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/labcon.v1.DriverService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (DriverService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DriverService_ServiceDesc.Streams[0], "/labcon.v1.DriverService/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &driverServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DriverService_WatchClient interface {
+	Recv() (*Snapshot, error)
+	grpc.ClientStream
+}
+
+type driverServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *driverServiceWatchClient) Recv() (*Snapshot, error) {
+	m := new(Snapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *driverServiceClient) NextOperation(ctx context.Context, in *NextOperationRequest, opts ...grpc.CallOption) (DriverService_NextOperationClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DriverService_ServiceDesc.Streams[1], "/labcon.v1.DriverService/NextOperation", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &driverServiceNextOperationClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DriverService_NextOperationClient interface {
+	Recv() (*Op, error)
+	grpc.ClientStream
+}
+
+type driverServiceNextOperationClient struct {
+	grpc.ClientStream
+}
+
+func (x *driverServiceNextOperationClient) Recv() (*Op, error) {
+	m := new(Op)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DriverServiceServer is the server API for DriverService service.
+// All implementations must embed UnimplementedDriverServiceServer
+// for forward compatibility
+type DriverServiceServer interface {
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	GetState(context.Context, *GetStateRequest) (*GetStateResponse, error)
+	SetState(context.Context, *SetStateRequest) (*SetStateResponse, error)
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	SetStatus(context.Context, *SetStatusRequest) (*SetStatusResponse, error)
+	GetOp(context.Context, *GetOpRequest) (*GetOpResponse, error)
+	SetOp(context.Context, *SetOpRequest) (*SetOpResponse, error)
+	CancelOp(context.Context, *CancelOpRequest) (*CancelOpResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Watch sends the current snapshot of a driver and then a new snapshot
+	// whenever it changes. The stream ends with NOT_FOUND once the driver is
+	// deleted and with UNAVAILABLE when the server starts shutting down.
+	Watch(*WatchRequest, DriverService_WatchServer) error
+	// NextOperation sends each operation dispatched to the calling driver once,
+	// including one already pending when the stream starts. The driver reports
+	// completion with SetStatus as it would when polling. The stream keeps the
+	// driver's lease alive, and ends with UNAVAILABLE when the server starts
+	// shutting down.
+	NextOperation(*NextOperationRequest, DriverService_NextOperationServer) error
+	mustEmbedUnimplementedDriverServiceServer()
+}
+
+// UnimplementedDriverServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDriverServiceServer struct {
+}
+
+func (UnimplementedDriverServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedDriverServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedDriverServiceServer) GetState(context.Context, *GetStateRequest) (*GetStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedDriverServiceServer) SetState(context.Context, *SetStateRequest) (*SetStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetState not implemented")
+}
+func (UnimplementedDriverServiceServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedDriverServiceServer) SetStatus(context.Context, *SetStatusRequest) (*SetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetStatus not implemented")
+}
+func (UnimplementedDriverServiceServer) GetOp(context.Context, *GetOpRequest) (*GetOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOp not implemented")
+}
+func (UnimplementedDriverServiceServer) SetOp(context.Context, *SetOpRequest) (*SetOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetOp not implemented")
+}
+func (UnimplementedDriverServiceServer) CancelOp(context.Context, *CancelOpRequest) (*CancelOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelOp not implemented")
+}
+func (UnimplementedDriverServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedDriverServiceServer) Watch(*WatchRequest, DriverService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedDriverServiceServer) NextOperation(*NextOperationRequest, DriverService_NextOperationServer) error {
+	return status.Errorf(codes.Unimplemented, "method NextOperation not implemented")
+}
+func (UnimplementedDriverServiceServer) mustEmbedUnimplementedDriverServiceServer() {}
+
+// UnsafeDriverServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DriverServiceServer will
+// result in compilation errors.
+type UnsafeDriverServiceServer interface {
+	mustEmbedUnimplementedDriverServiceServer()
+}
+
+func RegisterDriverServiceServer(s grpc.ServiceRegistrar, srv DriverServiceServer) {
+	s.RegisterService(&DriverService_ServiceDesc, srv)
+}
+
+func _DriverService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/GetState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_SetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).SetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/SetState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).SetState(ctx, req.(*SetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/GetStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_SetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).SetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/SetStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).SetStatus(ctx, req.(*SetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_GetOp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).GetOp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/GetOp",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).GetOp(ctx, req.(*GetOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_SetOp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).SetOp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/SetOp",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).SetOp(ctx, req.(*SetOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_CancelOp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).CancelOp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/CancelOp",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).CancelOp(ctx, req.(*CancelOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/labcon.v1.DriverService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DriverServiceServer).Watch(m, &driverServiceWatchServer{stream})
+}
+
+type DriverService_WatchServer interface {
+	Send(*Snapshot) error
+	grpc.ServerStream
+}
+
+type driverServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *driverServiceWatchServer) Send(m *Snapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _DriverService_NextOperation_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(NextOperationRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DriverServiceServer).NextOperation(m, &driverServiceNextOperationServer{stream})
+}
+
+type DriverService_NextOperationServer interface {
+	Send(*Op) error
+	grpc.ServerStream
+}
+
+type driverServiceNextOperationServer struct {
+	grpc.ServerStream
+}
+
+func (x *driverServiceNextOperationServer) Send(m *Op) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// DriverService_ServiceDesc is the grpc.ServiceDesc for DriverService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DriverService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "labcon.v1.DriverService",
+	HandlerType: (*DriverServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _DriverService_List_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _DriverService_Register_Handler,
+		},
+		{
+			MethodName: "GetState",
+			Handler:    _DriverService_GetState_Handler,
+		},
+		{
+			MethodName: "SetState",
+			Handler:    _DriverService_SetState_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _DriverService_GetStatus_Handler,
+		},
+		{
+			MethodName: "SetStatus",
+			Handler:    _DriverService_SetStatus_Handler,
+		},
+		{
+			MethodName: "GetOp",
+			Handler:    _DriverService_GetOp_Handler,
+		},
+		{
+			MethodName: "SetOp",
+			Handler:    _DriverService_SetOp_Handler,
+		},
+		{
+			MethodName: "CancelOp",
+			Handler:    _DriverService_CancelOp_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _DriverService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _DriverService_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "NextOperation",
+			Handler:       _DriverService_NextOperation_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "labcon.proto",
+}
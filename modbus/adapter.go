@@ -0,0 +1,322 @@
+// Package modbus adapts devices exposing Modbus TCP registers, such as PLC
+// controlled incubators and chillers, to labcon drivers. Registers declared in
+// a Config are polled into the driver state and operations write coils and
+// holding registers.
+//
+// A driver is typically set up by polling once for its initial state:
+//
+//	conn, err := net.Dial("tcp", "plc:502")
+//	adapter, err := modbus.NewAdapter(conn, config)
+//	state, err := adapter.Poll(ctx)
+//	d, err := labcon.NewDriver(client, "incubator", state)
+//	runtime := labcon.NewRuntime(d)
+//	adapter.Register(runtime)
+//	go adapter.Run(ctx, d, nil)
+//	runtime.Run(ctx)
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ktnyt/labcon"
+)
+
+var (
+	ErrUnknownOp    = errors.New("unknown operation")
+	ErrInvalidValue = errors.New("invalid register value")
+	ErrOutOfRange   = errors.New("value out of range for register")
+)
+
+// Adapter polls and writes the registers of a device.
+type Adapter struct {
+	config Config
+	names  []string
+
+	mu     sync.Mutex
+	client *client
+	state  map[string]interface{}
+}
+
+// NewAdapter creates an adapter talking to the device over rw, which is
+// usually a TCP connection to port 502.
+func NewAdapter(rw io.ReadWriter, config Config) (*Adapter, error) {
+	config.fillDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config.Registers))
+	units := make(map[string]interface{})
+	for name, register := range config.Registers {
+		names = append(names, name)
+		if register.Unit != "" {
+			units[name] = register.Unit
+		}
+	}
+	sort.Strings(names)
+
+	state := make(map[string]interface{})
+	if len(units) > 0 {
+		state[UnitsField] = units
+	}
+
+	return &Adapter{
+		config: config,
+		names:  names,
+		client: &client{rw: rw, unitID: config.UnitID, timeout: config.Timeout},
+		state:  state,
+	}, nil
+}
+
+// State returns a copy of the state last polled.
+func (adapter *Adapter) State() map[string]interface{} {
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+	return adapter.copyState()
+}
+
+func (adapter *Adapter) copyState() map[string]interface{} {
+	state := make(map[string]interface{}, len(adapter.state))
+	for key, value := range adapter.state {
+		state[key] = value
+	}
+	return state
+}
+
+// Poll reads every register into the state and returns the new state.
+func (adapter *Adapter) Poll(ctx context.Context) (map[string]interface{}, error) {
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+
+	if err := adapter.poll(ctx); err != nil {
+		return nil, err
+	}
+	return adapter.copyState(), nil
+}
+
+func (adapter *Adapter) poll(ctx context.Context) error {
+	for _, name := range adapter.names {
+		value, err := adapter.read(ctx, adapter.config.Registers[name])
+		if err != nil {
+			return fmt.Errorf("register %q: %w", name, err)
+		}
+		adapter.state[name] = value
+	}
+	return nil
+}
+
+func (adapter *Adapter) read(ctx context.Context, register RegisterConfig) (interface{}, error) {
+	switch register.Table {
+	case Coil, Discrete:
+		fn := uint8(fnReadCoils)
+		if register.Table == Discrete {
+			fn = fnReadDiscreteInputs
+		}
+		bits, err := adapter.client.readBits(ctx, fn, register.Address, 1)
+		if err != nil {
+			return nil, err
+		}
+		return bits[0], nil
+
+	default:
+		fn := uint8(fnReadHolding)
+		if register.Table == Input {
+			fn = fnReadInput
+		}
+		words, err := adapter.client.readWords(ctx, fn, register.Address, register.words())
+		if err != nil {
+			return nil, err
+		}
+		value := decode(register, words)*register.Scale + register.Offset
+		// Infinities and NaN cannot be encoded in JSON states.
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return strconv.FormatFloat(value, 'g', -1, 64), nil
+		}
+		return value, nil
+	}
+}
+
+// Register registers a handler for each configured operation.
+func (adapter *Adapter) Register(runtime *labcon.Runtime) {
+	for name := range adapter.config.Ops {
+		runtime.Handle(name, adapter.handler(name))
+	}
+}
+
+func (adapter *Adapter) handler(name string) labcon.Handler {
+	return func(ctx context.Context, arg labcon.Arg, update labcon.StateUpdater) error {
+		state, err := adapter.Exec(ctx, name, arg.Value())
+		if err != nil {
+			return err
+		}
+		return update(state)
+	}
+}
+
+// Exec writes the registers of the named operation with the given argument,
+// then polls the registers and returns the new state.
+func (adapter *Adapter) Exec(ctx context.Context, name string, arg interface{}) (map[string]interface{}, error) {
+	op, ok := adapter.config.Ops[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownOp, name)
+	}
+
+	fields := make([]string, 0, len(op.Set))
+	for field := range op.Set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+
+	for _, field := range fields {
+		value := resolve(op.Set[field], arg)
+		if err := adapter.write(ctx, adapter.config.Registers[field], value); err != nil {
+			return nil, fmt.Errorf("op %q: register %q: %w", name, field, err)
+		}
+	}
+
+	if err := adapter.poll(ctx); err != nil {
+		return nil, fmt.Errorf("op %q: %w", name, err)
+	}
+	return adapter.copyState(), nil
+}
+
+func (adapter *Adapter) write(ctx context.Context, register RegisterConfig, value interface{}) error {
+	if register.Table == Coil {
+		bit, ok := toBool(value)
+		if !ok {
+			return fmt.Errorf("%w %v", ErrInvalidValue, value)
+		}
+		return adapter.client.writeCoil(ctx, register.Address, bit)
+	}
+
+	f, ok := toFloat(value)
+	if !ok {
+		return fmt.Errorf("%w %v", ErrInvalidValue, value)
+	}
+	words, err := encode(register, (f-register.Offset)/register.Scale)
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, value)
+	}
+	return adapter.client.writeWords(ctx, register.Address, words)
+}
+
+// Run polls the registers at the configured interval and sets the state of the
+// driver whenever it changes, until the context is done. Errors are passed to
+// onError, which may be nil, and polling goes on.
+func (adapter *Adapter) Run(ctx context.Context, d labcon.Driver, onError func(err error)) {
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	ticker := time.NewTicker(adapter.config.Interval)
+	defer ticker.Stop()
+
+	var last map[string]interface{}
+	for {
+		state, err := adapter.Poll(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				onError(err)
+			}
+		case !reflect.DeepEqual(state, last):
+			if err := d.SetStateCtx(ctx, state); err != nil {
+				if ctx.Err() == nil {
+					onError(err)
+				}
+			} else {
+				last = state
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// decode returns the raw value of registers.
+func decode(register RegisterConfig, words []uint16) float64 {
+	switch register.Type {
+	case Int16:
+		return float64(int16(words[0]))
+	case Uint32:
+		return float64(uint32(words[0])<<16 | uint32(words[1]))
+	case Int32:
+		return float64(int32(uint32(words[0])<<16 | uint32(words[1])))
+	case Float32:
+		return float64(math.Float32frombits(uint32(words[0])<<16 | uint32(words[1])))
+	default:
+		return float64(words[0])
+	}
+}
+
+// encode returns the registers holding a raw value. Integers are rounded.
+func encode(register RegisterConfig, raw float64) ([]uint16, error) {
+	if register.Type == Float32 {
+		bits := math.Float32bits(float32(raw))
+		return []uint16{uint16(bits >> 16), uint16(bits)}, nil
+	}
+
+	raw = math.Round(raw)
+	var min, max float64
+	switch register.Type {
+	case Int16:
+		min, max = math.MinInt16, math.MaxInt16
+	case Uint32:
+		min, max = 0, math.MaxUint32
+	case Int32:
+		min, max = math.MinInt32, math.MaxInt32
+	default:
+		min, max = 0, math.MaxUint16
+	}
+	if math.IsNaN(raw) || raw < min || raw > max {
+		return nil, ErrOutOfRange
+	}
+
+	bits := uint32(int64(raw))
+	if register.words() == 1 {
+		return []uint16{uint16(bits)}, nil
+	}
+	return []uint16{uint16(bits >> 16), uint16(bits)}, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// toBool accepts booleans, and numbers as true unless zero.
+func toBool(value interface{}) (bool, bool) {
+	if b, ok := value.(bool); ok {
+		return b, true
+	}
+	f, ok := toFloat(value)
+	return f != 0, ok
+}
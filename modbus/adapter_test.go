@@ -0,0 +1,469 @@
+package modbus_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/modbus"
+	"github.com/ktnyt/labcon/utils"
+)
+
+const testConfig = `
+unit_id: 1
+interval: 10ms
+timeout: 1s
+registers:
+  temperature:
+    table: input
+    address: 0
+    type: int16
+    scale: 0.1
+    unit: degC
+  setpoint:
+    address: 0
+    scale: 0.1
+    unit: degC
+  runtime:
+    table: input
+    address: 1
+    type: uint32
+  gain:
+    address: 1
+    type: float32
+  running:
+    table: coil
+    address: 0
+  door_open:
+    table: discrete
+    address: 0
+ops:
+  set_temperature:
+    set: {setpoint: $arg}
+  start:
+    set: {running: true, setpoint: $arg.setpoint}
+  stop:
+    set: {running: false}
+  set_gain:
+    set: {gain: $arg}
+`
+
+// testDevice is an in-process Modbus TCP server with 16 of each kind of
+// register.
+type testDevice struct {
+	mu       sync.Mutex
+	coils    [16]bool
+	discrete [16]bool
+	holding  [16]uint16
+	input    [16]uint16
+}
+
+// serve answers requests on conn until it is closed. Requests for addresses
+// beyond the registers get an illegal data address exception.
+func (device *testDevice) serve(conn net.Conn) {
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		res := device.handle(pdu)
+		binary.BigEndian.PutUint16(header[4:], uint16(len(res)+1))
+		if _, err := conn.Write(append(header, res...)); err != nil {
+			return
+		}
+	}
+}
+
+func (device *testDevice) handle(pdu []byte) []byte {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	fn := pdu[0]
+	address := int(binary.BigEndian.Uint16(pdu[1:]))
+	count := int(binary.BigEndian.Uint16(pdu[3:]))
+	exception := []byte{fn | 0x80, 0x02}
+
+	switch fn {
+	case 0x01, 0x02:
+		bits := device.coils[:]
+		if fn == 0x02 {
+			bits = device.discrete[:]
+		}
+		if address+count > len(bits) {
+			return exception
+		}
+		data := make([]byte, (count+7)/8)
+		for i := 0; i < count; i++ {
+			if bits[address+i] {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{fn, uint8(len(data))}, data...)
+
+	case 0x03, 0x04:
+		words := device.holding[:]
+		if fn == 0x04 {
+			words = device.input[:]
+		}
+		if address+count > len(words) {
+			return exception
+		}
+		res := []byte{fn, uint8(2 * count)}
+		for i := 0; i < count; i++ {
+			res = append(res, uint8(words[address+i]>>8), uint8(words[address+i]))
+		}
+		return res
+
+	case 0x05:
+		if address >= len(device.coils) {
+			return exception
+		}
+		device.coils[address] = pdu[3] == 0xff
+		return pdu
+
+	case 0x10:
+		if address+count > len(device.holding) {
+			return exception
+		}
+		for i := 0; i < count; i++ {
+			device.holding[address+i] = binary.BigEndian.Uint16(pdu[6+2*i:])
+		}
+		return pdu[:5]
+
+	default:
+		return []byte{fn | 0x80, 0x01}
+	}
+}
+
+func newTestAdapter(t *testing.T, config modbus.Config) (*modbus.Adapter, *testDevice) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	device := &testDevice{}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go device.serve(conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	adapter, err := modbus.NewAdapter(conn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter, device
+}
+
+func TestAdapter(t *testing.T) {
+	config, err := modbus.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adapter, device := newTestAdapter(t, config)
+
+	device.mu.Lock()
+	device.input[0] = uint16(0xffff - 45 + 1) // -4.5 degC
+	device.input[1], device.input[2] = 0x0001, 0x0002
+	device.discrete[0] = true
+	device.mu.Unlock()
+
+	units := map[string]interface{}{"temperature": "degC", "setpoint": "degC"}
+
+	state, err := adapter.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(state, map[string]interface{}{
+		"temperature": -4.5,
+		"setpoint":    0.0,
+		"runtime":     65538.0,
+		"gain":        0.0,
+		"running":     false,
+		"door_open":   true,
+		"units":       units,
+	}); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+
+	cases := []struct {
+		op    string
+		arg   interface{}
+		check func(t *testing.T, state map[string]interface{})
+		err   error
+	}{
+		{
+			op:  "set_temperature",
+			arg: 37.0,
+			check: func(t *testing.T, state map[string]interface{}) {
+				if device.holding[0] != 370 {
+					t.Errorf("holding register 0 = %d, expected %d", device.holding[0], 370)
+				}
+				if ops := utils.ObjDiff(state["setpoint"], 37.0); ops != nil {
+					t.Error(utils.JoinOps(ops, "\n"))
+				}
+			},
+		},
+		{
+			op:  "start",
+			arg: map[string]interface{}{"setpoint": 4.0},
+			check: func(t *testing.T, state map[string]interface{}) {
+				if !device.coils[0] || device.holding[0] != 40 {
+					t.Errorf("coil 0 = %t and holding register 0 = %d, expected %t and %d", device.coils[0], device.holding[0], true, 40)
+				}
+				if state["running"] != true {
+					t.Errorf("running = %v, expected %t", state["running"], true)
+				}
+			},
+		},
+		{
+			op: "stop",
+			check: func(t *testing.T, state map[string]interface{}) {
+				if device.coils[0] {
+					t.Errorf("coil 0 = %t, expected %t", device.coils[0], false)
+				}
+			},
+		},
+		{
+			op:  "set_gain",
+			arg: 1.5,
+			check: func(t *testing.T, state map[string]interface{}) {
+				if device.holding[1] != 0x3fc0 || device.holding[2] != 0 {
+					t.Errorf("holding registers 1 and 2 = %#x, %#x, expected %#x, %#x", device.holding[1], device.holding[2], 0x3fc0, 0)
+				}
+				if ops := utils.ObjDiff(state["gain"], 1.5); ops != nil {
+					t.Error(utils.JoinOps(ops, "\n"))
+				}
+			},
+		},
+		{
+			op:  "set_temperature",
+			arg: -1.0,
+			err: modbus.ErrOutOfRange,
+		},
+		{
+			op:  "set_temperature",
+			arg: "hot",
+			err: modbus.ErrInvalidValue,
+		},
+		{
+			op:  "reset",
+			err: modbus.ErrUnknownOp,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			state, err := adapter.Exec(context.Background(), tt.op, tt.arg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("adapter.Exec(ctx, %q, %v) = (_, %v), expected %v", tt.op, tt.arg, err, tt.err)
+			}
+			if err == nil {
+				device.mu.Lock()
+				defer device.mu.Unlock()
+				tt.check(t, state)
+			}
+		})
+	}
+}
+
+func TestAdapterNonFinite(t *testing.T) {
+	config, err := modbus.Parse([]byte(`
+registers:
+  nan: {address: 0, type: float32}
+  inf: {address: 2, type: float32}
+  ninf: {address: 4, type: float32}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter, device := newTestAdapter(t, config)
+
+	device.mu.Lock()
+	device.holding[0] = 0x7fc0
+	device.holding[2] = 0x7f80
+	device.holding[4] = 0xff80
+	device.mu.Unlock()
+
+	state, err := adapter.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(state, map[string]interface{}{
+		"nan":  "NaN",
+		"inf":  "+Inf",
+		"ninf": "-Inf",
+	}); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestAdapterException(t *testing.T) {
+	config, err := modbus.Parse([]byte("registers: {far: {address: 100}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter, _ := newTestAdapter(t, config)
+
+	_, err = adapter.Poll(context.Background())
+	var exception *modbus.ExceptionError
+	if !errors.As(err, &exception) || exception.Code != 0x02 {
+		t.Errorf("adapter.Poll(ctx) = (_, %v), expected an illegal data address exception", err)
+	}
+
+	// The connection stays usable after an exception.
+	if _, err := adapter.Poll(context.Background()); !errors.As(err, &exception) {
+		t.Errorf("adapter.Poll(ctx) = (_, %v), expected an exception again", err)
+	}
+}
+
+func TestAdapterPartialFrame(t *testing.T) {
+	config, err := modbus.Parse([]byte("registers: {setpoint: {address: 0}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	device := &testDevice{}
+	device.holding[0] = 42
+	stalled := make(chan struct{})
+	go func() {
+		peer, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer peer.Close()
+
+		// Stall in the middle of the first response, then serve as usual.
+		header := make([]byte, 12)
+		if _, err := io.ReadFull(peer, header); err != nil {
+			return
+		}
+		res := append([]byte{header[0], header[1], 0, 0, 0, 5, header[6]}, device.handle(header[7:])...)
+		if _, err := peer.Write(res[:9]); err != nil {
+			return
+		}
+		<-stalled
+		if _, err := peer.Write(res[9:]); err != nil {
+			return
+		}
+		device.serve(peer)
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	adapter, err := modbus.NewAdapter(conn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := adapter.Poll(ctx); err == nil {
+		t.Fatal("adapter.Poll(ctx) = (_, nil), expected a timeout")
+	}
+	close(stalled)
+
+	// The rest of the stale frame is skipped rather than read as a response.
+	state, err := adapter.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := utils.ObjDiff(state, map[string]interface{}{"setpoint": 42.0}); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in  string
+		err error
+	}{
+		{
+			in:  testConfig,
+			err: nil,
+		},
+		{
+			in:  "registers: {x: {}}\nops: {set: {set: {y: 1}}}",
+			err: modbus.ErrUnknownRegister,
+		},
+		{
+			in:  "registers: {temperature: {address: 0}}",
+			err: nil,
+		},
+		{
+			in:  "registers: {}",
+			err: modbus.ErrNoRegisters,
+		},
+		{
+			in:  "registers: {units: {address: 0}}",
+			err: modbus.ErrReservedName,
+		},
+		{
+			in:  "registers: {x: {table: analog}}",
+			err: modbus.ErrUnknownTable,
+		},
+		{
+			in:  "registers: {x: {type: float64}}",
+			err: modbus.ErrUnknownType,
+		},
+		{
+			in:  "registers: {x: {table: coil, type: uint16}}",
+			err: modbus.ErrBitType,
+		},
+		{
+			in:  "registers: {x: {table: input}}\nops: {set: {set: {x: 1}}}",
+			err: modbus.ErrReadOnly,
+		},
+		{
+			in:  "registers: {x: {}}\nops: {noop: {}}",
+			err: modbus.ErrNoWrites,
+		},
+		{
+			in:  "interval: -1s\nregisters: {x: {}}",
+			err: modbus.ErrNegativeDuration,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if _, err := modbus.Parse([]byte(tt.in)); !errors.Is(err, tt.err) {
+				t.Errorf("modbus.Parse(in) = (_, %v), expected %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ktnyt/labcon/internal/deadline"
+)
+
+var (
+	ErrMalformedResponse = errors.New("malformed Modbus response")
+)
+
+// Function codes.
+const (
+	fnReadCoils          = 0x01
+	fnReadDiscreteInputs = 0x02
+	fnReadHolding        = 0x03
+	fnReadInput          = 0x04
+	fnWriteCoil          = 0x05
+	fnWriteRegisters     = 0x10
+)
+
+var exceptionNames = map[uint8]string{
+	0x01: "illegal function",
+	0x02: "illegal data address",
+	0x03: "illegal data value",
+	0x04: "server device failure",
+	0x05: "acknowledge",
+	0x06: "server device busy",
+	0x08: "memory parity error",
+	0x0a: "gateway path unavailable",
+	0x0b: "gateway target device failed to respond",
+}
+
+// ExceptionError is returned when the device answers with an exception.
+type ExceptionError struct {
+	Function uint8
+	Code     uint8
+}
+
+func (err *ExceptionError) Error() string {
+	name, ok := exceptionNames[err.Code]
+	if !ok {
+		name = "unknown exception"
+	}
+	return fmt.Sprintf("modbus function 0x%02x: %s (0x%02x)", err.Function, name, err.Code)
+}
+
+// client makes Modbus TCP requests one at a time.
+type client struct {
+	rw      io.ReadWriter
+	unitID  uint8
+	timeout time.Duration
+	tid     uint16
+
+	// unsent holds the rest of a request and frame the start of a response
+	// when a deadline or cancel cuts a call short mid-frame. The next call
+	// finishes both first so that the connection stays in step with the
+	// device.
+	unsent []byte
+	frame  []byte
+}
+
+// call sends a request with the given function code and data, and returns the
+// data of the response.
+func (c *client) call(ctx context.Context, fn uint8, data []byte) ([]byte, error) {
+	if d, ok := c.rw.(deadline.Conn); ok {
+		stop := deadline.Watch(ctx, d, c.timeout)
+		defer stop()
+	}
+
+	if len(c.unsent) > 0 {
+		n, err := c.rw.Write(c.unsent)
+		c.unsent = c.unsent[n:]
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.tid++
+	req := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint16(req[0:], c.tid)
+	binary.BigEndian.PutUint16(req[2:], 0)
+	binary.BigEndian.PutUint16(req[4:], uint16(2+len(data)))
+	req[6] = c.unitID
+	req[7] = fn
+	req = append(req, data...)
+	if n, err := c.rw.Write(req); err != nil {
+		if n > 0 {
+			c.unsent = req[n:]
+		}
+		return nil, err
+	}
+
+	// Responses to requests that timed out earlier are skipped.
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		header, pdu := frame[:7], frame[7:]
+		if binary.BigEndian.Uint16(header[0:]) != c.tid {
+			continue
+		}
+
+		switch pdu[0] {
+		case fn:
+			return pdu[1:], nil
+		case fn | 0x80:
+			if len(pdu) < 2 {
+				return nil, ErrMalformedResponse
+			}
+			return nil, &ExceptionError{Function: fn, Code: pdu[1]}
+		default:
+			return nil, ErrMalformedResponse
+		}
+	}
+}
+
+// readFrame reads the MBAP header and PDU of a response. A frame that is cut
+// short is kept and read to the end by the next call.
+func (c *client) readFrame() ([]byte, error) {
+	for {
+		size := 7
+		if len(c.frame) >= 7 {
+			n := binary.BigEndian.Uint16(c.frame[4:])
+			if n < 2 {
+				c.frame = nil
+				return nil, ErrMalformedResponse
+			}
+			size = 6 + int(n)
+			if len(c.frame) == size {
+				frame := c.frame
+				c.frame = nil
+				return frame, nil
+			}
+		}
+		buf := make([]byte, size-len(c.frame))
+		n, err := io.ReadFull(c.rw, buf)
+		c.frame = append(c.frame, buf[:n]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readBits reads coils or discrete inputs.
+func (c *client) readBits(ctx context.Context, fn uint8, address, count uint16) ([]bool, error) {
+	data, err := c.call(ctx, fn, addressCount(address, count))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1 || int(data[0]) != len(data)-1 || len(data)-1 < int(count+7)/8 {
+		return nil, ErrMalformedResponse
+	}
+	bits := make([]bool, count)
+	for i := range bits {
+		bits[i] = data[1+i/8]&(1<<(i%8)) != 0
+	}
+	return bits, nil
+}
+
+// readWords reads holding or input registers.
+func (c *client) readWords(ctx context.Context, fn uint8, address, count uint16) ([]uint16, error) {
+	data, err := c.call(ctx, fn, addressCount(address, count))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1 || int(data[0]) != len(data)-1 || len(data)-1 != 2*int(count) {
+		return nil, ErrMalformedResponse
+	}
+	words := make([]uint16, count)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[1+2*i:])
+	}
+	return words, nil
+}
+
+func (c *client) writeCoil(ctx context.Context, address uint16, value bool) error {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:], address)
+	if value {
+		data[2] = 0xff
+	}
+	_, err := c.call(ctx, fnWriteCoil, data)
+	return err
+}
+
+func (c *client) writeWords(ctx context.Context, address uint16, words []uint16) error {
+	data := make([]byte, 5+2*len(words))
+	binary.BigEndian.PutUint16(data[0:], address)
+	binary.BigEndian.PutUint16(data[2:], uint16(len(words)))
+	data[4] = uint8(2 * len(words))
+	for i, word := range words {
+		binary.BigEndian.PutUint16(data[5+2*i:], word)
+	}
+	_, err := c.call(ctx, fnWriteRegisters, data)
+	return err
+}
+
+func addressCount(address, count uint16) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:], address)
+	binary.BigEndian.PutUint16(data[2:], count)
+	return data
+}
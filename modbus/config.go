@@ -0,0 +1,231 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+var (
+	ErrNoRegisters      = errors.New("no registers configured")
+	ErrReservedName     = errors.New("register name is reserved")
+	ErrUnknownTable     = errors.New("unknown register table")
+	ErrUnknownType      = errors.New("unknown register type")
+	ErrBitType          = errors.New("coils and discrete inputs have no type")
+	ErrZeroScale        = errors.New("scale must not be zero")
+	ErrNoWrites         = errors.New("operation writes no registers")
+	ErrUnknownRegister  = errors.New("unknown register")
+	ErrReadOnly         = errors.New("register is read only")
+	ErrNegativeDuration = errors.New("duration must not be negative")
+)
+
+// Register tables.
+const (
+	Coil     = "coil"
+	Discrete = "discrete"
+	Input    = "input"
+	Holding  = "holding"
+)
+
+// Register types.
+const (
+	Uint16  = "uint16"
+	Int16   = "int16"
+	Uint32  = "uint32"
+	Int32   = "int32"
+	Float32 = "float32"
+)
+
+// UnitsField is the state field listing the units of registers.
+const UnitsField = "units"
+
+// Config describes the registers of a Modbus device and the operations
+// writing them.
+type Config struct {
+	// UnitID addresses the device behind a gateway. Devices reached directly
+	// usually ignore it.
+	UnitID uint8 `yaml:"unit_id"`
+
+	// Interval is how often registers are polled, which is every second if
+	// it is zero.
+	Interval time.Duration `yaml:"interval"`
+
+	// Timeout is how long to wait for a response, which is unlimited if it
+	// is zero. It only applies to connections with a SetDeadline method.
+	Timeout time.Duration `yaml:"timeout"`
+
+	Registers map[string]RegisterConfig `yaml:"registers"`
+	Ops       map[string]OpConfig       `yaml:"ops"`
+}
+
+// RegisterConfig describes a register, which is polled into the state field of
+// the same name. Coils and discrete inputs are booleans and other registers
+// are numbers converted from raw values as raw * scale + offset.
+type RegisterConfig struct {
+	// Table is "coil", "discrete", "input" or "holding", which is the
+	// default.
+	Table string `yaml:"table"`
+
+	// Address is the zero based address of the register.
+	Address uint16 `yaml:"address"`
+
+	// Type is "uint16", which is the default, "int16", or "uint32", "int32"
+	// or "float32" spanning two registers with the high word first.
+	Type string `yaml:"type"`
+
+	// Scale is 1 if omitted.
+	Scale  float64 `yaml:"scale"`
+	Offset float64 `yaml:"offset"`
+
+	// Unit, such as "degC", is listed in the "units" state field.
+	Unit string `yaml:"unit"`
+}
+
+// OpConfig describes an operation writing coils and holding registers.
+//
+// Values in Set may refer to the operation argument: "$arg" is replaced by
+// the whole argument and "$arg.key" by the value of key in the argument.
+type OpConfig struct {
+	// Set writes values to registers by name, in the order of the names.
+	Set map[string]interface{} `yaml:"set"`
+}
+
+// Load reads and validates the configuration at the given path.
+func Load(path string) (Config, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(p)
+}
+
+// Parse parses and validates a YAML configuration.
+func Parse(p []byte) (Config, error) {
+	var config Config
+	if err := yaml.UnmarshalWithOptions(p, &config, yaml.Strict()); err != nil {
+		return Config{}, err
+	}
+	config.fillDefaults()
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func (config *Config) fillDefaults() {
+	if config.Interval == 0 {
+		config.Interval = time.Second
+	}
+	for name, register := range config.Registers {
+		if register.Table == "" {
+			register.Table = Holding
+		}
+		if register.Type == "" && !register.bit() {
+			register.Type = Uint16
+		}
+		if register.Scale == 0 {
+			register.Scale = 1
+		}
+		config.Registers[name] = register
+	}
+}
+
+// Validate checks the configuration for errors.
+func (config Config) Validate() error {
+	if len(config.Registers) == 0 {
+		return ErrNoRegisters
+	}
+	if config.Interval < 0 {
+		return fmt.Errorf("interval: %w", ErrNegativeDuration)
+	}
+	if config.Timeout < 0 {
+		return fmt.Errorf("timeout: %w", ErrNegativeDuration)
+	}
+
+	for name, register := range config.Registers {
+		if err := register.Validate(); err != nil {
+			return fmt.Errorf("register %q: %w", name, err)
+		}
+		if name == UnitsField {
+			return fmt.Errorf("register %q: %w", name, ErrReservedName)
+		}
+	}
+
+	for name, op := range config.Ops {
+		if len(op.Set) == 0 {
+			return fmt.Errorf("op %q: %w", name, ErrNoWrites)
+		}
+		for field := range op.Set {
+			register, ok := config.Registers[field]
+			if !ok {
+				return fmt.Errorf("op %q: %w %q", name, ErrUnknownRegister, field)
+			}
+			if !register.writable() {
+				return fmt.Errorf("op %q: %w: %q", name, ErrReadOnly, field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the register configuration for errors.
+func (config RegisterConfig) Validate() error {
+	switch config.Table {
+	case Coil, Discrete:
+		if config.Type != "" {
+			return ErrBitType
+		}
+	case Input, Holding:
+		switch config.Type {
+		case Uint16, Int16, Uint32, Int32, Float32:
+		default:
+			return fmt.Errorf("%w %q", ErrUnknownType, config.Type)
+		}
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownTable, config.Table)
+	}
+
+	if config.Scale == 0 {
+		return ErrZeroScale
+	}
+	return nil
+}
+
+func (config RegisterConfig) bit() bool {
+	return config.Table == Coil || config.Table == Discrete
+}
+
+func (config RegisterConfig) writable() bool {
+	return config.Table == Coil || config.Table == Holding
+}
+
+// words is the number of 16-bit registers spanned by the register.
+func (config RegisterConfig) words() uint16 {
+	switch config.Type {
+	case Uint32, Int32, Float32:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// resolve replaces references to the operation argument in value.
+func resolve(value interface{}, arg interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "$arg") {
+		return value
+	}
+	if s == "$arg" {
+		return arg
+	}
+	key := strings.TrimPrefix(s, "$arg.")
+	if m, ok := arg.(map[string]interface{}); ok && key != s {
+		return m[key]
+	}
+	return value
+}
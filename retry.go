@@ -0,0 +1,118 @@
+package labcon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy describes how the Client retries failed requests. Requests are
+// retried on network errors and on 429, 502, 503 and 504 responses. Only
+// idempotent requests are retried unless RetryNonIdempotent is set, since a
+// failed POST request, e.g. Register or Dispatch, may have taken effect.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// A value of one or less disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the delay grows after each retry.
+	Multiplier float64
+
+	// Jitter is the fraction of the delay that is randomized, between 0 and
+	// 1, to keep clients from retrying in lockstep.
+	Jitter float64
+
+	// RetryNonIdempotent enables retries of non-idempotent requests.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy retries idempotent requests up to five times.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithRetry enables retries of failed requests with the given policy.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.retry = policy
+	}
+}
+
+// Backoff returns the delay before the given retry, counting from one.
+func (policy RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+
+	if policy.Jitter > 0 {
+		jitter := math.Min(policy.Jitter, 1)
+		backoff *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+
+	return time.Duration(backoff)
+}
+
+func (policy RetryPolicy) allows(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return policy.RetryNonIdempotent
+	}
+}
+
+// retryable reports whether a request that failed with err may succeed if it
+// is sent again, i.e. whether it failed in transport or with a transient error
+// status.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sleep waits for the given duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
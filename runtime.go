@@ -0,0 +1,184 @@
+package labcon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ktnyt/labcon/driver"
+)
+
+var (
+	ErrUnknownOp = errors.New("unknown operation")
+)
+
+// Arg is the argument of an operation.
+type Arg struct {
+	value interface{}
+}
+
+// Value returns the argument as decoded from JSON.
+func (arg Arg) Value() interface{} {
+	return arg.value
+}
+
+// Decode decodes the argument into v as if it was unmarshaled from JSON.
+func (arg Arg) Decode(v interface{}) error {
+	p, err := json.Marshal(arg.value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// StateUpdater sets the state of the driver running an operation.
+type StateUpdater func(state interface{}) error
+
+// Handler executes an operation. The context is canceled when the runtime is
+// shut down.
+type Handler func(ctx context.Context, arg Arg, update StateUpdater) error
+
+// PanicError is reported when a handler panics.
+type PanicError struct {
+	Value interface{}
+}
+
+func (err PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", err.Value)
+}
+
+// Runtime runs a driver by polling its operations and dispatching them to the
+// handlers registered by operation name.
+type Runtime struct {
+	driver   Driver
+	handlers map[string]Handler
+	interval time.Duration
+	timeout  time.Duration
+	onResult func(op driver.Op, err error)
+	onError  func(err error)
+}
+
+// RuntimeOption configures a Runtime.
+type RuntimeOption func(runtime *Runtime)
+
+// WithPollInterval sets how often the runtime polls for operations.
+func WithPollInterval(interval time.Duration) RuntimeOption {
+	return func(runtime *Runtime) {
+		runtime.interval = interval
+	}
+}
+
+// WithShutdownTimeout sets how long the runtime waits for the driver to
+// disconnect on shutdown.
+func WithShutdownTimeout(timeout time.Duration) RuntimeOption {
+	return func(runtime *Runtime) {
+		runtime.timeout = timeout
+	}
+}
+
+// WithResultHandler sets a function called with each completed operation and
+// the error of its handler, which is nil on success.
+func WithResultHandler(f func(op driver.Op, err error)) RuntimeOption {
+	return func(runtime *Runtime) {
+		runtime.onResult = f
+	}
+}
+
+// WithErrorHandler sets a function called with errors in communicating with
+// the server. The runtime keeps polling after such errors.
+func WithErrorHandler(f func(err error)) RuntimeOption {
+	return func(runtime *Runtime) {
+		runtime.onError = f
+	}
+}
+
+func NewRuntime(d Driver, opts ...RuntimeOption) *Runtime {
+	runtime := &Runtime{
+		driver:   d,
+		handlers: make(map[string]Handler),
+		interval: time.Second,
+		timeout:  10 * time.Second,
+		onResult: func(driver.Op, error) {},
+		onError:  func(error) {},
+	}
+	for _, opt := range opts {
+		opt(runtime)
+	}
+	return runtime
+}
+
+// Handle registers the handler for operations with the given name.
+func (runtime *Runtime) Handle(name string, handler Handler) {
+	runtime.handlers[name] = handler
+}
+
+// Run polls and executes operations until the context is done, and then
+// disconnects the driver. Once an operation completes the driver status is
+// set to Idle, or to Error if the handler failed or panicked. Operations
+// without a handler fail with ErrUnknownOp.
+func (runtime *Runtime) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return runtime.shutdown()
+		case <-timer.C:
+		}
+
+		op, err := runtime.driver.OperationCtx(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				runtime.onError(err)
+			}
+			timer.Reset(runtime.interval)
+		case op == nil:
+			timer.Reset(runtime.interval)
+		default:
+			runtime.execute(ctx, *op)
+			timer.Reset(0)
+		}
+	}
+}
+
+func (runtime *Runtime) execute(ctx context.Context, op driver.Op) {
+	err := runtime.call(ctx, op)
+
+	status := driver.Idle
+	if err != nil {
+		status = driver.Error
+	}
+	if err := runtime.driver.SetStatusCtx(ctx, status); err != nil && ctx.Err() == nil {
+		runtime.onError(err)
+	}
+
+	runtime.onResult(op, err)
+}
+
+func (runtime *Runtime) call(ctx context.Context, op driver.Op) (err error) {
+	handler, ok := runtime.handlers[op.Name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownOp, op.Name)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = PanicError{Value: v}
+		}
+	}()
+
+	update := func(state interface{}) error {
+		return runtime.driver.SetStateCtx(ctx, state)
+	}
+	return handler(ctx, Arg{value: op.Arg}, update)
+}
+
+func (runtime *Runtime) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), runtime.timeout)
+	defer cancel()
+	return runtime.driver.DisconnectCtx(ctx)
+}
@@ -0,0 +1,145 @@
+package labcon
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+type runtimeTestState struct {
+	Value int `json:"value"`
+}
+
+type runtimeTestResult struct {
+	op  driver.Op
+	err error
+}
+
+func TestRuntime(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	d, err := NewDriver(client, "foo", runtimeTestState{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan runtimeTestResult)
+	runtime := NewRuntime(
+		d,
+		WithPollInterval(time.Millisecond),
+		WithResultHandler(func(op driver.Op, err error) {
+			results <- runtimeTestResult{op, err}
+		}),
+	)
+
+	runtime.Handle("set", func(ctx context.Context, arg Arg, update StateUpdater) error {
+		var state runtimeTestState
+		if err := arg.Decode(&state); err != nil {
+			return err
+		}
+		return update(state)
+	})
+
+	runtime.Handle("panic", func(ctx context.Context, arg Arg, update StateUpdater) error {
+		panic("oops")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runtime.Run(ctx) }()
+
+	cases := []struct {
+		op     driver.Op
+		err    error
+		status driver.Status
+		state  runtimeTestState
+	}{
+		{
+			op:     driver.Op{Name: "set", Arg: map[string]int{"value": 42}},
+			err:    nil,
+			status: driver.Idle,
+			state:  runtimeTestState{Value: 42},
+		},
+		{
+			op:     driver.Op{Name: "panic"},
+			err:    PanicError{Value: "oops"},
+			status: driver.Error,
+			state:  runtimeTestState{Value: 42},
+		},
+		{
+			op:     driver.Op{Name: "unknown"},
+			err:    ErrUnknownOp,
+			status: driver.Error,
+			state:  runtimeTestState{Value: 42},
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if err := d.SetStatus(driver.Idle); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := client.Dispatch("foo", tt.op); err != nil {
+				t.Fatal(err)
+			}
+
+			var result runtimeTestResult
+			select {
+			case result = <-results:
+			case <-time.After(time.Second):
+				t.Fatalf("operation %q did not complete", tt.op.Name)
+			}
+
+			if !errors.Is(result.err, tt.err) {
+				t.Errorf("operation %q returned %v, want %v", tt.op.Name, result.err, tt.err)
+			}
+
+			status, err := client.GetStatus("foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != tt.status {
+				t.Errorf("client status = %q, want %q", status, tt.status)
+			}
+
+			var state runtimeTestState
+			if err := client.GetState("foo", &state); err != nil {
+				t.Fatal(err)
+			}
+
+			if ops := utils.ObjDiff(state, tt.state); ops != nil {
+				t.Error(utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runtime did not shut down")
+	}
+
+	names, err := client.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := utils.ObjDiff(names, []string{}); ops != nil {
+		t.Fatal(utils.JoinOps(ops, "\n"))
+	}
+}
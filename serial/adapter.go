@@ -0,0 +1,287 @@
+// Package serial adapts instruments speaking a line based ASCII protocol, such
+// as SCPI over RS-232 or USB-serial, to labcon drivers. Operations are mapped
+// to commands and responses are parsed into state fields as declared in a
+// Config, over any io.ReadWriter.
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ktnyt/labcon"
+	"github.com/ktnyt/labcon/internal/deadline"
+)
+
+var (
+	ErrUnknownOp         = errors.New("unknown operation")
+	ErrUnexpectedReply   = errors.New("response does not match")
+	ErrMalformedErrorMsg = errors.New("malformed error query response")
+)
+
+// InstrumentError is returned when the instrument reports an error in
+// response to the error query.
+type InstrumentError struct {
+	Code    int
+	Message string
+}
+
+func (err *InstrumentError) Error() string {
+	return fmt.Sprintf("instrument error %d: %s", err.Code, err.Message)
+}
+
+// Adapter executes the operations of a driver on an instrument.
+type Adapter struct {
+	config   Config
+	commands map[string]command
+
+	mu    sync.Mutex
+	rw    io.ReadWriter
+	r     *bufio.Reader
+	state map[string]interface{}
+}
+
+// NewAdapter creates an adapter talking to the instrument over rw.
+func NewAdapter(rw io.ReadWriter, config Config) (*Adapter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Terminator == "" {
+		config.Terminator = "\n"
+	}
+
+	commands := make(map[string]command, len(config.Ops))
+	for name, op := range config.Ops {
+		cmd, err := compile(op)
+		if err != nil {
+			return nil, fmt.Errorf("op %q: %w", name, err)
+		}
+		commands[name] = cmd
+	}
+
+	state := make(map[string]interface{}, len(config.State))
+	for key, value := range config.State {
+		state[key] = value
+	}
+
+	return &Adapter{
+		config:   config,
+		commands: commands,
+		rw:       rw,
+		r:        bufio.NewReader(rw),
+		state:    state,
+	}, nil
+}
+
+// State returns a copy of the state of the driver.
+func (adapter *Adapter) State() map[string]interface{} {
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+	return adapter.copyState()
+}
+
+func (adapter *Adapter) copyState() map[string]interface{} {
+	state := make(map[string]interface{}, len(adapter.state))
+	for key, value := range adapter.state {
+		state[key] = value
+	}
+	return state
+}
+
+// Register registers a handler for each configured operation.
+func (adapter *Adapter) Register(runtime *labcon.Runtime) {
+	for name := range adapter.config.Ops {
+		runtime.Handle(name, adapter.handler(name))
+	}
+}
+
+func (adapter *Adapter) handler(name string) labcon.Handler {
+	return func(ctx context.Context, arg labcon.Arg, update labcon.StateUpdater) error {
+		state, err := adapter.Exec(ctx, name, arg.Value())
+		if err != nil {
+			return err
+		}
+		return update(state)
+	}
+}
+
+// Exec sends the command of the named operation with the given argument,
+// parses the response into the state and returns the new state. Exchanges
+// with the instrument never overlap.
+func (adapter *Adapter) Exec(ctx context.Context, name string, arg interface{}) (map[string]interface{}, error) {
+	cmd, ok := adapter.commands[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownOp, name)
+	}
+
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+
+	fields, err := adapter.exchange(ctx, cmd, arg)
+	if err != nil {
+		return nil, fmt.Errorf("op %q: %w", name, err)
+	}
+
+	for field, value := range fields {
+		adapter.state[field] = value
+	}
+	return adapter.copyState(), nil
+}
+
+func (adapter *Adapter) exchange(ctx context.Context, cmd command, arg interface{}) (fields map[string]interface{}, err error) {
+	if d, ok := adapter.rw.(deadline.Conn); ok {
+		stop := deadline.Watch(ctx, d, adapter.config.Timeout)
+		defer stop()
+	}
+
+	// A partial response left by a failed exchange would be taken as the
+	// response to the next command.
+	defer func() {
+		if err != nil {
+			adapter.r.Reset(adapter.rw)
+		}
+	}()
+
+	if cmd.template != nil {
+		var buf bytes.Buffer
+		if err := cmd.template.Execute(&buf, arg); err != nil {
+			return nil, err
+		}
+		if err := adapter.send(buf.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.query {
+		line, err := adapter.receive()
+		if err != nil {
+			return nil, err
+		}
+		if fields, err = parse(cmd, line); err != nil {
+			return nil, err
+		}
+	}
+
+	if adapter.config.ErrorQuery != "" {
+		if err := adapter.checkError(); err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+func (adapter *Adapter) send(line string) error {
+	_, err := io.WriteString(adapter.rw, line+adapter.config.Terminator)
+	return err
+}
+
+// receive reads a response up to the terminator, which is removed along with
+// surrounding whitespace.
+func (adapter *Adapter) receive() (string, error) {
+	term := adapter.config.Terminator
+	var line []byte
+	for !bytes.HasSuffix(line, []byte(term)) {
+		p, err := adapter.r.ReadBytes(term[len(term)-1])
+		line = append(line, p...)
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line[:len(line)-len(term)])), nil
+}
+
+// checkError sends the error query and fails if the instrument answers with
+// an error code other than 0, as in `-113,"Undefined header"`.
+func (adapter *Adapter) checkError() error {
+	if err := adapter.send(adapter.config.ErrorQuery); err != nil {
+		return err
+	}
+	line, err := adapter.receive()
+	if err != nil {
+		return err
+	}
+
+	values := splitSCPI(line)
+	code, err := strconv.Atoi(strings.TrimSpace(values[0]))
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrMalformedErrorMsg, line)
+	}
+	if code == 0 {
+		return nil
+	}
+
+	var msg string
+	if len(values) > 1 {
+		msg = fmt.Sprint(parseValue(strings.Join(values[1:], ",")))
+	}
+	return &InstrumentError{Code: code, Message: msg}
+}
+
+func parse(cmd command, line string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	switch {
+	case cmd.regexp != nil:
+		match := cmd.regexp.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("%w %q: %q", ErrUnexpectedReply, cmd.regexp, line)
+		}
+		for i, name := range cmd.regexp.SubexpNames() {
+			if name != "" {
+				fields[name] = parseValue(match[i])
+			}
+		}
+
+	case len(cmd.scpi) > 0:
+		values := splitSCPI(line)
+		if len(values) < len(cmd.scpi) {
+			return nil, fmt.Errorf("%w %d SCPI values: %q", ErrUnexpectedReply, len(cmd.scpi), line)
+		}
+		for i, name := range cmd.scpi {
+			if name != "" {
+				fields[name] = parseValue(values[i])
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// splitSCPI splits a response at the commas outside of quoted strings.
+func splitSCPI(line string) []string {
+	var values []string
+	quoted := false
+	start := 0
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			values = append(values, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, line[start:])
+}
+
+// parseValue converts a response value into a string without its quotes, a
+// number or, failing that, the value as is.
+func parseValue(s string) interface{} {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	// Infinities and NaN cannot be encoded in JSON states.
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return s
+}
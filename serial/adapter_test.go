@@ -0,0 +1,257 @@
+package serial_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/cmd/labcon/lib"
+	"github.com/ktnyt/labcon/serial"
+	"github.com/ktnyt/labcon/utils"
+)
+
+const testConfig = `
+terminator: "\r\n"
+timeout: 1s
+error_query: "SYST:ERR?"
+state:
+  voltage: 0
+ops:
+  identify:
+    command: "*IDN?"
+    scpi: [vendor, model, "", firmware]
+  set_voltage:
+    command: "VOLT {{.volts}}"
+  measure:
+    command: "MEAS:VOLT?"
+    regexp: '^(?P<voltage>\S+) V$'
+  hang:
+    command: "HANG?"
+    query: true
+`
+
+// newTestInstrument returns the end of an in-memory connection to a fake
+// power supply, which answers commands terminated by "\r\n" until the test
+// ends.
+func newTestInstrument(t *testing.T) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	go func() {
+		voltage := "0.000"
+		errs := []string{}
+
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			var reply string
+			switch {
+			case line == "*IDN?":
+				reply = `"ACME, Inc.",PSU-1,SN42,1.2.3`
+			case strings.HasPrefix(line, "VOLT "):
+				arg := strings.TrimPrefix(line, "VOLT ")
+				if strings.HasPrefix(arg, "-") {
+					errs = append(errs, `-222,"Data out of range"`)
+				} else {
+					voltage = arg
+				}
+				continue
+			case line == "MEAS:VOLT?":
+				reply = voltage + " V"
+			case line == "SYST:ERR?":
+				reply = `+0,"No error"`
+				if len(errs) > 0 {
+					reply, errs = errs[0], errs[1:]
+				}
+			case line == "HANG?":
+				continue
+			default:
+				errs = append(errs, `-113,"Undefined header"`)
+				continue
+			}
+			if _, err := server.Write([]byte(reply + "\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	return client
+}
+
+func TestAdapter(t *testing.T) {
+	config, err := serial.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adapter, err := serial.NewAdapter(newTestInstrument(t), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		op    string
+		arg   interface{}
+		state map[string]interface{}
+		err   error
+	}{
+		{
+			op:  "identify",
+			arg: nil,
+			state: map[string]interface{}{
+				"voltage":  0,
+				"vendor":   "ACME, Inc.",
+				"model":    "PSU-1",
+				"firmware": "1.2.3",
+			},
+		},
+		{
+			op:  "set_voltage",
+			arg: map[string]interface{}{"volts": 5.5},
+			state: map[string]interface{}{
+				"voltage":  0,
+				"vendor":   "ACME, Inc.",
+				"model":    "PSU-1",
+				"firmware": "1.2.3",
+			},
+		},
+		{
+			op:  "measure",
+			arg: nil,
+			state: map[string]interface{}{
+				"voltage":  5.5,
+				"vendor":   "ACME, Inc.",
+				"model":    "PSU-1",
+				"firmware": "1.2.3",
+			},
+		},
+		{
+			op:  "set_voltage",
+			arg: map[string]interface{}{"volts": -1.0},
+			err: &serial.InstrumentError{Code: -222, Message: "Data out of range"},
+		},
+		{
+			op:  "set_voltage",
+			arg: map[string]interface{}{},
+		},
+		{
+			op:  "reset",
+			err: serial.ErrUnknownOp,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			state, err := adapter.Exec(context.Background(), tt.op, tt.arg)
+			if tt.state == nil {
+				if err == nil {
+					t.Fatalf("adapter.Exec(ctx, %q, %v) = (%v, nil), expected an error", tt.op, tt.arg, state)
+				}
+				var instrumentErr *serial.InstrumentError
+				switch {
+				case errors.As(tt.err, &instrumentErr):
+					var got *serial.InstrumentError
+					if !errors.As(err, &got) || *got != *instrumentErr {
+						t.Errorf("adapter.Exec(ctx, %q, %v) = (_, %v), expected %v", tt.op, tt.arg, err, tt.err)
+					}
+				case tt.err != nil && !errors.Is(err, tt.err):
+					t.Errorf("adapter.Exec(ctx, %q, %v) = (_, %v), expected %v", tt.op, tt.arg, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("adapter.Exec(ctx, %q, %v) = (_, %v)", tt.op, tt.arg, err)
+			}
+			if ops := utils.ObjDiff(state, tt.state); ops != nil {
+				t.Error(utils.JoinOps(ops, "\n"))
+			}
+		})
+	}
+
+	if ops := utils.ObjDiff(adapter.State()["voltage"], 5.5); ops != nil {
+		t.Error(utils.JoinOps(ops, "\n"))
+	}
+}
+
+func TestAdapterTimeout(t *testing.T) {
+	config, err := serial.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Timeout = 50 * time.Millisecond
+
+	adapter, err := serial.NewAdapter(newTestInstrument(t), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := adapter.Exec(context.Background(), "hang", nil); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("adapter.Exec(ctx, %q, nil) = (_, %v), expected %v", "hang", err, os.ErrDeadlineExceeded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	config.Timeout = 0
+	adapter, err = serial.NewAdapter(newTestInstrument(t), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.Exec(ctx, "hang", nil); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("adapter.Exec(ctx, %q, nil) = (_, %v) after cancel, expected %v", "hang", err, os.ErrDeadlineExceeded)
+	}
+
+	// The adapter keeps working after a timeout.
+	if _, err := adapter.Exec(context.Background(), "identify", nil); err != nil {
+		t.Errorf("adapter.Exec(ctx, %q, nil) = (_, %v) after a timeout", "identify", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in  string
+		err error
+	}{
+		{
+			in:  testConfig,
+			err: nil,
+		},
+		{
+			in:  "ops: {}",
+			err: serial.ErrNoOps,
+		},
+		{
+			in:  "timeout: -1s\nops: {reset: {command: '*RST'}}",
+			err: serial.ErrNegativeDuration,
+		},
+		{
+			in:  "ops: {noop: {}}",
+			err: serial.ErrEmptyOp,
+		},
+		{
+			in:  "ops: {read: {command: 'READ?', regexp: '(?P<x>.*)', scpi: [x]}}",
+			err: serial.ErrRegexpAndSCPI,
+		},
+		{
+			in:  "ops: {read: {command: 'READ?', regexp: '(.*)'}}",
+			err: serial.ErrNoNamedGroups,
+		},
+	}
+
+	for i, tt := range cases {
+		lib.RunCase(t, i, func(t *testing.T) {
+			if _, err := serial.Parse([]byte(tt.in)); !errors.Is(err, tt.err) {
+				t.Errorf("serial.Parse(in) = (_, %v), expected %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+var (
+	ErrNoOps            = errors.New("no operations configured")
+	ErrEmptyOp          = errors.New("operation neither sends a command nor reads a response")
+	ErrRegexpAndSCPI    = errors.New("response cannot be parsed with both a regexp and SCPI fields")
+	ErrNoNamedGroups    = errors.New("regexp has no named groups")
+	ErrNegativeDuration = errors.New("duration must not be negative")
+)
+
+// Config describes how the operations of a driver map to the commands of an
+// instrument speaking a line based ASCII protocol such as SCPI.
+type Config struct {
+	// Terminator ends every command and response. It is "\n" if empty.
+	Terminator string `yaml:"terminator"`
+
+	// Timeout is how long to wait for a response, which is unlimited if it
+	// is zero. It only applies to connections with a SetDeadline method, such
+	// as serial ports opened as files and network connections.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// ErrorQuery is sent after every command if set, e.g. "SYST:ERR?", and
+	// the operation fails unless the instrument answers with error code 0.
+	ErrorQuery string `yaml:"error_query"`
+
+	// State is the initial state of the driver.
+	State map[string]interface{} `yaml:"state"`
+
+	Ops map[string]OpConfig `yaml:"ops"`
+}
+
+// OpConfig describes an operation.
+//
+// Command is a text/template executed with the operation argument, so that
+// "VOLT {{.volts}}" sends "VOLT 5" for the argument {"volts": 5} and
+// "VOLT {{.}}" sends "VOLT 5" for the argument 5.
+//
+// Values parsed from the response are assigned to state fields. Quoted values
+// become strings without the quotes, numeric values become numbers and other
+// values are kept as strings.
+type OpConfig struct {
+	Command string `yaml:"command"`
+
+	// Query reads a response after the command. It is implied by Regexp and
+	// SCPI, so it only needs to be set to wait for an acknowledgement.
+	Query bool `yaml:"query"`
+
+	// Regexp parses the response, assigning each named group to the state
+	// field of the same name.
+	Regexp string `yaml:"regexp"`
+
+	// SCPI parses the response as comma separated values and assigns them to
+	// the state fields named in order. Values with an empty name are skipped.
+	SCPI []string `yaml:"scpi"`
+}
+
+var unescaper = strings.NewReplacer(`\r`, "\r", `\n`, "\n", `\t`, "\t", `\\`, `\`)
+
+// Load reads and validates the configuration at the given path.
+func Load(path string) (Config, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(p)
+}
+
+// Parse parses and validates a YAML configuration.
+func Parse(p []byte) (Config, error) {
+	var config Config
+	if err := yaml.UnmarshalWithOptions(p, &config, yaml.Strict()); err != nil {
+		return Config{}, err
+	}
+
+	// The YAML decoder leaves escapes such as \r undecoded in double quoted
+	// strings.
+	config.Terminator = unescaper.Replace(config.Terminator)
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Validate checks the configuration for errors.
+func (config Config) Validate() error {
+	if len(config.Ops) == 0 {
+		return ErrNoOps
+	}
+	if config.Timeout < 0 {
+		return fmt.Errorf("timeout: %w", ErrNegativeDuration)
+	}
+
+	for name, op := range config.Ops {
+		if _, err := compile(op); err != nil {
+			return fmt.Errorf("op %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// command is a compiled OpConfig.
+type command struct {
+	template *template.Template
+	query    bool
+	regexp   *regexp.Regexp
+	scpi     []string
+}
+
+func compile(op OpConfig) (command, error) {
+	if op.Regexp != "" && len(op.SCPI) > 0 {
+		return command{}, ErrRegexpAndSCPI
+	}
+
+	cmd := command{
+		query: op.Query || op.Regexp != "" || len(op.SCPI) > 0,
+		scpi:  op.SCPI,
+	}
+	if op.Command == "" && !cmd.query {
+		return command{}, ErrEmptyOp
+	}
+
+	if op.Command != "" {
+		t, err := template.New("command").Option("missingkey=error").Parse(op.Command)
+		if err != nil {
+			return command{}, err
+		}
+		cmd.template = t
+	}
+
+	if op.Regexp != "" {
+		re, err := regexp.Compile(op.Regexp)
+		if err != nil {
+			return command{}, err
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			named = named || name != ""
+		}
+		if !named {
+			return command{}, ErrNoNamedGroups
+		}
+		cmd.regexp = re
+	}
+
+	return cmd, nil
+}
@@ -0,0 +1,88 @@
+package labcon
+
+import (
+	"context"
+
+	"github.com/ktnyt/labcon/driver"
+)
+
+// TypedDriver is a Driver whose state is of type S.
+type TypedDriver[S any] struct {
+	Driver
+}
+
+func NewTypedDriver[S any](client *Client, name string, state S, opts ...DriverOption) (TypedDriver[S], error) {
+	return NewTypedDriverCtx(context.Background(), client, name, state, opts...)
+}
+
+func NewTypedDriverCtx[S any](ctx context.Context, client *Client, name string, state S, opts ...DriverOption) (TypedDriver[S], error) {
+	d, err := NewDriverCtx(ctx, client, name, state, opts...)
+	return TypedDriver[S]{Driver: d}, err
+}
+
+func (d TypedDriver[S]) GetState() (S, error) {
+	return d.GetStateCtx(context.Background())
+}
+
+func (d TypedDriver[S]) GetStateCtx(ctx context.Context) (S, error) {
+	var state S
+	err := d.Driver.GetStateCtx(ctx, &state)
+	return state, err
+}
+
+func (d TypedDriver[S]) SetState(state S) error {
+	return d.SetStateCtx(context.Background(), state)
+}
+
+func (d TypedDriver[S]) SetStateCtx(ctx context.Context, state S) error {
+	return d.Driver.SetStateCtx(ctx, state)
+}
+
+// TypedClient is a Client for drivers whose state is of type S.
+type TypedClient[S any] struct {
+	*Client
+}
+
+func NewTypedClient[S any](client *Client) TypedClient[S] {
+	return TypedClient[S]{Client: client}
+}
+
+func (client TypedClient[S]) GetState(name string) (S, error) {
+	return client.GetStateCtx(context.Background(), name)
+}
+
+func (client TypedClient[S]) GetStateCtx(ctx context.Context, name string) (S, error) {
+	var state S
+	err := client.Client.GetStateCtx(ctx, name, &state)
+	return state, err
+}
+
+func (client TypedClient[S]) SetState(name, token string, state S) error {
+	return client.SetStateCtx(context.Background(), name, token, state)
+}
+
+func (client TypedClient[S]) SetStateCtx(ctx context.Context, name, token string, state S) error {
+	return client.Client.SetStateCtx(ctx, name, token, state)
+}
+
+// DecodeArg decodes the argument of an operation into a value of type A.
+func DecodeArg[A any](op driver.Op) (A, error) {
+	var arg A
+	err := Arg{value: op.Arg}.Decode(&arg)
+	return arg, err
+}
+
+// Handle registers a handler for operations with the given name that takes
+// its argument as a value of type A and sets the driver state with values of
+// type S. Operations whose argument cannot be decoded fail.
+func Handle[A, S any](runtime *Runtime, name string, handler func(ctx context.Context, arg A, update func(state S) error) error) {
+	runtime.Handle(name, func(ctx context.Context, arg Arg, update StateUpdater) error {
+		var a A
+		if err := arg.Decode(&a); err != nil {
+			return err
+		}
+		return handler(ctx, a, func(state S) error {
+			return update(state)
+		})
+	})
+}
@@ -0,0 +1,123 @@
+package labcon
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ktnyt/labcon/driver"
+	"github.com/ktnyt/labcon/utils"
+)
+
+type typedTestState struct {
+	Temperature float64 `json:"temperature"`
+	Door        string  `json:"door"`
+}
+
+type typedTestArg struct {
+	Temperature float64 `json:"temperature"`
+}
+
+func TestTypedDriver(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	d, err := NewTypedDriver(client, "foo", typedTestState{Temperature: 25, Door: "closed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := d.GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := utils.ObjDiff(state, typedTestState{Temperature: 25, Door: "closed"}); ops != nil {
+		t.Fatal(utils.JoinOps(ops, "\n"))
+	}
+
+	if err := d.SetState(typedTestState{Temperature: 37, Door: "open"}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = NewTypedClient[typedTestState](client).GetState("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := utils.ObjDiff(state, typedTestState{Temperature: 37, Door: "open"}); ops != nil {
+		t.Fatal(utils.JoinOps(ops, "\n"))
+	}
+
+	if err := d.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeArg(t *testing.T) {
+	arg, err := DecodeArg[typedTestArg](driver.Op{
+		Name: "heat",
+		Arg:  map[string]interface{}{"temperature": 37.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if arg.Temperature != 37 {
+		t.Fatalf("arg.Temperature = %v, want 37", arg.Temperature)
+	}
+
+	if _, err := DecodeArg[typedTestArg](driver.Op{Name: "heat", Arg: "hot"}); err == nil {
+		t.Fatal("DecodeArg succeeded with a string argument")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	d, err := NewTypedDriver(client, "foo", typedTestState{Temperature: 25, Door: "closed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan error)
+	runtime := NewRuntime(
+		d.Driver,
+		WithPollInterval(time.Millisecond),
+		WithResultHandler(func(op driver.Op, err error) { results <- err }),
+	)
+
+	Handle(runtime, "heat", func(ctx context.Context, arg typedTestArg, update func(typedTestState) error) error {
+		return update(typedTestState{Temperature: arg.Temperature, Door: "closed"})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runtime.Run(ctx) }()
+
+	if err := client.Dispatch("foo", driver.Op{Name: "heat", Arg: typedTestArg{Temperature: 37}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := d.GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := utils.ObjDiff(state, typedTestState{Temperature: 37, Door: "closed"}); ops != nil {
+		t.Fatal(utils.JoinOps(ops, "\n"))
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}